@@ -0,0 +1,75 @@
+// Package admin serves operator-facing endpoints. None of them authenticate
+// callers themselves: mount them on a listener or behind middleware that only
+// operators can reach.
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/audit"
+	"github.com/ehubscher/goidp/internal/authn"
+	"github.com/ehubscher/goidp/internal/clientip"
+	"github.com/ehubscher/goidp/internal/errs"
+	"github.com/ehubscher/goidp/internal/render"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+type API struct {
+	Users   store.UserStore
+	Clients store.ClientStore
+	// Audit receives the events of operator actions. Nil means
+	// audit.SlogSink.
+	Audit audit.Sink
+	// TrustedProxies are the proxies whose X-Forwarded-For is believed
+	// when recording where an operator action came from.
+	TrustedProxies clientip.Proxies
+	// Now returns the current time. Nil means time.Now.
+	Now func() time.Time
+}
+
+func (a *API) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/reports/password-hashes", a.PasswordHashReport)
+	mux.HandleFunc("GET /admin/users/export", a.ExportUsers)
+	mux.HandleFunc("GET /admin/clients", a.ListClients)
+	mux.HandleFunc("POST /admin/clients/{id}/rotate-secret", a.RotateClientSecret)
+}
+
+func (a *API) now() time.Time {
+	if a.Now != nil {
+		return a.Now()
+	}
+
+	return time.Now()
+}
+
+func (a *API) audit() audit.Sink {
+	if a.Audit != nil {
+		return a.Audit
+	}
+
+	return audit.SlogSink{}
+}
+
+// PasswordHashReport summarizes how stored password hashes are distributed
+// over algorithms and parameters, to follow a migration after the hashing
+// parameters change. Users are streamed from the store, so only the tallies
+// are held in memory.
+func (a *API) PasswordHashReport(w http.ResponseWriter, r *http.Request) {
+	var report authn.HashReport
+	err := a.Users.EachPasswordHash(r.Context(), func(_ int64, passwordHash string) error {
+		report.Add(passwordHash)
+		return nil
+	})
+	if err != nil {
+		errs.WriteError(w, r, errs.Internal(err))
+		return
+	}
+	report.Finish()
+
+	if report.Levels == nil {
+		report.Levels = []authn.HashLevel{}
+	}
+
+	render.WriteDocument(w, r, http.StatusOK, report)
+}
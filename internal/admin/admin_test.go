@@ -0,0 +1,55 @@
+package admin_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/admin"
+	"github.com/ehubscher/goidp/internal/authn"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+func TestPasswordHashReport(t *testing.T) {
+	t.Setenv("BCRYPT_COST", "4")
+	users := store.NewMemoryUserStore()
+	ctx := context.Background()
+
+	for i, email := range []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com"} {
+		hash := "legacy"
+		if i > 0 {
+			var err error
+			hash, err = authn.GenerateHash(context.Background(), "bcrypt", "password123")
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err := users.CreateUser(ctx, email, hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	(&admin.API{Users: users}).RegisterHandlers(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/admin/reports/password-hashes", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d, want: %d", rec.Code, http.StatusOK)
+	}
+
+	var report authn.HashReport
+	err := json.NewDecoder(rec.Body).Decode(&report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != 4 || report.Unrecognized != 1 || len(report.Levels) != 1 {
+		t.Fatalf("got: %+v, want: 4 hashes, 1 unrecognized, 1 level", report)
+	}
+	if l := report.Levels[0]; l.Algorithm != "bcrypt" || l.Params != "c=4" || l.Count != 3 || l.Percent != 75 {
+		t.Errorf("got: %+v, want: 3 bcrypt c=4 at 75%%", l)
+	}
+}
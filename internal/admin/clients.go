@@ -0,0 +1,84 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ehubscher/goidp/internal/errs"
+	"github.com/ehubscher/goidp/internal/render"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const (
+	defaultClientPageSize = store.DefaultClientListLimit
+	maxClientPageSize     = 200
+)
+
+// listedClient is the metadata of a client that is safe to show operators.
+// Secrets and keys are deliberately absent, not merely omitted when empty.
+type listedClient struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Type         string   `json:"type"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types"`
+}
+
+type clientPage struct {
+	Clients    []listedClient `json:"clients"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// ListClients serves a page of registered clients. The name and type query
+// parameters filter the listing, limit sets the page size, and cursor is the
+// next_cursor of the previous page.
+func (a *API) ListClients(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := store.ClientFilter{Name: query.Get("name"), Type: query.Get("type")}
+	switch filter.Type {
+	case "", store.ClientConfidential, store.ClientPublic:
+	default:
+		errs.WriteError(w, r, errs.Invalid("type must be confidential or public"))
+		return
+	}
+
+	limit := defaultClientPageSize
+	if raw := query.Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxClientPageSize {
+			errs.WriteError(w, r, errs.Invalid("limit must be between 1 and "+strconv.Itoa(maxClientPageSize)))
+			return
+		}
+	}
+
+	clients, next, err := a.Clients.ListClients(r.Context(), filter, limit, query.Get("cursor"))
+	if err != nil {
+		errs.WriteError(w, r, errs.Internal(err))
+		return
+	}
+
+	page := clientPage{Clients: []listedClient{}, NextCursor: next}
+	for _, client := range clients {
+		grantTypes := client.GrantTypes
+		if len(grantTypes) == 0 {
+			grantTypes = store.DefaultGrantTypes
+		}
+		redirectURIs := client.RedirectURIs
+		if redirectURIs == nil {
+			redirectURIs = []string{}
+		}
+
+		page.Clients = append(page.Clients, listedClient{
+			ID:           client.ID,
+			Name:         client.Name,
+			Type:         client.Type(),
+			RedirectURIs: redirectURIs,
+			GrantTypes:   grantTypes,
+		})
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	render.WriteDocument(w, r, http.StatusOK, page)
+}
@@ -0,0 +1,158 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/admin"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+type clientPage struct {
+	Clients []struct {
+		ID         string   `json:"id"`
+		Name       string   `json:"name"`
+		Type       string   `json:"type"`
+		GrantTypes []string `json:"grant_types"`
+	} `json:"clients"`
+	NextCursor string `json:"next_cursor"`
+}
+
+func newClientsMux() *http.ServeMux {
+	clients := store.NewMemoryClientStore(
+		store.Client{ID: "billing", Name: "Billing Portal", SecretHash: "$2a$04$secret-hash"},
+		store.Client{ID: "cli", Name: "Command Line", RedirectURIs: []string{"http://127.0.0.1/callback"}},
+		store.Client{ID: "mobile", Name: "Mobile App", RedirectURIs: []string{"com.example.app:/callback"}},
+		store.Client{ID: "portal", Name: "Partner Portal", JWKSURI: "https://partner.example/jwks", GrantTypes: []string{"authorization_code"}},
+	)
+
+	mux := http.NewServeMux()
+	(&admin.API{Clients: clients}).RegisterHandlers(mux)
+	return mux
+}
+
+func listClients(t *testing.T, mux *http.ServeMux, query url.Values) (*httptest.ResponseRecorder, clientPage) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/clients?"+query.Encode(), nil))
+
+	var page clientPage
+	if rec.Code == http.StatusOK {
+		err := json.Unmarshal(rec.Body.Bytes(), &page)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return rec, page
+}
+
+func clientIDs(page clientPage) (ids []string) {
+	for _, c := range page.Clients {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
+
+func TestListClientsPaginates(t *testing.T) {
+	mux := newClientsMux()
+
+	var ids []string
+	query := url.Values{"limit": {"3"}}
+	for pages := 0; ; pages++ {
+		if pages == 2 {
+			t.Fatal("got: a third page, want: two")
+		}
+		_, page := listClients(t, mux, query)
+		ids = append(ids, clientIDs(page)...)
+		if page.NextCursor == "" {
+			break
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+
+	if got, want := strings.Join(ids, ","), "billing,cli,mobile,portal"; got != want {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+}
+
+func TestListClientsFilters(t *testing.T) {
+	var filters = []struct {
+		query url.Values
+		ids   string
+	}{
+		{url.Values{"type": {"public"}}, "cli,mobile"},
+		{url.Values{"type": {"confidential"}}, "billing,portal"},
+		{url.Values{"name": {"portal"}}, "billing,portal"},
+		{url.Values{"name": {"portal"}, "type": {"public"}}, ""},
+	}
+
+	mux := newClientsMux()
+	for _, f := range filters {
+		rec, page := listClients(t, mux, f.query)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusOK)
+		}
+		if got := strings.Join(clientIDs(page), ","); got != f.ids {
+			t.Errorf("%v: got: %q, want: %q", f.query, got, f.ids)
+		}
+	}
+}
+
+func TestListClientsRejectsBadQuery(t *testing.T) {
+	mux := newClientsMux()
+	for _, query := range []url.Values{{"type": {"native"}}, {"limit": {"0"}}, {"limit": {"1000"}}} {
+		rec, _ := listClients(t, mux, query)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%v: got: %d, want: %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestListClientsOmitsSecrets(t *testing.T) {
+	rec, page := listClients(t, newClientsMux(), url.Values{"name": {"billing"}})
+	if strings.Contains(rec.Body.String(), "secret") {
+		t.Errorf("got: %s, want: no secret hash", rec.Body)
+	}
+	if len(page.Clients) != 1 || strings.Join(page.Clients[0].GrantTypes, " ") != "authorization_code refresh_token" {
+		t.Errorf("got: %+v, want: billing with the default grant types", page.Clients)
+	}
+}
+
+func TestListClientsNegotiatesFormat(t *testing.T) {
+	clients := store.NewMemoryClientStore(store.Client{ID: "evil", Name: "<script>alert(1)</script>"})
+	mux := http.NewServeMux()
+	(&admin.API{Clients: clients}).RegisterHandlers(mux)
+
+	get := func(accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/admin/clients", nil)
+		r.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		return rec
+	}
+
+	rec := get("application/json")
+	var page clientPage
+	err := json.Unmarshal(rec.Body.Bytes(), &page)
+	if err != nil || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("got: %s %s, want: JSON", rec.Header().Get("Content-Type"), rec.Body)
+	}
+	if len(page.Clients) != 1 || page.Clients[0].Name != "<script>alert(1)</script>" {
+		t.Errorf("got: %+v, want: the client", page)
+	}
+
+	rec = get("text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	if got := rec.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("got: %s, want: text/html", got)
+	}
+	body := rec.Body.String()
+	if strings.Contains(body, "<script>") || !strings.Contains(body, "&lt;script&gt;alert(1)&lt;/script&gt;") {
+		t.Errorf("got: %s, want: the client name escaped", body)
+	}
+}
@@ -0,0 +1,89 @@
+package admin_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/admin"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+func newExportUsers(t *testing.T, n int) *store.MemoryUserStore {
+	t.Helper()
+
+	users := store.NewMemoryUserStore()
+	for i := range n {
+		_, err := users.CreateUser(context.Background(), fmt.Sprintf("user%d@example.com", i), "secret-hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return users
+}
+
+func TestExportUsers(t *testing.T) {
+	mux := http.NewServeMux()
+	(&admin.API{Users: newExportUsers(t, 250)}).RegisterHandlers(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/admin/users/export", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d, want: %d", rec.Code, http.StatusOK)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("Content-Type got: %q, want: application/x-ndjson", got)
+	}
+	if strings.Contains(rec.Body.String(), "secret-hash") {
+		t.Errorf("got: password hashes in the export, want: none")
+	}
+
+	var lines int
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var user map[string]any
+		err := json.Unmarshal(scanner.Bytes(), &user)
+		if err != nil {
+			t.Fatalf("line %d got: %v, want: a JSON object", lines+1, err)
+		}
+		if user["email"] != fmt.Sprintf("user%d@example.com", lines) {
+			t.Errorf("line %d got: %v, want: user%d", lines+1, user, lines)
+		}
+		lines++
+	}
+	if lines != 250 {
+		t.Errorf("got: %d lines, want: 250", lines)
+	}
+}
+
+// cancellingWriter cancels the request once the first user is written, as
+// if the client had disconnected.
+type cancellingWriter struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (w cancellingWriter) Write(b []byte) (int, error) {
+	defer w.cancel()
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestExportUsersCancelled(t *testing.T) {
+	mux := http.NewServeMux()
+	(&admin.API{Users: newExportUsers(t, 10)}).RegisterHandlers(mux)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(cancellingWriter{rec, cancel}, httptest.NewRequest("GET", "/admin/users/export", nil).WithContext(ctx))
+
+	if lines := strings.Count(rec.Body.String(), "\n"); lines != 1 {
+		t.Errorf("got: %d lines, want: 1 before the cancellation", lines)
+	}
+}
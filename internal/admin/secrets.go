@@ -0,0 +1,110 @@
+package admin
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/audit"
+	"github.com/ehubscher/goidp/internal/authn"
+	"github.com/ehubscher/goidp/internal/errs"
+	"github.com/ehubscher/goidp/internal/render"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const (
+	clientSecretBytes = 32
+	// maxSecretGrace bounds how long a rotated-out secret stays valid, so a
+	// leaked secret can't be kept alive indefinitely by mistake.
+	maxSecretGrace = 7 * 24 * time.Hour
+)
+
+type rotatedSecret struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// PreviousSecretExpiresAt is when the old secret stops working, absent
+	// when it stopped straight away.
+	PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at,omitempty"`
+}
+
+// RotateClientSecret replaces the secret of a client with a new random one
+// and returns it. Only its argon2id hash is kept, so this response is the
+// one chance to read it. The grace parameter, a duration such as "24h",
+// lets the old secret keep authenticating for that long; without it the old
+// secret stops working at once. Clients using client_secret_jwt get their
+// HMAC key replaced too, and that one has no grace period, so a grace is
+// refused for a client with no other secret.
+func (a *API) RotateClientSecret(w http.ResponseWriter, r *http.Request) {
+	var grace time.Duration
+	if raw := r.FormValue("grace"); raw != "" {
+		var err error
+		grace, err = time.ParseDuration(raw)
+		if err != nil || grace < 0 || grace > maxSecretGrace {
+			errs.WriteError(w, r, errs.Invalid("grace must be a duration of at most "+maxSecretGrace.String()))
+			return
+		}
+	}
+
+	client, err := a.Clients.GetClient(r.Context(), r.PathValue("id"))
+	if errors.Is(err, store.ErrNotFound) {
+		errs.WriteError(w, r, errs.NotFound("No such client."))
+		return
+	}
+	if err != nil {
+		errs.WriteError(w, r, errs.Internal(err))
+		return
+	}
+	if client.SecretHash == "" && client.Secret == "" {
+		errs.WriteError(w, r, errs.Invalid("The client has no secret to rotate."))
+		return
+	}
+	if client.SecretHash == "" && grace > 0 {
+		errs.WriteError(w, r, errs.Invalid("The client uses client_secret_jwt only, whose secret has no grace period."))
+		return
+	}
+
+	b := make([]byte, clientSecretBytes)
+	_, err = rand.Read(b)
+	if err != nil {
+		errs.WriteError(w, r, errs.Internal(err))
+		return
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+
+	resp := rotatedSecret{ClientID: client.ID, ClientSecret: secret}
+	if client.SecretHash != "" {
+		hash, err := authn.GenerateHash(r.Context(), "argon2id", secret)
+		if err != nil {
+			errs.WriteError(w, r, errs.Internal(err))
+			return
+		}
+		client.PreviousSecretHash, client.PreviousSecretExpiresAt = "", time.Time{}
+		if grace > 0 {
+			expiresAt := a.now().Add(grace)
+			client.PreviousSecretHash, client.PreviousSecretExpiresAt = client.SecretHash, expiresAt
+			resp.PreviousSecretExpiresAt = &expiresAt
+		}
+		client.SecretHash = hash
+	}
+	if client.Secret != "" {
+		client.Secret = secret
+	}
+
+	err = a.Clients.PutClient(r.Context(), client)
+	if err != nil {
+		errs.WriteError(w, r, errs.Internal(err))
+		return
+	}
+	a.audit().Record(r.Context(), audit.Event{
+		Type:       audit.ClientSecretRotated,
+		ClientID:   client.ID,
+		RemoteAddr: a.TrustedProxies.ClientIP(r),
+		Time:       a.now(),
+		Detail:     map[string]string{"grace": grace.String()},
+	})
+
+	w.Header().Set("Cache-Control", "no-store")
+	render.WriteDocument(w, r, http.StatusOK, resp)
+}
@@ -0,0 +1,201 @@
+package admin_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/admin"
+	"github.com/ehubscher/goidp/internal/audit"
+	"github.com/ehubscher/goidp/internal/authn"
+	"github.com/ehubscher/goidp/internal/oauth"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const oldClientSecret = "old-secret"
+
+type rotationEnv struct {
+	now     time.Time
+	mux     *http.ServeMux
+	events  *audit.Memory
+	clients *store.MemoryClientStore
+}
+
+// newRotationEnv serves the admin API and an OAuth provider sharing a
+// confidential client, so rotated secrets can be tried at the token endpoint,
+// and a client with only a client_secret_jwt secret.
+func newRotationEnv(t *testing.T) *rotationEnv {
+	t.Helper()
+
+	t.Setenv("BCRYPT_COST", "4")
+	t.Setenv("ARGON2ID_MEMORY", "1024")
+	t.Setenv("ARGON2ID_ITERATIONS", "1")
+	t.Setenv("ARGON2ID_PARALLELISM", "1")
+	t.Setenv("ARGON2ID_SALT_LENGTH", "16")
+	t.Setenv("ARGON2ID_KEY_LENGTH", "32")
+
+	hash, err := authn.GenerateHash(context.Background(), "bcrypt", oldClientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients := store.NewMemoryClientStore(
+		store.Client{ID: "billing", SecretHash: hash},
+		store.Client{ID: "reports", Secret: oldClientSecret},
+	)
+
+	env := &rotationEnv{
+		now:     time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		mux:     http.NewServeMux(),
+		events:  &audit.Memory{},
+		clients: clients,
+	}
+	now := func() time.Time { return env.now }
+	(&admin.API{Clients: clients, Audit: env.events, Now: now}).RegisterHandlers(env.mux)
+	(&oauth.Provider{Clients: clients, HashAlgorithm: "bcrypt", Now: now}).RegisterHandlers(env.mux)
+
+	return env
+}
+
+func (env *rotationEnv) rotate(t *testing.T, grace string) string {
+	t.Helper()
+
+	return env.rotateClient(t, "billing", grace)
+}
+
+func (env *rotationEnv) rotateClient(t *testing.T, clientID, grace string) string {
+	t.Helper()
+
+	target := "/admin/clients/" + clientID + "/rotate-secret"
+	if grace != "" {
+		target += "?" + url.Values{"grace": {grace}}.Encode()
+	}
+	rec := httptest.NewRecorder()
+	env.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusOK)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("got: Cache-Control %q, want: no-store", got)
+	}
+
+	var resp struct {
+		ClientSecret string `json:"client_secret"`
+	}
+	err := json.NewDecoder(rec.Body).Decode(&resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.ClientSecret
+}
+
+// authenticates reports whether secret authenticates the client at the
+// token endpoint. An unknown grant type is only rejected once the client
+// has authenticated, so nothing else has to be set up.
+func (env *rotationEnv) authenticates(secret string) bool {
+	r := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader("grant_type=none"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("billing:"+secret)))
+	rec := httptest.NewRecorder()
+	env.mux.ServeHTTP(rec, r)
+
+	return rec.Code != http.StatusUnauthorized
+}
+
+func TestRotateClientSecret(t *testing.T) {
+	env := newRotationEnv(t)
+
+	secret := env.rotate(t, "")
+	if !env.authenticates(secret) {
+		t.Error("got: new secret rejected, want: accepted")
+	}
+	if env.authenticates(oldClientSecret) {
+		t.Error("got: old secret accepted, want: rejected")
+	}
+
+	events := env.events.Events()
+	if len(events) != 1 || events[0].Type != audit.ClientSecretRotated || events[0].ClientID != "billing" {
+		t.Errorf("got: %+v, want: one %s event", events, audit.ClientSecretRotated)
+	}
+}
+
+func TestRotateClientSecretGrace(t *testing.T) {
+	env := newRotationEnv(t)
+
+	secret := env.rotate(t, "1h")
+	if !env.authenticates(secret) || !env.authenticates(oldClientSecret) {
+		t.Error("got: a secret rejected during the grace period, want: both accepted")
+	}
+
+	env.now = env.now.Add(time.Hour)
+	if env.authenticates(oldClientSecret) {
+		t.Error("got: old secret accepted after the grace period, want: rejected")
+	}
+	if !env.authenticates(secret) {
+		t.Error("got: new secret rejected, want: accepted")
+	}
+}
+
+func TestRotateClientSecretReturnedOnce(t *testing.T) {
+	env := newRotationEnv(t)
+
+	first := env.rotate(t, "")
+	second := env.rotate(t, "")
+	if first == "" || first == second {
+		t.Errorf("got: %q then %q, want: two different secrets", first, second)
+	}
+	if env.authenticates(first) {
+		t.Error("got: first secret accepted, want: rejected")
+	}
+
+	rec := httptest.NewRecorder()
+	env.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/clients", nil))
+	if strings.Contains(rec.Body.String(), second) {
+		t.Errorf("got: %s, want: no secret in the client listing", rec.Body)
+	}
+}
+
+func TestRotateClientSecretJWT(t *testing.T) {
+	env := newRotationEnv(t)
+
+	secret := env.rotateClient(t, "reports", "")
+	client, err := env.clients.GetClient(context.Background(), "reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Secret != secret || client.SecretHash != "" {
+		t.Errorf("got: %+v, want: only the client_secret_jwt secret replaced", client)
+	}
+
+	rec := httptest.NewRecorder()
+	env.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/clients/reports/rotate-secret?grace=1h", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got: %d, want: %d for a grace period", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestRotateClientSecretBadRequest(t *testing.T) {
+	env := newRotationEnv(t)
+
+	var requests = []struct {
+		target string
+		status int
+	}{
+		{"/admin/clients/billing/rotate-secret?grace=forever", http.StatusBadRequest},
+		{"/admin/clients/billing/rotate-secret?grace=720h", http.StatusBadRequest},
+		{"/admin/clients/unknown/rotate-secret", http.StatusNotFound},
+	}
+	for _, c := range requests {
+		rec := httptest.NewRecorder()
+		env.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, c.target, nil))
+		if rec.Code != c.status {
+			t.Errorf("%s: got: %d, want: %d", c.target, rec.Code, c.status)
+		}
+	}
+}
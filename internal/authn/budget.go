@@ -0,0 +1,133 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBusy means an argon2id hash would take the memory in use past the
+// budget and not enough was freed in time. It is temporary, so the request
+// can be retried.
+var ErrBusy = errors.New("password hashing memory budget exhausted")
+
+// MemoryBudget caps the total argon2id memory of the hashes being computed
+// at once. Counting memory rather than hashes keeps the bound right when
+// stored hashes use different parameters. A single hash larger than the
+// whole budget is admitted when nothing else is running, so a budget set
+// below some stored hash's cost slows those logins rather than refusing
+// them outright. The zero value is unlimited.
+type MemoryBudget struct {
+	// Total is the budget in KiB, the unit of ARGON2ID_MEMORY.
+	Total uint64
+	// Wait is how long a hash waits for memory to free up before failing
+	// with ErrBusy. Zero means it fails at once.
+	Wait time.Duration
+
+	mu    sync.Mutex
+	inUse uint64
+	// freed is closed, and then replaced, whenever memory is released.
+	freed chan struct{}
+}
+
+var memoryBudget atomic.Pointer[MemoryBudget]
+
+// SetMemoryBudget replaces the budget argon2id hashes are admitted against.
+// Hashes already running release their memory to the budget they were
+// admitted by.
+func SetMemoryBudget(b *MemoryBudget) {
+	memoryBudget.Store(b)
+}
+
+// ConfigureMemoryBudget reads ARGON2ID_MEMORY_BUDGET, in KiB, and
+// ARGON2ID_MEMORY_BUDGET_WAIT. An unset budget is unlimited.
+func ConfigureMemoryBudget() (*MemoryBudget, error) {
+	b := &MemoryBudget{}
+
+	if v := os.Getenv("ARGON2ID_MEMORY_BUDGET"); v != "" {
+		total, err := strconv.ParseUint(v, 10, 64)
+		if err != nil || total == 0 {
+			return nil, fmt.Errorf("ARGON2ID_MEMORY_BUDGET misconfigured: %q", v)
+		}
+		b.Total = total
+	}
+
+	if v := os.Getenv("ARGON2ID_MEMORY_BUDGET_WAIT"); v != "" {
+		wait, err := time.ParseDuration(v)
+		if err != nil || wait < 0 {
+			return nil, fmt.Errorf("ARGON2ID_MEMORY_BUDGET_WAIT misconfigured: %q", v)
+		}
+		b.Wait = wait
+	}
+
+	return b, nil
+}
+
+// Acquire admits a hash using kib of memory, waiting up to Wait for room,
+// or until ctx ends, when it returns ctx.Err(). release must be called once
+// the hash is done.
+func (b *MemoryBudget) Acquire(ctx context.Context, kib uint32) (release func(), err error) {
+	if b == nil || b.Total == 0 {
+		return func() {}, nil
+	}
+
+	var deadline <-chan time.Time
+	for {
+		b.mu.Lock()
+		if b.inUse == 0 || b.inUse+uint64(kib) <= b.Total {
+			b.inUse += uint64(kib)
+			b.mu.Unlock()
+			return sync.OnceFunc(func() { b.release(kib) }), nil
+		}
+		if b.freed == nil {
+			b.freed = make(chan struct{})
+		}
+		var freed chan struct{} = b.freed
+		b.mu.Unlock()
+
+		if deadline == nil {
+			if b.Wait <= 0 {
+				return nil, ErrBusy
+			}
+			timer := time.NewTimer(b.Wait)
+			defer timer.Stop()
+			deadline = timer.C
+		}
+		select {
+		case <-freed:
+		case <-deadline:
+			return nil, ErrBusy
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (b *MemoryBudget) release(kib uint32) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.inUse -= uint64(kib)
+	if b.freed != nil {
+		close(b.freed)
+		b.freed = nil
+	}
+}
+
+// InUse is the memory, in KiB, of the hashes currently admitted.
+func (b *MemoryBudget) InUse() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.inUse
+}
+
+// admitArgon2id admits a hash with params against the current budget.
+func admitArgon2id(ctx context.Context, params argon2Params) (release func(), err error) {
+	return memoryBudget.Load().Acquire(ctx, params.memory)
+}
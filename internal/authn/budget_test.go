@@ -0,0 +1,117 @@
+package authn_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/authn"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	b := &authn.MemoryBudget{Total: 64 * 1024}
+
+	first, err := b.Acquire(context.Background(), 32*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := b.Acquire(context.Background(), 32*1024)
+	if err != nil {
+		t.Fatalf("got: %v, want: admitted up to the budget", err)
+	}
+	if got := b.InUse(); got != 64*1024 {
+		t.Errorf("got: %d KiB in use, want: %d", got, 64*1024)
+	}
+
+	_, err = b.Acquire(context.Background(), 1)
+	if !errors.Is(err, authn.ErrBusy) {
+		t.Errorf("got: %v, want: %v", err, authn.ErrBusy)
+	}
+
+	first()
+	first()
+	if got := b.InUse(); got != 32*1024 {
+		t.Errorf("got: %d KiB in use, want: %d after one release", got, 32*1024)
+	}
+	second()
+}
+
+func TestMemoryBudgetWaits(t *testing.T) {
+	b := &authn.MemoryBudget{Total: 1024, Wait: time.Second}
+	held, err := b.Acquire(context.Background(), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admitted := make(chan error)
+	go func() {
+		release, err := b.Acquire(context.Background(), 512)
+		if err == nil {
+			release()
+		}
+		admitted <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	held()
+
+	if err = <-admitted; err != nil {
+		t.Errorf("got: %v, want: admitted once memory was released", err)
+	}
+}
+
+func TestMemoryBudgetWaitExpires(t *testing.T) {
+	b := &authn.MemoryBudget{Total: 1024, Wait: 20 * time.Millisecond}
+	held, err := b.Acquire(context.Background(), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held()
+
+	start := time.Now()
+	_, err = b.Acquire(context.Background(), 512)
+	if !errors.Is(err, authn.ErrBusy) || time.Since(start) < 20*time.Millisecond {
+		t.Errorf("got: %v after %s, want: %v after waiting", err, time.Since(start), authn.ErrBusy)
+	}
+}
+
+func TestMemoryBudgetWaitHonorsContext(t *testing.T) {
+	b := &authn.MemoryBudget{Total: 1024, Wait: time.Hour}
+	held, err := b.Acquire(context.Background(), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = b.Acquire(ctx, 512)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got: %v, want: %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestMemoryBudgetOversizedWhenIdle(t *testing.T) {
+	b := &authn.MemoryBudget{Total: 1024}
+
+	release, err := b.Acquire(context.Background(), 4096)
+	if err != nil {
+		t.Errorf("got: %v, want: admitted with nothing else running", err)
+	}
+	release()
+}
+
+func TestConfigureMemoryBudget(t *testing.T) {
+	t.Setenv("ARGON2ID_MEMORY_BUDGET", "262144")
+	t.Setenv("ARGON2ID_MEMORY_BUDGET_WAIT", "250ms")
+
+	b, err := authn.ConfigureMemoryBudget()
+	if err != nil || b.Total != 262144 || b.Wait != 250*time.Millisecond {
+		t.Errorf("got: %+v, %v, want: 262144 KiB waiting 250ms", b, err)
+	}
+
+	t.Setenv("ARGON2ID_MEMORY_BUDGET", "lots")
+	if _, err = authn.ConfigureMemoryBudget(); err == nil {
+		t.Error("got: nil, want: an error")
+	}
+}
@@ -0,0 +1,25 @@
+package authn
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+)
+
+// OnCompare, when set, is called by SecretsEqual with the values it
+// compares, so tests can check that a secret goes through it.
+var OnCompare func(presented, expected string)
+
+// SecretsEqual reports whether a presented secret equals the expected one,
+// in time that depends on neither value. Both are hashed first, because
+// subtle.ConstantTimeCompare alone returns early when the lengths differ.
+// Every comparison of a secret against a presented value should go
+// through it.
+func SecretsEqual(presented, expected string) bool {
+	if OnCompare != nil {
+		OnCompare(presented, expected)
+	}
+	a := sha256.Sum256([]byte(presented))
+	b := sha256.Sum256([]byte(expected))
+
+	return subtle.ConstantTimeCompare(a[:], b[:]) == 1
+}
@@ -0,0 +1,26 @@
+package authn_test
+
+import (
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/authn"
+)
+
+func TestSecretsEqual(t *testing.T) {
+	var cases = []struct {
+		presented, expected string
+		equal               bool
+	}{
+		{"s3cret", "s3cret", true},
+		{"", "", true},
+		{"s3cret", "s3creT", false},
+		{"s3cre", "s3cret", false},
+		{"", "s3cret", false},
+	}
+
+	for _, c := range cases {
+		if got := authn.SecretsEqual(c.presented, c.expected); got != c.equal {
+			t.Errorf("%q, %q got: %v, want: %v", c.presented, c.expected, got, c.equal)
+		}
+	}
+}
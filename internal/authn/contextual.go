@@ -0,0 +1,128 @@
+package authn
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// minPatternLength is the shortest run of a keyboard row, sequence or
+// repeated character that counts as a trivial pattern.
+const minPatternLength = 4
+
+// patternRows are the sequences whose runs ContextPolicy refuses, forwards
+// or backwards.
+var patternRows = []string{
+	"abcdefghijklmnopqrstuvwxyz",
+	"01234567890",
+	"qwertyuiop",
+	"asdfghjkl",
+	"zxcvbnm",
+	"qwertzuiop",
+	"azertyuiop",
+	"1qaz2wsx3edc4rfv5tgb6yhn7ujm8ik9ol0p",
+}
+
+// ContextPolicy is an organization's rules on what a new password may not
+// contain, ignoring case. Unlike StrengthPolicy, which weighs the whole
+// password, any one match refuses it. The zero value refuses nothing.
+type ContextPolicy struct {
+	// RejectEmail refuses passwords containing the local part of the
+	// user's email address, if it has at least 3 characters.
+	RejectEmail bool
+	// BlockedTerms are words such as the company or product name.
+	BlockedTerms []string
+	// RejectPatterns refuses runs of 4 or more characters along a keyboard
+	// row or the alphabet or digits, such as "asdf" or "4321", and of one
+	// repeated character.
+	RejectPatterns bool
+}
+
+// ConfigureContextPolicy reads PASSWORD_REJECT_EMAIL and
+// PASSWORD_REJECT_PATTERNS, which default to false, and
+// PASSWORD_BLOCKED_TERMS, a comma-separated list.
+func ConfigureContextPolicy() (p ContextPolicy, err error) {
+	if raw := os.Getenv("PASSWORD_REJECT_EMAIL"); raw != "" {
+		p.RejectEmail, err = strconv.ParseBool(raw)
+		if err != nil {
+			return ContextPolicy{}, fmt.Errorf("PASSWORD_REJECT_EMAIL misconfigured: %w", err)
+		}
+	}
+
+	if raw := os.Getenv("PASSWORD_REJECT_PATTERNS"); raw != "" {
+		p.RejectPatterns, err = strconv.ParseBool(raw)
+		if err != nil {
+			return ContextPolicy{}, fmt.Errorf("PASSWORD_REJECT_PATTERNS misconfigured: %w", err)
+		}
+	}
+
+	for _, term := range strings.Split(os.Getenv("PASSWORD_BLOCKED_TERMS"), ",") {
+		if term = strings.TrimSpace(term); term != "" {
+			p.BlockedTerms = append(p.BlockedTerms, term)
+		}
+	}
+
+	return p, nil
+}
+
+// Check returns a sentence of feedback for each rule password breaks.
+// userInputs are email addresses or other strings about the user, as given
+// to StrengthEstimator.
+func (p ContextPolicy) Check(password string, userInputs ...string) (feedback []string, ok bool) {
+	lower := strings.ToLower(password)
+
+	if p.RejectEmail {
+		for _, in := range userInputs {
+			local, _, _ := strings.Cut(strings.ToLower(in), "@")
+			if len([]rune(local)) >= 3 && strings.Contains(lower, local) {
+				feedback = append(feedback, "Don't include your email address.")
+				break
+			}
+		}
+	}
+
+	for _, term := range p.BlockedTerms {
+		if strings.Contains(lower, strings.ToLower(term)) {
+			feedback = append(feedback, fmt.Sprintf("Don't include %q.", term))
+		}
+	}
+
+	if p.RejectPatterns {
+		if pattern, found := trivialPattern(lower); found {
+			feedback = append(feedback, fmt.Sprintf("Avoid keyboard patterns and sequences like %q.", pattern))
+		}
+	}
+
+	return feedback, len(feedback) == 0
+}
+
+// trivialPattern returns the first run of minPatternLength characters in
+// s, which is lowercase, that repeats one character or follows one of
+// patternRows.
+func trivialPattern(s string) (pattern string, found bool) {
+	runes := []rune(s)
+	for i := 0; i+minPatternLength <= len(runes); i++ {
+		window := string(runes[i : i+minPatternLength])
+		if strings.Count(window, string(runes[i])) == minPatternLength && !unicode.IsSpace(runes[i]) {
+			return window, true
+		}
+		for _, row := range patternRows {
+			if strings.Contains(row, window) || strings.Contains(row, reverse(window)) {
+				return window, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+
+	return string(runes)
+}
@@ -0,0 +1,53 @@
+package authn_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/authn"
+)
+
+func TestContextPolicy(t *testing.T) {
+	policy := authn.ContextPolicy{RejectEmail: true, BlockedTerms: []string{"Acme"}, RejectPatterns: true}
+
+	var cases = []struct {
+		password string
+		feedback []string
+	}{
+		{"correct horse battery staple", nil},
+		{"my JANE.DOE password", []string{"Don't include your email address."}},
+		{"WorkAtACME forever", []string{`Don't include "Acme".`}},
+		{"horse qwerty staple", []string{`Avoid keyboard patterns and sequences like "qwer".`}},
+		{"horse 9876 staple", []string{`Avoid keyboard patterns and sequences like "9876".`}},
+		{"horse zzzz staple", []string{`Avoid keyboard patterns and sequences like "zzzz".`}},
+		{"jane.doe@acme", []string{"Don't include your email address.", `Don't include "Acme".`}},
+	}
+
+	for _, c := range cases {
+		feedback, ok := policy.Check(c.password, "Jane.Doe@example.com")
+		if ok != (c.feedback == nil) || !slices.Equal(feedback, c.feedback) {
+			t.Errorf("%q got: %v, %v, want: %v", c.password, feedback, ok, c.feedback)
+		}
+	}
+
+	if feedback, ok := (authn.ContextPolicy{}).Check("jane.doe acme qwerty", "jane.doe@example.com"); !ok {
+		t.Errorf("got: %v, want: the zero policy refusing nothing", feedback)
+	}
+}
+
+func TestConfigureContextPolicy(t *testing.T) {
+	t.Setenv("PASSWORD_REJECT_EMAIL", "true")
+	t.Setenv("PASSWORD_BLOCKED_TERMS", "acme, widgets,")
+	policy, err := authn.ConfigureContextPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !policy.RejectEmail || policy.RejectPatterns || !slices.Equal(policy.BlockedTerms, []string{"acme", "widgets"}) {
+		t.Errorf("got: %+v, want: email and two terms", policy)
+	}
+
+	t.Setenv("PASSWORD_REJECT_PATTERNS", "often")
+	if _, err := authn.ConfigureContextPolicy(); err == nil {
+		t.Error("got: nil, want: an error")
+	}
+}
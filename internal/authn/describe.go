@@ -0,0 +1,106 @@
+package authn
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrUnknownHash = errors.New("unrecognized hash encoding")
+
+// HashDescription is what an encoded hash says about how it was made,
+// without verifying anything.
+type HashDescription struct {
+	Algorithm string
+	// Params is the strength in the encoding's own notation, such as
+	// "m=65536,t=3,p=2" or "c=12,prehash=sha256".
+	Params   string
+	PepperID string
+}
+
+func DescribeHash(encodedHash string) (d HashDescription, err error) {
+	encodedHash, d.PepperID = splitPepperID(encodedHash)
+
+	var vals []string = strings.Split(encodedHash, "$")
+	if len(vals) < 3 {
+		return HashDescription{}, ErrUnknownHash
+	}
+	d.Algorithm = vals[1]
+
+	switch d.Algorithm {
+	case "argon2id":
+		params, _, _, err := decodeArgon2idHash(encodedHash)
+		if err != nil {
+			return HashDescription{}, err
+		}
+		d.Params = fmt.Sprintf("m=%d,t=%d,p=%d", params.memory, params.iterations, params.parallelism)
+	case "bcrypt":
+		hash, err := decodeBcryptHash(encodedHash)
+		if err != nil {
+			return HashDescription{}, err
+		}
+		cost, err := bcrypt.Cost(hash)
+		if err != nil {
+			return HashDescription{}, err
+		}
+		d.Params = fmt.Sprintf("c=%d", cost)
+		if bcryptPrehashed(encodedHash) {
+			d.Params += "," + bcryptPrehashParam
+		}
+	default:
+		return HashDescription{}, fmt.Errorf("%w: %s", ErrUnknownHash, d.Algorithm)
+	}
+
+	return d, nil
+}
+
+// HashReport tallies hashes by level, so operators can follow a migration to
+// new parameters. Add hashes one at a time; nothing but the counts is kept.
+type HashReport struct {
+	Total        int         `json:"total"`
+	Unrecognized int         `json:"unrecognized"`
+	Levels       []HashLevel `json:"levels"`
+}
+
+type HashLevel struct {
+	Algorithm string  `json:"algorithm"`
+	Params    string  `json:"params"`
+	Count     int     `json:"count"`
+	Percent   float64 `json:"percent"`
+}
+
+func (r *HashReport) Add(encodedHash string) {
+	r.Total++
+
+	d, err := DescribeHash(encodedHash)
+	if err != nil {
+		r.Unrecognized++
+		return
+	}
+
+	i := slices.IndexFunc(r.Levels, func(l HashLevel) bool {
+		return l.Algorithm == d.Algorithm && l.Params == d.Params
+	})
+	if i < 0 {
+		r.Levels = append(r.Levels, HashLevel{Algorithm: d.Algorithm, Params: d.Params})
+		i = len(r.Levels) - 1
+	}
+	r.Levels[i].Count++
+}
+
+// Finish computes the percentages and sorts the levels, most common first.
+func (r *HashReport) Finish() {
+	for i := range r.Levels {
+		r.Levels[i].Percent = 100 * float64(r.Levels[i].Count) / float64(r.Total)
+	}
+
+	slices.SortFunc(r.Levels, func(a, b HashLevel) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return strings.Compare(a.Algorithm+" "+a.Params, b.Algorithm+" "+b.Params)
+	})
+}
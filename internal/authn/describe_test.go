@@ -0,0 +1,77 @@
+package authn_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/authn"
+)
+
+func generateHash(t *testing.T, algo, memory, bcryptCost string) string {
+	t.Helper()
+	setHashEnv(t, memory, "1", bcryptCost)
+
+	hash, err := authn.GenerateHash(context.Background(), algo, "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hash
+}
+
+func TestDescribeHash(t *testing.T) {
+	got, err := authn.DescribeHash(generateHash(t, "argon2id", "1024", "4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (authn.HashDescription{Algorithm: "argon2id", Params: "m=1024,t=1,p=2"}); got != want {
+		t.Errorf("got: %+v, want: %+v", got, want)
+	}
+
+	got, err = authn.DescribeHash(generateHash(t, "bcrypt", "1024", "5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (authn.HashDescription{Algorithm: "bcrypt", Params: "c=5"}); got != want {
+		t.Errorf("got: %+v, want: %+v", got, want)
+	}
+
+	for _, hash := range []string{"", "plaintext", "$md5$abc$def"} {
+		_, err = authn.DescribeHash(hash)
+		if !errors.Is(err, authn.ErrUnknownHash) {
+			t.Errorf("%q: got: %v, want: %v", hash, err, authn.ErrUnknownHash)
+		}
+	}
+}
+
+func TestHashReport(t *testing.T) {
+	bcrypt4 := generateHash(t, "bcrypt", "1024", "4")
+	hashes := []string{
+		bcrypt4,
+		generateHash(t, "argon2id", "1024", "4"),
+		bcrypt4,
+		generateHash(t, "bcrypt", "1024", "5"),
+		"not a hash",
+	}
+
+	var report authn.HashReport
+	for _, hash := range hashes {
+		report.Add(hash)
+	}
+	report.Finish()
+
+	if report.Total != 5 || report.Unrecognized != 1 {
+		t.Errorf("got: total %d, unrecognized %d, want: 5, 1", report.Total, report.Unrecognized)
+	}
+
+	want := []authn.HashLevel{
+		{Algorithm: "bcrypt", Params: "c=4", Count: 2, Percent: 40},
+		{Algorithm: "argon2id", Params: "m=1024,t=1,p=2", Count: 1, Percent: 20},
+		{Algorithm: "bcrypt", Params: "c=5", Count: 1, Percent: 20},
+	}
+	if !slices.Equal(report.Levels, want) {
+		t.Errorf("got: %+v, want: %+v", report.Levels, want)
+	}
+}
@@ -0,0 +1,170 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxEmailLength       = 254
+	maxLocalPartLength   = 64
+	maxDomainLabelLength = 63
+)
+
+var (
+	ErrInvalidEmail = errors.New("invalid email address")
+	ErrEmailDomain  = errors.New("email domain does not accept mail")
+)
+
+// EmailValidator checks and normalizes email addresses given at
+// registration. The syntax check is deliberately practical rather than full
+// RFC 5322: quoted local parts, comments and address literals are refused, as
+// is anything outside printable ASCII so look-alike characters can't be used
+// to register near-duplicates. Internationalized domains must be given in
+// their punycode form.
+type EmailValidator struct {
+	// CheckMX additionally requires the domain to publish an MX record.
+	CheckMX bool
+
+	// LookupMX resolves the MX records of a domain. It defaults to
+	// net.DefaultResolver and exists so tests don't depend on DNS.
+	LookupMX func(ctx context.Context, domain string) ([]*net.MX, error)
+}
+
+// ConfigureEmailValidator reads EMAIL_CHECK_MX, which defaults to false.
+func ConfigureEmailValidator() (v EmailValidator, err error) {
+	raw := os.Getenv("EMAIL_CHECK_MX")
+	if raw == "" {
+		return EmailValidator{}, nil
+	}
+
+	v.CheckMX, err = strconv.ParseBool(raw)
+	if err != nil {
+		return EmailValidator{}, fmt.Errorf("EMAIL_CHECK_MX misconfigured: %w", err)
+	}
+
+	return v, nil
+}
+
+// Normalize trims and validates raw, returning the address in the form it
+// should be stored and compared in. Addresses are lowercased as a whole:
+// local parts are case-sensitive in theory but not at any provider in
+// practice, and treating them otherwise lets one mailbox hold many accounts.
+func (v EmailValidator) Normalize(ctx context.Context, raw string) (email string, err error) {
+	email = strings.ToLower(strings.TrimSpace(raw))
+
+	if len(email) > maxEmailLength {
+		return "", fmt.Errorf("%w: longer than %d characters", ErrInvalidEmail, maxEmailLength)
+	}
+	for _, c := range email {
+		if c <= ' ' || c > '~' {
+			return "", fmt.Errorf("%w: contains %q", ErrInvalidEmail, c)
+		}
+	}
+
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return "", fmt.Errorf("%w: missing @", ErrInvalidEmail)
+	}
+	err = validateLocalPart(local)
+	if err != nil {
+		return "", err
+	}
+	err = validateDomain(domain)
+	if err != nil {
+		return "", err
+	}
+
+	if v.CheckMX {
+		err = v.checkMX(ctx, domain)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return email, nil
+}
+
+func validateLocalPart(local string) error {
+	if local == "" || len(local) > maxLocalPartLength {
+		return fmt.Errorf("%w: local part must be 1 to %d characters", ErrInvalidEmail, maxLocalPartLength)
+	}
+	if strings.HasPrefix(local, ".") || strings.HasSuffix(local, ".") || strings.Contains(local, "..") {
+		return fmt.Errorf("%w: misplaced dot in local part", ErrInvalidEmail)
+	}
+
+	for _, c := range local {
+		if !isAtext(c) && c != '.' {
+			return fmt.Errorf("%w: local part contains %q", ErrInvalidEmail, c)
+		}
+	}
+
+	return nil
+}
+
+// isAtext reports whether c is allowed in an unquoted local part, per the
+// atext rule of RFC 5322 section 3.2.3.
+func isAtext(c rune) bool {
+	return isAlnum(c) || strings.ContainsRune("!#$%&'*+/=?^_`{|}~-", c)
+}
+
+func validateDomain(domain string) error {
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return fmt.Errorf("%w: domain must have at least two labels", ErrInvalidEmail)
+	}
+
+	for _, label := range labels {
+		if label == "" || len(label) > maxDomainLabelLength {
+			return fmt.Errorf("%w: domain labels must be 1 to %d characters", ErrInvalidEmail, maxDomainLabelLength)
+		}
+		if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return fmt.Errorf("%w: domain label %q starts or ends with a hyphen", ErrInvalidEmail, label)
+		}
+		for _, c := range label {
+			if !isAlnum(c) && c != '-' {
+				return fmt.Errorf("%w: domain contains %q", ErrInvalidEmail, c)
+			}
+		}
+	}
+
+	// An all-numeric top-level label means this is an IP address, not a name.
+	tld := labels[len(labels)-1]
+	if strings.Trim(tld, "0123456789") == "" {
+		return fmt.Errorf("%w: domain is not a host name", ErrInvalidEmail)
+	}
+
+	return nil
+}
+
+func isAlnum(c rune) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+func (v EmailValidator) checkMX(ctx context.Context, domain string) error {
+	lookup := v.LookupMX
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupMX
+	}
+
+	records, err := lookup(ctx, domain)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return fmt.Errorf("%w: %s", ErrEmailDomain, domain)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot look up MX records for %s: %w", domain, err)
+	}
+
+	// A single "." host is a null MX (RFC 7505): the domain accepts no mail.
+	if len(records) == 0 || len(records) == 1 && records[0].Host == "." {
+		return fmt.Errorf("%w: %s", ErrEmailDomain, domain)
+	}
+
+	return nil
+}
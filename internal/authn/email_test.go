@@ -0,0 +1,98 @@
+package authn_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/authn"
+)
+
+var validEmails = []struct {
+	raw, want string
+}{
+	{"alice@example.com", "alice@example.com"},
+	{"  alice@example.com\t\n", "alice@example.com"},
+	{"Alice.Smith+tag@Example.COM", "alice.smith+tag@example.com"},
+	{"o'brien@mail.example.co.uk", "o'brien@mail.example.co.uk"},
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	for _, c := range validEmails {
+		got, err := authn.EmailValidator{}.Normalize(context.Background(), c.raw)
+		if err != nil {
+			t.Errorf("%q got: %v, want: nil", c.raw, err)
+		}
+		if got != c.want {
+			t.Errorf("got: %q, want: %q", got, c.want)
+		}
+	}
+}
+
+var invalidEmails = []string{
+	"",
+	"alice",
+	"alice@",
+	"@example.com",
+	"alice@localhost",
+	"alice@@example.com",
+	"alice@example..com",
+	"alice@-example.com",
+	"alice@192.168.0.1",
+	".alice@example.com",
+	"al..ice@example.com",
+	"al ice@example.com",
+	`"alice"@example.com`,
+	"Alice <alice@example.com>",
+	"аlice@example.com", // Cyrillic а
+	"alice@exаmple.com",
+}
+
+func TestNormalizeEmailInvalid(t *testing.T) {
+	for _, raw := range invalidEmails {
+		_, err := authn.EmailValidator{}.Normalize(context.Background(), raw)
+		if !errors.Is(err, authn.ErrInvalidEmail) {
+			t.Errorf("%q got: %v, want: %v", raw, err, authn.ErrInvalidEmail)
+		}
+	}
+}
+
+func TestNormalizeEmailMX(t *testing.T) {
+	records := map[string][]*net.MX{
+		"example.com": {{Host: "mx.example.com.", Pref: 10}},
+		"nomail.com":  {{Host: ".", Pref: 0}},
+		"broken.com":  nil,
+	}
+	v := authn.EmailValidator{
+		CheckMX: true,
+		LookupMX: func(ctx context.Context, domain string) ([]*net.MX, error) {
+			mx, ok := records[domain]
+			if !ok {
+				return nil, &net.DNSError{Err: "no such host", Name: domain, IsNotFound: true}
+			}
+			if mx == nil {
+				return nil, &net.DNSError{Err: "server misbehaving", Name: domain, IsTemporary: true}
+			}
+			return mx, nil
+		},
+	}
+
+	_, err := v.Normalize(context.Background(), "alice@example.com")
+	if err != nil {
+		t.Errorf("got: %v, want: nil", err)
+	}
+
+	for _, raw := range []string{"alice@nomail.com", "alice@missing.com"} {
+		_, err = v.Normalize(context.Background(), raw)
+		if !errors.Is(err, authn.ErrEmailDomain) {
+			t.Errorf("%s got: %v, want: %v", raw, err, authn.ErrEmailDomain)
+		}
+	}
+
+	// A failing resolver is an error, but not a verdict on the address.
+	_, err = v.Normalize(context.Background(), "alice@broken.com")
+	if err == nil || errors.Is(err, authn.ErrEmailDomain) {
+		t.Errorf("got: %v, want: a lookup error", err)
+	}
+}
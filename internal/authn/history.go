@@ -0,0 +1,22 @@
+package authn
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrPasswordReused = errors.New("password matches one used recently")
+
+// CheckPasswordReuse returns ErrPasswordReused if password matches any of
+// the given encoded hashes. Hashes that can't be verified, e.g. because they
+// were made with a pepper that has since been retired, are skipped.
+func CheckPasswordReuse(ctx context.Context, password string, encodedHashes []string) error {
+	for _, encodedHash := range encodedHashes {
+		match, err := VerifyPassword(ctx, password, encodedHash)
+		if err == nil && match {
+			return ErrPasswordReused
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package authn
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Operations passed to a HashRecorder.
+const (
+	OpGenerate = "generate"
+	OpVerify   = "verify"
+)
+
+// HashRecorder is told how long each KDF run took, so operators can feed a
+// histogram and notice when hashing latency drifts after a parameter change
+// or under load. Only the KDF itself is timed, not decoding or peppering.
+type HashRecorder interface {
+	RecordHash(algo, op string, d time.Duration)
+}
+
+// HashRecorderFunc adapts a function to a HashRecorder.
+type HashRecorderFunc func(algo, op string, d time.Duration)
+
+func (f HashRecorderFunc) RecordHash(algo, op string, d time.Duration) {
+	f(algo, op, d)
+}
+
+type noopRecorder struct{}
+
+func (noopRecorder) RecordHash(string, string, time.Duration) {}
+
+var hashRecorder atomic.Pointer[HashRecorder]
+
+// SetHashRecorder replaces the recorder hashing durations are reported to.
+// Nil restores the default, which discards them. It is safe to call while
+// passwords are being hashed.
+func SetHashRecorder(r HashRecorder) {
+	if r == nil {
+		hashRecorder.Store(nil)
+		return
+	}
+	hashRecorder.Store(&r)
+}
+
+func recordHash(algo, op string, start time.Time) {
+	var r HashRecorder = noopRecorder{}
+	if p := hashRecorder.Load(); p != nil {
+		r = *p
+	}
+	r.RecordHash(algo, op, time.Since(start))
+}
@@ -0,0 +1,57 @@
+package authn_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/authn"
+)
+
+type recordedHash struct {
+	algo, op string
+	d        time.Duration
+}
+
+func TestHashRecorder(t *testing.T) {
+	setHashEnv(t, "4096", "1", "4")
+
+	var mu sync.Mutex
+	var recorded []recordedHash
+	authn.SetHashRecorder(authn.HashRecorderFunc(func(algo, op string, d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		recorded = append(recorded, recordedHash{algo, op, d})
+	}))
+	t.Cleanup(func() { authn.SetHashRecorder(nil) })
+
+	for _, algo := range []string{"argon2id", "bcrypt"} {
+		hash, err := authn.GenerateHash(context.Background(), algo, "password123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = authn.VerifyPassword(context.Background(), "password123", hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var want = []recordedHash{
+		{"argon2id", authn.OpGenerate, 0},
+		{"argon2id", authn.OpVerify, 0},
+		{"bcrypt", authn.OpGenerate, 0},
+		{"bcrypt", authn.OpVerify, 0},
+	}
+	if len(recorded) != len(want) {
+		t.Fatalf("got: %v, want: %d recordings", recorded, len(want))
+	}
+	for i, r := range recorded {
+		if r.algo != want[i].algo || r.op != want[i].op {
+			t.Errorf("got: %s %s, want: %s %s", r.algo, r.op, want[i].algo, want[i].op)
+		}
+		if r.d <= 0 {
+			t.Errorf("got: %v, want: a positive duration", r.d)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package authn
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
 	"errors"
@@ -9,23 +11,60 @@ import (
 	"log"
 	"log/slog"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var hashFuncs = map[string]func(string) (string, error){
+var hashFuncs = map[string]func(context.Context, string) (string, error){
 	"argon2id": generateArgon2idHash,
 	"bcrypt":   generateBcryptHash,
 }
 
-var verifyFuncs = map[string]func(string, string) (bool, error){
+var verifyFuncs = map[string]func(context.Context, string, string) (bool, error){
 	"argon2id": verifyArgon2idHash,
 	"bcrypt":   verifyBcryptHash,
 }
 
+// Bounds on the salt and key lengths accepted when decoding an encoded hash,
+// so a corrupt or malicious hash can't make us run the KDF with absurd sizes.
+const (
+	minDecodedSaltLength = 8
+	maxDecodedSaltLength = 64
+	minDecodedKeyLength  = 16
+	maxDecodedKeyLength  = 64
+)
+
+var (
+	ErrSaltLength = errors.New("argon2id salt length out of range")
+	ErrKeyLength  = errors.New("argon2id key length out of range")
+	// ErrPasswordTooLong means a password is over bcrypt's 72 byte limit
+	// and BCRYPT_PREHASH is off.
+	ErrPasswordTooLong = errors.New("password exceeds bcrypt's 72 byte limit")
+	// ErrArgon2Version means the hash can never be verified and the user
+	// has to reset their password. See Argon2VersionError.
+	ErrArgon2Version = errors.New("incompatible argon2 version")
+)
+
+// Argon2VersionError is returned for an argon2id hash made by an argon2
+// version other than the one golang.org/x/crypto/argon2 implements, such as
+// the v=16 (0x10) of older libraries. It unwraps to ErrArgon2Version.
+type Argon2VersionError struct {
+	Version int
+}
+
+func (e *Argon2VersionError) Error() string {
+	return fmt.Sprintf("argon2id hash has version %d but only %d can be verified: the password must be reset", e.Version, argon2.Version)
+}
+
+func (e *Argon2VersionError) Unwrap() error {
+	return ErrArgon2Version
+}
+
 type argon2Params struct {
 	memory      uint32
 	iterations  uint32
@@ -34,25 +73,57 @@ type argon2Params struct {
 	keyLength   uint32
 }
 
-func GenerateHash(algo, password string) (encodedHash string, err error) {
+func GenerateHash(ctx context.Context, algo, password string) (encodedHash string, err error) {
 	hashFunc, ok := hashFuncs[algo]
 	if !ok {
 		log.Fatalf("Algorithm %s is not supported.\n", algo)
 	}
 
-	return hashFunc(password)
+	current, _, err := configurePeppers()
+	if err != nil {
+		return "", err
+	}
+	if current.id == "" {
+		return hashFunc(ctx, password)
+	}
+
+	encodedHash, err = hashFunc(ctx, applyPepper(current.secret, password))
+	if err != nil {
+		return "", err
+	}
+
+	return withPepperID(encodedHash, current.id), nil
 }
 
-func VerifyPassword(password, encodedHash string) (match bool, err error) {
+func VerifyPassword(ctx context.Context, password, encodedHash string) (match bool, err error) {
+	encodedHash, pepperID := splitPepperID(encodedHash)
+	if pepperID != "" {
+		_, peppers, err := configurePeppers()
+		if err != nil {
+			return false, err
+		}
+
+		secret, ok := peppers[pepperID]
+		if !ok {
+			return false, fmt.Errorf("%w: %s", ErrUnknownPepper, pepperID)
+		}
+		password = applyPepper(secret, password)
+	}
+
+	err = currentVerifyPolicy().Check(encodedHash)
+	if err != nil {
+		return false, err
+	}
+
 	var vals []string = strings.Split(encodedHash, "$")
 	if len(vals) > 2 {
 		algo := vals[1]
 		verifyFunc, ok := verifyFuncs[algo]
 		if !ok {
-			log.Fatalf("Algorithm %s is not supported.\n", algo)
+			return false, fmt.Errorf("%w: %s", ErrUnknownHash, algo)
 		}
 
-		return verifyFunc(password, encodedHash)
+		return verifyFunc(ctx, password, encodedHash)
 	}
 
 	return false, nil
@@ -93,6 +164,46 @@ func configureArgon2id() (params argon2Params, err error) {
 	}, nil
 }
 
+// bcryptPrehashParam marks, in the parameter segment of a bcrypt hash, that
+// the password was pre-hashed with SHA-256.
+const bcryptPrehashParam = "prehash=sha256"
+
+// configureBcryptPrehash reads BCRYPT_PREHASH, which defaults to false. When
+// on, new bcrypt hashes are of the base64 SHA-256 of the password, so bytes
+// past bcrypt's 72 byte limit still count. Existing hashes keep verifying
+// either way, since each records whether it was pre-hashed.
+func configureBcryptPrehash() (prehash bool, err error) {
+	raw := os.Getenv("BCRYPT_PREHASH")
+	if raw == "" {
+		return false, nil
+	}
+
+	prehash, err = strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("BCRYPT_PREHASH misconfigured: %w", err)
+	}
+
+	return prehash, nil
+}
+
+// prehashPassword returns the base64 SHA-256 of password: 44 bytes, inside
+// bcrypt's limit and free of the NUL bytes raw digests can contain.
+func prehashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// bcryptPrehashed reports whether an encoded bcrypt hash records
+// pre-hashing.
+func bcryptPrehashed(encodedHash string) bool {
+	var vals []string = strings.Split(encodedHash, "$")
+	if len(vals) < 3 {
+		return false
+	}
+
+	return slices.Contains(strings.Split(vals[2], ","), bcryptPrehashParam)
+}
+
 func configureBcrypt() (cost int, err error) {
 	cost, err = strconv.Atoi(os.Getenv("BCRYPT_COST"))
 	if err != nil {
@@ -133,19 +244,25 @@ func decodeArgon2idHash(encodedHash string) (params argon2Params, salt, hash []b
 		return params, []byte{}, []byte{}, err
 	}
 	if version != argon2.Version {
-		return argon2Params{}, []byte{}, []byte{}, errors.New("incompatible Argon2 version")
+		return argon2Params{}, []byte{}, []byte{}, &Argon2VersionError{Version: version}
 	}
 
 	salt, err = base64.RawStdEncoding.Strict().DecodeString(vals[3])
 	if err != nil {
 		return params, salt, []byte{}, err
 	}
+	if len(salt) < minDecodedSaltLength || len(salt) > maxDecodedSaltLength {
+		return argon2Params{}, []byte{}, []byte{}, fmt.Errorf("%w: %d bytes", ErrSaltLength, len(salt))
+	}
 	params.saltLength = uint32(len(salt))
 
 	hash, err = base64.RawStdEncoding.Strict().DecodeString(vals[4])
 	if err != nil {
 		return params, salt, []byte{}, err
 	}
+	if len(hash) < minDecodedKeyLength || len(hash) > maxDecodedKeyLength {
+		return argon2Params{}, []byte{}, []byte{}, fmt.Errorf("%w: %d bytes", ErrKeyLength, len(hash))
+	}
 	params.keyLength = uint32(len(hash))
 
 	return params, salt, hash, nil
@@ -167,7 +284,7 @@ func decodeBcryptHash(encodedHash string) (hash []byte, err error) {
 	return hash, nil
 }
 
-func generateArgon2idHash(password string) (encodedHash string, err error) {
+func generateArgon2idHash(ctx context.Context, password string) (encodedHash string, err error) {
 	params, err := configureArgon2id()
 	if err != nil {
 		log.Fatalf("Argon2id memory misconfigured: %v\n", err)
@@ -180,7 +297,13 @@ func generateArgon2idHash(password string) (encodedHash string, err error) {
 		return "", err
 	}
 
+	release, err := admitArgon2id(ctx, params)
+	if err != nil {
+		return "", err
+	}
+
 	// This will generate a hash of the password using the Argon2id variant.
+	var start time.Time = time.Now()
 	var hash []byte = argon2.IDKey(
 		[]byte(password),
 		salt,
@@ -189,6 +312,8 @@ func generateArgon2idHash(password string) (encodedHash string, err error) {
 		params.parallelism,
 		params.keyLength,
 	)
+	recordHash("argon2id", OpGenerate, start)
+	release()
 
 	b64Salt := base64.RawStdEncoding.EncodeToString(salt)
 	b64Hash := base64.RawStdEncoding.EncodeToString(hash)
@@ -206,31 +331,52 @@ func generateArgon2idHash(password string) (encodedHash string, err error) {
 	return encodedHash, nil
 }
 
-func generateBcryptHash(password string) (encodedHash string, err error) {
+func generateBcryptHash(_ context.Context, password string) (encodedHash string, err error) {
 	cost, err := configureBcrypt()
 	if err != nil {
 		log.Fatalf("Bcrypt memory misconfigured: %v\n", err)
 	}
 
+	prehash, err := configureBcryptPrehash()
+	if err != nil {
+		return "", err
+	}
+	var params string = fmt.Sprintf("c=%d", cost)
+	if prehash {
+		password = prehashPassword(password)
+		params += "," + bcryptPrehashParam
+	}
+
+	var start time.Time = time.Now()
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	recordHash("bcrypt", OpGenerate, start)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", ErrPasswordTooLong
+	}
 	if err != nil {
 		slog.Error("Problem generating hash.", "err", err)
 		log.Fatal(err)
 	}
 
 	b64Hash := base64.RawStdEncoding.EncodeToString(hash)
-	encodedHash = fmt.Sprintf("$bcrypt$c=%d$%s", cost, b64Hash)
+	encodedHash = fmt.Sprintf("$bcrypt$%s$%s", params, b64Hash)
 
 	return encodedHash, nil
 }
 
-func verifyArgon2idHash(password, encodedHash string) (match bool, err error) {
+func verifyArgon2idHash(ctx context.Context, password, encodedHash string) (match bool, err error) {
 	params, salt, hash, err := decodeArgon2idHash(encodedHash)
 	if err != nil {
-		log.Fatal(err)
+		return false, err
+	}
+
+	release, err := admitArgon2id(ctx, params)
+	if err != nil {
+		return false, err
 	}
 
 	// Derive the key from the other password using the same parameters.
+	var start time.Time = time.Now()
 	var verification []byte = argon2.IDKey(
 		[]byte(password),
 		salt,
@@ -239,6 +385,8 @@ func verifyArgon2idHash(password, encodedHash string) (match bool, err error) {
 		params.parallelism,
 		params.keyLength,
 	)
+	recordHash("argon2id", OpVerify, start)
+	release()
 
 	// Check that the contents of the hashed passwords are identical.
 	// Note that we are using the subtle.ConstantTimeCompare() function for this
@@ -250,13 +398,18 @@ func verifyArgon2idHash(password, encodedHash string) (match bool, err error) {
 	return false, errors.New("invalid password")
 }
 
-func verifyBcryptHash(password, encodedHash string) (match bool, err error) {
+func verifyBcryptHash(_ context.Context, password, encodedHash string) (match bool, err error) {
 	hash, err := decodeBcryptHash(encodedHash)
 	if err != nil {
 		slog.Error("Problems decoding base64 encoded bcrypt string.", "err", err)
 	}
+	if bcryptPrehashed(encodedHash) {
+		password = prehashPassword(password)
+	}
 
+	var start time.Time = time.Now()
 	err = bcrypt.CompareHashAndPassword(hash, []byte(password))
+	recordHash("bcrypt", OpVerify, start)
 	if err != nil {
 		slog.Error("Invalid password.", "err", err)
 		return false, err
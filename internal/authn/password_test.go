@@ -1,6 +1,11 @@
 package authn_test
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/ehubscher/goidp/internal/authn"
@@ -16,9 +21,97 @@ var passwords = []struct {
 
 func TestVerifyPassword(t *testing.T) {
 	for _, password := range passwords {
-		match, err := authn.VerifyPassword(password.in[0], password.in[1])
+		match, err := authn.VerifyPassword(context.Background(), password.in[0], password.in[1])
 		if err != nil {
 			t.Errorf("got: %v, want: %v", match, password.out)
 		}
 	}
 }
+
+func argon2idHash(saltLength, keyLength int) string {
+	salt := base64.RawStdEncoding.EncodeToString(make([]byte, saltLength))
+	key := base64.RawStdEncoding.EncodeToString(make([]byte, keyLength))
+	return fmt.Sprintf("$argon2id$v=19,m=65536,t=6,p=2$%s$%s", salt, key)
+}
+
+var decodeLengths = []struct {
+	saltLength, keyLength int
+	err                   error
+}{
+	{4, 32, authn.ErrSaltLength},
+	{65, 32, authn.ErrSaltLength},
+	{16, 8, authn.ErrKeyLength},
+	{16, 1024, authn.ErrKeyLength},
+}
+
+func TestVerifyPasswordLengthBounds(t *testing.T) {
+	for _, l := range decodeLengths {
+		match, err := authn.VerifyPassword(context.Background(), "password123", argon2idHash(l.saltLength, l.keyLength))
+		if match || !errors.Is(err, l.err) {
+			t.Errorf("salt %d key %d got: %v, %v, want: false, %v", l.saltLength, l.keyLength, match, err, l.err)
+		}
+	}
+}
+
+func TestVerifyPasswordArgon2Version(t *testing.T) {
+	hash := strings.Replace(argon2idHash(16, 32), "v=19", "v=16", 1)
+
+	match, err := authn.VerifyPassword(context.Background(), "password123", hash)
+	var versionErr *authn.Argon2VersionError
+	if match || !errors.As(err, &versionErr) || versionErr.Version != 16 {
+		t.Errorf("got: %v, %v, want: false, version 16 error", match, err)
+	}
+	if !errors.Is(err, authn.ErrArgon2Version) {
+		t.Errorf("got: %v, want: %v", err, authn.ErrArgon2Version)
+	}
+
+	_, err = authn.DescribeHash(hash)
+	if !errors.Is(err, authn.ErrArgon2Version) {
+		t.Errorf("got: %v, want: %v", err, authn.ErrArgon2Version)
+	}
+}
+
+func TestVerifyPasswordUnknownAlgorithm(t *testing.T) {
+	match, err := authn.VerifyPassword(context.Background(), "password123", "$scrypt$ln=15$c2FsdA$aGFzaA")
+	if match || !errors.Is(err, authn.ErrUnknownHash) {
+		t.Errorf("got: %v, %v, want: false, %v", match, err, authn.ErrUnknownHash)
+	}
+}
+
+func TestBcryptPrehash(t *testing.T) {
+	t.Setenv("BCRYPT_COST", "4")
+	var long string = strings.Repeat("correct horse battery staple ", 3)
+	if len(long) <= 72 {
+		t.Fatalf("test passphrase is only %d bytes", len(long))
+	}
+
+	_, err := authn.GenerateHash(context.Background(), "bcrypt", long)
+	if !errors.Is(err, authn.ErrPasswordTooLong) {
+		t.Errorf("without pre-hashing got: %v, want: %v", err, authn.ErrPasswordTooLong)
+	}
+
+	t.Setenv("BCRYPT_PREHASH", "true")
+	hash, err := authn.GenerateHash(context.Background(), "bcrypt", long+"1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(hash, "c=4,prehash=sha256$") {
+		t.Errorf("got: %s, want: pre-hashing recorded", hash)
+	}
+	if match, err := authn.VerifyPassword(context.Background(), long+"1", hash); !match {
+		t.Errorf("got: %v, want: the password to verify", err)
+	}
+	if match, _ := authn.VerifyPassword(context.Background(), long+"2", hash); match {
+		t.Error("got: a match for a password differing past byte 72, want: none")
+	}
+
+	// Hashes record whether they were pre-hashed, so both kinds keep
+	// verifying whichever way the setting is.
+	t.Setenv("BCRYPT_PREHASH", "false")
+	if match, err := authn.VerifyPassword(context.Background(), long+"1", hash); !match {
+		t.Errorf("got: %v, want: the pre-hashed hash to verify", err)
+	}
+	if match, err := authn.VerifyPassword(context.Background(), "password123", passwords[1].in[1]); !match {
+		t.Errorf("got: %v, want: a plain bcrypt hash to verify", err)
+	}
+}
@@ -0,0 +1,116 @@
+package authn
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ehubscher/goidp/internal/secrets"
+)
+
+var ErrUnknownPepper = errors.New("hash was created with an unknown pepper")
+
+type pepper struct {
+	id     string
+	secret []byte
+}
+
+// configurePeppers reads the current pepper from the PEPPER secret and the
+// peppers still accepted for verification from PREVIOUS_PEPPERS, both as
+// id:secret with the previous ones comma separated. No PEPPER means new hashes
+// aren't peppered.
+func configurePeppers() (current pepper, peppers map[string][]byte, err error) {
+	peppers = make(map[string][]byte)
+
+	previous, err := lookupSecret("PREVIOUS_PEPPERS")
+	if err != nil {
+		return pepper{}, nil, err
+	}
+	for _, v := range strings.Split(previous, ",") {
+		if v == "" {
+			continue
+		}
+		p, err := parsePepper(v)
+		if err != nil {
+			return pepper{}, nil, fmt.Errorf("previous peppers misconfigured: %w", err)
+		}
+		peppers[p.id] = p.secret
+	}
+
+	v, err := lookupSecret("PEPPER")
+	if err != nil {
+		return pepper{}, nil, err
+	}
+	if v != "" {
+		current, err = parsePepper(v)
+		if err != nil {
+			return pepper{}, nil, fmt.Errorf("pepper misconfigured: %w", err)
+		}
+		peppers[current.id] = current.secret
+	}
+
+	return current, peppers, nil
+}
+
+// lookupSecret returns the named secret, or "" when it isn't configured.
+func lookupSecret(name string) (string, error) {
+	v, err := secrets.Get(name)
+	if errors.Is(err, secrets.ErrNotFound) {
+		return "", nil
+	}
+
+	return v, err
+}
+
+func parsePepper(v string) (p pepper, err error) {
+	id, secret, ok := strings.Cut(v, ":")
+	if !ok || id == "" || secret == "" {
+		return pepper{}, errors.New("expected id:secret")
+	}
+	if strings.ContainsAny(id, "$,=") {
+		return pepper{}, fmt.Errorf("pepper id %q contains a reserved character", id)
+	}
+
+	return pepper{id: id, secret: []byte(secret)}, nil
+}
+
+// applyPepper keys the password with the pepper before it is hashed. The
+// base64 HMAC is 43 bytes so it also stays inside bcrypt's 72 byte limit.
+func applyPepper(secret []byte, password string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(password))
+
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// withPepperID records the pepper id as the last entry of the encoded hash's
+// parameter segment, e.g. $argon2id$v=19,m=65536,t=3,p=2,pepper=v2$...
+func withPepperID(encodedHash, id string) string {
+	var vals []string = strings.Split(encodedHash, "$")
+	if len(vals) < 3 {
+		return encodedHash
+	}
+	vals[2] += ",pepper=" + id
+
+	return strings.Join(vals, "$")
+}
+
+// splitPepperID removes the pepper id from an encoded hash, returning the hash
+// as the algorithm-specific decoders expect it.
+func splitPepperID(encodedHash string) (stripped, id string) {
+	var vals []string = strings.Split(encodedHash, "$")
+	if len(vals) < 3 {
+		return encodedHash, ""
+	}
+
+	params, id, ok := strings.Cut(vals[2], ",pepper=")
+	if !ok {
+		return encodedHash, ""
+	}
+	vals[2] = params
+
+	return strings.Join(vals, "$"), id
+}
@@ -0,0 +1,61 @@
+package authn_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/authn"
+)
+
+func TestPepperRotation(t *testing.T) {
+	setHashEnv(t, "19456", "2", "4")
+	for _, algo := range []string{"argon2id", "bcrypt"} {
+		t.Setenv("PEPPER", "v1:old-secret")
+		t.Setenv("PREVIOUS_PEPPERS", "")
+		oldHash, err := authn.GenerateHash(context.Background(), algo, "password123")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Setenv("PEPPER", "v2:new-secret")
+		t.Setenv("PREVIOUS_PEPPERS", "v1:old-secret")
+		newHash, err := authn.GenerateHash(context.Background(), algo, "password123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(newHash, ",pepper=v2$") {
+			t.Errorf("%s got: %s, want: a hash recording pepper v2", algo, newHash)
+		}
+
+		for _, hash := range []string{oldHash, newHash} {
+			match, err := authn.VerifyPassword(context.Background(), "password123", hash)
+			if !match || err != nil {
+				t.Errorf("%s got: %v, %v, want: true, nil", algo, match, err)
+			}
+			match, _ = authn.VerifyPassword(context.Background(), "password124", hash)
+			if match {
+				t.Errorf("%s got: %v, want: false for the wrong password", algo, match)
+			}
+		}
+
+		// Once v1 is retired its hashes can no longer be verified.
+		t.Setenv("PREVIOUS_PEPPERS", "")
+		_, err = authn.VerifyPassword(context.Background(), "password123", oldHash)
+		if !errors.Is(err, authn.ErrUnknownPepper) {
+			t.Errorf("%s got: %v, want: %v", algo, err, authn.ErrUnknownPepper)
+		}
+	}
+}
+
+func TestUnpepperedHashStillVerifies(t *testing.T) {
+	t.Setenv("PEPPER", "v2:new-secret")
+
+	for _, password := range passwords {
+		match, err := authn.VerifyPassword(context.Background(), password.in[0], password.in[1])
+		if match != password.out || err != nil {
+			t.Errorf("got: %v, %v, want: %v, nil", match, err, password.out)
+		}
+	}
+}
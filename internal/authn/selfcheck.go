@@ -0,0 +1,101 @@
+package authn
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Minimums taken from the OWASP Password Storage Cheat Sheet.
+const (
+	minArgon2idMemory      = 19 * 1024 // KiB
+	minArgon2idIterations  = 2
+	minArgon2idParallelism = 1
+	minArgon2idSaltLength  = 16
+	minArgon2idKeyLength   = 32
+	minBcryptCost          = 10
+)
+
+var ErrWeakParams = errors.New("hashing parameters below recommended minimums")
+
+// Weakness describes a single configured parameter that falls below its
+// recommended minimum.
+type Weakness struct {
+	Algorithm string
+	EnvVar    string
+	Value     int
+	Minimum   int
+}
+
+func (w Weakness) String() string {
+	return fmt.Sprintf("%s: %s=%d is below the recommended minimum of %d", w.Algorithm, w.EnvVar, w.Value, w.Minimum)
+}
+
+// SelfCheck evaluates the configured KDF parameters against the recommended
+// minimums and logs a warning for each one that falls short. In strict mode
+// any weakness is returned as an error so the caller can refuse to start.
+func SelfCheck(strict bool) (weaknesses []Weakness, err error) {
+	params, err := configureArgon2id()
+	if err != nil {
+		return nil, err
+	}
+	weaknesses = append(weaknesses, checkArgon2idParams(params)...)
+
+	cost, err := configureBcrypt()
+	if err != nil {
+		return nil, err
+	}
+	weaknesses = append(weaknesses, checkBcryptCost(cost)...)
+
+	for _, w := range weaknesses {
+		slog.Warn(
+			"Weak password hashing parameter configured.",
+			"algo", w.Algorithm,
+			"env", w.EnvVar,
+			"value", w.Value,
+			"minimum", w.Minimum,
+			"fix", fmt.Sprintf("Set %s to at least %d.", w.EnvVar, w.Minimum),
+		)
+	}
+
+	if strict && len(weaknesses) > 0 {
+		var msgs []string
+		for _, w := range weaknesses {
+			msgs = append(msgs, w.String())
+		}
+		return weaknesses, fmt.Errorf("%w: %s", ErrWeakParams, strings.Join(msgs, "; "))
+	}
+
+	return weaknesses, nil
+}
+
+func checkArgon2idParams(params argon2Params) (weaknesses []Weakness) {
+	var checks = []struct {
+		env     string
+		value   int
+		minimum int
+	}{
+		{"ARGON2ID_MEMORY", int(params.memory), minArgon2idMemory},
+		{"ARGON2ID_ITERATIONS", int(params.iterations), minArgon2idIterations},
+		{"ARGON2ID_PARALLELISM", int(params.parallelism), minArgon2idParallelism},
+		{"ARGON2ID_SALT_LENGTH", int(params.saltLength), minArgon2idSaltLength},
+		{"ARGON2ID_KEY_LENGTH", int(params.keyLength), minArgon2idKeyLength},
+	}
+
+	for _, c := range checks {
+		if c.value < c.minimum {
+			weaknesses = append(weaknesses, Weakness{"argon2id", c.env, c.value, c.minimum})
+		}
+	}
+
+	return weaknesses
+}
+
+func checkBcryptCost(cost int) (weaknesses []Weakness) {
+	if cost < minBcryptCost {
+		weaknesses = append(weaknesses, Weakness{"bcrypt", "BCRYPT_COST", cost, minBcryptCost})
+	}
+
+	return weaknesses
+}
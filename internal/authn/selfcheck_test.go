@@ -0,0 +1,55 @@
+package authn_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/authn"
+)
+
+func setHashEnv(t *testing.T, memory, iterations, bcryptCost string) {
+	t.Setenv("ARGON2ID_MEMORY", memory)
+	t.Setenv("ARGON2ID_ITERATIONS", iterations)
+	t.Setenv("ARGON2ID_PARALLELISM", "2")
+	t.Setenv("ARGON2ID_SALT_LENGTH", "16")
+	t.Setenv("ARGON2ID_KEY_LENGTH", "32")
+	t.Setenv("BCRYPT_COST", bcryptCost)
+}
+
+var selfChecks = []struct {
+	memory, iterations, bcryptCost string
+	weaknesses                     int
+}{
+	{"65536", "3", "12", 0},
+	{"19456", "2", "10", 0},
+	{"4096", "3", "12", 1},
+	{"4096", "1", "4", 3},
+}
+
+func TestSelfCheck(t *testing.T) {
+	for _, c := range selfChecks {
+		setHashEnv(t, c.memory, c.iterations, c.bcryptCost)
+
+		weaknesses, err := authn.SelfCheck(false)
+		if err != nil {
+			t.Errorf("got: %v, want: nil", err)
+		}
+		if len(weaknesses) != c.weaknesses {
+			t.Errorf("got: %d weaknesses, want: %d", len(weaknesses), c.weaknesses)
+		}
+	}
+}
+
+func TestSelfCheckStrict(t *testing.T) {
+	for _, c := range selfChecks {
+		setHashEnv(t, c.memory, c.iterations, c.bcryptCost)
+
+		_, err := authn.SelfCheck(true)
+		if c.weaknesses > 0 && !errors.Is(err, authn.ErrWeakParams) {
+			t.Errorf("got: %v, want: %v", err, authn.ErrWeakParams)
+		}
+		if c.weaknesses == 0 && err != nil {
+			t.Errorf("got: %v, want: nil", err)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package authn
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MaxStrengthScore is the best score a password can get.
+const MaxStrengthScore = 4
+
+// Strength is an estimate of how hard a password is to guess.
+type Strength struct {
+	// Score runs from 0, guessable in a handful of tries, to
+	// MaxStrengthScore, out of reach even offline, as zxcvbn scores do.
+	Score int
+	// Feedback holds suggestions for a stronger password, each a sentence.
+	Feedback []string
+}
+
+// StrengthEstimator estimates password strength. userInputs are strings
+// such as the email address, which a password made from is easy to guess.
+// Implementations can wrap a zxcvbn port or anything else.
+type StrengthEstimator interface {
+	Estimate(password string, userInputs ...string) Strength
+}
+
+// StrengthPolicy refuses new passwords scoring below MinScore. The zero
+// value refuses nothing.
+type StrengthPolicy struct {
+	Estimator StrengthEstimator
+	MinScore  int
+}
+
+// ConfigureStrengthPolicy reads PASSWORD_MIN_SCORE, 0 to 4, which defaults
+// to 0. Any other value uses the EntropyEstimator.
+func ConfigureStrengthPolicy() (StrengthPolicy, error) {
+	raw := os.Getenv("PASSWORD_MIN_SCORE")
+	if raw == "" {
+		return StrengthPolicy{}, nil
+	}
+
+	score, err := strconv.Atoi(raw)
+	if err != nil || score < 0 || score > MaxStrengthScore {
+		return StrengthPolicy{}, fmt.Errorf("PASSWORD_MIN_SCORE misconfigured: %q is not 0 to %d", raw, MaxStrengthScore)
+	}
+	if score == 0 {
+		return StrengthPolicy{}, nil
+	}
+
+	return StrengthPolicy{Estimator: EntropyEstimator{}, MinScore: score}, nil
+}
+
+// Check returns the feedback for a password scoring below MinScore, or nil
+// if it is strong enough.
+func (p StrengthPolicy) Check(password string, userInputs ...string) (feedback []string, ok bool) {
+	if p.Estimator == nil || p.MinScore <= 0 {
+		return nil, true
+	}
+
+	strength := p.Estimator.Estimate(password, userInputs...)
+	if strength.Score >= p.MinScore {
+		return nil, true
+	}
+
+	return strength.Feedback, false
+}
+
+// commonPasswords are the passwords and words guessed first. Matching is
+// on lowercase substrings, so "Password1" counts too.
+var commonPasswords = []string{
+	"password", "passwort", "qwerty", "azerty", "letmein", "welcome",
+	"iloveyou", "admin", "login", "monkey", "dragon", "master", "secret",
+	"sunshine", "princess", "football", "baseball", "shadow", "superman",
+	"trustno1", "starwars", "whatever", "hello", "freedom", "summer",
+	"winter", "changeme", "123456", "654321", "111111", "000000",
+}
+
+// EntropyEstimator is a dependency-free stand-in for zxcvbn. It credits
+// each character with the entropy of the character classes used, except
+// that common passwords, runs, sequences and user inputs are credited as
+// a single guess from a short list.
+type EntropyEstimator struct{}
+
+// Score thresholds in bits. Uniform guessing overrates real passwords, so
+// these are well above zxcvbn's guess counts.
+var strengthBits = [MaxStrengthScore]float64{28, 40, 56, 72}
+
+func (EntropyEstimator) Estimate(password string, userInputs ...string) Strength {
+	original := []rune(password)
+	runes := make([]rune, len(original))
+	for i, r := range original {
+		runes[i] = unicode.ToLower(r)
+	}
+	covered := make([]bool, len(runes))
+
+	var bits float64
+	var feedback []string
+	cover := func(from, to int) {
+		for i := from; i < to; i++ {
+			covered[i] = true
+		}
+		bits += 4
+	}
+
+	var inputs []string
+	for _, in := range userInputs {
+		local, _, _ := strings.Cut(strings.ToLower(in), "@")
+		if len([]rune(local)) >= 3 {
+			inputs = append(inputs, local)
+		}
+	}
+	if coverWords(runes, inputs, cover) {
+		feedback = append(feedback, "Don't build it from your email address or name.")
+	}
+	if coverWords(runes, commonPasswords, cover) {
+		feedback = append(feedback, "Avoid common passwords and words.")
+	}
+	if coverPatterns(runes, covered, cover, func(a, b rune) bool { return a == b }) {
+		feedback = append(feedback, `Avoid repeated characters like "aaa".`)
+	}
+	if coverPatterns(runes, covered, cover, func(a, b rune) bool { return b == a+1 || b == a-1 }) {
+		feedback = append(feedback, `Avoid sequences like "abc" or "123".`)
+	}
+
+	var rest []rune
+	for i, r := range original {
+		if !covered[i] {
+			rest = append(rest, r)
+		}
+	}
+	bits += float64(len(rest)) * math.Log2(float64(charsetSize(rest)))
+
+	var score int
+	for score < MaxStrengthScore && bits >= strengthBits[score] {
+		score++
+	}
+	if score < MaxStrengthScore {
+		feedback = append(feedback, "Add more words; a few uncommon words together are easy to remember and hard to guess.")
+	}
+
+	return Strength{Score: score, Feedback: feedback}
+}
+
+// coverWords covers every occurrence of words in runes, reporting whether
+// there were any.
+func coverWords(runes []rune, words []string, cover func(from, to int)) bool {
+	var found bool
+	for _, w := range words {
+		word := []rune(w)
+		for i := 0; i+len(word) <= len(runes); i++ {
+			if string(runes[i:i+len(word)]) == w {
+				cover(i, i+len(word))
+				found = true
+				i += len(word) - 1
+			}
+		}
+	}
+
+	return found
+}
+
+// coverPatterns covers runs of three or more uncovered characters in which
+// each follows from the one before, reporting whether there were any.
+func coverPatterns(runes []rune, covered []bool, cover func(from, to int), follows func(a, b rune) bool) bool {
+	var found bool
+	for start := 0; start < len(runes); {
+		end := start + 1
+		for end < len(runes) && !covered[end] && !covered[end-1] && follows(runes[end-1], runes[end]) {
+			end++
+		}
+		if end-start >= 3 {
+			cover(start, end)
+			found = true
+		}
+		start = end
+	}
+
+	return found
+}
+
+func charsetSize(runes []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	var size int
+	for _, c := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if c.used {
+			size += c.size
+		}
+	}
+
+	return max(size, 1)
+}
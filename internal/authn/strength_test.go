@@ -0,0 +1,81 @@
+package authn_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/authn"
+)
+
+func TestEntropyEstimator(t *testing.T) {
+	var passwords = []struct {
+		password string
+		weak     bool
+	}{
+		{"Password1!", true},
+		{"abcdefgh123", true},
+		{"zzzzzzzzzzzz", true},
+		{"jane.doe1990", true},
+		{"correct horse battery staple", false},
+		{"plum-ferry-lantern-oboe", false},
+	}
+
+	policy := authn.StrengthPolicy{Estimator: authn.EntropyEstimator{}, MinScore: 3}
+	for _, c := range passwords {
+		feedback, ok := policy.Check(c.password, "jane.doe@example.com")
+		if ok == c.weak {
+			t.Errorf("%q got: ok %t, want: %t", c.password, ok, !c.weak)
+		}
+		if c.weak && len(feedback) == 0 {
+			t.Errorf("%q got: no feedback, want: some", c.password)
+		}
+	}
+}
+
+func TestEntropyEstimatorFeedback(t *testing.T) {
+	strength := authn.EntropyEstimator{}.Estimate("jane.doe1234", "Jane.Doe@example.com")
+	for _, want := range []string{"Don't build it from your email address or name.", `Avoid sequences like "abc" or "123".`} {
+		if !slices.Contains(strength.Feedback, want) {
+			t.Errorf("got: %q, want: %q among them", strength.Feedback, want)
+		}
+	}
+}
+
+type fixedEstimator int
+
+func (e fixedEstimator) Estimate(password string, userInputs ...string) authn.Strength {
+	return authn.Strength{Score: int(e), Feedback: []string{"Be longer."}}
+}
+
+func TestStrengthPolicy(t *testing.T) {
+	if _, ok := (authn.StrengthPolicy{}).Check("x"); !ok {
+		t.Error("got: refused, want: the zero policy refusing nothing")
+	}
+
+	policy := authn.StrengthPolicy{Estimator: fixedEstimator(2), MinScore: 3}
+	if feedback, ok := policy.Check("anything"); ok || !slices.Equal(feedback, []string{"Be longer."}) {
+		t.Errorf("got: %t %q, want: refused with the estimator's feedback", ok, feedback)
+	}
+	policy.MinScore = 2
+	if _, ok := policy.Check("anything"); !ok {
+		t.Error("got: refused, want: a password at MinScore accepted")
+	}
+}
+
+func TestConfigureStrengthPolicy(t *testing.T) {
+	t.Setenv("PASSWORD_MIN_SCORE", "3")
+	policy, err := authn.ConfigureStrengthPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.MinScore != 3 || policy.Estimator == nil {
+		t.Errorf("got: %+v, want: MinScore 3 with an estimator", policy)
+	}
+
+	for _, raw := range []string{"5", "-1", "strong"} {
+		t.Setenv("PASSWORD_MIN_SCORE", raw)
+		if _, err := authn.ConfigureStrengthPolicy(); err == nil {
+			t.Errorf("%q got: nil, want: an error", raw)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package authn
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// TOTP parameters. They are the RFC 6238 defaults, which are also the only
+// ones every authenticator app supports.
+const (
+	totpDigits = 6
+	totpStep   = 30 * time.Second
+	// totpSkew is how many steps either side of the current one are
+	// accepted, to allow for clock drift and slow typing.
+	totpSkew = 1
+)
+
+// TOTPCode returns the one-time password for secret at t.
+func TOTPCode(secret []byte, t time.Time) string {
+	return hotp(secret, t.Unix()/int64(totpStep.Seconds()))
+}
+
+// VerifyTOTP checks code against secret at now. Only steps after lastStep
+// match, so a code can't be used twice; the step that matched is returned
+// to be recorded as the new lastStep.
+func VerifyTOTP(secret []byte, code string, now time.Time, lastStep int64) (step int64, ok bool) {
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / int64(totpStep.Seconds())
+	for s := current - totpSkew; s <= current+totpSkew; s++ {
+		if s <= lastStep {
+			continue
+		}
+		if SecretsEqual(code, hotp(secret, s)) {
+			return s, true
+		}
+	}
+
+	return 0, false
+}
+
+// hotp is the HOTP value of RFC 4226 section 5.3 for counter.
+func hotp(secret []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
@@ -0,0 +1,56 @@
+package authn_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/authn"
+)
+
+// The SHA-1 test vectors of RFC 6238 appendix B, truncated to six digits.
+var totpVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+}
+
+func TestTOTPCode(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	for _, v := range totpVectors {
+		if got := authn.TOTPCode(secret, time.Unix(v.unix, 0)); got != v.code {
+			t.Errorf("%d got: %s, want: %s", v.unix, got, v.code)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1234567890, 0)
+	code := authn.TOTPCode(secret, now)
+
+	var compared []string
+	authn.OnCompare = func(presented, expected string) { compared = append(compared, expected) }
+	t.Cleanup(func() { authn.OnCompare = nil })
+
+	step, ok := authn.VerifyTOTP(secret, code, now.Add(30*time.Second), 0)
+	if !ok {
+		t.Fatal("got: rejected, want: a code one step old accepted")
+	}
+	if !slices.Contains(compared, code) {
+		t.Errorf("got: %v, want: the code compared with SecretsEqual", compared)
+	}
+	if _, ok := authn.VerifyTOTP(secret, code, now, step); ok {
+		t.Error("got: accepted, want: a used code rejected")
+	}
+	if _, ok := authn.VerifyTOTP(secret, code, now.Add(2*time.Minute), 0); ok {
+		t.Error("got: accepted, want: an old code rejected")
+	}
+	if _, ok := authn.VerifyTOTP(secret, "000000", now, 0); ok {
+		t.Error("got: accepted, want: a wrong code rejected")
+	}
+}
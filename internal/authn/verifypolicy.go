@@ -0,0 +1,136 @@
+package authn
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrRehashRequired means a stored hash uses an algorithm or parameters the
+// verify policy no longer accepts. The password isn't checked, so the user
+// has to set a new one, e.g. through a reset.
+var ErrRehashRequired = errors.New("hash below verification policy, rehash required")
+
+// VerifyPolicy is the floor a stored hash must meet for VerifyPassword to
+// check it at all. It is separate from the parameters used for new hashes so
+// that weak hashes already stored can be disabled. The zero value accepts
+// every supported hash.
+type VerifyPolicy struct {
+	// Algorithms allowed for verification. Empty means all supported ones.
+	Algorithms []string
+
+	MinBcryptCost         int
+	MinArgon2idMemory     uint32
+	MinArgon2idIterations uint32
+}
+
+var verifyPolicy atomic.Pointer[VerifyPolicy]
+
+// SetVerifyPolicy replaces the policy VerifyPassword enforces. It is safe to
+// call while passwords are being verified.
+func SetVerifyPolicy(policy VerifyPolicy) {
+	verifyPolicy.Store(&policy)
+}
+
+func currentVerifyPolicy() VerifyPolicy {
+	if policy := verifyPolicy.Load(); policy != nil {
+		return *policy
+	}
+
+	return VerifyPolicy{}
+}
+
+// ConfigureVerifyPolicy reads VERIFY_ALGORITHMS (comma-separated),
+// VERIFY_MIN_BCRYPT_COST, VERIFY_MIN_ARGON2ID_MEMORY and
+// VERIFY_MIN_ARGON2ID_ITERATIONS. Unset values impose no floor.
+func ConfigureVerifyPolicy() (policy VerifyPolicy, err error) {
+	if v := os.Getenv("VERIFY_ALGORITHMS"); v != "" {
+		for _, algo := range strings.Split(v, ",") {
+			algo = strings.TrimSpace(algo)
+			if _, ok := verifyFuncs[algo]; !ok {
+				return VerifyPolicy{}, fmt.Errorf("VERIFY_ALGORITHMS misconfigured: %s is not supported", algo)
+			}
+			policy.Algorithms = append(policy.Algorithms, algo)
+		}
+	}
+
+	var mins = []struct {
+		env string
+		set func(n int)
+	}{
+		{"VERIFY_MIN_BCRYPT_COST", func(n int) { policy.MinBcryptCost = n }},
+		{"VERIFY_MIN_ARGON2ID_MEMORY", func(n int) { policy.MinArgon2idMemory = uint32(n) }},
+		{"VERIFY_MIN_ARGON2ID_ITERATIONS", func(n int) { policy.MinArgon2idIterations = uint32(n) }},
+	}
+	for _, m := range mins {
+		v := os.Getenv(m.env)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return VerifyPolicy{}, fmt.Errorf("%s misconfigured: %q", m.env, v)
+		}
+		m.set(n)
+	}
+
+	return policy, nil
+}
+
+// Check returns ErrRehashRequired if encodedHash, without any pepper id,
+// falls below the policy.
+func (policy VerifyPolicy) Check(encodedHash string) error {
+	var vals []string = strings.Split(encodedHash, "$")
+	if len(vals) < 3 {
+		return nil
+	}
+
+	var algo string = vals[1]
+	if len(policy.Algorithms) > 0 && !slices.Contains(policy.Algorithms, algo) {
+		return fmt.Errorf("%w: %s is not allowed", ErrRehashRequired, algo)
+	}
+
+	switch algo {
+	case "bcrypt":
+		if policy.MinBcryptCost == 0 {
+			return nil
+		}
+		hash, err := decodeBcryptHash(encodedHash)
+		if err != nil {
+			return err
+		}
+		cost, err := bcrypt.Cost(hash)
+		if err != nil {
+			return err
+		}
+		if cost < policy.MinBcryptCost {
+			return fmt.Errorf("%w: bcrypt cost %d below %d", ErrRehashRequired, cost, policy.MinBcryptCost)
+		}
+	case "argon2id":
+		if policy.MinArgon2idMemory == 0 && policy.MinArgon2idIterations == 0 {
+			return nil
+		}
+		params, _, _, err := decodeArgon2idHash(encodedHash)
+		if err != nil {
+			return err
+		}
+		if params.memory < policy.MinArgon2idMemory || params.iterations < policy.MinArgon2idIterations {
+			return fmt.Errorf(
+				"%w: argon2id m=%d,t=%d below m=%d,t=%d",
+				ErrRehashRequired,
+				params.memory,
+				params.iterations,
+				policy.MinArgon2idMemory,
+				policy.MinArgon2idIterations,
+			)
+		}
+	}
+
+	return nil
+}
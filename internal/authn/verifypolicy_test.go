@@ -0,0 +1,77 @@
+package authn_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/authn"
+)
+
+func setVerifyPolicy(t *testing.T, policy authn.VerifyPolicy) {
+	authn.SetVerifyPolicy(policy)
+	t.Cleanup(func() { authn.SetVerifyPolicy(authn.VerifyPolicy{}) })
+}
+
+func TestVerifyPolicyBcryptFloor(t *testing.T) {
+	t.Setenv("BCRYPT_COST", "10")
+	aboveFloor, err := authn.GenerateHash(context.Background(), "bcrypt", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setVerifyPolicy(t, authn.VerifyPolicy{MinBcryptCost: 10})
+
+	// passwords[1] is a cost 4 bcrypt hash.
+	match, err := authn.VerifyPassword(context.Background(), "password123", passwords[1].in[1])
+	if match || !errors.Is(err, authn.ErrRehashRequired) {
+		t.Errorf("got: %v, %v, want: false, %v", match, err, authn.ErrRehashRequired)
+	}
+
+	match, err = authn.VerifyPassword(context.Background(), "password123", aboveFloor)
+	if !match || err != nil {
+		t.Errorf("got: %v, %v, want: true, nil", match, err)
+	}
+}
+
+func TestVerifyPolicyAlgorithms(t *testing.T) {
+	setVerifyPolicy(t, authn.VerifyPolicy{Algorithms: []string{"argon2id"}})
+
+	_, err := authn.VerifyPassword(context.Background(), "password123", passwords[1].in[1])
+	if !errors.Is(err, authn.ErrRehashRequired) {
+		t.Errorf("got: %v, want: %v", err, authn.ErrRehashRequired)
+	}
+
+	match, err := authn.VerifyPassword(context.Background(), "password123", passwords[0].in[1])
+	if !match || err != nil {
+		t.Errorf("got: %v, %v, want: true, nil", match, err)
+	}
+}
+
+func TestVerifyPolicyArgon2idFloor(t *testing.T) {
+	// passwords[0] uses m=65536,t=6.
+	setVerifyPolicy(t, authn.VerifyPolicy{MinArgon2idMemory: 65536, MinArgon2idIterations: 8})
+
+	_, err := authn.VerifyPassword(context.Background(), "password123", passwords[0].in[1])
+	if !errors.Is(err, authn.ErrRehashRequired) {
+		t.Errorf("got: %v, want: %v", err, authn.ErrRehashRequired)
+	}
+}
+
+func TestConfigureVerifyPolicy(t *testing.T) {
+	t.Setenv("VERIFY_ALGORITHMS", "argon2id, bcrypt")
+	t.Setenv("VERIFY_MIN_BCRYPT_COST", "12")
+
+	policy, err := authn.ConfigureVerifyPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policy.Algorithms) != 2 || policy.MinBcryptCost != 12 {
+		t.Errorf("got: %+v, want: both algorithms and cost 12", policy)
+	}
+
+	t.Setenv("VERIFY_ALGORITHMS", "md5")
+	_, err = authn.ConfigureVerifyPolicy()
+	if err == nil {
+		t.Errorf("got: nil, want: an error for an unsupported algorithm")
+	}
+}
@@ -0,0 +1,78 @@
+package authn
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+const defaultWarmupBudget = 2 * time.Second
+
+// Warmup runs one throwaway argon2id hash at startup, with the configured
+// parameters, so the first login doesn't pay for growing the heap to the
+// KDF's memory cost. The zero value is disabled.
+type Warmup struct {
+	Enabled bool
+	// Budget is how long Run waits for the hash. Zero means 2 seconds.
+	Budget time.Duration
+}
+
+// ConfigureWarmup reads KDF_WARMUP, which defaults to false, and
+// KDF_WARMUP_BUDGET.
+func ConfigureWarmup() (w Warmup, err error) {
+	if v := os.Getenv("KDF_WARMUP"); v != "" {
+		w.Enabled, err = strconv.ParseBool(v)
+		if err != nil {
+			return Warmup{}, fmt.Errorf("KDF_WARMUP misconfigured: %w", err)
+		}
+	}
+
+	if v := os.Getenv("KDF_WARMUP_BUDGET"); v != "" {
+		w.Budget, err = time.ParseDuration(v)
+		if err != nil || w.Budget < 0 {
+			return Warmup{}, fmt.Errorf("KDF_WARMUP_BUDGET misconfigured: %q", v)
+		}
+	}
+
+	return w, nil
+}
+
+func (w Warmup) budget() time.Duration {
+	if w.Budget > 0 {
+		return w.Budget
+	}
+
+	return defaultWarmupBudget
+}
+
+// Run performs the warmup if enabled and reports whether it finished within
+// the budget. A warmup over budget is left to finish in the background
+// rather than hold up readiness.
+func (w Warmup) Run() bool {
+	if !w.Enabled {
+		return false
+	}
+
+	done := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		_, err := GenerateHash(context.Background(), "argon2id", "warmup")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			slog.Warn("KDF warmup failed.", "err", err)
+			return false
+		}
+		slog.Info("KDF warmup done.", "duration", time.Since(start))
+		return true
+	case <-time.After(w.budget()):
+		slog.Warn("KDF warmup over budget, continuing without waiting.", "budget", w.budget())
+		return false
+	}
+}
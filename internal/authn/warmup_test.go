@@ -0,0 +1,65 @@
+package authn_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/authn"
+)
+
+func countArgon2idHashes(t *testing.T) *atomic.Int32 {
+	t.Helper()
+
+	var n atomic.Int32
+	authn.SetHashRecorder(authn.HashRecorderFunc(func(algo, op string, _ time.Duration) {
+		if algo == "argon2id" && op == authn.OpGenerate {
+			n.Add(1)
+		}
+	}))
+	t.Cleanup(func() { authn.SetHashRecorder(nil) })
+
+	return &n
+}
+
+func TestWarmup(t *testing.T) {
+	setHashEnv(t, "4096", "1", "4")
+	n := countArgon2idHashes(t)
+
+	if !(authn.Warmup{Enabled: true}).Run() {
+		t.Errorf("got: false, want: the warmup to finish")
+	}
+	if got := n.Load(); got != 1 {
+		t.Errorf("got: %d hashes, want: 1", got)
+	}
+}
+
+func TestWarmupDisabled(t *testing.T) {
+	setHashEnv(t, "4096", "1", "4")
+	n := countArgon2idHashes(t)
+
+	if (authn.Warmup{}).Run() {
+		t.Errorf("got: true, want: no warmup")
+	}
+	if got := n.Load(); got != 0 {
+		t.Errorf("got: %d hashes, want: 0", got)
+	}
+}
+
+func TestConfigureWarmup(t *testing.T) {
+	t.Setenv("KDF_WARMUP", "true")
+	t.Setenv("KDF_WARMUP_BUDGET", "500ms")
+
+	w, err := authn.ConfigureWarmup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !w.Enabled || w.Budget != 500*time.Millisecond {
+		t.Errorf("got: %+v, want: enabled with a 500ms budget", w)
+	}
+
+	t.Setenv("KDF_WARMUP", "sometimes")
+	if _, err := authn.ConfigureWarmup(); err == nil {
+		t.Errorf("got: nil, want: an error")
+	}
+}
@@ -0,0 +1,122 @@
+// Package clientip finds the address a request really came from when the
+// server sits behind reverse proxies.
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// Proxies are the networks of reverse proxies whose X-Forwarded-For entries
+// are believed. The zero value trusts no proxy.
+type Proxies []netip.Prefix
+
+// Networks is a set of CIDRs, such as the ranges of an office network.
+type Networks []netip.Prefix
+
+// Parse reads a comma-separated list of CIDRs or bare IPs, such as
+// "10.0.0.0/8, 192.0.2.7".
+func Parse(raw string) (Proxies, error) {
+	networks, err := ParseNetworks(raw)
+	return Proxies(networks), err
+}
+
+// ParseNetworks reads the same syntax as Parse.
+func ParseNetworks(raw string) (networks Networks, err error) {
+	for _, v := range strings.Split(raw, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(v)
+			if addrErr != nil {
+				return nil, fmt.Errorf("%q is not a CIDR or IP address", v)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		networks = append(networks, prefix.Masked())
+	}
+
+	return networks, nil
+}
+
+// Configure reads TRUSTED_PROXIES, which defaults to none.
+func Configure() (Proxies, error) {
+	proxies, err := Parse(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return nil, fmt.Errorf("TRUSTED_PROXIES misconfigured: %w", err)
+	}
+
+	return proxies, nil
+}
+
+// Contains reports whether ip, as returned by ClientIP, is in one of the
+// networks. Anything that doesn't parse as an IP is in none.
+func (n Networks) Contains(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && n.contains(addr.Unmap())
+}
+
+func (n Networks) contains(addr netip.Addr) bool {
+	for _, prefix := range n {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p Proxies) trusted(addr netip.Addr) bool {
+	return Networks(p).contains(addr)
+}
+
+// ClientIP returns the IP of the client, without a port. X-Forwarded-For is
+// only consulted when the connection comes from a trusted proxy, and then
+// walked from the right, the entry the nearest proxy appended, until the
+// first address that isn't a trusted proxy. Entries further left were
+// written by whoever sent the request and can say anything. A malformed
+// entry stops the walk at the last address that could be trusted.
+func (p Proxies) ClientIP(r *http.Request) string {
+	var remote string = remoteHost(r.RemoteAddr)
+	addr, err := netip.ParseAddr(remote)
+	if err != nil || !p.trusted(addr.Unmap()) {
+		return remote
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	var client netip.Addr = addr.Unmap()
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(remoteHost(strings.TrimSpace(hops[i])))
+		if err != nil {
+			break
+		}
+		client = hop.Unmap()
+		if !p.trusted(client) {
+			break
+		}
+	}
+
+	return client.String()
+}
+
+// remoteHost strips the port from addr, if it has one.
+func remoteHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return strings.Trim(addr, "[]")
+	}
+
+	return host
+}
@@ -0,0 +1,79 @@
+package clientip_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/clientip"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := clientip.Parse("10.0.0.0/8, 192.0.2.7, ::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests = []struct {
+		name       string
+		proxies    clientip.Proxies
+		remoteAddr string
+		xff        []string
+		want       string
+	}{
+		{"no proxies", nil, "203.0.113.5:1234", nil, "203.0.113.5"},
+		{"spoofed without trusted proxies", nil, "203.0.113.5:1234", []string{"198.51.100.1"}, "203.0.113.5"},
+		{"spoofed from untrusted peer", proxies, "203.0.113.5:1234", []string{"198.51.100.1"}, "203.0.113.5"},
+		{"one trusted proxy", proxies, "10.0.0.2:80", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed entry before the proxy's", proxies, "10.0.0.2:80", []string{"6.6.6.6, 198.51.100.1"}, "198.51.100.1"},
+		{"proxy chain", proxies, "10.0.0.2:80", []string{"198.51.100.1, 192.0.2.7", "10.1.1.1"}, "198.51.100.1"},
+		{"all trusted", proxies, "10.0.0.2:80", []string{"10.0.0.3"}, "10.0.0.3"},
+		{"no header", proxies, "10.0.0.2:80", nil, "10.0.0.2"},
+		{"malformed entry", proxies, "10.0.0.2:80", []string{"198.51.100.1, garbage, 10.0.0.3"}, "10.0.0.3"},
+		{"ipv6 loopback proxy", proxies, "[::1]:80", []string{"2001:db8::1"}, "2001:db8::1"},
+	}
+
+	for _, c := range requests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = c.remoteAddr
+		for _, v := range c.xff {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+
+		if got := c.proxies.ClientIP(r); got != c.want {
+			t.Errorf("%s got: %s, want: %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8,not-an-ip")
+	if _, err := clientip.Configure(); err == nil {
+		t.Error("got: nil, want: an error")
+	}
+
+	t.Setenv("TRUSTED_PROXIES", "")
+	if proxies, err := clientip.Configure(); err != nil || len(proxies) != 0 {
+		t.Errorf("got: %v, %v, want: no proxies", proxies, err)
+	}
+}
+
+func TestNetworksContains(t *testing.T) {
+	networks, err := clientip.ParseNetworks("10.0.0.0/8, 2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for ip, want := range map[string]bool{
+		"10.9.8.7":        true,
+		"::ffff:10.9.8.7": true,
+		"2001:db8::1":     true,
+		"192.0.2.1":       false,
+		"not an ip":       false,
+		"":                false,
+	} {
+		if got := networks.Contains(ip); got != want {
+			t.Errorf("%q got: %t, want: %t", ip, got, want)
+		}
+	}
+}
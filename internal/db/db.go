@@ -0,0 +1,140 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+//go:embed migrations/*.sql migrations/postgres/*.sql
+var migrations embed.FS
+
+func Open(name string) (*sql.DB, error) {
+	// SQLite doesn't enforce foreign keys unless asked to on every connection,
+	// so the pragma goes in the DSN rather than being executed once.
+	var sep string = "?"
+	if strings.Contains(name, "?") {
+		sep = "&"
+	}
+
+	return sql.Open("sqlite", "file:"+name+sep+"_pragma=foreign_keys(1)")
+}
+
+// Migrate applies any embedded SQLite migrations that haven't been applied
+// yet.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	return SQLite.Migrate(ctx, db)
+}
+
+// Migrate applies any of the dialect's embedded migrations that haven't been
+// applied yet. It records versions in the same table goose uses so the two
+// can be mixed. Each dialect has its own migration files, numbered alike.
+func (d Dialect) Migrate(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, d.versionTable())
+	if err != nil {
+		return fmt.Errorf("cannot create migrations table: %w", err)
+	}
+
+	names, err := fs.Glob(migrations, d.migrationGlob())
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		version, err := strconv.ParseInt(strings.SplitN(path.Base(name), "_", 2)[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid migration name %s: %w", name, err)
+		}
+
+		var applied int
+		err = db.QueryRowContext(ctx, d.Rebind(`SELECT COUNT(*) FROM goose_db_version WHERE version_id = ? AND is_applied = ?`), version, true).Scan(&applied)
+		if err != nil {
+			return err
+		}
+		if applied > 0 {
+			continue
+		}
+
+		contents, err := migrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, upStatements(string(contents)))
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %s failed: %w", name, err)
+		}
+		_, err = tx.ExecContext(ctx, d.Rebind(`INSERT INTO goose_db_version(version_id, is_applied) VALUES(?, ?)`), version, true)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d Dialect) versionTable() string {
+	if d == Postgres {
+		return `CREATE TABLE IF NOT EXISTS goose_db_version (
+		id SERIAL PRIMARY KEY,
+		version_id BIGINT NOT NULL,
+		is_applied BOOLEAN NOT NULL,
+		tstamp TIMESTAMP DEFAULT now()
+	)`
+	}
+
+	return `CREATE TABLE IF NOT EXISTS goose_db_version (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		version_id INTEGER NOT NULL,
+		is_applied INTEGER NOT NULL,
+		tstamp TIMESTAMP DEFAULT (datetime('now'))
+	)`
+}
+
+func (d Dialect) migrationGlob() string {
+	if d == Postgres {
+		return "migrations/postgres/*.sql"
+	}
+
+	return "migrations/*.sql"
+}
+
+// upStatements returns the SQL between the goose Up and Down annotations.
+func upStatements(migration string) string {
+	var up strings.Builder
+	var inUp bool
+	for _, line := range strings.Split(migration, "\n") {
+		var trimmed string = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "-- +goose Up"):
+			inUp = true
+		case strings.HasPrefix(trimmed, "-- +goose Down"):
+			inUp = false
+		case strings.HasPrefix(trimmed, "-- +goose"):
+		case inUp:
+			up.WriteString(line)
+			up.WriteString("\n")
+		}
+	}
+
+	return up.String()
+}
@@ -0,0 +1,53 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/db"
+)
+
+func TestMigrate(t *testing.T) {
+	conn, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+
+	// Running twice must be a no-op the second time.
+	for i := 0; i < 2; i++ {
+		err = db.Migrate(context.Background(), conn)
+		if err != nil {
+			t.Fatalf("run %d got: %v, want: nil", i, err)
+		}
+	}
+
+	_, err = conn.Exec(`INSERT INTO users(email, password_hash) VALUES(?,?)`, "example1@email.com", "hash")
+	if err != nil {
+		t.Errorf("got: %v, want: nil", err)
+	}
+	_, err = conn.Exec(`INSERT INTO profiles(user_id, name) VALUES(1, ?)`, "Example")
+	if err != nil {
+		t.Errorf("got: %v, want: nil", err)
+	}
+}
+
+func TestForeignKeys(t *testing.T) {
+	conn, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+
+	err = db.Migrate(context.Background(), conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = conn.Exec(`INSERT INTO profiles(user_id, name) VALUES(42, ?)`, "Nobody")
+	if err == nil {
+		t.Errorf("got: nil, want: foreign key violation")
+	}
+}
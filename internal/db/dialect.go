@@ -0,0 +1,163 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Dialect is a SQL database the stores can run against. Queries are written
+// once, in SQLite's syntax with ? placeholders, and the dialect rewrites what
+// differs.
+type Dialect int
+
+const (
+	SQLite Dialect = iota
+	Postgres
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case Postgres:
+		return "postgres"
+	default:
+		return "sqlite"
+	}
+}
+
+// ParseDialect accepts the names printed by String.
+func ParseDialect(name string) (Dialect, error) {
+	switch name {
+	case "sqlite":
+		return SQLite, nil
+	case "postgres":
+		return Postgres, nil
+	}
+
+	return 0, fmt.Errorf("unknown database dialect %q", name)
+}
+
+// Driver is the database/sql driver name the dialect opens connections with.
+// Postgres uses pgx's stdlib driver, which the binary must link in with a
+// blank import of github.com/jackc/pgx/v5/stdlib.
+func (d Dialect) Driver() string {
+	if d == Postgres {
+		return "pgx"
+	}
+
+	return "sqlite"
+}
+
+// Rebind rewrites the ? placeholders in query into the dialect's own style.
+// Question marks inside quoted strings and identifiers are left alone.
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+
+	var b strings.Builder
+	var quote rune
+	var n int
+	for _, c := range query {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
+
+// FoldEqual returns a condition comparing column to a placeholder without
+// regard to case.
+func (d Dialect) FoldEqual(column string) string {
+	if d == Postgres {
+		return "lower(" + column + ") = lower(?)"
+	}
+
+	return column + " = ? COLLATE NOCASE"
+}
+
+// QuerierFor is the package-level QuerierFor with every query rebound for
+// the dialect.
+func (d Dialect) QuerierFor(ctx context.Context, conn *sql.DB) Querier {
+	q := QuerierFor(ctx, conn)
+	if d == SQLite {
+		return q
+	}
+
+	return reboundQuerier{q, d}
+}
+
+type reboundQuerier struct {
+	q       Querier
+	dialect Dialect
+}
+
+func (r reboundQuerier) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return r.q.ExecContext(ctx, r.dialect.Rebind(query), args...)
+}
+
+func (r reboundQuerier) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return r.q.QueryContext(ctx, r.dialect.Rebind(query), args...)
+}
+
+func (r reboundQuerier) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return r.q.QueryRowContext(ctx, r.dialect.Rebind(query), args...)
+}
+
+// Config selects the database to connect to.
+type Config struct {
+	Dialect Dialect
+	// DSN is the SQLite file name or the Postgres connection string.
+	DSN string
+}
+
+// Configure reads DB_DRIVER, which is sqlite or postgres and defaults to
+// sqlite. SQLite opens the file named by DB_NAME with a .sqlite suffix;
+// Postgres connects to DATABASE_URL.
+func Configure() (c Config, err error) {
+	if raw := os.Getenv("DB_DRIVER"); raw != "" {
+		c.Dialect, err = ParseDialect(raw)
+		if err != nil {
+			return Config{}, fmt.Errorf("DB_DRIVER misconfigured: %w", err)
+		}
+	}
+
+	switch c.Dialect {
+	case Postgres:
+		c.DSN = os.Getenv("DATABASE_URL")
+		if c.DSN == "" {
+			return Config{}, fmt.Errorf("DATABASE_URL misconfigured: required when DB_DRIVER is postgres")
+		}
+	default:
+		c.DSN = os.Getenv("DB_NAME") + ".sqlite"
+	}
+
+	return c, nil
+}
+
+func (c Config) Open() (*sql.DB, error) {
+	if c.Dialect == SQLite {
+		return Open(c.DSN)
+	}
+
+	if !slices.Contains(sql.Drivers(), c.Dialect.Driver()) {
+		return nil, fmt.Errorf("%s driver %q is not linked into this binary", c.Dialect, c.Dialect.Driver())
+	}
+
+	return sql.Open(c.Dialect.Driver(), c.DSN)
+}
@@ -0,0 +1,63 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/db"
+)
+
+func TestRebind(t *testing.T) {
+	var cases = []struct {
+		query    string
+		sqlite   string
+		postgres string
+	}{
+		{`SELECT 1`, `SELECT 1`, `SELECT 1`},
+		{`SELECT a FROM t WHERE b = ? AND c = ?`, `SELECT a FROM t WHERE b = ? AND c = ?`, `SELECT a FROM t WHERE b = $1 AND c = $2`},
+		{`SELECT '?', "a?" FROM t WHERE b = ?`, `SELECT '?', "a?" FROM t WHERE b = ?`, `SELECT '?', "a?" FROM t WHERE b = $1`},
+		{`SELECT 'it''s ?' WHERE b = ?`, `SELECT 'it''s ?' WHERE b = ?`, `SELECT 'it''s ?' WHERE b = $1`},
+	}
+
+	for _, c := range cases {
+		if got := db.SQLite.Rebind(c.query); got != c.sqlite {
+			t.Errorf("sqlite got: %q, want: %q", got, c.sqlite)
+		}
+		if got := db.Postgres.Rebind(c.query); got != c.postgres {
+			t.Errorf("postgres got: %q, want: %q", got, c.postgres)
+		}
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	t.Setenv("DB_NAME", "goidp")
+	t.Setenv("DB_DRIVER", "")
+
+	c, err := db.Configure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Dialect != db.SQLite || c.DSN != "goidp.sqlite" {
+		t.Errorf("got: %+v, want: sqlite on goidp.sqlite", c)
+	}
+
+	t.Setenv("DB_DRIVER", "postgres")
+	_, err = db.Configure()
+	if err == nil {
+		t.Errorf("got: nil, want: an error without DATABASE_URL")
+	}
+
+	t.Setenv("DATABASE_URL", "postgres://localhost/goidp")
+	c, err = db.Configure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Dialect != db.Postgres || c.DSN != "postgres://localhost/goidp" {
+		t.Errorf("got: %+v, want: postgres on DATABASE_URL", c)
+	}
+
+	t.Setenv("DB_DRIVER", "mysql")
+	_, err = db.Configure()
+	if err == nil {
+		t.Errorf("got: nil, want: an error for an unknown driver")
+	}
+}
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS profiles (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    given_name VARCHAR(255) NOT NULL DEFAULT '',
+    family_name VARCHAR(255) NOT NULL DEFAULT '',
+    picture VARCHAR(2048) NOT NULL DEFAULT '',
+    locale VARCHAR(35) NOT NULL DEFAULT '',
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS profiles;
+ALTER TABLE users DROP COLUMN email_verified;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+-- code holds the hex SHA-256 of the authorization code, never the code.
+CREATE TABLE IF NOT EXISTS auth_codes (
+    id INTEGER PRIMARY KEY,
+    code CHAR(64) NOT NULL UNIQUE,
+    client_id VARCHAR(255) NOT NULL,
+    redirect_uri TEXT NOT NULL,
+    scope TEXT NOT NULL DEFAULT '',
+    nonce TEXT NOT NULL DEFAULT '',
+    claims TEXT NOT NULL DEFAULT '',
+    code_challenge VARCHAR(128) NOT NULL DEFAULT '',
+    code_challenge_method VARCHAR(16) NOT NULL DEFAULT '',
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    auth_time DATETIME NOT NULL,
+    used BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_after DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS auth_codes_expires_after ON auth_codes(expires_after);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS auth_codes;
+-- +goose StatementEnd
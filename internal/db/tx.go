@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/retryafter"
+)
+
+// Querier is the part of *sql.DB and *sql.Tx that stores need, so they can run
+// either inside or outside a transaction.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type txKey struct{}
+
+func WithTx(ctx context.Context, tx *sql.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+func TxFromContext(ctx context.Context) (tx *sql.Tx, ok bool) {
+	tx, ok = ctx.Value(txKey{}).(*sql.Tx)
+	return tx, ok
+}
+
+// QuerierFor returns the transaction carried by ctx when there is one, so
+// store calls made within a Transaction share it, and conn otherwise.
+func QuerierFor(ctx context.Context, conn *sql.DB) Querier {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+
+	return conn
+}
+
+// Transaction runs each request in a transaction carried by its context. The
+// transaction commits when the handler writes a 2xx status, or returns without
+// writing one, and rolls back on any other status or a panic. Committing at
+// the moment the status is written means a failed commit can still be
+// reported as a 500, but handlers must finish their database work first.
+func Transaction(conn *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tx, err := conn.BeginTx(r.Context(), nil)
+			if err != nil {
+				slog.Error("Cannot begin transaction.", "err", err)
+				retryafter.Set(w.Header(), 5*time.Second)
+				http.Error(w, "Service temporarily unavailable.", http.StatusServiceUnavailable)
+				return
+			}
+
+			tw := &txResponseWriter{ResponseWriter: w, tx: tx}
+			defer func() {
+				if v := recover(); v != nil {
+					tx.Rollback()
+					panic(v)
+				}
+			}()
+
+			next.ServeHTTP(tw, r.WithContext(WithTx(r.Context(), tx)))
+			tw.finish(http.StatusOK)
+		})
+	}
+}
+
+type txResponseWriter struct {
+	http.ResponseWriter
+	tx       *sql.Tx
+	finished bool
+	failed   bool
+}
+
+func (w *txResponseWriter) finish(status int) {
+	if w.finished {
+		return
+	}
+	w.finished = true
+
+	if status < 200 || status > 299 {
+		w.tx.Rollback()
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	err := w.tx.Commit()
+	if err != nil {
+		slog.Error("Cannot commit transaction.", "err", err)
+		w.failed = true
+		http.Error(w.ResponseWriter, "Internal server error.", http.StatusInternalServerError)
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *txResponseWriter) WriteHeader(status int) {
+	// Informational responses don't end the handler's work.
+	if status >= 100 && status <= 199 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	w.finish(status)
+}
+
+func (w *txResponseWriter) Write(b []byte) (int, error) {
+	w.finish(http.StatusOK)
+	if w.failed {
+		return len(b), nil
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *txResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
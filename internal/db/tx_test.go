@@ -0,0 +1,84 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/db"
+)
+
+func openMigrated(t *testing.T) *sql.DB {
+	t.Helper()
+
+	conn, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetMaxOpenConns(1)
+
+	err = db.Migrate(context.Background(), conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn
+}
+
+var transactions = []struct {
+	name   string
+	status int
+	panics bool
+	users  int
+}{
+	{"success", http.StatusCreated, false, 1},
+	{"implicit success", 0, false, 1},
+	{"handler error", http.StatusBadRequest, false, 0},
+	{"panic", 0, true, 0},
+}
+
+func TestTransaction(t *testing.T) {
+	for _, c := range transactions {
+		conn := openMigrated(t)
+
+		handler := db.Transaction(conn)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, err := db.QuerierFor(r.Context(), conn).ExecContext(
+				r.Context(),
+				`INSERT INTO users(email, password_hash) VALUES(?,?)`,
+				"example1@email.com",
+				"hash",
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.panics {
+				panic("boom")
+			}
+			if c.status != 0 {
+				w.WriteHeader(c.status)
+			}
+		}))
+
+		func() {
+			defer func() {
+				v := recover()
+				if (v != nil) != c.panics {
+					t.Errorf("%s got panic: %v, want panic: %v", c.name, v, c.panics)
+				}
+			}()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+		}()
+
+		var users int
+		err := conn.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&users)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if users != c.users {
+			t.Errorf("%s got: %d users, want: %d", c.name, users, c.users)
+		}
+	}
+}
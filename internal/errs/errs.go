@@ -0,0 +1,154 @@
+// Package errs is the error type handlers return to the HTTP layer. An Error
+// pairs the internal cause, which is only ever logged, with a kind that
+// decides the status and a message that is safe to show to the caller.
+package errs
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/problem"
+	"github.com/ehubscher/goidp/internal/retryafter"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const retryAfter = 5 * time.Second
+
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindInvalid
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindConflict
+	KindUnavailable
+)
+
+var kinds = map[Kind]struct {
+	code    string
+	status  int
+	message string
+}{
+	KindInternal:     {"internal", http.StatusInternalServerError, "Internal server error."},
+	KindInvalid:      {"invalid", http.StatusBadRequest, "Invalid request."},
+	KindUnauthorized: {"unauthorized", http.StatusUnauthorized, "Authentication required."},
+	KindForbidden:    {"forbidden", http.StatusForbidden, "Not allowed."},
+	KindNotFound:     {"not_found", http.StatusNotFound, "Not found."},
+	KindConflict:     {"conflict", http.StatusConflict, "Already exists."},
+	KindUnavailable:  {"unavailable", http.StatusServiceUnavailable, "Temporarily unavailable, retry later."},
+}
+
+type Error struct {
+	Kind Kind
+	// Message is shown to the caller. Empty means a generic message for
+	// the kind.
+	Message string
+	// Cause is logged but never shown.
+	Cause error
+}
+
+// kind returns the kind's properties, treating unknown kinds as internal.
+func (e *Error) kind() (code string, status int, message string) {
+	k, ok := kinds[e.Kind]
+	if !ok {
+		k = kinds[KindInternal]
+	}
+
+	return k.code, k.status, k.message
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" {
+		_, _, msg = e.kind()
+	}
+	if e.Cause != nil {
+		return msg + ": " + e.Cause.Error()
+	}
+
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Code is a stable, machine-readable name for the kind.
+func (e *Error) Code() string {
+	code, _, _ := e.kind()
+	return code
+}
+
+func (e *Error) Status() int {
+	_, status, _ := e.kind()
+	return status
+}
+
+func Invalid(message string) *Error {
+	return &Error{Kind: KindInvalid, Message: message}
+}
+
+func Unauthorized(message string) *Error {
+	return &Error{Kind: KindUnauthorized, Message: message}
+}
+
+func Forbidden(message string) *Error {
+	return &Error{Kind: KindForbidden, Message: message}
+}
+
+func NotFound(message string) *Error {
+	return &Error{Kind: KindNotFound, Message: message}
+}
+
+func Conflict(message string) *Error {
+	return &Error{Kind: KindConflict, Message: message}
+}
+
+// Internal wraps an unexpected error. Causes that mean the store is only
+// temporarily down become KindUnavailable instead.
+func Internal(cause error) *Error {
+	if errors.Is(cause, store.ErrUnavailable) {
+		return &Error{Kind: KindUnavailable, Cause: cause}
+	}
+
+	return &Error{Kind: KindInternal, Cause: cause}
+}
+
+// As returns err as an *Error, treating anything else as Internal.
+func As(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	return Internal(err)
+}
+
+// WriteError logs err and writes it as a problem response. Only the safe
+// message reaches the caller; server-side failures are logged at error
+// level with their cause.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	e := As(err)
+
+	var status int = e.Status()
+	if status >= 500 {
+		slog.Error("Request failed.", "path", r.URL.Path, "code", e.Code(), "err", e.Cause)
+	} else if e.Cause != nil {
+		slog.Debug("Request rejected.", "path", r.URL.Path, "code", e.Code(), "err", e.Cause)
+	}
+
+	if e.Kind == KindUnavailable {
+		retryafter.Set(w.Header(), retryAfter)
+	}
+
+	// Internal failures get no detail at all rather than a generic one.
+	var detail string = e.Message
+	if detail == "" && status != http.StatusInternalServerError {
+		_, _, detail = e.kind()
+	}
+	problem.Error(w, r, status, detail)
+}
@@ -0,0 +1,80 @@
+package errs_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/errs"
+	"github.com/ehubscher/goidp/internal/problem"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+var errorStatuses = []struct {
+	err    error
+	status int
+	detail string
+}{
+	{errs.Invalid("Malformed profile."), http.StatusBadRequest, "Malformed profile."},
+	{errs.Unauthorized(""), http.StatusUnauthorized, "Authentication required."},
+	{errs.Forbidden("Nope."), http.StatusForbidden, "Nope."},
+	{errs.NotFound("No such user."), http.StatusNotFound, "No such user."},
+	{errs.Conflict("Taken."), http.StatusConflict, "Taken."},
+	{errs.Internal(errors.New("disk on fire")), http.StatusInternalServerError, ""},
+	{errs.Internal(fmt.Errorf("query: %w", store.ErrUnavailable)), http.StatusServiceUnavailable, "Temporarily unavailable, retry later."},
+	{errors.New("not an errs.Error"), http.StatusInternalServerError, ""},
+	{fmt.Errorf("wrapped: %w", errs.NotFound("")), http.StatusNotFound, "Not found."},
+}
+
+func TestWriteError(t *testing.T) {
+	for _, c := range errorStatuses {
+		r := httptest.NewRequest(http.MethodGet, "/account/profile", nil)
+		rec := httptest.NewRecorder()
+
+		errs.WriteError(rec, r, c.err)
+
+		if rec.Code != c.status {
+			t.Errorf("%v got: %d, want: %d", c.err, rec.Code, c.status)
+		}
+		if got := rec.Header().Get("Content-Type"); got != problem.ContentType {
+			t.Errorf("%v got: %s, want: %s", c.err, got, problem.ContentType)
+		}
+		if strings.Contains(rec.Body.String(), "disk on fire") {
+			t.Errorf("got: %s, want: the cause kept internal", rec.Body)
+		}
+
+		var prob problem.Problem
+		err := json.NewDecoder(rec.Body).Decode(&prob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prob.Detail != c.detail {
+			t.Errorf("%v got: %q, want: %q", c.err, prob.Detail, c.detail)
+		}
+	}
+}
+
+func TestWriteErrorUnavailable(t *testing.T) {
+	rec := httptest.NewRecorder()
+	errs.WriteError(rec, httptest.NewRequest(http.MethodGet, "/", nil), errs.Internal(store.ErrUnavailable))
+
+	if rec.Header().Get("Retry-After") == "" {
+		t.Errorf("got: no Retry-After, want: Retry-After")
+	}
+}
+
+func TestErrorUnwrap(t *testing.T) {
+	cause := errors.New("cause")
+	err := errs.Internal(cause)
+
+	if !errors.Is(err, cause) {
+		t.Errorf("got: %v, want: it to wrap %v", err, cause)
+	}
+	if err.Code() != "internal" {
+		t.Errorf("got: %s, want: internal", err.Code())
+	}
+}
@@ -0,0 +1,64 @@
+// Package feature holds the feature flags that decide which optional
+// endpoints a deployment serves. Flags are read at boot and again on a
+// config reload.
+package feature
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Known features. Anything missing from Flags is enabled, so existing
+// deployments keep their behaviour as flags are introduced.
+const (
+	Registration    = "registration"
+	PasswordChange  = "password_change"
+	Token           = "token"
+	ClaimsParameter = "claims_parameter"
+	Introspection   = "introspection"
+)
+
+var known = []string{Registration, PasswordChange, Token, ClaimsParameter, Introspection}
+
+// Flags maps a feature name to whether it is enabled.
+type Flags map[string]bool
+
+func (f Flags) Enabled(name string) bool {
+	enabled, ok := f[name]
+	return !ok || enabled
+}
+
+// Configure reads FEATURES, a comma-separated list of name=bool pairs such
+// as "registration=false,token=true". Unknown names are an error so a typo
+// can't silently leave a feature on.
+func Configure() (Flags, error) {
+	return Parse(os.Getenv("FEATURES"))
+}
+
+func Parse(raw string) (Flags, error) {
+	flags := make(Flags)
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("feature flag %q misconfigured: want name=bool", pair)
+		}
+		if !slices.Contains(known, name) {
+			return nil, fmt.Errorf("unknown feature %q", name)
+		}
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("feature flag %q misconfigured: %w", pair, err)
+		}
+		flags[name] = enabled
+	}
+
+	return flags, nil
+}
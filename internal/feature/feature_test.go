@@ -0,0 +1,34 @@
+package feature_test
+
+import (
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/feature"
+)
+
+func TestParse(t *testing.T) {
+	flags, err := feature.Parse(" registration=false, token=true ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want = map[string]bool{
+		feature.Registration:    false,
+		feature.Token:           true,
+		feature.ClaimsParameter: true, // unset features stay enabled
+	}
+	for name, enabled := range want {
+		if flags.Enabled(name) != enabled {
+			t.Errorf("%s got: %v, want: %v", name, flags.Enabled(name), enabled)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, raw := range []string{"regisration=false", "token", "token=maybe"} {
+		_, err := feature.Parse(raw)
+		if err == nil {
+			t.Errorf("%q got: nil, want: an error", raw)
+		}
+	}
+}
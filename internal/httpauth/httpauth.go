@@ -0,0 +1,135 @@
+// Package httpauth parses the credentials of an Authorization header, so
+// every endpoint treats malformed headers the same way.
+package httpauth
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrMissing means there is no Authorization header, or it is blank.
+	ErrMissing = errors.New("no authorization header")
+	// ErrScheme means the header uses another authentication scheme.
+	ErrScheme = errors.New("unexpected authorization scheme")
+	// ErrMalformed means the header has the expected scheme but its
+	// credentials can't be parsed.
+	ErrMalformed = errors.New("malformed authorization header")
+)
+
+// credentials splits header into its scheme, matched case-insensitively per
+// RFC 9110 section 11.1, and credentials. Whitespace around either,
+// including runs of spaces between them, is ignored.
+func credentials(header, scheme string) (string, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return "", ErrMissing
+	}
+
+	got, rest, _ := strings.Cut(header, " ")
+	if !strings.EqualFold(got, scheme) {
+		return "", fmt.Errorf("%w: want %s", ErrScheme, scheme)
+	}
+
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return "", fmt.Errorf("%w: no credentials", ErrMalformed)
+	}
+	if strings.ContainsAny(rest, " \t") {
+		return "", fmt.Errorf("%w: credentials contain whitespace", ErrMalformed)
+	}
+
+	return rest, nil
+}
+
+// ParseBearer returns the token of an RFC 6750 Bearer header.
+func ParseBearer(header string) (token string, err error) {
+	token, err = credentials(header, "Bearer")
+	if err != nil {
+		return "", err
+	}
+
+	if !isToken68(token) {
+		return "", fmt.Errorf("%w: token contains invalid characters", ErrMalformed)
+	}
+
+	return token, nil
+}
+
+// isToken68 reports whether s matches the b64token rule of RFC 6750
+// section 2.1: 1*( ALPHA / DIGIT / "-" / "." / "_" / "~" / "+" / "/" ) *"=".
+func isToken68(s string) bool {
+	var body string = strings.TrimRight(s, "=")
+	if body == "" {
+		return false
+	}
+
+	for _, c := range body {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.ContainsRune("-._~+/", c)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ParseBasic returns the user id and password of an RFC 7617 Basic header.
+// They are returned as sent: any further decoding, such as the form
+// encoding OAuth client credentials are supposed to use, is the caller's.
+// An empty user id is malformed; an empty password is not.
+func ParseBasic(header string) (user, password string, err error) {
+	encoded, err := credentials(header, "Basic")
+	if err != nil {
+		return "", "", err
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: invalid base64", ErrMalformed)
+	}
+	user, password, found := strings.Cut(string(decoded), ":")
+	if !found {
+		return "", "", fmt.Errorf("%w: no colon", ErrMalformed)
+	}
+	if user == "" {
+		return "", "", fmt.Errorf("%w: empty user id", ErrMalformed)
+	}
+
+	return user, password, nil
+}
+
+// BearerChallenge formats an RFC 6750 section 3 WWW-Authenticate value.
+// Empty attributes are left out, so a request that carried no credentials
+// gets a challenge with only the realm, as section 3.1 asks.
+func BearerChallenge(realm, code, description, scope string) string {
+	var b strings.Builder
+	b.WriteString("Bearer realm=")
+	b.WriteString(quote(realm))
+
+	var attrs = []struct {
+		name, value string
+	}{
+		{"error", code},
+		{"error_description", description},
+		{"scope", scope},
+	}
+	for _, a := range attrs {
+		if a.value == "" {
+			continue
+		}
+		b.WriteString(", ")
+		b.WriteString(a.name)
+		b.WriteString("=")
+		b.WriteString(quote(a.value))
+	}
+
+	return b.String()
+}
+
+// quote makes s an RFC 9110 quoted-string.
+func quote(s string) string {
+	var r = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(s) + `"`
+}
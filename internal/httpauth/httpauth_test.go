@@ -0,0 +1,89 @@
+package httpauth_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/httpauth"
+)
+
+func TestParseBearer(t *testing.T) {
+	var headers = []struct {
+		header string
+		token  string
+		err    error
+	}{
+		{"Bearer abc.def-ghi_jkl~+/==", "abc.def-ghi_jkl~+/==", nil},
+		{"bearer abc", "abc", nil},
+		{"BEARER abc", "abc", nil},
+		{"  Bearer   abc  ", "abc", nil},
+		{"", "", httpauth.ErrMissing},
+		{"   ", "", httpauth.ErrMissing},
+		{"abc", "", httpauth.ErrScheme},
+		{"Basic abc", "", httpauth.ErrScheme},
+		{"Bearerabc", "", httpauth.ErrScheme},
+		{"Bearer", "", httpauth.ErrMalformed},
+		{"Bearer   ", "", httpauth.ErrMalformed},
+		{"Bearer abc def", "", httpauth.ErrMalformed},
+		{"Bearer abc\tdef", "", httpauth.ErrMalformed},
+		{"Bearer ===", "", httpauth.ErrMalformed},
+		{"Bearer a=b", "", httpauth.ErrMalformed},
+		{`Bearer "abc"`, "", httpauth.ErrMalformed},
+	}
+
+	for _, c := range headers {
+		token, err := httpauth.ParseBearer(c.header)
+		if token != c.token || !errors.Is(err, c.err) {
+			t.Errorf("%q got: %q, %v, want: %q, %v", c.header, token, err, c.token, c.err)
+		}
+	}
+}
+
+func basic(s string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func TestParseBasic(t *testing.T) {
+	var headers = []struct {
+		header         string
+		user, password string
+		err            error
+	}{
+		{basic("client1:s3cret"), "client1", "s3cret", nil},
+		{basic("client1:with:colons"), "client1", "with:colons", nil},
+		{basic("client1:"), "client1", "", nil},
+		{"basic  " + base64.StdEncoding.EncodeToString([]byte("client1:s3cret")) + " ", "client1", "s3cret", nil},
+		{"", "", "", httpauth.ErrMissing},
+		{"Bearer abc", "", "", httpauth.ErrScheme},
+		{"Basic", "", "", httpauth.ErrMalformed},
+		{"Basic !!!not-base64", "", "", httpauth.ErrMalformed},
+		{basic("no-colon"), "", "", httpauth.ErrMalformed},
+		{basic(":secret"), "", "", httpauth.ErrMalformed},
+	}
+
+	for _, c := range headers {
+		user, password, err := httpauth.ParseBasic(c.header)
+		if user != c.user || password != c.password || !errors.Is(err, c.err) {
+			t.Errorf("%q got: %q, %q, %v, want: %q, %q, %v", c.header, user, password, err, c.user, c.password, c.err)
+		}
+	}
+}
+
+func TestBearerChallenge(t *testing.T) {
+	var challenges = []struct {
+		code, description, scope string
+		want                     string
+	}{
+		{"", "", "", `Bearer realm="goidp"`},
+		{"invalid_token", "The access token expired.", "", `Bearer realm="goidp", error="invalid_token", error_description="The access token expired."`},
+		{"insufficient_scope", "Needs more.", "openid email", `Bearer realm="goidp", error="insufficient_scope", error_description="Needs more.", scope="openid email"`},
+		{"invalid_request", `A "quoted" \ value.`, "", `Bearer realm="goidp", error="invalid_request", error_description="A \"quoted\" \\ value."`},
+	}
+
+	for _, c := range challenges {
+		if got := httpauth.BearerChallenge("goidp", c.code, c.description, c.scope); got != c.want {
+			t.Errorf("got: %s, want: %s", got, c.want)
+		}
+	}
+}
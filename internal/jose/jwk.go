@@ -0,0 +1,126 @@
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+)
+
+const minRSABits = 2048
+
+// JWK is the public half of a signing key as published in a JWKS (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func NewRSAJWK(kid, alg string, pub *rsa.PublicKey) JWK {
+	return JWK{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: alg,
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+func NewECJWK(kid, alg string, pub *ecdsa.PublicKey) JWK {
+	var size int = (pub.Curve.Params().BitSize + 7) / 8
+
+	return JWK{
+		Kty: "EC",
+		Kid: kid,
+		Use: "sig",
+		Alg: alg,
+		Crv: pub.Curve.Params().Name,
+		X:   base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size))),
+		Y:   base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size))),
+	}
+}
+
+// PublicKey decodes the key for use with JWS.Verify, along with the alg it
+// verifies. That is Alg, which must match the key type, or if unset the one
+// alg this package supports for the key type. RSA keys under 2048 bits and
+// EC points off the curve are refused.
+func (j JWK) PublicKey() (alg string, key crypto.PublicKey, err error) {
+	switch j.Kty {
+	case "RSA":
+		alg = RS256
+		key, err = j.rsaPublicKey()
+	case "EC":
+		alg = ES256
+		key, err = j.ecPublicKey()
+	default:
+		return "", nil, fmt.Errorf("%w: key type %q", ErrUnsupported, j.Kty)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if j.Alg != "" && j.Alg != alg {
+		return "", nil, fmt.Errorf("%w: %s with a %s key", ErrUnsupported, j.Alg, j.Kty)
+	}
+
+	return alg, key, nil
+}
+
+func (j JWK) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(j.N)
+	if err != nil {
+		return nil, fmt.Errorf("%w: JWK n: %w", ErrMalformed, err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(j.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, fmt.Errorf("%w: JWK e", ErrMalformed)
+	}
+
+	pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	if pub.N.BitLen() < minRSABits {
+		return nil, fmt.Errorf("%w: RSA key of %d bits", ErrUnsupported, pub.N.BitLen())
+	}
+
+	return pub, nil
+}
+
+func (j JWK) ecPublicKey() (*ecdsa.PublicKey, error) {
+	if j.Crv != "P-256" {
+		return nil, fmt.Errorf("%w: curve %q", ErrUnsupported, j.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(j.X)
+	if err != nil || len(x) != 32 {
+		return nil, fmt.Errorf("%w: JWK x", ErrMalformed)
+	}
+	y, err := base64.RawURLEncoding.DecodeString(j.Y)
+	if err != nil || len(y) != 32 {
+		return nil, fmt.Errorf("%w: JWK y", ErrMalformed)
+	}
+
+	// crypto/ecdh checks the point is on the curve.
+	point := append(append([]byte{4}, x...), y...)
+	_, err = ecdh.P256().NewPublicKey(point)
+	if err != nil {
+		return nil, fmt.Errorf("%w: JWK point: %w", ErrMalformed, err)
+	}
+
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+}
@@ -0,0 +1,99 @@
+package jose_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/jose"
+)
+
+func TestNewRSAJWK(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwk := jose.NewRSAJWK("k1", "RS256", &key.PublicKey)
+	if jwk.Kty != "RSA" || jwk.Kid != "k1" || jwk.Alg != "RS256" || jwk.E != "AQAB" {
+		t.Errorf("got: %+v, want: an RS256 RSA key with kid k1", jwk)
+	}
+}
+
+func TestNewECJWK(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwk := jose.NewECJWK("k2", "ES256", &key.PublicKey)
+	x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jwk.Crv != "P-256" || len(x) != 32 {
+		t.Errorf("got: %+v, want: a P-256 key with 32 byte coordinates", jwk)
+	}
+}
+
+func TestJWKPublicKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smallKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offCurve := jose.NewECJWK("k", "", &ecKey.PublicKey)
+	offCurve.Y = offCurve.X
+
+	var jwks = []struct {
+		name string
+		jwk  jose.JWK
+		alg  string
+	}{
+		{"rsa", jose.NewRSAJWK("k", "RS256", &rsaKey.PublicKey), jose.RS256},
+		{"ec without alg", jose.NewECJWK("k", "", &ecKey.PublicKey), jose.ES256},
+		{"alg mismatch", jose.NewECJWK("k", "RS256", &ecKey.PublicKey), ""},
+		{"small rsa", jose.NewRSAJWK("k", "RS256", &smallKey.PublicKey), ""},
+		{"off curve", offCurve, ""},
+	}
+
+	for _, c := range jwks {
+		alg, key, err := c.jwk.PublicKey()
+		if c.alg == "" {
+			if err == nil {
+				t.Errorf("%s got: nil, want: an error", c.name)
+			}
+			continue
+		}
+		if err != nil || alg != c.alg || key == nil {
+			t.Errorf("%s got: %s, %v, want: %s", c.name, alg, err, c.alg)
+		}
+	}
+
+	payload := []byte(`{"sub":"1"}`)
+	token, err := jose.Sign(jose.Header{Alg: jose.ES256}, ecKey, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jws, err := jose.Parse(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alg, pub, err := jose.NewECJWK("k", "ES256", &ecKey.PublicKey).PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jws.Verify(alg, pub); err != nil {
+		t.Errorf("got: %v, want: the decoded key to verify", err)
+	}
+}
@@ -0,0 +1,167 @@
+package jose_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/jose"
+)
+
+func testKeys(t *testing.T) (*rsa.PrivateKey, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rsaKey, ecKey
+}
+
+func TestSignVerify(t *testing.T) {
+	rsaKey, ecKey := testKeys(t)
+
+	var algs = []struct {
+		alg          string
+		private, pub any
+	}{
+		{jose.RS256, rsaKey, &rsaKey.PublicKey},
+		{jose.ES256, ecKey, &ecKey.PublicKey},
+		{jose.HS256, []byte("client-secret"), []byte("client-secret")},
+	}
+
+	for _, a := range algs {
+		token, err := jose.Sign(jose.Header{Alg: a.alg, Kid: "k1"}, a.private, []byte(`{"sub":"1"}`))
+		if err != nil {
+			t.Fatalf("%s got: %v, want: nil", a.alg, err)
+		}
+
+		jws, err := jose.Parse(token)
+		if err != nil {
+			t.Fatalf("%s got: %v, want: nil", a.alg, err)
+		}
+		if string(jws.Payload) != `{"sub":"1"}` || jws.Header.Kid != "k1" {
+			t.Errorf("%s got: %s %+v, want: the signed payload and header", a.alg, jws.Payload, jws.Header)
+		}
+
+		err = jws.Verify(a.alg, a.pub)
+		if err != nil {
+			t.Errorf("%s got: %v, want: nil", a.alg, err)
+		}
+
+		tampered, _ := jose.Parse(token[:len(token)-4] + "AAAA")
+		err = tampered.Verify(a.alg, a.pub)
+		if !errors.Is(err, jose.ErrSignature) {
+			t.Errorf("%s got: %v, want: %v", a.alg, err, jose.ErrSignature)
+		}
+	}
+}
+
+func TestVerifyPinsAlgorithm(t *testing.T) {
+	rsaKey, _ := testKeys(t)
+
+	// An HS256 token "signed" with the RSA public key must not verify just
+	// because its header asks for HS256.
+	token, err := jose.Sign(jose.Header{Alg: jose.HS256}, []byte("public key bytes"), []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jws, err := jose.Parse(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = jws.Verify(jose.RS256, &rsaKey.PublicKey)
+	if !errors.Is(err, jose.ErrAlgorithm) {
+		t.Errorf("got: %v, want: %v", err, jose.ErrAlgorithm)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	for _, token := range []string{"", "a.b", "a.b.c.d", "!!.e30.AA", "e30.!!.AA"} {
+		_, err := jose.Parse(token)
+		if !errors.Is(err, jose.ErrMalformed) {
+			t.Errorf("%q got: %v, want: %v", token, err, jose.ErrMalformed)
+		}
+	}
+}
+
+func TestKeyManager(t *testing.T) {
+	rsaKey, ecKey := testKeys(t)
+
+	current, err := jose.NewKey(jose.ES256, ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous, err := jose.NewKey(jose.RS256, rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := jose.NewKeyManager(current, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys.SigningKey().ID != current.ID {
+		t.Errorf("got: %s, want: %s", keys.SigningKey().ID, current.ID)
+	}
+	if _, ok := keys.Key(previous.ID); !ok {
+		t.Errorf("got: no key, want: %s", previous.ID)
+	}
+
+	jwks, err := keys.PublicKeys(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kid != current.ID || jwks.Keys[1].Alg != jose.RS256 {
+		t.Errorf("got: %+v, want: both keys, current first", jwks.Keys)
+	}
+
+	_, err = jose.NewKey(jose.ES256, rsaKey)
+	if !errors.Is(err, jose.ErrUnsupported) {
+		t.Errorf("got: %v, want: %v", err, jose.ErrUnsupported)
+	}
+}
+
+func TestKeyManagerSigningKeyFor(t *testing.T) {
+	rsaKey, ecKey := testKeys(t)
+
+	es256, err := jose.NewKey(jose.ES256, ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs256, err := jose.NewKey(jose.RS256, rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := jose.NewKeyManager(es256, rs256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var selections = []struct {
+		alg string
+		kid string
+		ok  bool
+	}{
+		{"", es256.ID, true},
+		{jose.ES256, es256.ID, true},
+		{jose.RS256, rs256.ID, true},
+		{jose.HS256, "", false},
+	}
+	for _, c := range selections {
+		key, ok := keys.SigningKeyFor(c.alg)
+		if ok != c.ok || key.ID != c.kid {
+			t.Errorf("%q got: %s, %t, want: %s, %t", c.alg, key.ID, ok, c.kid, c.ok)
+		}
+	}
+}
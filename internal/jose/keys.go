@@ -0,0 +1,165 @@
+package jose
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Key is a private signing key. ID is the kid published in the JWKS and set in
+// the header of everything it signs.
+type Key struct {
+	ID      string
+	Alg     string
+	Private crypto.Signer
+}
+
+func NewKey(alg string, private crypto.Signer) (Key, error) {
+	key := Key{Alg: alg, Private: private}
+
+	jwk, err := key.JWK()
+	if err != nil {
+		return Key{}, err
+	}
+	key.ID = Thumbprint(jwk)
+
+	return key, nil
+}
+
+func (k Key) Public() crypto.PublicKey {
+	return k.Private.Public()
+}
+
+func (k Key) JWK() (JWK, error) {
+	switch pub := k.Private.Public().(type) {
+	case *rsa.PublicKey:
+		if k.Alg != RS256 {
+			return JWK{}, fmt.Errorf("%w: %s with an RSA key", ErrUnsupported, k.Alg)
+		}
+		return NewRSAJWK(k.ID, k.Alg, pub), nil
+	case *ecdsa.PublicKey:
+		if k.Alg != ES256 || pub.Curve.Params().BitSize != 256 {
+			return JWK{}, fmt.Errorf("%w: %s with an EC key", ErrUnsupported, k.Alg)
+		}
+		return NewECJWK(k.ID, k.Alg, pub), nil
+	default:
+		return JWK{}, fmt.Errorf("%w: key type %T", ErrUnsupported, pub)
+	}
+}
+
+// Thumbprint computes the RFC 7638 thumbprint of a public key, which makes a
+// stable kid.
+func Thumbprint(jwk JWK) string {
+	var members any
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	}
+
+	b, _ := json.Marshal(members)
+	var sum [32]byte = sha256.Sum256(b)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// KeyManager holds the keys tokens are signed and verified with. One of them
+// is the current signing key; the rest remain published so tokens they
+// signed still verify.
+type KeyManager struct {
+	mu      sync.RWMutex
+	keys    map[string]Key
+	order   []string
+	signing string
+}
+
+func NewKeyManager(signing Key, others ...Key) (*KeyManager, error) {
+	m := &KeyManager{keys: make(map[string]Key)}
+	for _, k := range append([]Key{signing}, others...) {
+		_, err := k.JWK()
+		if err != nil {
+			return nil, err
+		}
+		if k.ID == "" {
+			return nil, fmt.Errorf("key without an id")
+		}
+		if _, ok := m.keys[k.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %s", k.ID)
+		}
+		m.keys[k.ID] = k
+		m.order = append(m.order, k.ID)
+	}
+	m.signing = signing.ID
+
+	return m, nil
+}
+
+func (m *KeyManager) SigningKey() Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.keys[m.signing]
+}
+
+// SigningKeyFor returns the key to sign with when alg is required, such as
+// for a client that registered an id_token_signed_response_alg. That is the
+// signing key if it uses alg, and otherwise the first other key that does.
+// An empty alg means the signing key.
+func (m *KeyManager) SigningKeyFor(alg string) (key Key, ok bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key = m.keys[m.signing]
+	if alg == "" || key.Alg == alg {
+		return key, true
+	}
+
+	for _, kid := range m.order {
+		if m.keys[kid].Alg == alg {
+			return m.keys[kid], true
+		}
+	}
+
+	return Key{}, false
+}
+
+func (m *KeyManager) Key(kid string) (key Key, ok bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key, ok = m.keys[kid]
+	return key, ok
+}
+
+func (m *KeyManager) PublicKeys(ctx context.Context) (JWKS, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	jwks := JWKS{Keys: make([]JWK, 0, len(m.keys))}
+	for _, kid := range slices.Clone(m.order) {
+		jwk, err := m.keys[kid].JWK()
+		if err != nil {
+			return JWKS{}, err
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks, nil
+}
@@ -0,0 +1,144 @@
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+)
+
+const devKeyBits = 2048
+
+var ErrNoSigningKey = errors.New("no signing key configured")
+
+// ParsePrivateKeyPEM parses the first PEM block of data as a PKCS #8, PKCS #1
+// (RSA) or SEC 1 (EC) private key.
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%w: key type %T", ErrUnsupported, key)
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("cannot parse %s block as a private key", block.Type)
+}
+
+// KeyFromSigner makes a Key with the algorithm this package uses for the key
+// type: RS256 for RSA and ES256 for P-256.
+func KeyFromSigner(signer crypto.Signer) (Key, error) {
+	switch pub := signer.Public().(type) {
+	case *rsa.PublicKey:
+		return NewKey(RS256, signer)
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return Key{}, fmt.Errorf("%w: curve %s", ErrUnsupported, pub.Curve.Params().Name)
+		}
+		return NewKey(ES256, signer)
+	default:
+		return Key{}, fmt.Errorf("%w: key type %T", ErrUnsupported, pub)
+	}
+}
+
+func LoadKey(path string) (Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, err
+	}
+	signer, err := ParsePrivateKeyPEM(data)
+	if err != nil {
+		return Key{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return KeyFromSigner(signer)
+}
+
+// ConfigureSigningKey loads the signing key from SIGNING_KEY_FILE. Without
+// one, startup fails unless DEV_MODE is true, in which case an RSA key is
+// generated. A generated key dies with the process, and every token signed
+// with it with the key, unless DEV_SIGNING_KEY_FILE names a file to keep it
+// in across restarts.
+func ConfigureSigningKey() (Key, error) {
+	if path := os.Getenv("SIGNING_KEY_FILE"); path != "" {
+		key, err := LoadKey(path)
+		if err != nil {
+			return Key{}, fmt.Errorf("SIGNING_KEY_FILE misconfigured: %w", err)
+		}
+		return key, nil
+	}
+
+	var devMode bool
+	if raw := os.Getenv("DEV_MODE"); raw != "" {
+		var err error
+		devMode, err = strconv.ParseBool(raw)
+		if err != nil {
+			return Key{}, fmt.Errorf("DEV_MODE misconfigured: %w", err)
+		}
+	}
+	if !devMode {
+		return Key{}, fmt.Errorf("%w: set SIGNING_KEY_FILE, or DEV_MODE=true for a generated key", ErrNoSigningKey)
+	}
+
+	return devSigningKey(os.Getenv("DEV_SIGNING_KEY_FILE"))
+}
+
+// devSigningKey generates an RSA key, reusing the one in path if there is
+// one and writing a new one there if not. An empty path keeps it in memory.
+func devSigningKey(path string) (Key, error) {
+	if path != "" {
+		key, err := LoadKey(path)
+		if err == nil {
+			slog.Warn("DEV_MODE: using the development signing key. Never do this in production.", "file", path)
+			return key, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return Key{}, fmt.Errorf("DEV_SIGNING_KEY_FILE misconfigured: %w", err)
+		}
+	}
+
+	private, err := rsa.GenerateKey(rand.Reader, devKeyBits)
+	if err != nil {
+		return Key{}, err
+	}
+	key, err := NewKey(RS256, private)
+	if err != nil {
+		return Key{}, err
+	}
+
+	if path == "" {
+		slog.Warn("DEV_MODE: generated an ephemeral signing key. Tokens won't survive a restart. Never do this in production.", "kid", key.ID)
+		return key, nil
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return Key{}, err
+	}
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+	if err != nil {
+		return Key{}, fmt.Errorf("DEV_SIGNING_KEY_FILE misconfigured: %w", err)
+	}
+	slog.Warn("DEV_MODE: generated a development signing key. Never do this in production.", "kid", key.ID, "file", path)
+
+	return key, nil
+}
@@ -0,0 +1,105 @@
+package jose_test
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/jose"
+)
+
+func TestConfigureSigningKeyProductionRequiresKey(t *testing.T) {
+	t.Setenv("SIGNING_KEY_FILE", "")
+	t.Setenv("DEV_MODE", "")
+
+	_, err := jose.ConfigureSigningKey()
+	if !errors.Is(err, jose.ErrNoSigningKey) {
+		t.Errorf("got: %v, want: %v", err, jose.ErrNoSigningKey)
+	}
+
+	t.Setenv("DEV_MODE", "false")
+	_, err = jose.ConfigureSigningKey()
+	if !errors.Is(err, jose.ErrNoSigningKey) {
+		t.Errorf("got: %v, want: %v", err, jose.ErrNoSigningKey)
+	}
+}
+
+func TestConfigureSigningKeyDevMode(t *testing.T) {
+	t.Setenv("SIGNING_KEY_FILE", "")
+	t.Setenv("DEV_MODE", "true")
+	t.Setenv("DEV_SIGNING_KEY_FILE", "")
+
+	key, err := jose.ConfigureSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Alg != jose.RS256 || key.ID == "" {
+		t.Errorf("got: %s key %q, want: an RS256 key with a kid", key.Alg, key.ID)
+	}
+
+	other, err := jose.ConfigureSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.ID == key.ID {
+		t.Error("got: the same key twice, want: a fresh ephemeral key")
+	}
+}
+
+func TestConfigureSigningKeyDevModePersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dev-key.pem")
+	t.Setenv("SIGNING_KEY_FILE", "")
+	t.Setenv("DEV_MODE", "true")
+	t.Setenv("DEV_SIGNING_KEY_FILE", path)
+
+	first, err := jose.ConfigureSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("got: %o, want: 600", info.Mode().Perm())
+	}
+
+	second, err := jose.ConfigureSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID != first.ID {
+		t.Errorf("got: %s, want: the persisted key %s", second.ID, first.ID)
+	}
+}
+
+func TestConfigureSigningKeyFile(t *testing.T) {
+	_, ecKey := testKeys(t)
+	der, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SIGNING_KEY_FILE", path)
+	t.Setenv("DEV_MODE", "true")
+
+	key, err := jose.ConfigureSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Alg != jose.ES256 {
+		t.Errorf("got: %s, want: %s", key.Alg, jose.ES256)
+	}
+
+	t.Setenv("SIGNING_KEY_FILE", filepath.Join(t.TempDir(), "missing.pem"))
+	if _, err = jose.ConfigureSigningKey(); err == nil {
+		t.Error("got: nil, want: an error for a missing key file")
+	}
+}
@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type Options struct {
+	Format    string // text or json
+	Level     slog.Level
+	AddSource bool
+}
+
+// level is the level of the logger Setup installs. It is a LevelVar so a
+// config reload can change it without replacing the handler.
+var level slog.LevelVar
+
+// Setup configures the default slog logger from LOG_FORMAT, LOG_LEVEL and
+// LOG_SOURCE so that every package-level slog call picks it up.
+func Setup() error {
+	opts, err := configureLogging()
+	if err != nil {
+		return err
+	}
+
+	level.Set(opts.Level)
+	handler, err := newHandler(os.Stderr, opts, &level)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(handler))
+
+	return nil
+}
+
+// Level is the level of the logger Setup installed.
+func Level() slog.Level {
+	return level.Level()
+}
+
+// SetLevel changes the level of the logger Setup installed, taking effect
+// for every later log call.
+func SetLevel(l slog.Level) {
+	if level.Level() != l {
+		slog.Info("Log level changed.", "from", level.Level(), "to", l)
+		level.Set(l)
+	}
+}
+
+// ParseLevel parses a LOG_LEVEL value. Empty means info.
+func ParseLevel(raw string) (l slog.Level, err error) {
+	if raw == "" {
+		return slog.LevelInfo, nil
+	}
+
+	err = l.UnmarshalText([]byte(raw))
+	if err != nil {
+		return 0, fmt.Errorf("log level misconfigured: %w", err)
+	}
+
+	return l, nil
+}
+
+func NewHandler(w io.Writer, opts Options) (slog.Handler, error) {
+	return newHandler(w, opts, opts.Level)
+}
+
+func newHandler(w io.Writer, opts Options, level slog.Leveler) (slog.Handler, error) {
+	handlerOpts := &slog.HandlerOptions{
+		Level:     level,
+		AddSource: opts.AddSource,
+	}
+
+	switch opts.Format {
+	case "", "text":
+		return slog.NewTextHandler(w, handlerOpts), nil
+	case "json":
+		return slog.NewJSONHandler(w, handlerOpts), nil
+	default:
+		return nil, fmt.Errorf("unsupported log format %q", opts.Format)
+	}
+}
+
+func configureLogging() (opts Options, err error) {
+	opts.Format = strings.ToLower(os.Getenv("LOG_FORMAT"))
+
+	opts.Level, err = ParseLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		return Options{}, err
+	}
+
+	var source string = os.Getenv("LOG_SOURCE")
+	if source != "" {
+		opts.AddSource, err = strconv.ParseBool(source)
+		if err != nil {
+			return Options{}, fmt.Errorf("log source misconfigured: %w", err)
+		}
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,66 @@
+package logging_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/logging"
+)
+
+func TestJSONHandler(t *testing.T) {
+	var buf bytes.Buffer
+	handler, err := logging.NewHandler(&buf, logging.Options{Format: "json", Level: slog.LevelWarn})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.New(handler)
+	logger.Info("Dropped by level.")
+	logger.Warn("Kept by level.", "rows", 1)
+	logger.Error("Also kept.", "err", "boom")
+
+	var lines int
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var entry map[string]any
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			t.Fatalf("got: %q, want: a JSON line", scanner.Text())
+		}
+		if entry["level"] == "INFO" {
+			t.Errorf("got: %v, want: no INFO entries", entry)
+		}
+		lines++
+	}
+
+	if lines != 2 {
+		t.Errorf("got: %d lines, want: %d", lines, 2)
+	}
+}
+
+func TestSetup(t *testing.T) {
+	var setups = []struct {
+		format, level string
+		ok            bool
+	}{
+		{"json", "debug", true},
+		{"text", "", true},
+		{"", "warn", true},
+		{"xml", "", false},
+		{"json", "loud", false},
+	}
+
+	defer slog.SetDefault(slog.Default())
+	for _, s := range setups {
+		t.Setenv("LOG_FORMAT", s.format)
+		t.Setenv("LOG_LEVEL", s.level)
+
+		err := logging.Setup()
+		if (err == nil) != s.ok {
+			t.Errorf("LOG_FORMAT=%q LOG_LEVEL=%q got: %v, want ok: %v", s.format, s.level, err, s.ok)
+		}
+	}
+}
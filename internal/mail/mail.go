@@ -0,0 +1,156 @@
+// Package mail sends email, such as verification and password reset
+// messages, through an in-process queue so requests never wait on SMTP.
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers a message. Errors are treated as transient and retried by
+// Queue.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTP delivers messages as plain text through an SMTP relay. Auth is
+// optional; net/smtp only sends PLAIN credentials over TLS or to localhost.
+type SMTP struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+// ConfigureSMTP reads SMTP_ADDR (host:port), SMTP_FROM and, for
+// authenticated relays, SMTP_USERNAME and SMTP_PASSWORD.
+func ConfigureSMTP() (SMTP, error) {
+	s := SMTP{Addr: os.Getenv("SMTP_ADDR"), From: os.Getenv("SMTP_FROM")}
+	if s.Addr == "" || s.From == "" {
+		return SMTP{}, fmt.Errorf("SMTP_ADDR and SMTP_FROM must both be set")
+	}
+
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return SMTP{}, fmt.Errorf("SMTP_ADDR misconfigured: %w", err)
+	}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		s.Auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+
+	return s, nil
+}
+
+func (s SMTP) Send(ctx context.Context, msg Message) error {
+	// Header injection is the one way message content could change who
+	// receives it.
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return fmt.Errorf("mail header contains a line break")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\nTo: %s\r\nSubject: %s\r\n", s.From, msg.To, msg.Subject)
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return s.send(ctx, msg.To, []byte(b.String()))
+}
+
+// send is smtp.SendMail over a connection bound to ctx: its deadline
+// applies to every read and write, and cancelling ctx closes the connection,
+// so a relay that stops answering can't hold a queue worker forever.
+func (s SMTP) send(ctx context.Context, to string, body []byte) error {
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: host})
+		if err != nil {
+			return err
+		}
+	}
+	if s.Auth != nil {
+		if ok, _ := c.Extension("AUTH"); ok {
+			err = c.Auth(s.Auth)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = c.Mail(s.From)
+	if err != nil {
+		return err
+	}
+	err = c.Rcpt(to)
+	if err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// Capture keeps sent messages in memory, for tests and development.
+type Capture struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (c *Capture) Send(ctx context.Context, msg Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.messages = append(c.messages, msg)
+
+	return nil
+}
+
+func (c *Capture) Messages() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Message(nil), c.messages...)
+}
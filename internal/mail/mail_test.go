@@ -0,0 +1,44 @@
+package mail_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/mail"
+)
+
+func TestSMTPSendDeadline(t *testing.T) {
+	// A relay that accepts connections and never answers.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	s := mail.SMTP{Addr: l.Addr().String(), From: "idp@example.com"}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	returned := make(chan error, 1)
+	go func() { returned <- s.Send(ctx, mail.Message{To: "user@example.com", Subject: "Hi"}) }()
+
+	select {
+	case err := <-returned:
+		if err == nil {
+			t.Error("got: nil, want: an error from the silent relay")
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("got: Send blocked past its context, want: it to give up")
+	}
+}
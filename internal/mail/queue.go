@@ -0,0 +1,169 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWorkers     = 2
+	defaultQueueSize   = 100
+	defaultMaxAttempts = 5
+	defaultBackoff     = time.Second
+	// sendTimeout bounds a single delivery attempt.
+	sendTimeout = 30 * time.Second
+)
+
+var (
+	ErrQueueFull   = errors.New("mail queue full")
+	ErrQueueClosed = errors.New("mail queue closed")
+)
+
+// Queue sends messages in the background with a fixed pool of workers.
+// Failed sends are retried with exponential backoff; a message that still
+// fails after MaxAttempts, or is still queued when Shutdown gives up, is
+// logged as a dead letter and dropped. Messages live only in memory, so any
+// still queued when the process dies are lost.
+type Queue struct {
+	Mailer Mailer
+	// Workers is the number of concurrent senders. Zero means 2.
+	Workers int
+	// Size is how many messages can wait before Enqueue fails. Zero means
+	// 100.
+	Size int
+	// MaxAttempts is how often a message is tried. Zero means 5.
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubling after each
+	// further attempt. Zero means one second.
+	Backoff time.Duration
+
+	once    sync.Once
+	mu      sync.RWMutex
+	closed  bool
+	pending chan Message
+	// ctx is cancelled when Shutdown gives up, ending sends in flight.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func (q *Queue) start() {
+	q.once.Do(func() {
+		workers, size := q.Workers, q.Size
+		if workers <= 0 {
+			workers = defaultWorkers
+		}
+		if size <= 0 {
+			size = defaultQueueSize
+		}
+
+		q.pending = make(chan Message, size)
+		q.ctx, q.cancel = context.WithCancel(context.Background())
+		for i := 0; i < workers; i++ {
+			q.wg.Add(1)
+			go q.work()
+		}
+	})
+}
+
+// Enqueue queues msg for sending and returns at once. It fails when the
+// queue is full rather than block the request it is called from.
+func (q *Queue) Enqueue(msg Message) error {
+	q.start()
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	select {
+	case q.pending <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Shutdown stops accepting messages and waits for the queued ones to be
+// sent. When ctx ends first, it returns ctx's error at once: sends in flight
+// are cancelled and the messages left are dead-lettered in the background.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.start()
+
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.pending)
+	}
+	q.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+
+	for msg := range q.pending {
+		if q.ctx.Err() != nil {
+			deadLetter(msg, ErrQueueClosed)
+			continue
+		}
+		q.deliver(msg)
+	}
+}
+
+func (q *Queue) deliver(msg Message) {
+	attempts, backoff := q.MaxAttempts, q.Backoff
+	if attempts <= 0 {
+		attempts = defaultMaxAttempts
+	}
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+
+	var err error
+	var attempt int
+	for attempt = 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			slog.Warn("Cannot send mail, retrying.", "attempt", attempt-1, "err", err)
+			select {
+			case <-time.After(backoff):
+				backoff *= 2
+			case <-q.ctx.Done():
+				attempt = attempts + 1
+				continue
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(q.ctx, sendTimeout)
+		err = q.Mailer.Send(ctx, msg)
+		cancel()
+		if err == nil {
+			return
+		}
+	}
+
+	deadLetter(msg, err)
+}
+
+func deadLetter(msg Message, err error) {
+	// Only the recipient and subject are logged: bodies carry tokens.
+	slog.Error("Dead letter: giving up on mail.", "to", msg.To, "subject", msg.Subject, "err", err)
+}
@@ -0,0 +1,147 @@
+package mail_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/mail"
+)
+
+func TestQueueDelivers(t *testing.T) {
+	capture := &mail.Capture{}
+	q := &mail.Queue{Mailer: capture}
+
+	msg := mail.Message{To: "user@example.com", Subject: "Verify your email", Body: "code"}
+	if err := q.Enqueue(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := capture.Messages(); len(got) != 1 || got[0] != msg {
+		t.Errorf("got: %v, want: [%v]", got, msg)
+	}
+}
+
+func TestQueueDrainsOnShutdown(t *testing.T) {
+	capture := &mail.Capture{}
+	q := &mail.Queue{Mailer: capture, Workers: 1, Size: 50}
+
+	for i := 0; i < 50; i++ {
+		if err := q.Enqueue(mail.Message{To: "user@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(capture.Messages()); got != 50 {
+		t.Errorf("got: %d sent, want: %d", got, 50)
+	}
+	if err := q.Enqueue(mail.Message{}); !errors.Is(err, mail.ErrQueueClosed) {
+		t.Errorf("got: %v, want: %v", err, mail.ErrQueueClosed)
+	}
+}
+
+// flaky fails its first failures sends, then captures.
+type flaky struct {
+	mail.Capture
+	failures, calls atomic.Int32
+}
+
+func (f *flaky) Send(ctx context.Context, msg mail.Message) error {
+	if f.calls.Add(1) <= f.failures.Load() {
+		return errors.New("connection refused")
+	}
+
+	return f.Capture.Send(ctx, msg)
+}
+
+func TestQueueRetries(t *testing.T) {
+	mailer := &flaky{}
+	mailer.failures.Store(2)
+	q := &mail.Queue{Mailer: mailer, MaxAttempts: 3, Backoff: time.Millisecond}
+
+	q.Enqueue(mail.Message{To: "user@example.com"})
+	q.Shutdown(context.Background())
+
+	if got := len(mailer.Messages()); got != 1 || mailer.calls.Load() != 3 {
+		t.Errorf("got: %d sent in %d calls, want: 1 in 3", got, mailer.calls.Load())
+	}
+}
+
+func TestQueueGivesUp(t *testing.T) {
+	mailer := &flaky{}
+	mailer.failures.Store(100)
+	q := &mail.Queue{Mailer: mailer, MaxAttempts: 3, Backoff: time.Millisecond}
+
+	q.Enqueue(mail.Message{To: "user@example.com"})
+	q.Shutdown(context.Background())
+
+	if got := mailer.calls.Load(); got != 3 {
+		t.Errorf("got: %d calls, want: %d", got, 3)
+	}
+}
+
+func TestQueueShutdownDeadline(t *testing.T) {
+	mailer := &flaky{}
+	mailer.failures.Store(100)
+	q := &mail.Queue{Mailer: mailer, Backoff: time.Hour}
+	q.Enqueue(mail.Message{To: "user@example.com"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got: %v, want: %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestQueueShutdownDoesNotWaitOnSend(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	q := &mail.Queue{Mailer: blocking(block), Workers: 1}
+	for range 3 {
+		q.Enqueue(mail.Message{To: "user@example.com"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	returned := make(chan error, 1)
+	go func() { returned <- q.Shutdown(ctx) }()
+
+	select {
+	case err := <-returned:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got: %v, want: %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(time.Second):
+		t.Error("got: Shutdown blocked on a hung send, want: it to return at the deadline")
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	block := make(chan struct{})
+	q := &mail.Queue{Mailer: blocking(block), Workers: 1, Size: 1}
+	defer q.Shutdown(context.Background())
+	defer close(block)
+
+	var err error
+	for i := 0; i < 3 && err == nil; i++ {
+		err = q.Enqueue(mail.Message{})
+	}
+	if !errors.Is(err, mail.ErrQueueFull) {
+		t.Errorf("got: %v, want: %v", err, mail.ErrQueueFull)
+	}
+}
+
+type blocking chan struct{}
+
+func (b blocking) Send(ctx context.Context, msg mail.Message) error {
+	<-b
+	return nil
+}
@@ -0,0 +1,72 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+// Access token formats a client can be configured with.
+const (
+	AccessTokenJWT    = "jwt"
+	AccessTokenOpaque = "opaque"
+)
+
+var (
+	ErrUnsupportedTokenFormat = errors.New("unsupported access token format")
+	errNoAccessTokenStore     = errors.New("opaque access tokens need an access token store")
+)
+
+func validateAccessTokenFormat(format string) error {
+	switch format {
+	case "", AccessTokenJWT, AccessTokenOpaque:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedTokenFormat, format)
+	}
+}
+
+// issueAccessToken issues an access token in the client's format: a signed
+// JWT resource servers can check locally, or a random token only /introspect
+// can resolve. Both live for the issuer's access token lifetime. Clients
+// with pairwise subjects always get opaque tokens, since a JWT would carry
+// the user's id for them to read.
+func (p *Provider) issueAccessToken(ctx context.Context, client store.Client, userID int64, scopes []string, claims string) (token string, expiresIn time.Duration, err error) {
+	if client.AccessTokenFormat != AccessTokenOpaque && !p.Subjects.pairwise(client) {
+		var extra map[string]any
+		if claims != "" {
+			extra = map[string]any{"userinfo_claims": claims}
+		}
+		return p.Tokens.IssueAccessTokenWith(strconv.FormatInt(userID, 10), client.ID, client.Audiences, scopes, 0, extra)
+	}
+	if p.AccessTokens == nil {
+		return "", 0, errNoAccessTokenStore
+	}
+
+	token, err = randomToken(32)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var now = p.now()
+	expiresIn = p.Tokens.Lifetime()
+	err = p.AccessTokens.CreateAccessToken(ctx, store.AccessToken{
+		TokenHash: hashRememberToken(token),
+		ClientID:  client.ID,
+		UserID:    userID,
+		Scope:     strings.Join(scopes, " "),
+		Claims:    claims,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(expiresIn),
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	return token, expiresIn, nil
+}
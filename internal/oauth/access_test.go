@@ -0,0 +1,131 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/oauth"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+// withTokenFormat configures the test client for format, after withTokens.
+func (env *testEnv) withTokenFormat(t *testing.T, format string) {
+	t.Helper()
+
+	clients := env.provider.Clients.(*store.MemoryClientStore)
+	client, err := clients.GetClient(context.Background(), testClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.AccessTokenFormat = format
+	err = clients.PutClient(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (env *testEnv) introspect(t *testing.T, tok string) map[string]any {
+	t.Helper()
+
+	r := postForm("/introspect", url.Values{"token": {tok}})
+	r.Header.Set("Authorization", basicAuth(testClientID, testClientSecret))
+
+	return decodeMap(t, env.do(r))
+}
+
+func TestOpaqueAccessToken(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	env.withTokenFormat(t, oauth.AccessTokenOpaque)
+	env.provider.AccessTokens = store.NewMemoryAccessTokenStore()
+
+	rec := env.exchange(t, basicAuth(testClientID, testClientSecret), env.codeGrant(t))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusOK)
+	}
+	resp := decodeTokenResult(t, rec)
+	if strings.Contains(resp.AccessToken, ".") {
+		t.Errorf("got: %s, want: an opaque token", resp.AccessToken)
+	}
+	if _, err := env.provider.Tokens.Validate(resp.AccessToken); err == nil {
+		t.Errorf("got: a valid JWT, want: an opaque token")
+	}
+
+	claims := env.introspect(t, resp.AccessToken)
+	if claims["active"] != true || claims["sub"] != strconv.FormatInt(env.user.ID, 10) || claims["client_id"] != testClientID || claims["scope"] != "openid" {
+		t.Errorf("got: %v, want: the active token's claims", claims)
+	}
+
+	env.now = env.now.Add(time.Hour)
+	if claims := env.introspect(t, resp.AccessToken); len(claims) != 1 || claims["active"] != false {
+		t.Errorf("got: %v, want: only active false", claims)
+	}
+}
+
+func TestOpaqueAccessTokenAudience(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	env.withTokenFormat(t, oauth.AccessTokenOpaque)
+	env.provider.AccessTokens = store.NewMemoryAccessTokenStore()
+
+	clients := env.provider.Clients.(*store.MemoryClientStore)
+	client, err := clients.GetClient(context.Background(), testClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Audiences = []string{"https://api.example", testClientID}
+	err = clients.PutClient(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := env.exchange(t, basicAuth(testClientID, testClientSecret), env.codeGrant(t))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusOK)
+	}
+
+	// As for a JWT: the client first, then its other audiences once each.
+	claims := env.introspect(t, decodeTokenResult(t, rec).AccessToken)
+	aud, _ := claims["aud"].([]any)
+	if len(aud) != 2 || aud[0] != testClientID || aud[1] != "https://api.example" || claims["azp"] != testClientID {
+		t.Errorf("got: aud %v azp %v, want: the client's audiences and azp", claims["aud"], claims["azp"])
+	}
+}
+
+func TestJWTAccessToken(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	env.withTokenFormat(t, oauth.AccessTokenJWT)
+	env.provider.AccessTokens = store.NewMemoryAccessTokenStore()
+
+	rec := env.exchange(t, basicAuth(testClientID, testClientSecret), env.codeGrant(t))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusOK)
+	}
+	resp := decodeTokenResult(t, rec)
+	jwt, err := env.provider.Tokens.Validate(resp.AccessToken)
+	if err != nil {
+		t.Fatalf("got: %v, want: a self-contained token", err)
+	}
+
+	claims := env.introspect(t, resp.AccessToken)
+	if claims["active"] != true || claims["jti"] != jwt.ID || claims["client_id"] != testClientID {
+		t.Errorf("got: %v, want: the JWT's claims", claims)
+	}
+}
+
+func TestOpaqueAccessTokenWithoutStore(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	env.withTokenFormat(t, oauth.AccessTokenOpaque)
+
+	rec := env.exchange(t, basicAuth(testClientID, testClientSecret), env.codeGrant(t))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,67 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ehubscher/goidp/internal/errs"
+	"github.com/ehubscher/goidp/internal/render"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+type profileDocument struct {
+	Name       string `json:"name"`
+	GivenName  string `json:"given_name"`
+	FamilyName string `json:"family_name"`
+	Picture    string `json:"picture"`
+	Locale     string `json:"locale"`
+}
+
+// Profile serves GET and PUT /account/profile for the logged-in user.
+func (p *Provider) Profile(w http.ResponseWriter, r *http.Request) {
+	session, ok := p.session(w, r)
+	if !ok {
+		errs.WriteError(w, r, errs.Unauthorized("Authentication required."))
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		var doc profileDocument
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&doc)
+		if err != nil {
+			errs.WriteError(w, r, errs.Invalid("Malformed profile."))
+			return
+		}
+
+		err = p.Profiles.UpdateProfile(r.Context(), store.Profile{
+			UserID:     session.UserID,
+			Name:       doc.Name,
+			GivenName:  doc.GivenName,
+			FamilyName: doc.FamilyName,
+			Picture:    doc.Picture,
+			Locale:     doc.Locale,
+			UpdatedAt:  p.now(),
+		})
+		if err != nil {
+			errs.WriteError(w, r, errs.Internal(fmt.Errorf("cannot update profile of user %d: %w", session.UserID, err)))
+			return
+		}
+	}
+
+	profile, err := p.Profiles.GetProfile(r.Context(), session.UserID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		errs.WriteError(w, r, errs.Internal(fmt.Errorf("cannot load profile of user %d: %w", session.UserID, err)))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	render.WriteDocument(w, r, http.StatusOK, profileDocument{
+		Name:       profile.Name,
+		GivenName:  profile.GivenName,
+		FamilyName: profile.FamilyName,
+		Picture:    profile.Picture,
+		Locale:     profile.Locale,
+	})
+}
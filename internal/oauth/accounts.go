@@ -0,0 +1,258 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ehubscher/goidp/internal/render"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const (
+	// maxAccounts caps how many accounts one browser can be signed in to
+	// at once, which also bounds the session cookie.
+	maxAccounts = 4
+	// sessionIDSeparator joins the session ids in the session cookie. It
+	// never occurs in an id since those are base64url.
+	sessionIDSeparator = "."
+	// selectedAccountParam carries the user the chooser picked on the
+	// resumed authorization request.
+	selectedAccountParam = "selected_account"
+)
+
+// sessionCookieIDs returns the session ids in the session cookie. The cookie
+// holds one session per signed-in account, the active one first.
+func (p *Provider) sessionCookieIDs(r *http.Request) []string {
+	value, _, ok := p.signedCookie(r, sessionCookieName)
+	if !ok {
+		return nil
+	}
+
+	var ids []string = strings.Split(value, sessionIDSeparator)
+	if len(ids) > maxAccounts {
+		ids = ids[:maxAccounts]
+	}
+
+	return ids
+}
+
+// accountSessions returns the unexpired sessions in the session cookie, at
+// most one per user, in cookie order.
+func (p *Provider) accountSessions(ctx context.Context, r *http.Request) (sessions []store.Session) {
+	for _, id := range p.sessionCookieIDs(r) {
+		session, ok := p.lookupSession(ctx, id)
+		if !ok || slices.ContainsFunc(sessions, func(s store.Session) bool { return s.UserID == session.UserID }) {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions
+}
+
+// setSessionCookie writes the session cookie for sessions, the first of
+// which becomes the active one.
+func (p *Provider) setSessionCookie(w http.ResponseWriter, sessions []store.Session) {
+	var ids []string
+	for _, s := range sessions {
+		ids = append(ids, p.resealSession(s))
+	}
+	if len(ids) > maxAccounts {
+		ids = ids[:maxAccounts]
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    p.CookieKeys.sign(strings.Join(ids, sessionIDSeparator)),
+		Path:     "/",
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// resealSession returns the id of s to write into the session cookie: a
+// sealed session sealed with a previous key is resealed with the current
+// one, anything else is kept as it is.
+func (p *Provider) resealSession(s store.Session) string {
+	if !p.SessionKeys.enabled() || !isSealedSession(s.ID) {
+		return s.ID
+	}
+	if _, stale, err := p.SessionKeys.open(s.ID); err != nil || !stale {
+		return s.ID
+	}
+
+	sealed, err := p.SessionKeys.seal(s)
+	if err != nil {
+		slog.Error("Cannot reseal session.", "err", err)
+		return s.ID
+	}
+
+	return sealed
+}
+
+// sessionCookieStale reports whether the session cookie should be written
+// again with the current keys: it was signed with a previous cookie key, or
+// holds a session sealed with a previous session key.
+func (p *Provider) sessionCookieStale(r *http.Request) bool {
+	if _, stale, _ := p.signedCookie(r, sessionCookieName); stale {
+		return true
+	}
+	if !p.SessionKeys.enabled() {
+		return false
+	}
+
+	for _, id := range p.sessionCookieIDs(r) {
+		if !isSealedSession(id) {
+			continue
+		}
+		if _, stale, err := p.SessionKeys.open(id); err == nil && stale {
+			return true
+		}
+	}
+
+	return false
+}
+
+// chooseAccount decides which signed-in account an authorization request is
+// for. The user is shown the account chooser when the request asks for it
+// with prompt=select_account, or when several accounts are signed in and
+// neither the chooser's selection nor login_hint picks one. It returns false
+// when it has answered the request itself.
+func (p *Provider) chooseAccount(w http.ResponseWriter, r *http.Request, session store.Session, req authorizeRequest) (store.Session, bool) {
+	accounts := p.accountSessions(r.Context(), r)
+	if !slices.ContainsFunc(accounts, func(s store.Session) bool { return s.ID == session.ID }) {
+		// A session just restored from a remember-me token.
+		accounts = append([]store.Session{session}, accounts...)
+	}
+
+	if selected := r.Form.Get(selectedAccountParam); selected != "" {
+		for i, s := range accounts {
+			if strconv.FormatInt(s.UserID, 10) == selected {
+				p.setSessionCookie(w, append([]store.Session{s}, slices.Delete(slices.Clone(accounts), i, i+1)...))
+				return s, true
+			}
+		}
+	}
+
+	if !req.Prompt.SelectAccount {
+		if len(accounts) == 1 {
+			return accounts[0], true
+		}
+
+		users, err := p.accountUsers(r.Context(), accounts)
+		if err != nil {
+			slog.Error("Cannot load signed-in accounts.", "err", err)
+			internalError(w, err)
+			return store.Session{}, false
+		}
+		if hint := r.Form.Get("login_hint"); hint != "" {
+			for i, u := range users {
+				if strings.EqualFold(u.Email, hint) {
+					p.setSessionCookie(w, append([]store.Session{accounts[i]}, slices.Delete(slices.Clone(accounts), i, i+1)...))
+					return accounts[i], true
+				}
+			}
+		}
+
+		if req.Prompt.None {
+			p.redirectError(w, r, req.RedirectURI, req.State, "account_selection_required", "More than one account is signed in.")
+			return store.Session{}, false
+		}
+	}
+
+	p.renderAccountChooser(w, r, accounts, req)
+	return store.Session{}, false
+}
+
+func (p *Provider) accountUsers(ctx context.Context, accounts []store.Session) (users []store.User, err error) {
+	for _, s := range accounts {
+		user, err := p.Users.GetUserByID(ctx, s.UserID)
+		if errors.Is(err, store.ErrNotFound) {
+			// Keep indexes aligned with accounts; an empty email never
+			// matches a hint.
+			users = append(users, store.User{ID: s.UserID})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+func (p *Provider) renderAccountChooser(w http.ResponseWriter, r *http.Request, accounts []store.Session, req authorizeRequest) {
+	users, err := p.accountUsers(r.Context(), accounts)
+	if err != nil {
+		slog.Error("Cannot load signed-in accounts.", "err", err)
+		internalError(w, err)
+		return
+	}
+
+	var choices []render.Account
+	for _, u := range users {
+		if u.Email == "" {
+			continue
+		}
+		choices = append(choices, render.Account{Email: u.Email, URL: selectAccountURL(r.Form, u.ID)})
+	}
+
+	var name string = req.ClientName
+	if name == "" {
+		name = req.ClientID
+	}
+
+	p.pages().Accounts(w, http.StatusOK, render.AccountsPage{
+		Page:          render.Page{UI: p.uiContext(r.Form)},
+		ClientName:    name,
+		Accounts:      choices,
+		AddAccountURL: "/login?" + url.Values{"return_to": {accountResumeURL(r.Form)}}.Encode(),
+	})
+}
+
+// accountResumeURL is resumeURL without select_account, which the chooser
+// has satisfied.
+func accountResumeURL(form url.Values) string {
+	params := url.Values{}
+	for k, v := range form {
+		params[k] = slices.Clone(v)
+	}
+	params.Del(selectedAccountParam)
+	dropPrompt(params, "select_account")
+
+	return resumeURL(params)
+}
+
+// selectAccountURL resumes the authorization request as userID.
+func selectAccountURL(form url.Values, userID int64) string {
+	u, _ := url.Parse(accountResumeURL(form))
+	query := u.Query()
+	query.Set(selectedAccountParam, strconv.FormatInt(userID, 10))
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// withSelectedAccount points an authorization request being resumed after
+// login at the account just signed in to, so the chooser isn't shown again.
+// Other return targets are left alone.
+func withSelectedAccount(returnTo string, userID int64) string {
+	u, err := url.Parse(returnTo)
+	if err != nil || u.Path != "/authorize" {
+		return returnTo
+	}
+
+	query := u.Query()
+	query.Set(selectedAccountParam, strconv.FormatInt(userID, 10))
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
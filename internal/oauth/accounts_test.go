@@ -0,0 +1,188 @@
+package oauth_test
+
+import (
+	"context"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const (
+	secondEmail     = "example2@email.com"
+	secondSessionID = "second-session"
+)
+
+// withTwoAccounts signs a second user in alongside the first and returns a
+// session cookie holding both sessions, the first user's active.
+func (env *testEnv) withTwoAccounts(t *testing.T) (store.User, *http.Cookie) {
+	t.Helper()
+
+	second, err := env.provider.Users.CreateUser(context.Background(), secondEmail, testPasswordHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.provider.Consents.SaveConsent(context.Background(), store.Consent{
+		UserID:   second.ID,
+		ClientID: testClientID,
+		Scopes:   []string{"openid"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.sessions.CreateSession(context.Background(), store.Session{
+		ID:        secondSessionID,
+		UserID:    second.ID,
+		AuthTime:  env.now.Add(-time.Hour),
+		ExpiresAt: env.now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cookie := env.withSession(t)
+	cookie.Value += "." + secondSessionID
+
+	return second, cookie
+}
+
+func (env *testEnv) authorizeAs(t *testing.T, cookie *http.Cookie, extra url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(extra), nil)
+	r.AddCookie(cookie)
+
+	return env.do(r)
+}
+
+func (env *testEnv) codeUser(t *testing.T, rec *httptest.ResponseRecorder) int64 {
+	t.Helper()
+
+	code, err := env.provider.Codes.ConsumeAuthCode(context.Background(), redirectParams(t, rec).Get("code"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return code.UserID
+}
+
+var accountLink = regexp.MustCompile(`<a href="([^"]+)">` + regexp.QuoteMeta(secondEmail) + `</a>`)
+
+func TestSelectAccount(t *testing.T) {
+	env := newTestEnv(t)
+	second, cookie := env.withTwoAccounts(t)
+
+	rec := env.authorizeAs(t, cookie, url.Values{"prompt": {"select_account"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d, want: %d", rec.Code, http.StatusOK)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, testEmail) || !strings.Contains(body, secondEmail) {
+		t.Fatalf("got: %q, want: both accounts offered", body)
+	}
+
+	match := accountLink.FindStringSubmatch(body)
+	if match == nil {
+		t.Fatalf("got: %q, want: a link for %s", body, secondEmail)
+	}
+	r := httptest.NewRequest(http.MethodGet, html.UnescapeString(match[1]), nil)
+	r.AddCookie(cookie)
+	rec = env.do(r)
+
+	if got := env.codeUser(t, rec); got != second.ID {
+		t.Errorf("got: user %d, want: %d", got, second.ID)
+	}
+	active := responseCookie(rec, "goidp_session")
+	if active == nil || !strings.HasPrefix(active.Value, secondSessionID+".") {
+		t.Errorf("got: %v, want: %s active", active, secondSessionID)
+	}
+}
+
+func TestSelectAccountSingleSession(t *testing.T) {
+	env := newTestEnv(t)
+
+	rec := env.authorizeAs(t, env.withSession(t), url.Values{"prompt": {"select_account"}})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), testEmail) {
+		t.Errorf("got: %d, want: the account chooser", rec.Code)
+	}
+}
+
+func TestMultipleAccountsWithoutPrompt(t *testing.T) {
+	env := newTestEnv(t)
+	second, cookie := env.withTwoAccounts(t)
+
+	rec := env.authorizeAs(t, cookie, nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), secondEmail) {
+		t.Errorf("got: %d, want: the account chooser", rec.Code)
+	}
+
+	rec = env.authorizeAs(t, cookie, url.Values{"login_hint": {secondEmail}})
+	if got := env.codeUser(t, rec); got != second.ID {
+		t.Errorf("got: user %d, want: %d", got, second.ID)
+	}
+
+	rec = env.authorizeAs(t, cookie, url.Values{"prompt": {"none"}})
+	if got := redirectParams(t, rec).Get("error"); got != "account_selection_required" {
+		t.Errorf("got: %q, want: %q", got, "account_selection_required")
+	}
+}
+
+func TestLoginHintConsent(t *testing.T) {
+	env := newTestEnv(t)
+	second, cookie := env.withTwoAccounts(t)
+
+	rec := env.authorizeAs(t, cookie, url.Values{"scope": {"openid email"}, "login_hint": {secondEmail}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d, want: %d", rec.Code, http.StatusOK)
+	}
+	match := challengePattern.FindStringSubmatch(rec.Body.String())
+	if match == nil {
+		t.Fatalf("got: %s, want: a consent challenge", rec.Body.String())
+	}
+	active := responseCookie(rec, "goidp_session")
+	if active == nil || !strings.HasPrefix(active.Value, secondSessionID+".") {
+		t.Fatalf("got: %v, want: %s active", active, secondSessionID)
+	}
+
+	r := postForm("/consent", url.Values{"challenge": {match[1]}, "action": {"approve"}})
+	r.AddCookie(active)
+	if got := env.codeUser(t, env.do(r)); got != second.ID {
+		t.Errorf("got: user %d, want: %d", got, second.ID)
+	}
+}
+
+func TestLoginAddsAccount(t *testing.T) {
+	env := newTestEnv(t)
+	second, err := env.provider.Users.CreateUser(context.Background(), secondEmail, testPasswordHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := postForm("/login", url.Values{
+		"email":     {secondEmail},
+		"password":  {testPassword},
+		"return_to": {authorizeURL(url.Values{"prompt": {"select_account"}})},
+	})
+	r.AddCookie(env.withSession(t))
+	rec := env.do(r)
+
+	cookie := responseCookie(rec, "goidp_session")
+	ids := strings.Split(cookie.Value, ".")
+	if len(ids) != 2 || ids[1] != testSessionID {
+		t.Fatalf("got: %q, want: the new session followed by %s", cookie.Value, testSessionID)
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := location.Query().Get("selected_account"); got != strconv.FormatInt(second.ID, 10) {
+		t.Errorf("got: %s, want: selected_account=%d", location, second.ID)
+	}
+}
@@ -0,0 +1,137 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/jose"
+	"github.com/ehubscher/goidp/internal/store"
+	"github.com/ehubscher/goidp/internal/token"
+)
+
+const (
+	jwtBearerAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	// maxAssertionLifetime bounds how far ahead a client assertion's exp may
+	// be, and so how long its jti has to be remembered.
+	maxAssertionLifetime = 10 * time.Minute
+)
+
+// clientAssertionClaims are the claims RFC 7523 section 3 requires of a
+// client assertion.
+type clientAssertionClaims struct {
+	Issuer    string         `json:"iss"`
+	Subject   string         `json:"sub"`
+	Audience  token.Audience `json:"aud"`
+	ExpiresAt int64          `json:"exp"`
+	ID        string         `json:"jti"`
+}
+
+// authenticateAssertion authenticates a client by a JWT sent as
+// client_assertion: for client_secret_jwt signed with HS256 using the
+// client's secret, for private_key_jwt with one of the client's keys.
+// Any failure is ErrInvalidCredentials, except the replay cache being full,
+// which is ErrUnavailable so the client retries.
+func (p *Provider) authenticateAssertion(r *http.Request) (client store.Client, method string, err error) {
+	if r.PostForm.Get("client_assertion_type") != jwtBearerAssertionType || r.Header.Get("Authorization") != "" {
+		return store.Client{}, "", ErrInvalidCredentials
+	}
+
+	jws, err := jose.Parse(r.PostForm.Get("client_assertion"))
+	if err != nil {
+		slog.Debug("Rejected client assertion.", "err", err)
+		return store.Client{}, "", ErrInvalidCredentials
+	}
+	var claims clientAssertionClaims
+	err = json.Unmarshal(jws.Payload, &claims)
+	if err != nil || claims.Issuer == "" || claims.Subject != claims.Issuer {
+		slog.Debug("Rejected client assertion with bad iss or sub.", "err", err)
+		return store.Client{}, "", ErrInvalidCredentials
+	}
+	if id := r.PostForm.Get("client_id"); id != "" && id != claims.Issuer {
+		return store.Client{}, "", ErrInvalidCredentials
+	}
+
+	client, err = p.lookupClient(r.Context(), claims.Issuer)
+	if err != nil {
+		return store.Client{}, "", err
+	}
+	if client.ID == "" {
+		return store.Client{}, "", ErrInvalidCredentials
+	}
+	err = p.verifyAssertion(r.Context(), client, jws)
+	if err != nil {
+		slog.Debug("Rejected client assertion.", "client_id", client.ID, "err", err)
+		return store.Client{}, "", ErrInvalidCredentials
+	}
+
+	err = p.checkAssertionClaims(r, claims)
+	if err != nil {
+		slog.Debug("Rejected client assertion.", "client_id", client.ID, "err", err)
+		return store.Client{}, "", ErrInvalidCredentials
+	}
+
+	err = p.spend(r.Context(), replayAssertionID, client.ID, claims.ID, maxAssertionLifetime)
+	if errors.Is(err, errNonceReplayed) {
+		slog.Warn("Rejected replayed client assertion.", "client_id", client.ID)
+		return store.Client{}, "", ErrInvalidCredentials
+	}
+	if err != nil {
+		return store.Client{}, "", fmt.Errorf("cannot check client assertion for replay: %w", err)
+	}
+
+	method = AuthMethodPrivateKey
+	if jws.Header.Alg == jose.HS256 {
+		method = AuthMethodSecretJWT
+	}
+
+	return client, method, nil
+}
+
+// verifyAssertion checks the assertion's signature. The header's alg only
+// picks the method; the key then pins the alg, so an asymmetric key can't
+// be used as an HMAC secret.
+func (p *Provider) verifyAssertion(ctx context.Context, client store.Client, jws *jose.JWS) error {
+	if jws.Header.Alg == jose.HS256 {
+		if client.Secret == "" {
+			return errors.New("client has no secret for client_secret_jwt")
+		}
+		return jws.Verify(jose.HS256, []byte(client.Secret))
+	}
+
+	alg, key, err := p.clientKey(ctx, client, jws.Header.Kid)
+	if err != nil {
+		return err
+	}
+
+	return jws.Verify(alg, key)
+}
+
+// checkAssertionClaims checks the audience and lifetime of an assertion.
+// The audience may be the issuer, the token endpoint or the endpoint the
+// assertion is presented to.
+func (p *Provider) checkAssertionClaims(r *http.Request, claims clientAssertionClaims) error {
+	var audiences = []string{p.Issuer, p.Issuer + "/token", p.Issuer + r.URL.Path}
+	if !slices.ContainsFunc(claims.Audience, func(aud string) bool { return slices.Contains(audiences, aud) }) {
+		return fmt.Errorf("unexpected audience %v", claims.Audience)
+	}
+
+	var now = p.now()
+	var exp = time.Unix(claims.ExpiresAt, 0)
+	if !now.Before(exp) {
+		return errors.New("assertion has expired")
+	}
+	if exp.Sub(now) > maxAssertionLifetime {
+		return fmt.Errorf("assertion expires more than %v ahead", maxAssertionLifetime)
+	}
+	if claims.ID == "" {
+		return errors.New("assertion has no jti")
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package oauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/jose"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const (
+	testIssuer    = "https://idp.example"
+	assertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+)
+
+// withAssertionSecret lets the test client use client_secret_jwt, after
+// withTokens.
+func (env *testEnv) withAssertionSecret(t *testing.T) {
+	t.Helper()
+
+	env.provider.Issuer = testIssuer
+	clients := env.provider.Clients.(*store.MemoryClientStore)
+	client, err := clients.GetClient(context.Background(), testClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Secret = testClientSecret
+	err = clients.PutClient(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (env *testEnv) assertion(t *testing.T, secret, jti string, exp time.Time) string {
+	t.Helper()
+
+	return signAssertion(t, jose.Header{Alg: jose.HS256, Typ: "JWT"}, []byte(secret), jti, exp)
+}
+
+// signAssertion signs a client assertion for the test client, with key as
+// jose.Sign takes it.
+func signAssertion(t *testing.T, header jose.Header, key any, jti string, exp time.Time) string {
+	t.Helper()
+
+	payload, err := json.Marshal(map[string]any{
+		"iss": testClientID,
+		"sub": testClientID,
+		"aud": testIssuer + "/token",
+		"exp": exp.Unix(),
+		"jti": jti,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwt, err := jose.Sign(header, key, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return jwt
+}
+
+func assertionGrant(grant url.Values, assertion string) url.Values {
+	grant.Set("client_assertion_type", assertionType)
+	grant.Set("client_assertion", assertion)
+	return grant
+}
+
+func TestClientSecretJWT(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	env.withAssertionSecret(t)
+
+	assertion := env.assertion(t, testClientSecret, "jti-1", env.now.Add(time.Minute))
+	rec := env.exchange(t, "", assertionGrant(env.codeGrant(t), assertion))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusOK)
+	}
+}
+
+func TestClientSecretJWTRejected(t *testing.T) {
+	var assertions = []struct {
+		name   string
+		secret string
+		exp    time.Duration
+	}{
+		{"wrong secret", "not-the-client-secret", time.Minute},
+		{"expired", testClientSecret, -time.Second},
+		{"too long-lived", testClientSecret, time.Hour},
+	}
+
+	for _, c := range assertions {
+		env := newTestEnv(t)
+		env.withTokens(t)
+		env.withAssertionSecret(t)
+
+		assertion := env.assertion(t, c.secret, "jti-1", env.now.Add(c.exp))
+		rec := env.exchange(t, "", assertionGrant(env.codeGrant(t), assertion))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s got: %d, want: %d", c.name, rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestClientSecretJWTIntrospect(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	env.withAssertionSecret(t)
+
+	tok, _, err := env.provider.Tokens.IssueAccessToken("1", testClientID, nil, []string{"openid"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	form := assertionGrant(url.Values{"token": {tok}}, env.assertion(t, testClientSecret, "jti-1", env.now.Add(time.Minute)))
+	resp := decodeMap(t, env.do(postForm("/introspect", form)))
+	if resp["active"] != true {
+		t.Errorf("got: %v, want: an active token", resp)
+	}
+
+	// The same assertion can't be used twice.
+	if rec := env.do(postForm("/introspect", form)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("replay got: %d, want: %d", rec.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,315 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/ehubscher/goidp/internal/feature"
+	"github.com/ehubscher/goidp/internal/render"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const sessionCookieName = "goidp_session"
+
+// authorizeRequest is a validated authorization request, kept so it can be
+// resumed after an interactive step such as consent.
+type authorizeRequest struct {
+	ClientID    string
+	ClientName  string
+	RedirectURI string
+	Scopes      []string
+	State       string
+	Nonce       string
+	// NonceReuse is the client's AllowNonceReuse.
+	NonceReuse bool
+	Prompt     Prompt
+	Claims     ClaimsRequest
+	// CodeChallenge and its method are the request's PKCE parameters.
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+func (p *Provider) Authorize(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Malformed authorization request.", http.StatusBadRequest)
+		return
+	}
+
+	client, err := p.Clients.GetClient(r.Context(), r.Form.Get("client_id"))
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Unknown client.", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("Cannot load client.", "err", err)
+		internalError(w, err)
+		return
+	}
+
+	// Errors before the redirect URI is known to be registered must not be
+	// sent to it.
+	redirectURI, ok := matchRedirectURI(client, r.Form.Get("redirect_uri"))
+	if !ok {
+		http.Error(w, "Invalid redirect_uri.", http.StatusBadRequest)
+		return
+	}
+	// Registered URIs are validated too, should a client have been stored
+	// without going through ValidateClient.
+	err = ValidateRedirectURI(redirectURI, p.AllowInsecureRedirectURIs)
+	if err != nil {
+		slog.Warn("Refusing insecure redirect_uri.", "client_id", client.ID, "err", err)
+		http.Error(w, "Insecure redirect_uri, it must use https.", http.StatusBadRequest)
+		return
+	}
+
+	req := authorizeRequest{
+		ClientID:    client.ID,
+		ClientName:  client.Name,
+		RedirectURI: redirectURI,
+		NonceReuse:  client.AllowNonceReuse,
+		Scopes:      p.ScopePolicy.apply(strings.Fields(r.Form.Get("scope"))),
+		State:       r.Form.Get("state"),
+		Nonce:       r.Form.Get("nonce"),
+	}
+
+	req.Prompt, err = ParsePrompt(r.Form.Get("prompt"))
+	if err != nil {
+		p.redirectError(w, r, req.RedirectURI, req.State, "invalid_request", "Invalid prompt parameter.")
+		return
+	}
+
+	if p.features().Enabled(feature.ClaimsParameter) {
+		req.Claims, err = ParseClaimsRequest(r.Form.Get("claims"))
+		if err != nil {
+			p.redirectError(w, r, req.RedirectURI, req.State, "invalid_request", "Malformed claims parameter.")
+			return
+		}
+	}
+
+	req.CodeChallenge, req.CodeChallengeMethod, err = parseCodeChallenge(r.Form)
+	if err != nil {
+		p.redirectError(w, r, req.RedirectURI, req.State, "invalid_request", "Invalid PKCE parameters: "+err.Error()+".")
+		return
+	}
+	// A public client has no secret, so only PKCE keeps a stolen code from
+	// being redeemed.
+	if req.CodeChallenge == "" && client.TokenEndpointAuthMethod == AuthMethodNone {
+		p.redirectError(w, r, req.RedirectURI, req.State, "invalid_request", "Public clients must use PKCE.")
+		return
+	}
+
+	if !p.Flows.responseTypeEnabled(r.Form.Get("response_type")) {
+		p.redirectError(w, r, req.RedirectURI, req.State, "unsupported_response_type", "The response type is not supported.")
+		return
+	}
+
+	if unknown := p.scopes().Unknown(req.Scopes); len(unknown) > 0 {
+		p.redirectError(w, r, req.RedirectURI, req.State, "invalid_scope", "Unsupported scope: "+strings.Join(unknown, " "))
+		return
+	}
+
+	// prompt=login forces the user to authenticate afresh, so an existing
+	// session is deliberately ignored.
+	session, ok := p.session(w, r)
+	if !ok || req.Prompt.Login {
+		if req.Prompt.None {
+			p.redirectError(w, r, req.RedirectURI, req.State, "login_required", "End-user authentication is required.")
+			return
+		}
+
+		p.renderLogin(w, r, http.StatusOK, render.LoginPage{
+			ReturnTo:  resumeURL(r.Form),
+			LoginHint: r.Form.Get("login_hint"),
+		})
+		return
+	}
+
+	session, ok = p.chooseAccount(w, r, session, req)
+	if !ok {
+		return
+	}
+
+	if p.RequireEssentialClaims && req.Claims.hasEssential() {
+		missing, err := p.missingEssentialClaims(r.Context(), session.UserID, req.Claims)
+		if err != nil {
+			slog.Error("Cannot load user claims.", "err", err)
+			internalError(w, err)
+			return
+		}
+		if len(missing) > 0 {
+			p.redirectError(w, r, req.RedirectURI, req.State, "access_denied", "Essential claims are not available: "+strings.Join(missing, " "))
+			return
+		}
+	}
+
+	needed, err := p.needsConsent(r.Context(), session.UserID, req)
+	if err != nil {
+		slog.Error("Cannot load consent.", "err", err)
+		internalError(w, err)
+		return
+	}
+	if needed {
+		if req.Prompt.None {
+			p.redirectError(w, r, req.RedirectURI, req.State, "consent_required", "End-user consent is required.")
+			return
+		}
+
+		p.promptConsent(w, r, session, req)
+		return
+	}
+
+	p.issueCode(w, r, session, req)
+}
+
+// missingEssentialClaims returns the essential claims in req that the user
+// has no value for.
+func (p *Provider) missingEssentialClaims(ctx context.Context, userID int64, req ClaimsRequest) ([]string, error) {
+	user, err := p.Users.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := p.Profiles.GetProfile(ctx, userID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	return MissingEssentialClaims(user, profile, req), nil
+}
+
+func (p *Provider) issueCode(w http.ResponseWriter, r *http.Request, session store.Session, req authorizeRequest) {
+	// The nonce is only spent here, once the request is granted, as the
+	// same request is replayed through login and consent to get this far.
+	if req.Nonce != "" && !req.NonceReuse && p.nonceReplayWindow() > 0 {
+		err := p.spend(r.Context(), replayNonce, req.ClientID, req.Nonce, p.nonceReplayWindow())
+		if errors.Is(err, errNonceReplayed) {
+			p.redirectError(w, r, req.RedirectURI, req.State, "invalid_request", "The nonce has already been used.")
+			return
+		}
+		if err != nil {
+			slog.Error("Cannot check nonce for replay.", "err", err)
+			p.redirectError(w, r, req.RedirectURI, req.State, "temporarily_unavailable", "")
+			return
+		}
+	}
+
+	code, err := randomToken(p.CodePolicy.length())
+	if err != nil {
+		slog.Error("Cannot generate authorization code.", "err", err)
+		p.redirectError(w, r, req.RedirectURI, req.State, "server_error", "")
+		return
+	}
+
+	var claims []byte
+	if !req.Claims.IsZero() {
+		claims, err = json.Marshal(req.Claims)
+		if err != nil {
+			slog.Error("Cannot encode claims request.", "err", err)
+			p.redirectError(w, r, req.RedirectURI, req.State, "server_error", "")
+			return
+		}
+	}
+
+	var now = p.now()
+	err = p.Codes.CreateAuthCode(r.Context(), store.AuthCode{
+		Code:                code,
+		ClientID:            req.ClientID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               strings.Join(req.Scopes, " "),
+		Nonce:               req.Nonce,
+		Claims:              string(claims),
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		UserID:              session.UserID,
+		AuthTime:            session.AuthTime,
+		CreatedAt:           now,
+		ExpiresAfter:        now.Add(p.CodePolicy.ttl()),
+	})
+	if err != nil {
+		slog.Error("Cannot store authorization code.", "err", err)
+		if errors.Is(err, store.ErrUnavailable) {
+			p.redirectError(w, r, req.RedirectURI, req.State, "temporarily_unavailable", "")
+			return
+		}
+		p.redirectError(w, r, req.RedirectURI, req.State, "server_error", "")
+		return
+	}
+
+	params := url.Values{"code": {code}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	p.redirect(w, r, req.RedirectURI, params)
+}
+
+// matchRedirectURI returns the redirect URI to use for the request. When the
+// client has exactly one registered URI the parameter may be omitted,
+// otherwise it must match a registered URI exactly.
+func matchRedirectURI(client store.Client, requested string) (redirectURI string, ok bool) {
+	if requested == "" {
+		if len(client.RedirectURIs) == 1 {
+			return client.RedirectURIs[0], true
+		}
+		return "", false
+	}
+
+	if slices.Contains(client.RedirectURIs, requested) {
+		return requested, true
+	}
+
+	return "", false
+}
+
+// resumeURL rebuilds the authorization request so it can be resumed once the
+// user has logged in. The login prompt is dropped since it has been satisfied
+// by the time the request is resumed.
+func resumeURL(form url.Values) string {
+	params := url.Values{}
+	for k, v := range form {
+		params[k] = slices.Clone(v)
+	}
+	dropPrompt(params, "login")
+
+	return "/authorize?" + params.Encode()
+}
+
+func (p *Provider) redirectError(w http.ResponseWriter, r *http.Request, redirectURI, state, code, description string) {
+	params := url.Values{"error": {code}}
+	if description != "" {
+		params.Set("error_description", description)
+	}
+	if state != "" {
+		params.Set("state", state)
+	}
+
+	p.redirect(w, r, redirectURI, params)
+}
+
+// redirect sends an authorization response to the client. Every response,
+// success or error, carries iss (RFC 9207) so clients can detect mix-up
+// attacks.
+func (p *Provider) redirect(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	if p.Issuer != "" {
+		params.Set("iss", p.Issuer)
+	}
+
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "Invalid redirect_uri.", http.StatusBadRequest)
+		return
+	}
+
+	var query url.Values = u.Query()
+	for k, v := range params {
+		query[k] = v
+	}
+	u.RawQuery = query.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
@@ -0,0 +1,290 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/authn"
+	"github.com/ehubscher/goidp/internal/oauth"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const (
+	testClientID    = "client1"
+	testRedirectURI = "https://client.example/cb"
+	testEmail       = "example1@email.com"
+	testPassword    = "password123"
+	// bcrypt hash of testPassword with cost 4 so tests stay fast.
+	testPasswordHash = "$bcrypt$c=4$JDJhJDA0JDVWaEhScW5XTUtESmN6U3NyL3FMZHV5UnBsamsxV08wTjNINXNmdVdFd0tmdU5MZ1I4ck02"
+	testSessionID    = "existing-session"
+)
+
+type testEnv struct {
+	provider *oauth.Provider
+	mux      *http.ServeMux
+	sessions *store.MemorySessionStore
+	user     store.User
+	now      time.Time
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	t.Setenv("BCRYPT_COST", "4")
+
+	users := store.NewMemoryUserStore()
+	user, err := users.CreateUser(context.Background(), testEmail, testPasswordHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := &testEnv{
+		sessions: store.NewMemorySessionStore(),
+		user:     user,
+		now:      time.Date(2024, 3, 17, 12, 0, 0, 0, time.UTC),
+	}
+	consents := store.NewMemoryConsentStore()
+	err = consents.SaveConsent(context.Background(), store.Consent{
+		UserID:   user.ID,
+		ClientID: testClientID,
+		Scopes:   []string{"openid"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.provider = &oauth.Provider{
+		Users: users,
+		Clients: store.NewMemoryClientStore(store.Client{
+			ID:           testClientID,
+			RedirectURIs: []string{testRedirectURI},
+		}),
+		Sessions: env.sessions,
+		Codes:    store.NewMemoryAuthCodeStore(),
+		Profiles: store.NewMemoryProfileStore(),
+		Consents: consents,
+		// bcrypt at the minimum cost keeps hashing cheap, and unlike argon2id
+		// needs no other configuration.
+		HashAlgorithm: "bcrypt",
+		Now:           func() time.Time { return env.now },
+	}
+	env.mux = http.NewServeMux()
+	env.provider.RegisterHandlers(env.mux)
+
+	return env
+}
+
+// withSession stores a session authenticated an hour ago and returns its
+// cookie.
+func (env *testEnv) withSession(t *testing.T) *http.Cookie {
+	t.Helper()
+
+	err := env.sessions.CreateSession(context.Background(), store.Session{
+		ID:        testSessionID,
+		UserID:    env.user.ID,
+		AuthTime:  env.now.Add(-time.Hour),
+		ExpiresAt: env.now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &http.Cookie{Name: "goidp_session", Value: testSessionID}
+}
+
+func (env *testEnv) do(r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	env.mux.ServeHTTP(rec, r)
+	return rec
+}
+
+func authorizeURL(extra url.Values) string {
+	params := url.Values{
+		"client_id":     {testClientID},
+		"redirect_uri":  {testRedirectURI},
+		"response_type": {"code"},
+		"scope":         {"openid"},
+		"state":         {"xyz"},
+	}
+	for k, v := range extra {
+		params[k] = v
+	}
+
+	return "/authorize?" + params.Encode()
+}
+
+func redirectParams(t *testing.T, rec *httptest.ResponseRecorder) url.Values {
+	t.Helper()
+
+	if rec.Code != http.StatusFound {
+		t.Fatalf("got: %d, want: %d", rec.Code, http.StatusFound)
+	}
+	u, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u.Query()
+}
+
+// watchSecretsEqual records the comparisons authn.SecretsEqual makes for
+// the rest of the test. The returned func reports whether presented was
+// compared against expected.
+func watchSecretsEqual(t *testing.T) func(presented, expected string) bool {
+	t.Helper()
+
+	var compared [][2]string
+	authn.OnCompare = func(presented, expected string) {
+		compared = append(compared, [2]string{presented, expected})
+	}
+	t.Cleanup(func() { authn.OnCompare = nil })
+
+	return func(presented, expected string) bool {
+		return slices.Contains(compared, [2]string{presented, expected})
+	}
+}
+
+func TestAuthorizeReusesSession(t *testing.T) {
+	env := newTestEnv(t)
+	cookie := env.withSession(t)
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(nil), nil)
+	r.AddCookie(cookie)
+
+	params := redirectParams(t, env.do(r))
+	if params.Get("code") == "" {
+		t.Errorf("got: %v, want: a code", params)
+	}
+	if params.Get("state") != "xyz" {
+		t.Errorf("got: %s, want: %s", params.Get("state"), "xyz")
+	}
+}
+
+func TestAuthorizePromptLogin(t *testing.T) {
+	env := newTestEnv(t)
+	cookie := env.withSession(t)
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{"prompt": {"login"}}), nil)
+	r.AddCookie(cookie)
+
+	rec := env.do(r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d, want: %d", rec.Code, http.StatusOK)
+	}
+	if !strings.Contains(rec.Body.String(), `action="/login"`) {
+		t.Fatalf("got: %s, want: the login form", rec.Body.String())
+	}
+
+	// Log in again and resume the authorization request.
+	env.now = env.now.Add(time.Minute)
+	form := url.Values{
+		"email":     {testEmail},
+		"password":  {testPassword},
+		"return_to": {authorizeURL(nil)},
+	}
+	r = postForm("/login", form)
+	r.AddCookie(cookie)
+
+	rec = env.do(r)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("got: %d, want: %d", rec.Code, http.StatusFound)
+	}
+
+	var fresh *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "goidp_session" {
+			fresh = c
+		}
+	}
+	if fresh == nil || fresh.Value == testSessionID {
+		t.Fatalf("got: %v, want: a new session cookie", fresh)
+	}
+
+	session, err := env.sessions.GetSession(context.Background(), fresh.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !session.AuthTime.Equal(env.now) {
+		t.Errorf("got: %v, want: %v", session.AuthTime, env.now)
+	}
+
+	_, err = env.sessions.GetSession(context.Background(), testSessionID)
+	if err != store.ErrNotFound {
+		t.Errorf("got: %v, want: %v", err, store.ErrNotFound)
+	}
+}
+
+func TestAuthorizePromptLoginResume(t *testing.T) {
+	env := newTestEnv(t)
+	cookie := env.withSession(t)
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{"prompt": {"login consent"}}), nil)
+	r.AddCookie(cookie)
+
+	rec := env.do(r)
+	if strings.Contains(rec.Body.String(), "prompt=login") {
+		t.Errorf("got: %s, want: return_to without prompt=login", rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "prompt=consent") {
+		t.Errorf("got: %s, want: return_to keeping prompt=consent", rec.Body.String())
+	}
+}
+
+func TestAuthorizePromptLoginNone(t *testing.T) {
+	env := newTestEnv(t)
+	cookie := env.withSession(t)
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{"prompt": {"login none"}}), nil)
+	r.AddCookie(cookie)
+
+	params := redirectParams(t, env.do(r))
+	if params.Get("error") != "invalid_request" {
+		t.Errorf("got: %s, want: %s", params.Get("error"), "invalid_request")
+	}
+	if params.Get("code") != "" {
+		t.Errorf("got: %s, want: no code", params.Get("code"))
+	}
+}
+
+func TestAuthorizePromptNoneWithoutSession(t *testing.T) {
+	env := newTestEnv(t)
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{"prompt": {"none"}}), nil)
+
+	params := redirectParams(t, env.do(r))
+	if params.Get("error") != "login_required" {
+		t.Errorf("got: %s, want: %s", params.Get("error"), "login_required")
+	}
+}
+
+func TestAuthorizeIssuerParameter(t *testing.T) {
+	var requests = []struct {
+		name  string
+		extra url.Values
+		key   string
+	}{
+		{"success", nil, "code"},
+		{"error", url.Values{"prompt": {"none login"}}, "error"},
+	}
+
+	for _, c := range requests {
+		env := newTestEnv(t)
+		env.provider.Issuer = "https://idp.example"
+
+		r := httptest.NewRequest(http.MethodGet, authorizeURL(c.extra), nil)
+		r.AddCookie(env.withSession(t))
+
+		params := redirectParams(t, env.do(r))
+		if params.Get(c.key) == "" {
+			t.Errorf("%s got: %v, want: %s", c.name, params, c.key)
+		}
+		if params.Get("iss") != "https://idp.example" {
+			t.Errorf("%s got: %s, want: %s", c.name, params.Get("iss"), "https://idp.example")
+		}
+	}
+}
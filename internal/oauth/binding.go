@@ -0,0 +1,73 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+// Refresh token bindings a client can be configured with.
+const (
+	// RefreshBindingIP binds refresh tokens to the client's network: the
+	// /24 of an IPv4 address or the /64 of an IPv6 one, so a change of
+	// address within it is tolerated.
+	RefreshBindingIP = "ip"
+	// RefreshBindingDevice binds refresh tokens to the device_id the client
+	// sends with every token request.
+	RefreshBindingDevice = "device"
+)
+
+var (
+	ErrUnsupportedRefreshBinding = errors.New("unsupported refresh token binding")
+	errMissingDeviceID           = errors.New("device_id is required")
+)
+
+func validateRefreshBinding(binding string) error {
+	switch binding {
+	case "", RefreshBindingIP, RefreshBindingDevice:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedRefreshBinding, binding)
+	}
+}
+
+// refreshBinding returns the fingerprint of the context r comes from under
+// the client's binding, or "" if its refresh tokens aren't bound. Only a
+// hash is kept, so stored tokens don't record IPs or device ids.
+func (p *Provider) refreshBinding(r *http.Request, client store.Client) (string, error) {
+	var context string
+	switch client.RefreshTokenBinding {
+	case "":
+		return "", nil
+	case RefreshBindingIP:
+		addr, err := netip.ParseAddr(p.TrustedProxies.ClientIP(r))
+		if err != nil {
+			return "", fmt.Errorf("cannot parse client IP: %w", err)
+		}
+		bits := 64
+		if addr.Is4() {
+			bits = 24
+		}
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			return "", err
+		}
+		context = "ip:" + prefix.String()
+	case RefreshBindingDevice:
+		deviceID := r.PostForm.Get("device_id")
+		if deviceID == "" {
+			return "", errMissingDeviceID
+		}
+		context = "device:" + deviceID
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedRefreshBinding, client.RefreshTokenBinding)
+	}
+
+	sum := sha256.Sum256([]byte(context))
+	return hex.EncodeToString(sum[:]), nil
+}
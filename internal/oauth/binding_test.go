@@ -0,0 +1,132 @@
+package oauth_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/oauth"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+// bindingRequest is a token request for form coming from remoteAddr.
+func bindingRequest(form url.Values, remoteAddr string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Authorization", basicAuth(testClientID, testClientSecret))
+	r.RemoteAddr = remoteAddr
+
+	return r
+}
+
+// withBoundRefreshToken configures the test client with binding and returns
+// a refresh token issued to a code exchange sent with extra from remoteAddr.
+func (env *testEnv) withBoundRefreshToken(t *testing.T, binding, remoteAddr string, extra url.Values) string {
+	t.Helper()
+
+	env.withRefreshToken(t)
+	clients := env.provider.Clients.(*store.MemoryClientStore)
+	client, err := clients.GetClient(context.Background(), testClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.RefreshTokenBinding = binding
+	err = clients.PutClient(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{"scope": {grantedScope}}), nil)
+	r.AddCookie(env.freshSession(t, "bound"))
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {redirectParams(t, env.do(r)).Get("code")},
+		"redirect_uri": {testRedirectURI},
+	}
+	for k, v := range extra {
+		form[k] = v
+	}
+
+	rec := env.do(bindingRequest(form, remoteAddr))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusOK)
+	}
+
+	return decodeTokenResult(t, rec).RefreshToken
+}
+
+func TestRefreshBindingIP(t *testing.T) {
+	var requests = []struct {
+		name       string
+		remoteAddr string
+		status     int
+	}{
+		{"same address", "192.0.2.1:1234", http.StatusOK},
+		{"same network", "192.0.2.77:4321", http.StatusOK},
+		{"other network", "198.51.100.1:1234", http.StatusBadRequest},
+	}
+
+	for _, c := range requests {
+		t.Run(c.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			refreshToken := env.withBoundRefreshToken(t, oauth.RefreshBindingIP, "192.0.2.1:1234", nil)
+
+			form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}}
+			rec := env.do(bindingRequest(form, c.remoteAddr))
+			if rec.Code != c.status {
+				t.Errorf("got: %d %s, want: %d", rec.Code, rec.Body, c.status)
+			}
+			if c.status != http.StatusOK && decodeTokenResult(t, rec).Error != "invalid_grant" {
+				t.Error("got: another error, want: invalid_grant")
+			}
+		})
+	}
+}
+
+func TestRefreshBindingDevice(t *testing.T) {
+	var requests = []struct {
+		name     string
+		deviceID string
+		status   int
+		error    string
+	}{
+		{"same device", "phone-1", http.StatusOK, ""},
+		{"other device", "phone-2", http.StatusBadRequest, "invalid_grant"},
+		{"no device", "", http.StatusBadRequest, "invalid_request"},
+	}
+
+	for _, c := range requests {
+		t.Run(c.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			refreshToken := env.withBoundRefreshToken(t, oauth.RefreshBindingDevice, "192.0.2.1:1234", url.Values{"device_id": {"phone-1"}})
+
+			// The device binding holds whatever address the client moves to.
+			form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}}
+			if c.deviceID != "" {
+				form.Set("device_id", c.deviceID)
+			}
+			rec := env.do(bindingRequest(form, "198.51.100.1:1234"))
+			if rec.Code != c.status {
+				t.Fatalf("got: %d %s, want: %d", rec.Code, rec.Body, c.status)
+			}
+			if resp := decodeTokenResult(t, rec); resp.Error != c.error {
+				t.Errorf("got: %q, want: %q", resp.Error, c.error)
+			}
+		})
+	}
+}
+
+func TestValidateClientRefreshBinding(t *testing.T) {
+	err := oauth.ValidateClient(store.Client{
+		ID:                  testClientID,
+		RedirectURIs:        []string{testRedirectURI},
+		RefreshTokenBinding: "tls",
+	}, false)
+	if !errors.Is(err, oauth.ErrUnsupportedRefreshBinding) {
+		t.Errorf("got: %v, want: %v", err, oauth.ErrUnsupportedRefreshBinding)
+	}
+}
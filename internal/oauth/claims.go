@@ -0,0 +1,191 @@
+package oauth
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+// scopeClaims lists the claims each scope releases, per OIDC Core 5.4.
+var scopeClaims = map[string][]string{
+	"profile": {"name", "given_name", "family_name", "picture", "locale", "updated_at"},
+	"email":   {"email", "email_verified"},
+}
+
+// ClaimRequest is an individual claim request, per OIDC Core 5.5.1. A null
+// request is represented by a nil pointer.
+type ClaimRequest struct {
+	Essential bool  `json:"essential,omitempty"`
+	Value     any   `json:"value,omitempty"`
+	Values    []any `json:"values,omitempty"`
+}
+
+// ClaimsRequest is the value of the claims authorization parameter.
+type ClaimsRequest struct {
+	UserInfo map[string]*ClaimRequest `json:"userinfo,omitempty"`
+	IDToken  map[string]*ClaimRequest `json:"id_token,omitempty"`
+}
+
+// ParseClaimsRequest parses the claims parameter. An empty raw value is an
+// empty request. Any other top-level members are ignored.
+func ParseClaimsRequest(raw string) (req ClaimsRequest, err error) {
+	if raw == "" {
+		return ClaimsRequest{}, nil
+	}
+
+	err = json.Unmarshal([]byte(raw), &req)
+	if err != nil {
+		return ClaimsRequest{}, err
+	}
+
+	return req, nil
+}
+
+func (req ClaimsRequest) IsZero() bool {
+	return len(req.UserInfo) == 0 && len(req.IDToken) == 0
+}
+
+// availableClaims returns every claim we could release for the user.
+func availableClaims(user store.User, profile store.Profile) map[string]any {
+	claims := map[string]any{
+		"sub":            strconv.FormatInt(user.ID, 10),
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+	}
+
+	var strs = []struct {
+		name, value string
+	}{
+		{"name", profile.Name},
+		{"given_name", profile.GivenName},
+		{"family_name", profile.FamilyName},
+		{"picture", profile.Picture},
+		{"locale", profile.Locale},
+	}
+	for _, s := range strs {
+		if s.value != "" {
+			claims[s.name] = s.value
+		}
+	}
+	if !profile.UpdatedAt.IsZero() {
+		claims["updated_at"] = profile.UpdatedAt.Unix()
+	}
+
+	return claims
+}
+
+// UserClaims builds the claims released for a user under the given scopes.
+// It is shared by /userinfo and the id_token builder so both always agree.
+func UserClaims(user store.User, profile store.Profile, scopes []string) map[string]any {
+	available := availableClaims(user, profile)
+	claims := map[string]any{"sub": available["sub"]}
+
+	for scope, names := range scopeClaims {
+		if !slices.Contains(scopes, scope) {
+			continue
+		}
+		for _, name := range names {
+			if v, ok := available[name]; ok {
+				claims[name] = v
+			}
+		}
+	}
+
+	return claims
+}
+
+// ReleaseClaims returns the sub and the individually requested claims from
+// one member of a claims request. A requested claim is released only when
+// one of the granted scopes covers it, so the claims parameter can't reach
+// past what the user consented to. Requested claims we don't know or don't
+// hold for the user are left out.
+func ReleaseClaims(user store.User, profile store.Profile, scopes []string, requested map[string]*ClaimRequest) map[string]any {
+	available := availableClaims(user, profile)
+	claims := map[string]any{"sub": available["sub"]}
+
+	for name := range requested {
+		if !claimGranted(name, scopes) {
+			continue
+		}
+		if v, ok := available[name]; ok {
+			claims[name] = v
+		}
+	}
+
+	return claims
+}
+
+// userInfoClaims returns the names of the claims requested for userinfo in
+// the raw claims parameter, sorted and space-separated, for access tokens to
+// carry. A request that doesn't parse was refused at /authorize already.
+func userInfoClaims(raw string) string {
+	req, err := ParseClaimsRequest(raw)
+	if err != nil {
+		return ""
+	}
+
+	var names []string
+	for name := range req.UserInfo {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return strings.Join(names, " ")
+}
+
+// requestedClaims is the claims request member for names, a list of claims
+// requested without further detail.
+func requestedClaims(names []string) map[string]*ClaimRequest {
+	requested := make(map[string]*ClaimRequest, len(names))
+	for _, name := range names {
+		requested[name] = nil
+	}
+
+	return requested
+}
+
+// claimGranted reports whether one of scopes releases the claim name.
+func claimGranted(name string, scopes []string) bool {
+	for _, scope := range scopes {
+		if slices.Contains(scopeClaims[scope], name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MissingEssentialClaims returns the essential claims in req, from either
+// member, that the user has no value for. The result is sorted.
+func MissingEssentialClaims(user store.User, profile store.Profile, req ClaimsRequest) (missing []string) {
+	available := availableClaims(user, profile)
+
+	for _, member := range []map[string]*ClaimRequest{req.UserInfo, req.IDToken} {
+		for name, c := range member {
+			if c == nil || !c.Essential {
+				continue
+			}
+			if _, ok := available[name]; !ok && !slices.Contains(missing, name) {
+				missing = append(missing, name)
+			}
+		}
+	}
+	slices.Sort(missing)
+
+	return missing
+}
+
+func (req ClaimsRequest) hasEssential() bool {
+	for _, member := range []map[string]*ClaimRequest{req.UserInfo, req.IDToken} {
+		for _, c := range member {
+			if c != nil && c.Essential {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,280 @@
+package oauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/jose"
+	"github.com/ehubscher/goidp/internal/oauth"
+	"github.com/ehubscher/goidp/internal/problem"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+var claimScopes = []struct {
+	scopes []string
+	want   []string
+	absent []string
+}{
+	{[]string{"openid"}, []string{"sub"}, []string{"name", "email"}},
+	{[]string{"openid", "profile"}, []string{"sub", "name", "given_name", "family_name", "locale", "updated_at"}, []string{"email", "picture"}},
+	{[]string{"openid", "email"}, []string{"sub", "email", "email_verified"}, []string{"name"}},
+}
+
+func TestUserClaims(t *testing.T) {
+	user := store.User{ID: 7, Email: "example1@email.com", EmailVerified: true}
+	profile := store.Profile{
+		UserID:     7,
+		Name:       "Jane Doe",
+		GivenName:  "Jane",
+		FamilyName: "Doe",
+		Locale:     "en-CA",
+		UpdatedAt:  time.Unix(1711962000, 0),
+	}
+
+	for _, c := range claimScopes {
+		claims := oauth.UserClaims(user, profile, c.scopes)
+		for _, name := range c.want {
+			if _, ok := claims[name]; !ok {
+				t.Errorf("scopes %v got: %v, want claim: %s", c.scopes, claims, name)
+			}
+		}
+		for _, name := range c.absent {
+			if _, ok := claims[name]; ok {
+				t.Errorf("scopes %v got: %v, want no claim: %s", c.scopes, claims, name)
+			}
+		}
+	}
+
+	claims := oauth.UserClaims(user, profile, []string{"openid", "profile"})
+	if claims["sub"] != "7" || claims["name"] != "Jane Doe" {
+		t.Errorf("got: %v, want: sub 7 and name Jane Doe", claims)
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	env := newTestEnv(t)
+
+	r := httptest.NewRequest(http.MethodPut, "/account/profile", strings.NewReader(`{"name":"Jane Doe"}`))
+	rec := env.do(r)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusUnauthorized)
+	}
+	if got := rec.Header().Get("Content-Type"); got != problem.ContentType {
+		t.Errorf("got: %s, want: %s", got, problem.ContentType)
+	}
+
+	r = httptest.NewRequest(http.MethodPut, "/account/profile", strings.NewReader(`{"name":"Jane Doe","given_name":"Jane"}`))
+	r.AddCookie(env.withSession(t))
+	rec = env.do(r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d, want: %d", rec.Code, http.StatusOK)
+	}
+
+	var doc map[string]string
+	err := json.NewDecoder(rec.Body).Decode(&doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc["name"] != "Jane Doe" || doc["given_name"] != "Jane" {
+		t.Errorf("got: %v, want: the updated profile", doc)
+	}
+
+	profile, err := env.provider.Profiles.GetProfile(r.Context(), env.user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := oauth.UserClaims(env.user, profile, []string{"openid", "profile"})
+	if claims["given_name"] != "Jane" {
+		t.Errorf("got: %v, want: given_name Jane", claims)
+	}
+}
+
+func TestReleaseRequestedClaims(t *testing.T) {
+	user := store.User{ID: 7, Email: "example1@email.com"}
+	requested := map[string]*oauth.ClaimRequest{
+		"email":       nil,
+		"nickname":    {Essential: true},
+		"not_a_claim": nil,
+	}
+
+	claims := oauth.ReleaseClaims(user, store.Profile{}, []string{"openid"}, requested)
+	if _, ok := claims["email"]; ok {
+		t.Errorf("got: %v, want: no email without the email scope", claims)
+	}
+
+	claims = oauth.ReleaseClaims(user, store.Profile{}, []string{"openid", "email"}, requested)
+	if claims["email"] != "example1@email.com" {
+		t.Errorf("got: %v, want: the requested email claim", claims)
+	}
+	for _, name := range []string{"nickname", "not_a_claim", "email_verified"} {
+		if _, ok := claims[name]; ok {
+			t.Errorf("got: %v, want no claim: %s", claims, name)
+		}
+	}
+}
+
+const claimsParameter = `{"id_token":{"email":null,"given_name":{"essential":true}},"userinfo":{"locale":null}}`
+
+func TestAuthorizeClaimsParameter(t *testing.T) {
+	env := newTestEnv(t)
+	err := env.provider.Profiles.UpdateProfile(context.Background(), store.Profile{UserID: env.user.ID, GivenName: "Jane"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.provider.Consents.SaveConsent(context.Background(), store.Consent{
+		UserID:   env.user.ID,
+		ClientID: testClientID,
+		Scopes:   []string{"openid", "email", "profile"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{"scope": {"openid email profile"}, "claims": {claimsParameter}}), nil)
+	r.AddCookie(env.withSession(t))
+	code := redirectParams(t, env.do(r)).Get("code")
+
+	redeemed, err := env.provider.RedeemCode(context.Background(), code, testClientID, testRedirectURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := oauth.ParseClaimsRequest(redeemed.Claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := env.provider.Profiles.GetProfile(context.Background(), env.user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idToken := oauth.ReleaseClaims(env.user, profile, strings.Fields(redeemed.Scope), req.IDToken)
+	if idToken["email"] != testEmail || idToken["given_name"] != "Jane" {
+		t.Errorf("got: %v, want: the requested id_token claims", idToken)
+	}
+	if _, ok := idToken["locale"]; ok {
+		t.Errorf("got: %v, want: locale only at userinfo", idToken)
+	}
+}
+
+func TestIDTokenClaimsLimitedToScopes(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{"claims": {`{"id_token":{"email":null}}`}}), nil)
+	r.AddCookie(env.withSession(t))
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {redirectParams(t, env.do(r)).Get("code")},
+		"redirect_uri": {testRedirectURI},
+	}
+
+	rec := env.exchange(t, basicAuth(testClientID, testClientSecret), form)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusOK)
+	}
+	idToken, _ := decodeMap(t, rec)["id_token"].(string)
+	jws, err := jose.Parse(idToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims map[string]any
+	err = json.Unmarshal(jws.Payload, &claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := claims["email"]; ok {
+		t.Errorf("got: %v, want: no email for scope openid", claims)
+	}
+}
+
+func TestAuthorizeEssentialClaimUnavailable(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		env := newTestEnv(t)
+		env.provider.RequireEssentialClaims = strict
+
+		// The user has no profile, so the essential given_name can't be met.
+		r := httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{"claims": {claimsParameter}}), nil)
+		r.AddCookie(env.withSession(t))
+		params := redirectParams(t, env.do(r))
+
+		if strict && params.Get("error") != "access_denied" {
+			t.Errorf("strict got: %v, want: access_denied", params)
+		}
+		if !strict && params.Get("code") == "" {
+			t.Errorf("got: %v, want: a code without the claim", params)
+		}
+	}
+}
+
+func TestAuthorizeMalformedClaims(t *testing.T) {
+	env := newTestEnv(t)
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{"claims": {"{not json"}}), nil)
+	r.AddCookie(env.withSession(t))
+	if params := redirectParams(t, env.do(r)); params.Get("error") != "invalid_request" {
+		t.Errorf("got: %v, want: invalid_request", params)
+	}
+}
+
+func TestUserInfoRequestedClaims(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	err := env.provider.Consents.SaveConsent(context.Background(), store.Consent{
+		UserID:   env.user.ID,
+		ClientID: testClientID,
+		Scopes:   []string{"openid", "email"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{"scope": {"openid email"}, "claims": {`{"userinfo":{"email":null}}`}}), nil)
+	r.AddCookie(env.withSession(t))
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {redirectParams(t, env.do(r)).Get("code")},
+		"redirect_uri": {testRedirectURI},
+	}
+
+	rec := env.exchange(t, basicAuth(testClientID, testClientSecret), form)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusOK)
+	}
+	resp := decodeMap(t, rec)
+
+	for name, want := range map[string]string{"id_token": "", "access_token": "email"} {
+		tok, _ := resp[name].(string)
+		jws, err := jose.Parse(tok)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var claims map[string]any
+		err = json.Unmarshal(jws.Payload, &claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := claims["email"]; ok {
+			t.Errorf("%s got: %v, want: email only at userinfo", name, claims)
+		}
+		if got, _ := claims["userinfo_claims"].(string); got != want {
+			t.Errorf("%s userinfo_claims got: %q, want: %q", name, got, want)
+		}
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+	r.Header.Set("Authorization", "Bearer "+resp["access_token"].(string))
+	rec = env.do(r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d, want: %d", rec.Code, http.StatusOK)
+	}
+	if claims := decodeMap(t, rec); claims["email"] != testEmail {
+		t.Errorf("got: %v, want: the email requested for userinfo", claims)
+	}
+}
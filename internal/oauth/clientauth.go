@@ -0,0 +1,197 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/ehubscher/goidp/internal/httpauth"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+// Client authentication methods, as registered in
+// token_endpoint_auth_method (RFC 7591 section 2).
+const (
+	AuthMethodSecretBasic = "client_secret_basic"
+	AuthMethodSecretPost  = "client_secret_post"
+	AuthMethodSecretJWT   = "client_secret_jwt"
+	AuthMethodPrivateKey  = "private_key_jwt"
+	// AuthMethodNone is a public client sending only its client_id.
+	AuthMethodNone = "none"
+)
+
+var (
+	// ErrMalformedClientAuth means the Authorization header isn't valid
+	// Basic credentials.
+	ErrMalformedClientAuth   = errors.New("malformed client authentication")
+	ErrUnsupportedAuthMethod = errors.New("unsupported token endpoint auth method")
+)
+
+// validateAuthMethod checks that client has the credentials its
+// TokenEndpointAuthMethod needs.
+func validateAuthMethod(client store.Client) error {
+	var ok bool
+	switch client.TokenEndpointAuthMethod {
+	case "":
+		return nil
+	case AuthMethodSecretBasic, AuthMethodSecretPost:
+		ok = client.SecretHash != ""
+	case AuthMethodSecretJWT:
+		ok = client.Secret != ""
+	case AuthMethodPrivateKey:
+		ok = client.JWKS != "" || client.JWKSURI != ""
+	case AuthMethodNone:
+		ok = client.Type() == store.ClientPublic
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedAuthMethod, client.TokenEndpointAuthMethod)
+	}
+	if !ok {
+		return fmt.Errorf("%s doesn't fit the client's credentials", client.TokenEndpointAuthMethod)
+	}
+
+	return nil
+}
+
+// clientCredentials holds the candidate spellings of credentials sent with
+// HTTP Basic. RFC 6749 section 2.3.1 requires form-urlencoding them before
+// base64, but plenty of clients skip that, so the raw values are kept as a
+// fallback for when the decoded ones don't authenticate.
+type clientCredentials struct {
+	ids     []string
+	secrets []string
+}
+
+// parseBasicClientAuth parses an Authorization: Basic header value. ok is
+// false when the header uses another scheme or is absent.
+func parseBasicClientAuth(header string) (creds clientCredentials, ok bool, err error) {
+	rawID, rawSecret, err := httpauth.ParseBasic(header)
+	if errors.Is(err, httpauth.ErrMissing) || errors.Is(err, httpauth.ErrScheme) {
+		return clientCredentials{}, false, nil
+	}
+	if err != nil {
+		return clientCredentials{}, true, fmt.Errorf("%w: %w", ErrMalformedClientAuth, err)
+	}
+
+	return clientCredentials{
+		ids:     formDecodedCandidates(rawID),
+		secrets: formDecodedCandidates(rawSecret),
+	}, true, nil
+}
+
+// formDecodedCandidates returns the form-decoded value of s followed by s
+// itself if that differs. A value that isn't valid form encoding can only
+// have been sent raw.
+func formDecodedCandidates(s string) []string {
+	decoded, err := url.QueryUnescape(s)
+	if err != nil || decoded == s {
+		return []string{s}
+	}
+
+	return []string{decoded, s}
+}
+
+// authenticateClient authenticates the client of a token, introspection or
+// revocation request, from a client assertion, HTTP Basic or, failing that,
+// client_secret_post form parameters. A client with a
+// TokenEndpointAuthMethod must use exactly that method, even when another
+// would authenticate it. Any failure is ErrInvalidCredentials.
+func (p *Provider) authenticateClient(r *http.Request) (store.Client, error) {
+	client, method, err := p.clientAuthMethod(r)
+	if err != nil {
+		return store.Client{}, err
+	}
+	if client.TokenEndpointAuthMethod != "" && client.TokenEndpointAuthMethod != method {
+		slog.Warn("Rejected client authentication with an unregistered method.", "client_id", client.ID, "method", method)
+		return store.Client{}, ErrInvalidCredentials
+	}
+
+	return client, nil
+}
+
+// clientAuthMethod authenticates the client by whichever method the
+// request uses, and returns which it was.
+func (p *Provider) clientAuthMethod(r *http.Request) (client store.Client, method string, err error) {
+	if r.PostForm.Has("client_assertion") || r.PostForm.Has("client_assertion_type") {
+		return p.authenticateAssertion(r)
+	}
+
+	method = AuthMethodSecretBasic
+	creds, ok, err := parseBasicClientAuth(r.Header.Get("Authorization"))
+	if err != nil {
+		return store.Client{}, "", ErrInvalidCredentials
+	}
+	if !ok {
+		if r.PostForm.Get("client_id") == "" {
+			return store.Client{}, "", ErrInvalidCredentials
+		}
+		method = AuthMethodSecretPost
+		creds = clientCredentials{
+			ids:     []string{r.PostForm.Get("client_id")},
+			secrets: []string{r.PostForm.Get("client_secret")},
+		}
+	}
+
+	for _, id := range creds.ids {
+		client, err := p.lookupClient(r.Context(), id)
+		if err != nil {
+			return store.Client{}, "", err
+		}
+		if client.ID == "" {
+			continue
+		}
+		// Public clients have nothing to check, so only the method itself
+		// is: a client_id posted alone.
+		if client.TokenEndpointAuthMethod == AuthMethodNone {
+			if method == AuthMethodSecretPost && !r.PostForm.Has("client_secret") {
+				return client, AuthMethodNone, nil
+			}
+			return store.Client{}, "", ErrInvalidCredentials
+		}
+
+		for _, secret := range creds.secrets {
+			match, err := p.verifySecret(r.Context(), secret, client.SecretHash)
+			if err == nil && !match {
+				match, err = p.verifyPreviousSecret(r.Context(), client, secret)
+			}
+			if err != nil {
+				return store.Client{}, "", err
+			}
+			if match {
+				return client, method, nil
+			}
+		}
+
+		return store.Client{}, "", ErrInvalidCredentials
+	}
+
+	// Spend the same effort on an unknown client as on a wrong secret.
+	_, err = p.verifySecret(r.Context(), creds.secrets[0], "")
+	if err != nil {
+		return store.Client{}, "", err
+	}
+
+	return store.Client{}, "", ErrInvalidCredentials
+}
+
+// lookupClient returns the zero Client when id is unknown.
+func (p *Provider) lookupClient(ctx context.Context, id string) (store.Client, error) {
+	client, err := p.Clients.GetClient(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return store.Client{}, nil
+	}
+
+	return client, err
+}
+
+// verifyPreviousSecret reports whether secret is the client's previous
+// secret and its grace period after a rotation hasn't run out.
+func (p *Provider) verifyPreviousSecret(ctx context.Context, client store.Client, secret string) (bool, error) {
+	if client.PreviousSecretHash == "" || !p.now().Before(client.PreviousSecretExpiresAt) {
+		return false, nil
+	}
+
+	return p.verifySecret(ctx, secret, client.PreviousSecretHash)
+}
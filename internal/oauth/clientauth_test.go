@@ -0,0 +1,161 @@
+package oauth_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/jose"
+	"github.com/ehubscher/goidp/internal/oauth"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+func postCredentials(grant url.Values, secret bool) url.Values {
+	grant.Set("client_id", testClientID)
+	if secret {
+		grant.Set("client_secret", testClientSecret)
+	}
+	return grant
+}
+
+// authAttempt is one way of authenticating the test client at /token.
+type authAttempt struct {
+	method        string
+	authorization string
+	form          func(env *testEnv, t *testing.T) url.Values
+}
+
+func authAttempts(priv any) []authAttempt {
+	return []authAttempt{
+		{oauth.AuthMethodSecretBasic, basicAuth(testClientID, testClientSecret), func(env *testEnv, t *testing.T) url.Values {
+			return env.codeGrant(t)
+		}},
+		{oauth.AuthMethodSecretPost, "", func(env *testEnv, t *testing.T) url.Values {
+			return postCredentials(env.codeGrant(t), true)
+		}},
+		{oauth.AuthMethodSecretJWT, "", func(env *testEnv, t *testing.T) url.Values {
+			return assertionGrant(env.codeGrant(t), env.assertion(t, testClientSecret, "jti-hs", env.now.Add(time.Minute)))
+		}},
+		{oauth.AuthMethodPrivateKey, "", func(env *testEnv, t *testing.T) url.Values {
+			header := jose.Header{Alg: jose.ES256, Kid: "client-key"}
+			return assertionGrant(env.codeGrant(t), signAssertion(t, header, priv, "jti-es", env.now.Add(time.Minute)))
+		}},
+	}
+}
+
+func TestTokenEndpointAuthMethod(t *testing.T) {
+	priv, jwks := newClientKey(t)
+	doc, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, registered := range []string{"", oauth.AuthMethodSecretBasic, oauth.AuthMethodSecretPost, oauth.AuthMethodSecretJWT, oauth.AuthMethodPrivateKey} {
+		for _, attempt := range authAttempts(priv) {
+			env := newTestEnv(t)
+			env.withTokens(t)
+			env.withClientKeys(t, func(client *store.Client) {
+				client.Secret = testClientSecret
+				client.JWKS = string(doc)
+				client.TokenEndpointAuthMethod = registered
+			})
+
+			rec := env.exchange(t, attempt.authorization, attempt.form(env, t))
+			want := http.StatusOK
+			if registered != "" && registered != attempt.method {
+				want = http.StatusUnauthorized
+			}
+			if rec.Code != want {
+				t.Errorf("registered %q, used %s got: %d %s, want: %d", registered, attempt.method, rec.Code, rec.Body, want)
+				continue
+			}
+			if want == http.StatusUnauthorized && decodeMap(t, rec)["error"] != "invalid_client" {
+				t.Errorf("registered %q, used %s got: %s, want: invalid_client", registered, attempt.method, rec.Body)
+			}
+		}
+	}
+}
+
+func TestTokenEndpointAuthMethodNone(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	env.withClientKeys(t, func(client *store.Client) {
+		client.SecretHash = ""
+		client.TokenEndpointAuthMethod = oauth.AuthMethodNone
+	})
+
+	grant := postCredentials(env.pkceCodeGrant(t), false)
+	grant.Set("code_verifier", testCodeVerifier)
+	rec := env.exchange(t, "", grant)
+	if rec.Code != http.StatusOK {
+		t.Errorf("client_id alone got: %d %s, want: %d", rec.Code, rec.Body, http.StatusOK)
+	}
+	rec = env.exchange(t, "", postCredentials(url.Values{"grant_type": {"authorization_code"}}, true))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("with a secret got: %d, want: %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	r := postForm("/introspect", url.Values{"client_id": {testClientID}, "token": {"anything"}})
+	rec = env.do(r)
+	if rec.Code != http.StatusUnauthorized || decodeMap(t, rec)["error"] != "invalid_client" {
+		t.Errorf("introspection got: %d %s, want: %d invalid_client", rec.Code, rec.Body, http.StatusUnauthorized)
+	}
+}
+
+func TestIntrospectAuthMethod(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	env.withClientKeys(t, func(client *store.Client) { client.TokenEndpointAuthMethod = oauth.AuthMethodSecretBasic })
+
+	r := postForm("/introspect", url.Values{"client_id": {testClientID}, "client_secret": {testClientSecret}, "token": {"anything"}})
+	rec := env.do(r)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("client_secret_post got: %d, want: %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	r = postForm("/introspect", url.Values{"token": {"anything"}})
+	r.Header.Set("Authorization", basicAuth(testClientID, testClientSecret))
+	rec = env.do(r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("client_secret_basic got: %d %s, want: %d", rec.Code, rec.Body, http.StatusOK)
+	}
+}
+
+func TestValidateClientAuthMethod(t *testing.T) {
+	var cases = []struct {
+		client store.Client
+		ok     bool
+	}{
+		{store.Client{ID: "c", SecretHash: "hash", TokenEndpointAuthMethod: oauth.AuthMethodSecretBasic}, true},
+		{store.Client{ID: "c", TokenEndpointAuthMethod: oauth.AuthMethodSecretPost}, false},
+		{store.Client{ID: "c", SecretHash: "hash", TokenEndpointAuthMethod: oauth.AuthMethodPrivateKey}, false},
+		{store.Client{ID: "c", TokenEndpointAuthMethod: oauth.AuthMethodNone}, true},
+		{store.Client{ID: "c", SecretHash: "hash", TokenEndpointAuthMethod: oauth.AuthMethodNone}, false},
+		{store.Client{ID: "c", TokenEndpointAuthMethod: "tls_client_auth"}, false},
+	}
+
+	for _, c := range cases {
+		err := oauth.ValidateClient(c.client, false)
+		if (err == nil) != c.ok {
+			t.Errorf("%s got: %v, want ok: %v", c.client.TokenEndpointAuthMethod, err, c.ok)
+		}
+	}
+}
+
+func TestAuthMethodNoneRequiresPKCE(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	env.withClientKeys(t, func(client *store.Client) {
+		client.SecretHash = ""
+		client.TokenEndpointAuthMethod = oauth.AuthMethodNone
+	})
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(nil), nil)
+	r.AddCookie(env.withSession(t))
+	if got := redirectParams(t, env.do(r)); got.Get("error") != "invalid_request" {
+		t.Errorf("got: %v, want: error invalid_request", got)
+	}
+}
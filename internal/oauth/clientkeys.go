@@ -0,0 +1,230 @@
+package oauth
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/jose"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const (
+	clientJWKSTTL = 5 * time.Minute
+	// clientJWKSRefetchInterval limits refetching a jwks_uri for an unknown
+	// kid, so assertions naming made-up kids can't make us hammer it.
+	clientJWKSRefetchInterval = time.Minute
+	// clientJWKSFailureTTL is how long a failed fetch of a jwks_uri is
+	// remembered, so a client whose keys are down doesn't have every one of
+	// its requests wait on the same timeout.
+	clientJWKSFailureTTL = 30 * time.Second
+	maxClientJWKSSize    = 64 << 10
+	defaultJWKSTimeout   = 5 * time.Second
+)
+
+var errNoClientKey = errors.New("no matching client key")
+
+type cachedJWKS struct {
+	jwks    jose.JWKS
+	fetched time.Time
+	// err is the failure of the last fetch, made at failed.
+	err    error
+	failed time.Time
+}
+
+// jwksFetch is a fetch of one jwks_uri in progress. Its other fields are
+// set before done is closed; abandoned means the fetching request went away
+// first, so the error says nothing about the uri.
+type jwksFetch struct {
+	done      chan struct{}
+	jwks      jose.JWKS
+	err       error
+	abandoned bool
+}
+
+// clientJWKSCache holds the key sets fetched from clients' jwks_uri. Each
+// uri is fetched by one request at a time, which the others asking for it
+// wait on; requests for other uris never wait.
+type clientJWKSCache struct {
+	mu       sync.Mutex
+	entries  map[string]cachedJWKS
+	inflight map[string]*jwksFetch
+}
+
+// validateClientKeys checks that an inline JWKS holds only usable keys and
+// that a jwks_uri uses https.
+func validateClientKeys(client store.Client) error {
+	if client.JWKS != "" {
+		var jwks jose.JWKS
+		err := json.Unmarshal([]byte(client.JWKS), &jwks)
+		if err != nil {
+			return fmt.Errorf("malformed JWKS: %w", err)
+		}
+		for _, jwk := range jwks.Keys {
+			_, _, err = jwk.PublicKey()
+			if err != nil {
+				return fmt.Errorf("JWKS key %q: %w", jwk.Kid, err)
+			}
+		}
+	}
+	if client.JWKSURI != "" {
+		u, err := url.Parse(client.JWKSURI)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("jwks_uri %q is not an https URL", client.JWKSURI)
+		}
+	}
+
+	return nil
+}
+
+func (p *Provider) httpClient() *http.Client {
+	if p.HTTPClient != nil {
+		return p.HTTPClient
+	}
+
+	return &http.Client{Timeout: defaultJWKSTimeout}
+}
+
+// clientKey returns the public key of client named by kid, from its inline
+// JWKS or else its jwks_uri. An empty kid matches a key set's only key.
+func (p *Provider) clientKey(ctx context.Context, client store.Client, kid string) (alg string, key crypto.PublicKey, err error) {
+	if client.JWKS != "" {
+		var jwks jose.JWKS
+		err = json.Unmarshal([]byte(client.JWKS), &jwks)
+		if err != nil {
+			return "", nil, fmt.Errorf("client %s has a malformed JWKS: %w", client.ID, err)
+		}
+		return findClientKey(jwks, kid)
+	}
+	if client.JWKSURI == "" {
+		return "", nil, errNoClientKey
+	}
+
+	return p.clientJWKS.key(ctx, p, client.JWKSURI, kid)
+}
+
+func (c *clientJWKSCache) key(ctx context.Context, p *Provider, uri, kid string) (alg string, key crypto.PublicKey, err error) {
+	var now = p.now()
+
+	for {
+		c.mu.Lock()
+		if c.entries == nil {
+			c.entries = make(map[string]cachedJWKS)
+			c.inflight = make(map[string]*jwksFetch)
+		}
+		entry, ok := c.entries[uri]
+		if ok && now.Sub(entry.fetched) < clientJWKSTTL {
+			alg, key, err = findClientKey(entry.jwks, kid)
+			// The client may have rotated keys since the last fetch.
+			if !errors.Is(err, errNoClientKey) || now.Sub(entry.fetched) < clientJWKSRefetchInterval {
+				c.mu.Unlock()
+				return alg, key, err
+			}
+		}
+		if ok && entry.err != nil && now.Sub(entry.failed) < clientJWKSFailureTTL {
+			c.mu.Unlock()
+			return "", nil, entry.err
+		}
+		fetch, running := c.inflight[uri]
+		if !running {
+			fetch = &jwksFetch{done: make(chan struct{})}
+			c.inflight[uri] = fetch
+		}
+		c.mu.Unlock()
+
+		if !running {
+			c.fetch(ctx, p, uri, fetch, now)
+		}
+		select {
+		case <-fetch.done:
+		case <-ctx.Done():
+			return "", nil, ctx.Err()
+		}
+		if fetch.abandoned && ctx.Err() == nil {
+			continue
+		}
+		if fetch.err != nil {
+			return "", nil, fetch.err
+		}
+
+		return findClientKey(fetch.jwks, kid)
+	}
+}
+
+// fetch fetches uri for everyone waiting on it and caches the outcome.
+func (c *clientJWKSCache) fetch(ctx context.Context, p *Provider, uri string, fetch *jwksFetch, now time.Time) {
+	fetch.jwks, fetch.err = fetchJWKS(ctx, p.httpClient(), uri)
+	fetch.abandoned = fetch.err != nil && ctx.Err() != nil
+
+	c.mu.Lock()
+	delete(c.inflight, uri)
+	entry := c.entries[uri]
+	switch {
+	case fetch.err == nil:
+		c.entries[uri] = cachedJWKS{jwks: fetch.jwks, fetched: now}
+	case !fetch.abandoned:
+		entry.err, entry.failed = fetch.err, now
+		c.entries[uri] = entry
+	}
+	c.mu.Unlock()
+
+	close(fetch.done)
+}
+
+func fetchJWKS(ctx context.Context, client *http.Client, uri string) (jwks jose.JWKS, err error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "https" {
+		return jose.JWKS{}, fmt.Errorf("jwks_uri %q is not an https URL", uri)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return jose.JWKS{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return jose.JWKS{}, fmt.Errorf("cannot fetch jwks_uri: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return jose.JWKS{}, fmt.Errorf("cannot fetch jwks_uri: %s", resp.Status)
+	}
+
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxClientJWKSSize)).Decode(&jwks)
+	if err != nil {
+		return jose.JWKS{}, fmt.Errorf("malformed JWKS at jwks_uri: %w", err)
+	}
+
+	return jwks, nil
+}
+
+func findClientKey(jwks jose.JWKS, kid string) (alg string, key crypto.PublicKey, err error) {
+	var signing []jose.JWK
+	for _, jwk := range jwks.Keys {
+		if jwk.Use == "" || jwk.Use == "sig" {
+			signing = append(signing, jwk)
+		}
+	}
+
+	if kid == "" {
+		if len(signing) != 1 {
+			return "", nil, fmt.Errorf("%w: no kid and %d keys", errNoClientKey, len(signing))
+		}
+		return signing[0].PublicKey()
+	}
+	for _, jwk := range signing {
+		if jwk.Kid == kid {
+			return jwk.PublicKey()
+		}
+	}
+
+	return "", nil, fmt.Errorf("%w: kid %q", errNoClientKey, kid)
+}
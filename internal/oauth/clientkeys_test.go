@@ -0,0 +1,236 @@
+package oauth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/jose"
+	"github.com/ehubscher/goidp/internal/oauth"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+func newClientKey(t *testing.T) (*ecdsa.PrivateKey, jose.JWKS) {
+	t.Helper()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return priv, jose.JWKS{Keys: []jose.JWK{jose.NewECJWK("client-key", jose.ES256, &priv.PublicKey)}}
+}
+
+// withClientKeys configures the test client for private_key_jwt, after
+// withTokens.
+func (env *testEnv) withClientKeys(t *testing.T, update func(client *store.Client)) {
+	t.Helper()
+
+	env.provider.Issuer = testIssuer
+	clients := env.provider.Clients.(*store.MemoryClientStore)
+	client, err := clients.GetClient(context.Background(), testClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	update(&client)
+	if err := oauth.ValidateClient(client, false); err != nil {
+		t.Fatal(err)
+	}
+	err = clients.PutClient(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrivateKeyJWT(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	priv, jwks := newClientKey(t)
+	doc, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.withClientKeys(t, func(client *store.Client) { client.JWKS = string(doc) })
+
+	header := jose.Header{Alg: jose.ES256, Kid: "client-key"}
+	assertion := signAssertion(t, header, priv, "jti-1", env.now.Add(time.Minute))
+	rec := env.exchange(t, "", assertionGrant(env.codeGrant(t), assertion))
+	if rec.Code != http.StatusOK {
+		t.Errorf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusOK)
+	}
+}
+
+func TestPrivateKeyJWTSignatureMismatch(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	_, jwks := newClientKey(t)
+	other, _ := newClientKey(t)
+	doc, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.withClientKeys(t, func(client *store.Client) { client.JWKS = string(doc) })
+
+	header := jose.Header{Alg: jose.ES256, Kid: "client-key"}
+	assertion := signAssertion(t, header, other, "jti-1", env.now.Add(time.Minute))
+	rec := env.exchange(t, "", assertionGrant(env.codeGrant(t), assertion))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAssertionIDsDontFillNonceCache(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	cookie := env.withSession(t)
+	env.provider.NonceCacheSize = 1
+	priv, jwks := newClientKey(t)
+	doc, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.withClientKeys(t, func(client *store.Client) { client.JWKS = string(doc) })
+
+	header := jose.Header{Alg: jose.ES256, Kid: "client-key"}
+	form := assertionGrant(introspectForm(t, env), signAssertion(t, header, priv, "jti-1", env.now.Add(time.Minute)))
+	if resp := decodeMap(t, env.do(postForm("/introspect", form))); resp["active"] != true {
+		t.Fatalf("got: %v, want: an active token", resp)
+	}
+	if params := env.authorizeNonce(t, cookie, "n-0S6_WzA2Mj"); params.Get("code") == "" {
+		t.Errorf("got: %v, want: a code with the assertion id cache full", params)
+	}
+}
+
+func TestPrivateKeyJWTFromJWKSURI(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	priv, jwks := newClientKey(t)
+
+	var fetches atomic.Int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	defer srv.Close()
+	env.provider.HTTPClient = srv.Client()
+	env.withClientKeys(t, func(client *store.Client) { client.JWKSURI = srv.URL + "/jwks" })
+
+	header := jose.Header{Alg: jose.ES256, Kid: "client-key"}
+	for _, jti := range []string{"jti-1", "jti-2"} {
+		form := assertionGrant(introspectForm(t, env), signAssertion(t, header, priv, jti, env.now.Add(time.Minute)))
+		if resp := decodeMap(t, env.do(postForm("/introspect", form))); resp["active"] != true {
+			t.Errorf("%s got: %v, want: an active token", jti, resp)
+		}
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("got: %d fetches, want: 1", fetches.Load())
+	}
+
+	// An unknown kid is refetched, but at most once a minute.
+	header.Kid = "rotated"
+	for _, jti := range []string{"jti-3", "jti-4"} {
+		form := assertionGrant(introspectForm(t, env), signAssertion(t, header, priv, jti, env.now.Add(time.Minute)))
+		if rec := env.do(postForm("/introspect", form)); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s got: %d, want: %d", jti, rec.Code, http.StatusUnauthorized)
+		}
+		env.now = env.now.Add(30 * time.Second)
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("got: %d fetches, want: 1", fetches.Load())
+	}
+}
+
+func TestClientJWKSFailureCached(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	priv, _ := newClientKey(t)
+
+	var fetches atomic.Int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	env.provider.HTTPClient = srv.Client()
+	env.withClientKeys(t, func(client *store.Client) { client.JWKSURI = srv.URL + "/jwks" })
+
+	header := jose.Header{Alg: jose.ES256, Kid: "client-key"}
+	for _, jti := range []string{"jti-1", "jti-2", "jti-3"} {
+		form := assertionGrant(introspectForm(t, env), signAssertion(t, header, priv, jti, env.now.Add(time.Minute)))
+		if rec := env.do(postForm("/introspect", form)); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s got: %d, want: %d", jti, rec.Code, http.StatusUnauthorized)
+		}
+		env.now = env.now.Add(20 * time.Second)
+	}
+	// The failure is remembered for 30s, so the third request refetches.
+	if fetches.Load() != 2 {
+		t.Errorf("got: %d fetches, want: 2", fetches.Load())
+	}
+}
+
+func TestClientJWKSSlowURI(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	priv, jwks := newClientKey(t)
+
+	var arrived = make(chan struct{})
+	var release = make(chan struct{})
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(arrived)
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	defer srv.Close()
+	env.provider.HTTPClient = srv.Client()
+	env.withClientKeys(t, func(client *store.Client) { client.JWKSURI = srv.URL + "/slow" })
+
+	header := jose.Header{Alg: jose.ES256, Kid: "client-key"}
+	var slow = make(chan struct{})
+	go func() {
+		defer close(slow)
+		form := assertionGrant(introspectForm(t, env), signAssertion(t, header, priv, "jti-1", env.now.Add(time.Minute)))
+		env.do(postForm("/introspect", form))
+	}()
+	defer func() { <-slow }()
+	defer close(release)
+	<-arrived
+
+	// Another jwks_uri is fetched while /slow is still hanging.
+	env.withClientKeys(t, func(client *store.Client) { client.JWKSURI = srv.URL + "/fast" })
+	var fast = make(chan map[string]any, 1)
+	go func() {
+		form := assertionGrant(introspectForm(t, env), signAssertion(t, header, priv, "jti-2", env.now.Add(time.Minute)))
+		fast <- decodeMap(t, env.do(postForm("/introspect", form)))
+	}()
+	select {
+	case resp := <-fast:
+		if resp["active"] != true {
+			t.Errorf("got: %v, want: an active token", resp)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("fetching one jwks_uri blocked another")
+	}
+}
+
+func introspectForm(t *testing.T, env *testEnv) url.Values {
+	t.Helper()
+
+	tok, _, err := env.provider.Tokens.IssueAccessToken("1", testClientID, nil, []string{"openid"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return url.Values{"token": {tok}}
+}
@@ -0,0 +1,104 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const (
+	defaultCodeLength = 32
+	minCodeLength     = 16 // 128 bits of entropy.
+	defaultCodeTTL    = 60 * time.Second
+	maxCodeTTL        = 10 * time.Minute // RFC 6749 section 4.1.2.
+)
+
+var (
+	ErrCodeInvalid = errors.New("authorization code is invalid")
+	ErrCodeExpired = errors.New("authorization code has expired")
+)
+
+// CodePolicy controls how authorization codes are generated. The zero value
+// uses the defaults.
+type CodePolicy struct {
+	Length int // random bytes per code
+	TTL    time.Duration
+}
+
+func (c CodePolicy) Validate() error {
+	if c.Length != 0 && c.Length < minCodeLength {
+		return fmt.Errorf("authorization code length must be at least %d bytes, got %d", minCodeLength, c.Length)
+	}
+	if c.TTL < 0 || c.TTL > maxCodeTTL {
+		return fmt.Errorf("authorization code TTL must be between 0 and %s, got %s", maxCodeTTL, c.TTL)
+	}
+
+	return nil
+}
+
+func (c CodePolicy) length() int {
+	if c.Length > 0 {
+		return c.Length
+	}
+
+	return defaultCodeLength
+}
+
+func (c CodePolicy) ttl() time.Duration {
+	if c.TTL > 0 {
+		return c.TTL
+	}
+
+	return defaultCodeTTL
+}
+
+// ConfigureCodePolicy reads AUTH_CODE_LENGTH and AUTH_CODE_TTL, rejecting
+// values below the security minimums.
+func ConfigureCodePolicy() (policy CodePolicy, err error) {
+	if v := os.Getenv("AUTH_CODE_LENGTH"); v != "" {
+		policy.Length, err = strconv.Atoi(v)
+		if err != nil {
+			return CodePolicy{}, fmt.Errorf("authorization code length misconfigured: %w", err)
+		}
+	}
+
+	if v := os.Getenv("AUTH_CODE_TTL"); v != "" {
+		policy.TTL, err = time.ParseDuration(v)
+		if err != nil {
+			return CodePolicy{}, fmt.Errorf("authorization code TTL misconfigured: %w", err)
+		}
+	}
+
+	err = policy.Validate()
+	if err != nil {
+		return CodePolicy{}, err
+	}
+
+	return policy, nil
+}
+
+// RedeemCode consumes an authorization code, checking it hasn't expired and
+// was issued to the client and redirect URI presenting it.
+func (p *Provider) RedeemCode(ctx context.Context, code, clientID, redirectURI string) (store.AuthCode, error) {
+	authCode, err := p.Codes.ConsumeAuthCode(ctx, code)
+	if errors.Is(err, store.ErrNotFound) {
+		return store.AuthCode{}, ErrCodeInvalid
+	}
+	if err != nil {
+		return store.AuthCode{}, err
+	}
+
+	if !p.now().Before(authCode.ExpiresAfter) {
+		return store.AuthCode{}, ErrCodeExpired
+	}
+	if authCode.ClientID != clientID || authCode.RedirectURI != redirectURI {
+		return store.AuthCode{}, ErrCodeInvalid
+	}
+
+	return authCode, nil
+}
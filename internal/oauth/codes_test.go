@@ -0,0 +1,94 @@
+package oauth_test
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/oauth"
+)
+
+func (env *testEnv) issueCode(t *testing.T) string {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(nil), nil)
+	r.AddCookie(env.withSession(t))
+
+	return redirectParams(t, env.do(r)).Get("code")
+}
+
+func TestCodePolicyLength(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.CodePolicy = oauth.CodePolicy{Length: 48}
+
+	raw, err := base64.RawURLEncoding.DecodeString(env.issueCode(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) != 48 {
+		t.Errorf("got: %d bytes, want: %d", len(raw), 48)
+	}
+}
+
+func TestRedeemCodeExpiry(t *testing.T) {
+	var redemptions = []struct {
+		after time.Duration
+		err   error
+	}{
+		{29 * time.Second, nil},
+		{30 * time.Second, oauth.ErrCodeExpired},
+	}
+
+	for _, c := range redemptions {
+		env := newTestEnv(t)
+		env.provider.CodePolicy = oauth.CodePolicy{TTL: 30 * time.Second}
+		code := env.issueCode(t)
+
+		env.now = env.now.Add(c.after)
+		_, err := env.provider.RedeemCode(context.Background(), code, testClientID, testRedirectURI)
+		if err != c.err {
+			t.Errorf("after %s got: %v, want: %v", c.after, err, c.err)
+		}
+	}
+}
+
+func TestRedeemCodeSingleUse(t *testing.T) {
+	env := newTestEnv(t)
+	code := env.issueCode(t)
+
+	_, err := env.provider.RedeemCode(context.Background(), code, "other-client", testRedirectURI)
+	if err != oauth.ErrCodeInvalid {
+		t.Errorf("got: %v, want: %v", err, oauth.ErrCodeInvalid)
+	}
+
+	_, err = env.provider.RedeemCode(context.Background(), code, testClientID, testRedirectURI)
+	if err != oauth.ErrCodeInvalid {
+		t.Errorf("got: %v, want: %v", err, oauth.ErrCodeInvalid)
+	}
+}
+
+func TestConfigureCodePolicy(t *testing.T) {
+	var configs = []struct {
+		length, ttl string
+		ok          bool
+	}{
+		{"", "", true},
+		{"32", "5m", true},
+		{"8", "", false},
+		{"", "1h", false},
+		{"abc", "", false},
+	}
+
+	for _, c := range configs {
+		t.Setenv("AUTH_CODE_LENGTH", c.length)
+		t.Setenv("AUTH_CODE_TTL", c.ttl)
+
+		_, err := oauth.ConfigureCodePolicy()
+		if (err == nil) != c.ok {
+			t.Errorf("length %q ttl %q got: %v, want ok: %v", c.length, c.ttl, err, c.ok)
+		}
+	}
+}
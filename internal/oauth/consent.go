@@ -0,0 +1,177 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/render"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const consentChallengeTTL = 10 * time.Minute
+
+type pendingConsent struct {
+	userID  int64
+	req     authorizeRequest
+	expires time.Time
+}
+
+// consentChallenges holds authorization requests waiting on the user's
+// decision. The challenge is single use and bound to the user, so a client
+// can't skip consent by posting an approval itself.
+type consentChallenges struct {
+	mu      sync.Mutex
+	pending map[string]pendingConsent
+}
+
+func (c *consentChallenges) add(id string, pending pendingConsent, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pending == nil {
+		c.pending = make(map[string]pendingConsent)
+	}
+	for k, v := range c.pending {
+		if !now.Before(v.expires) {
+			delete(c.pending, k)
+		}
+	}
+	c.pending[id] = pending
+}
+
+func (c *consentChallenges) take(id string, now time.Time) (pending pendingConsent, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pending, ok = c.pending[id]
+	delete(c.pending, id)
+	if !ok || !now.Before(pending.expires) {
+		return pendingConsent{}, false
+	}
+
+	return pending, true
+}
+
+// needsConsent reports whether the user has to be asked before the request
+// can be granted, either because prompt=consent was sent or because a
+// requested scope hasn't been consented to yet.
+func (p *Provider) needsConsent(ctx context.Context, userID int64, req authorizeRequest) (bool, error) {
+	if req.Prompt.Consent {
+		return true, nil
+	}
+
+	consent, err := p.Consents.GetConsent(ctx, userID, req.ClientID)
+	if errors.Is(err, store.ErrNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for _, s := range req.Scopes {
+		if !slices.Contains(consent.Scopes, s) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (p *Provider) promptConsent(w http.ResponseWriter, r *http.Request, session store.Session, req authorizeRequest) {
+	challenge, err := randomToken(32)
+	if err != nil {
+		slog.Error("Cannot generate consent challenge.", "err", err)
+		p.redirectError(w, r, req.RedirectURI, req.State, "server_error", "")
+		return
+	}
+
+	var now = p.now()
+	p.consentChallenges.add(challenge, pendingConsent{
+		userID:  session.UserID,
+		req:     req,
+		expires: now.Add(consentChallengeTTL),
+	}, now)
+
+	var name string = req.ClientName
+	if name == "" {
+		name = req.ClientID
+	}
+
+	var scopes []render.Scope
+	for _, s := range p.scopes().Describe(req.Scopes) {
+		scopes = append(scopes, render.Scope(s))
+	}
+
+	p.pages().Consent(w, http.StatusOK, render.ConsentPage{
+		Page: render.Page{
+			UI:        p.uiContext(r.Form),
+			CSRFToken: p.csrfToken(w, r),
+		},
+		ClientName: name,
+		Scopes:     scopes,
+		Challenge:  challenge,
+	})
+}
+
+// Consent handles the user's decision on the consent page.
+func (p *Provider) Consent(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Malformed consent request.", http.StatusBadRequest)
+		return
+	}
+
+	if !p.validCSRF(r) {
+		http.Error(w, csrfFailedMessage, http.StatusForbidden)
+		return
+	}
+
+	pending, ok := p.consentChallenges.take(r.PostForm.Get("challenge"), p.now())
+	if !ok {
+		http.Error(w, "Consent request is invalid or has expired.", http.StatusBadRequest)
+		return
+	}
+
+	session, ok := p.session(w, r)
+	if !ok || session.UserID != pending.userID {
+		http.Error(w, "Consent request is invalid or has expired.", http.StatusBadRequest)
+		return
+	}
+
+	var req authorizeRequest = pending.req
+	if r.PostForm.Get("action") != "approve" {
+		p.redirectError(w, r, req.RedirectURI, req.State, "access_denied", "The user denied the request.")
+		return
+	}
+
+	consent, err := p.Consents.GetConsent(r.Context(), session.UserID, req.ClientID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		slog.Error("Cannot load consent.", "err", err)
+		internalError(w, err)
+		return
+	}
+	for _, s := range req.Scopes {
+		if !slices.Contains(consent.Scopes, s) {
+			consent.Scopes = append(consent.Scopes, s)
+		}
+	}
+
+	err = p.Consents.SaveConsent(r.Context(), store.Consent{
+		UserID:    session.UserID,
+		ClientID:  req.ClientID,
+		Scopes:    normalizeScopes(consent.Scopes),
+		GrantedAt: p.now(),
+	})
+	if err != nil {
+		slog.Error("Cannot save consent.", "err", err)
+		internalError(w, err)
+		return
+	}
+
+	p.issueCode(w, r, session, req)
+}
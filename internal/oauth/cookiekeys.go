@@ -0,0 +1,153 @@
+package oauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ehubscher/goidp/internal/secrets"
+)
+
+// signatureSeparator separates a signed cookie's value, key id and MAC. It
+// isn't in the base64url alphabet or sessionIDSeparator.
+const signatureSeparator = "~"
+
+// CookieKey is a secret the session and CSRF cookies are signed with. The
+// id is written into every cookie so the right key can be found after a
+// rotation.
+type CookieKey struct {
+	ID     string
+	Secret []byte
+}
+
+// CookieKeys sign new cookies with Current and still accept cookies signed
+// with any of Previous, in the way the JWT signing keys rotate. Keep a
+// retired key in Previous for as long as cookies signed with it should
+// stay valid, the session TTL at most; cookies are re-signed with Current
+// when they are next used. The zero CookieKeys leaves cookies unsigned.
+//
+// Signing means a cookie can't be forged without the server secret even
+// where a store lookup alone would accept a guessed or leaked value. Turning
+// signing on for the first time invalidates the unsigned cookies.
+type CookieKeys struct {
+	Current  CookieKey
+	Previous []CookieKey
+}
+
+// ConfigureCookieKeys reads the current key from the COOKIE_SECRET secret
+// and the keys still accepted from PREVIOUS_COOKIE_SECRETS, both as
+// id:secret with the previous ones comma separated, just like the peppers.
+func ConfigureCookieKeys() (keys CookieKeys, err error) {
+	previous, err := lookupSecret("PREVIOUS_COOKIE_SECRETS")
+	if err != nil {
+		return CookieKeys{}, err
+	}
+	for _, v := range strings.Split(previous, ",") {
+		if v == "" {
+			continue
+		}
+		key, err := parseCookieKey(v)
+		if err != nil {
+			return CookieKeys{}, fmt.Errorf("PREVIOUS_COOKIE_SECRETS misconfigured: %w", err)
+		}
+		keys.Previous = append(keys.Previous, key)
+	}
+
+	v, err := lookupSecret("COOKIE_SECRET")
+	if err != nil {
+		return CookieKeys{}, err
+	}
+	if v == "" {
+		if len(keys.Previous) > 0 {
+			return CookieKeys{}, errors.New("PREVIOUS_COOKIE_SECRETS is set without COOKIE_SECRET")
+		}
+		return CookieKeys{}, nil
+	}
+	keys.Current, err = parseCookieKey(v)
+	if err != nil {
+		return CookieKeys{}, fmt.Errorf("COOKIE_SECRET misconfigured: %w", err)
+	}
+
+	return keys, nil
+}
+
+// lookupSecret returns the named secret, or "" when it isn't configured.
+func lookupSecret(name string) (string, error) {
+	v, err := secrets.Get(name)
+	if errors.Is(err, secrets.ErrNotFound) {
+		return "", nil
+	}
+
+	return v, err
+}
+
+func parseCookieKey(v string) (CookieKey, error) {
+	id, secret, ok := strings.Cut(v, ":")
+	if !ok || id == "" || len(secret) < 32 {
+		return CookieKey{}, errors.New("expected id:secret with a secret of at least 32 bytes")
+	}
+	if strings.ContainsAny(id, signatureSeparator+sessionIDSeparator+",") {
+		return CookieKey{}, fmt.Errorf("cookie key id %q contains a reserved character", id)
+	}
+
+	return CookieKey{ID: id, Secret: []byte(secret)}, nil
+}
+
+func (k CookieKeys) enabled() bool {
+	return len(k.Current.Secret) > 0
+}
+
+func (k CookieKey) mac(value string) string {
+	mac := hmac.New(sha256.New, k.Secret)
+	mac.Write([]byte(k.ID + signatureSeparator + value))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// sign returns value~id~mac, or value itself when signing is off.
+func (k CookieKeys) sign(value string) string {
+	if !k.enabled() {
+		return value
+	}
+
+	return strings.Join([]string{value, k.Current.ID, k.Current.mac(value)}, signatureSeparator)
+}
+
+// verify returns the value of a cookie made by sign. stale reports that it
+// was signed with a previous key and should be re-signed.
+func (k CookieKeys) verify(signed string) (value string, stale, ok bool) {
+	if !k.enabled() {
+		return signed, false, true
+	}
+
+	parts := strings.Split(signed, signatureSeparator)
+	if len(parts) != 3 {
+		return "", false, false
+	}
+	value, id, mac := parts[0], parts[1], parts[2]
+
+	for i, key := range append([]CookieKey{k.Current}, k.Previous...) {
+		if key.ID == id {
+			if !hmac.Equal([]byte(mac), []byte(key.mac(value))) {
+				return "", false, false
+			}
+			return value, i > 0, true
+		}
+	}
+
+	return "", false, false
+}
+
+// signedCookie returns the verified value of the named cookie.
+func (p *Provider) signedCookie(r *http.Request, name string) (value string, stale, ok bool) {
+	cookie, err := r.Cookie(name)
+	if err != nil || cookie.Value == "" {
+		return "", false, false
+	}
+
+	return p.CookieKeys.verify(cookie.Value)
+}
@@ -0,0 +1,137 @@
+package oauth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/oauth"
+)
+
+var (
+	oldCookieKey = oauth.CookieKey{ID: "k1", Secret: []byte("first-secret-first-secret-first!")}
+	newCookieKey = oauth.CookieKey{ID: "k2", Secret: []byte("second-secret-second-secret-sec!")}
+)
+
+var csrfField = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+// csrfFromPage renders the login page and returns its CSRF cookie and the
+// token from its form.
+func (env *testEnv) csrfFromPage(t *testing.T) (*http.Cookie, string) {
+	t.Helper()
+
+	rec := env.do(httptest.NewRequest(http.MethodGet, authorizeURL(nil), nil))
+	cookie := responseCookie(rec, "goidp_csrf")
+	match := csrfField.FindStringSubmatch(rec.Body.String())
+	if cookie == nil || match == nil {
+		t.Fatalf("got: %v, want: a CSRF cookie and a token in the form", cookie)
+	}
+
+	return cookie, match[1]
+}
+
+// signedLogin logs in through the login page, so the CSRF cookie is signed
+// with the provider's CookieKeys.
+func (env *testEnv) signedLogin(t *testing.T, csrf *http.Cookie, token string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	form := url.Values{
+		"email":      {testEmail},
+		"password":   {testPassword},
+		"return_to":  {authorizeURL(nil)},
+		"csrf_token": {token},
+	}
+	r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(csrf)
+
+	return env.do(r)
+}
+
+func TestSessionCookieKeyRotation(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.CookieKeys = oauth.CookieKeys{Current: oldCookieKey}
+
+	csrf, token := env.csrfFromPage(t)
+	session := responseCookie(env.signedLogin(t, csrf, token), "goidp_session")
+	if session == nil || !strings.Contains(session.Value, "~k1~") {
+		t.Fatalf("got: %v, want: a session cookie signed with k1", session)
+	}
+
+	env.provider.CookieKeys = oauth.CookieKeys{Current: newCookieKey, Previous: []oauth.CookieKey{oldCookieKey}}
+	rec := env.authorizeWith(t, session)
+	if code := redirectParams(t, rec).Get("code"); code == "" {
+		t.Fatalf("got: %s, want: a code for the session signed with the previous key", rec.Header().Get("Location"))
+	}
+	resigned := responseCookie(rec, "goidp_session")
+	if resigned == nil || !strings.Contains(resigned.Value, "~k2~") {
+		t.Errorf("got: %v, want: the session cookie re-signed with k2", resigned)
+	}
+
+	// Once the previous key is retired its cookies are no longer accepted.
+	env.provider.CookieKeys = oauth.CookieKeys{Current: newCookieKey}
+	if rec := env.authorizeWith(t, session); rec.Code != http.StatusOK {
+		t.Errorf("got: %d, want: the login page", rec.Code)
+	}
+	if rec := env.authorizeWith(t, resigned); rec.Code != http.StatusFound {
+		t.Errorf("got: %d, want: %d for the re-signed cookie", rec.Code, http.StatusFound)
+	}
+}
+
+func TestSessionCookieTampered(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.CookieKeys = oauth.CookieKeys{Current: newCookieKey}
+
+	csrf, token := env.csrfFromPage(t)
+	session := responseCookie(env.signedLogin(t, csrf, token), "goidp_session")
+	value, _, _ := strings.Cut(session.Value, "~")
+	for _, forged := range []string{value, "other" + session.Value[len(value):], value + "~k2~" + strings.Repeat("A", 43)} {
+		if rec := env.authorizeWith(t, &http.Cookie{Name: "goidp_session", Value: forged}); rec.Code != http.StatusOK {
+			t.Errorf("%q got: %d, want: the login page", forged, rec.Code)
+		}
+	}
+}
+
+func TestCSRFCookieKeyRotation(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.CookieKeys = oauth.CookieKeys{Current: oldCookieKey}
+
+	cookie, token := env.csrfFromPage(t)
+	if !strings.Contains(cookie.Value, "~k1~") {
+		t.Fatalf("got: %v, want: a CSRF cookie signed with k1", cookie)
+	}
+
+	env.provider.CookieKeys = oauth.CookieKeys{Current: newCookieKey, Previous: []oauth.CookieKey{oldCookieKey}}
+	if rec := env.signedLogin(t, cookie, token); rec.Code != http.StatusFound {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusFound)
+	}
+
+	// The next form re-signs the same token with the current key.
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(nil), nil)
+	r.AddCookie(cookie)
+	resigned := responseCookie(env.do(r), "goidp_csrf")
+	if resigned == nil || !strings.Contains(resigned.Value, "~k2~") || !strings.HasPrefix(resigned.Value, token+"~") {
+		t.Errorf("got: %v, want: token %s re-signed with k2", resigned, token)
+	}
+}
+
+func TestConfigureCookieKeys(t *testing.T) {
+	t.Setenv("COOKIE_SECRET", "k2:"+string(newCookieKey.Secret))
+	t.Setenv("PREVIOUS_COOKIE_SECRETS", "k1:"+string(oldCookieKey.Secret))
+
+	keys, err := oauth.ConfigureCookieKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys.Current.ID != "k2" || len(keys.Previous) != 1 || keys.Previous[0].ID != "k1" {
+		t.Errorf("got: %+v, want: k2 with k1 previous", keys)
+	}
+
+	t.Setenv("COOKIE_SECRET", "k2:short")
+	if _, err = oauth.ConfigureCookieKeys(); err == nil {
+		t.Error("got: nil, want: an error for a short secret")
+	}
+}
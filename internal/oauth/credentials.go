@@ -0,0 +1,197 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/authn"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const (
+	defaultInvalidCredentialsMessage = "Invalid email or password."
+	emailUnverifiedDescription       = "The user's email address is not verified."
+)
+
+var (
+	// ErrInvalidCredentials is returned for every kind of credential
+	// failure, so callers can't tell an unknown identifier from a wrong
+	// secret.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrAccountLocked means too many logins failed for an email address.
+	ErrAccountLocked = errors.New("account locked")
+)
+
+// lockedError is ErrAccountLocked along with how long the lock has left.
+type lockedError struct {
+	remaining time.Duration
+}
+
+func (e lockedError) Error() string {
+	return fmt.Sprintf("%v for %s", ErrAccountLocked, e.remaining)
+}
+
+func (e lockedError) Unwrap() error {
+	return ErrAccountLocked
+}
+
+// dummyHash is verified against when there is no stored hash, so a failed
+// lookup costs as much as a failed comparison. A failed generation, such as
+// one refused by a busy hashing budget, is retried on the next use. The hash
+// is generated outside the lock, since that can wait on the budget, so the
+// first concurrent uses may each generate one; the first stored is kept.
+type dummyHash struct {
+	mu   sync.Mutex
+	hash string
+}
+
+func (d *dummyHash) get(ctx context.Context, algo string) string {
+	d.mu.Lock()
+	var hash string = d.hash
+	d.mu.Unlock()
+	if hash != "" {
+		return hash
+	}
+
+	secret, err := randomToken(16)
+	if err == nil {
+		hash, err = authn.GenerateHash(ctx, algo, secret)
+	}
+	if err != nil {
+		slog.Error("Cannot generate dummy password hash.", "err", err)
+		return ""
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.hash == "" {
+		d.hash = hash
+	}
+
+	return d.hash
+}
+
+// verifySecret checks secret against encodedHash, or against a dummy hash of
+// a random secret when encodedHash is empty, and reports only whether it
+// matched. The error is only set when the check couldn't be done for now,
+// because the hashing memory budget is exhausted, and is then
+// store.ErrUnavailable so callers answer 503, or when ctx ended first.
+func (p *Provider) verifySecret(ctx context.Context, secret, encodedHash string) (match bool, err error) {
+	if encodedHash == "" {
+		encodedHash = p.dummyHash.get(ctx, p.hashAlgorithm())
+	}
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+	if encodedHash == "" {
+		return false, nil
+	}
+
+	match, err = authn.VerifyPassword(ctx, secret, encodedHash)
+	if errors.Is(err, authn.ErrBusy) {
+		return false, unavailableIfBusy(err)
+	}
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+	if err != nil {
+		slog.Warn("Cannot verify secret against stored hash.", "err", err)
+		return false, nil
+	}
+
+	return match, nil
+}
+
+// unavailableIfBusy marks authn.ErrBusy as store.ErrUnavailable, so a hash
+// refused by the memory budget is answered with 503 and Retry-After.
+func unavailableIfBusy(err error) error {
+	if errors.Is(err, authn.ErrBusy) {
+		return fmt.Errorf("%w: %w", store.ErrUnavailable, err)
+	}
+
+	return err
+}
+
+// authenticateUser returns the user identified by email and password, or
+// ErrInvalidCredentials whichever of the two is wrong. Any other error means
+// the check itself couldn't be done. Failures are counted per email address,
+// whether or not an account has it, and once an address is locked every
+// attempt fails with ErrAccountLocked, the right password included. So
+// neither the lock nor the result while locked tells which accounts exist.
+// remoteIP decides which lockout threshold applies. Users without a local
+// password are checked with the External verifier, if there is one.
+func (p *Provider) authenticateUser(ctx context.Context, email, password, remoteIP string) (store.User, error) {
+	user, err := p.Users.GetUserByEmail(ctx, email)
+	if errors.Is(err, store.ErrNotFound) && p.External != nil {
+		// Provisioning stores the normalized address, so a variant of a
+		// local user's address has to find them before the external
+		// source is asked, or its password would sign them in.
+		normalized, normErr := p.Email.Normalize(ctx, email)
+		if normErr == nil && normalized != email {
+			user, err = p.Users.GetUserByEmail(ctx, normalized)
+		}
+	}
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return store.User{}, err
+	}
+	var found bool = err == nil
+
+	var now time.Time = p.now()
+	var key string = lockoutKey(email)
+	var threshold int = p.Lockout.threshold(remoteIP)
+	var locked bool = p.lockouts.lockedFor(key, threshold, now, p.Lockout.duration()) > 0
+	var match bool
+	if p.External != nil && user.PasswordHash == "" && !locked {
+		user, match, err = p.verifyExternal(ctx, user, found, email, password, remoteIP)
+		found = match
+	} else {
+		match, err = p.verifySecret(ctx, password, user.PasswordHash)
+		if found && !match && err == nil {
+			p.checkIncompatibleHash(ctx, user)
+		}
+	}
+	// Neither a check refused for lack of hashing memory nor an unreachable
+	// external source is a failed attempt.
+	if err != nil {
+		return store.User{}, err
+	}
+	// Attempts while locked aren't counted: they would extend the lock only
+	// when the password is wrong, which an unknown address always is.
+	if locked {
+		slog.Warn("Refused login to a locked email address.", "remote_addr", remoteIP)
+		return store.User{}, lockedError{p.lockouts.lockedFor(key, threshold, now, p.Lockout.duration())}
+	}
+	if !match || !found {
+		if p.Lockout.enabled() {
+			p.lockouts.fail(key, now, p.Lockout.duration())
+		}
+		return store.User{}, ErrInvalidCredentials
+	}
+	p.lockouts.reset(key)
+
+	return user, nil
+}
+
+// checkIncompatibleHash reports user to the IncompatibleHash hook if their
+// password hash was made by an argon2 version that can't be verified.
+func (p *Provider) checkIncompatibleHash(ctx context.Context, user store.User) {
+	if p.IncompatibleHash == nil {
+		return
+	}
+	_, err := authn.DescribeHash(user.PasswordHash)
+	if errors.Is(err, authn.ErrArgon2Version) {
+		p.IncompatibleHash(ctx, user)
+	}
+}
+
+func (p *Provider) invalidCredentialsMessage() string {
+	if p.InvalidCredentialsMessage != "" {
+		return p.InvalidCredentialsMessage
+	}
+
+	return defaultInvalidCredentialsMessage
+}
@@ -0,0 +1,115 @@
+package oauth_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/authn"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+// noncePattern matches the CSP nonce, which is the one part of a page that
+// differs on every response.
+var noncePattern = regexp.MustCompile(`nonce(="|-)[^"']+`)
+
+func stripNonces(s string) string {
+	return noncePattern.ReplaceAllString(s, "nonce")
+}
+
+func TestLoginFailuresAreIndistinguishable(t *testing.T) {
+	env := newTestEnv(t)
+
+	unknown := env.login(t, url.Values{"email": {"nobody@email.com"}})
+	wrong := env.login(t, url.Values{"password": {"not the password"}})
+
+	if unknown.Code != http.StatusUnauthorized || wrong.Code != unknown.Code {
+		t.Errorf("got: %d and %d, want: %d", unknown.Code, wrong.Code, http.StatusUnauthorized)
+	}
+	if stripNonces(unknown.Body.String()) != stripNonces(wrong.Body.String()) {
+		t.Errorf("got:\n%s\nand:\n%s\nwant: identical bodies", unknown.Body, wrong.Body)
+	}
+	for k := range wrong.Header() {
+		if stripNonces(unknown.Header().Get(k)) != stripNonces(wrong.Header().Get(k)) {
+			t.Errorf("%s got: %q and %q, want: identical", k, unknown.Header().Get(k), wrong.Header().Get(k))
+		}
+	}
+	if !bytes.Contains(wrong.Body.Bytes(), []byte("Invalid email or password.")) {
+		t.Errorf("got: %s, want: the generic message", wrong.Body)
+	}
+}
+
+func TestLoginFailureMessageIsConfigurable(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.InvalidCredentialsMessage = "Sign-in failed."
+
+	rec := env.login(t, url.Values{"password": {"not the password"}})
+	if !bytes.Contains(rec.Body.Bytes(), []byte("Sign-in failed.")) {
+		t.Errorf("got: %s, want: the configured message", rec.Body)
+	}
+}
+
+func TestLoginIncompatibleHash(t *testing.T) {
+	env := newTestEnv(t)
+	// Made by an argon2 library implementing version 0x10.
+	hash := "$argon2id$v=16,m=65536,t=6,p=2$gQc4ZccIqosKqCMKYUgP8A$x/xg/7uiPsBrRd11wC0mtiM2fjeqHzqTcjs2fLMsiGw"
+	err := env.provider.Users.UpdatePasswordHash(context.Background(), env.user.ID, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var flagged []int64
+	env.provider.IncompatibleHash = func(_ context.Context, user store.User) {
+		flagged = append(flagged, user.ID)
+	}
+
+	rec := env.login(t, nil)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusUnauthorized)
+	}
+	if len(flagged) != 1 || flagged[0] != env.user.ID {
+		t.Errorf("got: %v, want: [%d]", flagged, env.user.ID)
+	}
+
+	env.login(t, url.Values{"email": {"nobody@email.com"}})
+	if len(flagged) != 1 {
+		t.Errorf("got: %v, want: only the user with the old hash", flagged)
+	}
+}
+
+func TestLoginWhileHashBudgetExhausted(t *testing.T) {
+	env := newTestEnv(t)
+	t.Setenv("ARGON2ID_MEMORY", "1024")
+	t.Setenv("ARGON2ID_ITERATIONS", "1")
+	t.Setenv("ARGON2ID_PARALLELISM", "1")
+	t.Setenv("ARGON2ID_SALT_LENGTH", "16")
+	t.Setenv("ARGON2ID_KEY_LENGTH", "32")
+	hash, err := authn.GenerateHash(context.Background(), "argon2id", testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.provider.Users.UpdatePasswordHash(context.Background(), env.user.ID, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	budget := &authn.MemoryBudget{Total: 1024}
+	authn.SetMemoryBudget(budget)
+	t.Cleanup(func() { authn.SetMemoryBudget(nil) })
+
+	release, err := budget.Acquire(context.Background(), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := env.login(t, nil)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("got: %d, want: %d with Retry-After", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	release()
+	if rec := env.login(t, nil); rec.Code != http.StatusFound {
+		t.Errorf("got: %d, want: %d once memory is free", rec.Code, http.StatusFound)
+	}
+}
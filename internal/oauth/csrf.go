@@ -0,0 +1,61 @@
+package oauth
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/ehubscher/goidp/internal/authn"
+)
+
+const (
+	csrfCookieName    = "goidp_csrf"
+	csrfFormField     = "csrf_token"
+	csrfTokenLength   = 32
+	csrfFailedMessage = "This form has expired. Please try again."
+)
+
+// csrfToken returns the token forms must post back, setting it as a cookie
+// on first use. Checking the posted token against the cookie (the double
+// submit pattern) stops other sites from posting forms on the user's behalf,
+// including logging them in to an attacker's account.
+// The cookie is signed when CookieKeys are configured, and re-signed with
+// the current key when it was signed with a previous one.
+func (p *Provider) csrfToken(w http.ResponseWriter, r *http.Request) string {
+	token, stale, ok := p.signedCookie(r, csrfCookieName)
+	if ok && !stale {
+		return token
+	}
+
+	if !ok {
+		var err error
+		token, err = randomToken(csrfTokenLength)
+		if err != nil {
+			// Without a token the form can't be submitted, which fails
+			// closed.
+			slog.Error("Cannot generate CSRF token.", "err", err)
+			return ""
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    p.CookieKeys.sign(token),
+		Path:     "/",
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return token
+}
+
+// validCSRF reports whether the posted form carries the token from the CSRF
+// cookie.
+func (p *Provider) validCSRF(r *http.Request) bool {
+	token, _, ok := p.signedCookie(r, csrfCookieName)
+	if !ok {
+		return false
+	}
+
+	var posted string = r.PostForm.Get(csrfFormField)
+	return authn.SecretsEqual(posted, token)
+}
@@ -0,0 +1,92 @@
+package oauth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testCSRFToken = "test-csrf-token"
+
+// postForm builds a form post carrying a valid CSRF token.
+func postForm(target string, form url.Values) *http.Request {
+	form.Set("csrf_token", testCSRFToken)
+
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(&http.Cookie{Name: "goidp_csrf", Value: testCSRFToken})
+
+	return r
+}
+
+func TestLoginRequiresCSRFToken(t *testing.T) {
+	var requests = []struct {
+		name   string
+		cookie string
+		token  string
+	}{
+		{"no cookie", "", testCSRFToken},
+		{"no token", testCSRFToken, ""},
+		{"mismatch", testCSRFToken, "other"},
+	}
+
+	for _, c := range requests {
+		env := newTestEnv(t)
+
+		form := url.Values{
+			"email":      {testEmail},
+			"password":   {testPassword},
+			"csrf_token": {c.token},
+		}
+		r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if c.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "goidp_csrf", Value: c.cookie})
+		}
+
+		rec := env.do(r)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s got: %d, want: %d", c.name, rec.Code, http.StatusForbidden)
+		}
+		if responseCookie(rec, "goidp_session") != nil {
+			t.Errorf("%s got: a session, want: none", c.name)
+		}
+	}
+}
+
+func TestLoginComparesCSRFToken(t *testing.T) {
+	env := newTestEnv(t)
+	compared := watchSecretsEqual(t)
+
+	form := url.Values{"email": {testEmail}, "password": {testPassword}, "csrf_token": {"other"}}
+	r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(&http.Cookie{Name: "goidp_csrf", Value: testCSRFToken})
+	env.do(r)
+	if !compared("other", testCSRFToken) {
+		t.Error("got: no comparison, want: the token compared with SecretsEqual")
+	}
+}
+
+func TestLoginPageSetsCSRFCookie(t *testing.T) {
+	env := newTestEnv(t)
+
+	rec := env.do(httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{"login_hint": {"hint@email.com"}}), nil))
+	cookie := responseCookie(rec, "goidp_csrf")
+	if cookie == nil || !cookie.HttpOnly || !cookie.Secure {
+		t.Fatalf("got: %v, want: a secure CSRF cookie", cookie)
+	}
+
+	var body string = rec.Body.String()
+	if !strings.Contains(body, `name="csrf_token" value="`+cookie.Value+`"`) {
+		t.Errorf("got: %s, want: the CSRF token in the form", body)
+	}
+	if !strings.Contains(body, `value="hint@email.com"`) {
+		t.Errorf("got: %s, want: the email prefilled from login_hint", body)
+	}
+	if csp := rec.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "default-src 'none'") {
+		t.Errorf("got: %q, want: a restrictive CSP", csp)
+	}
+}
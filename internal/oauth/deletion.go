@@ -0,0 +1,116 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ehubscher/goidp/internal/audit"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+// DeactivateUser soft-deletes a user and revokes everything that would let
+// them keep using the provider: sessions, remember-me tokens, refresh tokens
+// and opaque access tokens. JWT access tokens already issued stay valid
+// until they expire. Audit records keep resolving to the user's row.
+func (p *Provider) DeactivateUser(ctx context.Context, userID int64) error {
+	err := p.Users.SoftDelete(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = p.revokeUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	p.audit().Record(ctx, audit.Event{Type: audit.UserDeactivated, UserID: userID, Time: p.now()})
+
+	return nil
+}
+
+// EraseUser is for erasure requests: it revokes the user's credentials like
+// DeactivateUser, then purges their consents, profile, password history and
+// MFA enrollment and finally the user itself. It can be retried after a
+// failure, and works on users already deactivated.
+func (p *Provider) EraseUser(ctx context.Context, userID int64) error {
+	err := p.revokeUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = p.Consents.DeleteUserConsents(ctx, userID)
+	if err != nil {
+		return err
+	}
+	err = p.Profiles.DeleteProfile(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if p.PasswordHistory != nil {
+		err = p.PasswordHistory.DeletePasswordHistory(ctx, userID)
+		if err != nil {
+			return err
+		}
+	}
+	if p.MFA != nil {
+		err = p.MFA.DeleteMFAEnrollment(ctx, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = p.Users.HardDelete(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	p.audit().Record(ctx, audit.Event{Type: audit.UserErased, UserID: userID, Time: p.now()})
+
+	return nil
+}
+
+func (p *Provider) revokeUser(ctx context.Context, userID int64) error {
+	err := p.Sessions.DeleteUserSessions(ctx, userID, "")
+	if err != nil {
+		return err
+	}
+	if p.RememberTokens != nil {
+		err = p.RememberTokens.DeleteUserRememberTokens(ctx, userID)
+		if err != nil {
+			return err
+		}
+	}
+	if p.RefreshTokens != nil {
+		err = p.RefreshTokens.DeleteUserRefreshTokens(ctx, userID)
+		if err != nil {
+			return err
+		}
+	}
+	if p.AccessTokens != nil {
+		err = p.AccessTokens.DeleteUserAccessTokens(ctx, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// activeUser reports whether userID still exists and isn't deactivated, for
+// grants that would otherwise mint tokens from stored state alone. Under
+// RequireVerifiedEmail the user must also have a verified email, which
+// unverified reports separately.
+func (p *Provider) activeUser(ctx context.Context, userID int64) (active, unverified bool, err error) {
+	user, err := p.Users.GetUserByID(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	if p.RequireVerifiedEmail && !user.EmailVerified {
+		return false, true, nil
+	}
+
+	return true, false, nil
+}
@@ -0,0 +1,66 @@
+package oauth_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/audit"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+func TestDeactivateUser(t *testing.T) {
+	env := newTestEnv(t)
+	sink := &audit.Memory{}
+	env.provider.Audit = sink
+	refreshToken := env.withRefreshToken(t)
+
+	err := env.provider.DeactivateUser(context.Background(), env.user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := env.login(t, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("login got: %d, want: %d", rec.Code, http.StatusUnauthorized)
+	}
+	if resp := decodeTokenResult(t, env.refresh(t, refreshToken, "")); resp.Error != "invalid_grant" {
+		t.Errorf("refresh got: %+v, want: invalid_grant", resp)
+	}
+	if _, err := env.sessions.GetSession(context.Background(), testSessionID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("session got: %v, want: %v", err, store.ErrNotFound)
+	}
+
+	events := sink.Events()
+	if len(events) != 1 || events[0].Type != audit.UserDeactivated || events[0].UserID != env.user.ID {
+		t.Errorf("got: %+v, want: one %s event", events, audit.UserDeactivated)
+	}
+}
+
+func TestEraseUser(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	err := env.provider.Profiles.UpdateProfile(ctx, store.Profile{UserID: env.user.ID, Name: "Ex Ample"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = env.provider.DeactivateUser(ctx, env.user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.provider.EraseUser(ctx, env.user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := env.provider.Consents.GetConsent(ctx, env.user.ID, testClientID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("consent got: %v, want: %v", err, store.ErrNotFound)
+	}
+	if _, err := env.provider.Profiles.GetProfile(ctx, env.user.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("profile got: %v, want: %v", err, store.ErrNotFound)
+	}
+	if err := env.provider.Users.HardDelete(ctx, env.user.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("user got: %v, want: %v", err, store.ErrNotFound)
+	}
+}
@@ -0,0 +1,153 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/feature"
+	"github.com/ehubscher/goidp/internal/jose"
+)
+
+const documentCacheTTL = 5 * time.Minute
+
+// KeySource provides the public signing keys published at the JWKS endpoint.
+type KeySource interface {
+	PublicKeys(ctx context.Context) (jose.JWKS, error)
+}
+
+// documentCache keeps the last successfully built copy of a rarely changing
+// JSON document, so it can still be served while its source, typically the
+// database, is briefly unavailable.
+type documentCache struct {
+	mu      sync.Mutex
+	body    []byte
+	fetched time.Time
+}
+
+func (c *documentCache) get(ctx context.Context, now time.Time, load func(ctx context.Context) (any, error)) (body []byte, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.body != nil && now.Sub(c.fetched) < documentCacheTTL {
+		return c.body, nil
+	}
+
+	doc, err := load(ctx)
+	if err == nil {
+		body, err = json.Marshal(doc)
+	}
+	if err != nil {
+		if c.body != nil {
+			slog.Warn("Serving stale cached document.", "age", now.Sub(c.fetched), "err", err)
+			return c.body, nil
+		}
+		return nil, err
+	}
+
+	c.body = body
+	c.fetched = now
+
+	return body, nil
+}
+
+// reset makes the next get build a fresh copy. The old one is kept to
+// fall back on should that fail.
+func (c *documentCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.fetched = time.Time{}
+}
+
+func (p *Provider) Discovery(w http.ResponseWriter, r *http.Request) {
+	p.serveDocument(w, r, &p.discoveryCache, func(ctx context.Context) (any, error) {
+		jwks, err := p.publicKeys(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var algs []string
+		for _, k := range jwks.Keys {
+			if k.Alg != "" && !slices.Contains(algs, k.Alg) {
+				algs = append(algs, k.Alg)
+			}
+		}
+
+		var scopes []string
+		for name := range p.scopes() {
+			scopes = append(scopes, name)
+		}
+		slices.Sort(scopes)
+
+		doc := map[string]any{
+			"issuer":                                         p.Issuer,
+			"authorization_endpoint":                         p.Issuer + "/authorize",
+			"jwks_uri":                                       p.Issuer + "/jwks",
+			"end_session_endpoint":                           p.Issuer + "/end_session",
+			"response_types_supported":                       p.Flows.responseTypes(),
+			"subject_types_supported":                        p.Subjects.types(),
+			"id_token_signing_alg_values_supported":          algs,
+			"scopes_supported":                               scopes,
+			"display_values_supported":                       displayValues,
+			"prompt_values_supported":                        promptValues,
+			"ui_locales_supported":                           p.uiLocales(),
+			"authorization_response_iss_parameter_supported": true,
+		}
+		if p.features().Enabled(feature.Token) {
+			doc["token_endpoint"] = p.Issuer + "/token"
+			doc["userinfo_endpoint"] = p.Issuer + "/userinfo"
+			doc["token_endpoint_auth_methods_supported"] = []string{AuthMethodSecretBasic, AuthMethodSecretPost, AuthMethodSecretJWT, AuthMethodPrivateKey, AuthMethodNone}
+			doc["token_endpoint_auth_signing_alg_values_supported"] = []string{jose.HS256, jose.RS256, jose.ES256}
+			doc["code_challenge_methods_supported"] = []string{pkceS256}
+			grantTypes := []string{}
+			for _, grantType := range supportedGrantTypes {
+				if p.Flows.grantTypeEnabled(grantType) && (grantType != "refresh_token" || p.RefreshTokens != nil) {
+					grantTypes = append(grantTypes, grantType)
+				}
+			}
+			doc["grant_types_supported"] = grantTypes
+		}
+		if p.features().Enabled(feature.Introspection) {
+			doc["introspection_endpoint"] = p.Issuer + "/introspect"
+			doc["introspection_endpoint_auth_methods_supported"] = []string{AuthMethodSecretBasic, AuthMethodSecretPost, AuthMethodSecretJWT, AuthMethodPrivateKey}
+			doc["introspection_endpoint_auth_signing_alg_values_supported"] = []string{jose.HS256, jose.RS256, jose.ES256}
+		}
+		if p.features().Enabled(feature.ClaimsParameter) {
+			doc["claims_parameter_supported"] = true
+		}
+
+		return doc, nil
+	})
+}
+
+func (p *Provider) JWKS(w http.ResponseWriter, r *http.Request) {
+	p.serveDocument(w, r, &p.jwksCache, func(ctx context.Context) (any, error) {
+		return p.publicKeys(ctx)
+	})
+}
+
+func (p *Provider) publicKeys(ctx context.Context) (jose.JWKS, error) {
+	if p.Keys == nil {
+		return jose.JWKS{Keys: []jose.JWK{}}, nil
+	}
+
+	return p.Keys.PublicKeys(ctx)
+}
+
+func (p *Provider) serveDocument(w http.ResponseWriter, r *http.Request, cache *documentCache, load func(ctx context.Context) (any, error)) {
+	body, err := cache.get(r.Context(), p.now(), load)
+	if err != nil {
+		slog.Error("Cannot build document.", "path", r.URL.Path, "err", err)
+		internalError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Write(body)
+}
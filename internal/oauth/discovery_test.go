@@ -0,0 +1,110 @@
+package oauth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/db"
+	"github.com/ehubscher/goidp/internal/jose"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+// flakyKeys stands in for a database-backed key source that goes away after
+// the first successful read.
+type flakyKeys struct {
+	jwks  jose.JWKS
+	calls int
+}
+
+func (k *flakyKeys) PublicKeys(ctx context.Context) (jose.JWKS, error) {
+	k.calls++
+	if k.calls > 1 {
+		return jose.JWKS{}, store.ErrUnavailable
+	}
+
+	return k.jwks, nil
+}
+
+func newFlakyKeys(t *testing.T) *flakyKeys {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &flakyKeys{jwks: jose.JWKS{Keys: []jose.JWK{jose.NewRSAJWK("k1", "RS256", &key.PublicKey)}}}
+}
+
+func TestJWKSServesWhileStoreUnavailable(t *testing.T) {
+	env := newTestEnv(t)
+	keys := newFlakyKeys(t)
+	env.provider.Keys = keys
+
+	var bodies []string
+	for i := 0; i < 2; i++ {
+		rec := env.do(httptest.NewRequest(http.MethodGet, "/jwks", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d got: %d, want: %d", i, rec.Code, http.StatusOK)
+		}
+		bodies = append(bodies, rec.Body.String())
+
+		// Expire the cache so the second request goes back to the source.
+		env.now = env.now.Add(time.Hour)
+	}
+
+	if keys.calls != 2 {
+		t.Errorf("got: %d calls, want: %d", keys.calls, 2)
+	}
+	if bodies[0] != bodies[1] {
+		t.Errorf("got: %s, want: %s", bodies[1], bodies[0])
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.Issuer = "https://idp.example"
+	env.provider.Keys = newFlakyKeys(t)
+
+	rec := env.do(httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d, want: %d", rec.Code, http.StatusOK)
+	}
+
+	var doc map[string]any
+	err := json.NewDecoder(rec.Body).Decode(&doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc["issuer"] != "https://idp.example" || doc["jwks_uri"] != "https://idp.example/jwks" {
+		t.Errorf("got: %v, want: issuer and jwks_uri under https://idp.example", doc)
+	}
+}
+
+func TestStoreUnavailableReturns503(t *testing.T) {
+	env := newTestEnv(t)
+
+	conn, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.provider.Profiles = store.NewSQLiteProfileStore(conn)
+	conn.Close()
+
+	r := httptest.NewRequest(http.MethodGet, "/account/profile", nil)
+	r.AddCookie(env.withSession(t))
+
+	rec := env.do(r)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Errorf("got: no Retry-After, want: Retry-After")
+	}
+}
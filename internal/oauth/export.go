@@ -0,0 +1,143 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/audit"
+	"github.com/ehubscher/goidp/internal/errs"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+// exportDocument is everything held about a user, for a data subject access
+// request. Credentials are left out on purpose: password hashes, session ids
+// and tokens would let whoever holds the file act as the user.
+type exportDocument struct {
+	User        exportUser      `json:"user"`
+	Profile     profileDocument `json:"profile"`
+	Consents    []exportConsent `json:"consents"`
+	Sessions    []exportSession `json:"sessions"`
+	AuditEvents []exportEvent   `json:"audit_events"`
+	ExportedAt  time.Time       `json:"exported_at"`
+}
+
+type exportUser struct {
+	ID            int64     `json:"id"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type exportConsent struct {
+	ClientID  string    `json:"client_id"`
+	Scopes    []string  `json:"scopes"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+type exportSession struct {
+	CreatedAt time.Time `json:"created_at"`
+	AuthTime  time.Time `json:"auth_time"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Current marks the session the export was requested from.
+	Current bool `json:"current"`
+}
+
+type exportEvent struct {
+	Type       string            `json:"type"`
+	ClientID   string            `json:"client_id,omitempty"`
+	RemoteAddr string            `json:"remote_addr,omitempty"`
+	Time       time.Time         `json:"time"`
+	Detail     map[string]string `json:"detail,omitempty"`
+}
+
+// Export serves GET /account/export, a download of the logged-in user's
+// data. Like a password change it requires a recent sign-in. Audit events
+// are included only if the audit sink can be queried.
+func (p *Provider) Export(w http.ResponseWriter, r *http.Request) {
+	session, ok := p.session(w, r)
+	if !ok {
+		errs.WriteError(w, r, errs.Unauthorized("Authentication required."))
+		return
+	}
+	if p.now().Sub(session.AuthTime) > p.recentAuthMaxAge() {
+		errs.WriteError(w, r, errs.Unauthorized("Recent authentication required, sign in again."))
+		return
+	}
+
+	doc, err := p.export(r, session)
+	if err != nil {
+		errs.WriteError(w, r, errs.Internal(fmt.Errorf("cannot export user %d: %w", session.UserID, err)))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="account-export.json"`)
+	w.Header().Set("Cache-Control", "no-store")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(doc)
+}
+
+func (p *Provider) export(r *http.Request, session store.Session) (doc exportDocument, err error) {
+	ctx := r.Context()
+	now := p.now()
+
+	user, err := p.Users.GetUserByID(ctx, session.UserID)
+	if err != nil {
+		return exportDocument{}, fmt.Errorf("cannot load user: %w", err)
+	}
+	doc.User = exportUser{
+		ID:            user.ID,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		CreatedAt:     user.CreatedAt,
+	}
+
+	profile, err := p.Profiles.GetProfile(ctx, user.ID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return exportDocument{}, fmt.Errorf("cannot load profile: %w", err)
+	}
+	doc.Profile = profileDocument{
+		Name:       profile.Name,
+		GivenName:  profile.GivenName,
+		FamilyName: profile.FamilyName,
+		Picture:    profile.Picture,
+		Locale:     profile.Locale,
+	}
+
+	consents, err := p.Consents.ListUserConsents(ctx, user.ID)
+	if err != nil {
+		return exportDocument{}, fmt.Errorf("cannot list consents: %w", err)
+	}
+	doc.Consents = []exportConsent{}
+	for _, c := range consents {
+		doc.Consents = append(doc.Consents, exportConsent{c.ClientID, c.Scopes, c.GrantedAt})
+	}
+
+	sessions, err := p.Sessions.ListUserSessions(ctx, user.ID, now)
+	if err != nil {
+		return exportDocument{}, fmt.Errorf("cannot list sessions: %w", err)
+	}
+	doc.Sessions = []exportSession{}
+	for _, s := range sessions {
+		doc.Sessions = append(doc.Sessions, exportSession{s.CreatedAt, s.AuthTime, s.ExpiresAt, s.ID == p.SessionIDKeys.hash(session.ID)})
+	}
+
+	doc.AuditEvents = []exportEvent{}
+	if querier, ok := p.audit().(audit.Querier); ok {
+		events, err := querier.UserEvents(ctx, user.ID)
+		if err != nil {
+			return exportDocument{}, fmt.Errorf("cannot list audit events: %w", err)
+		}
+		for _, e := range events {
+			doc.AuditEvents = append(doc.AuditEvents, exportEvent{e.Type, e.ClientID, e.RemoteAddr, e.Time, e.Detail})
+		}
+	}
+
+	doc.ExportedAt = now
+
+	return doc, nil
+}
@@ -0,0 +1,74 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/audit"
+)
+
+func (env *testEnv) export(t *testing.T, cookie *http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, "/account/export", nil)
+	r.AddCookie(cookie)
+
+	return env.do(r)
+}
+
+func TestExport(t *testing.T) {
+	env := newTestEnv(t)
+	sink := &audit.Memory{}
+	env.provider.Audit = sink
+	sink.Record(context.Background(), audit.Event{Type: audit.PasswordChanged, UserID: env.user.ID, Time: env.now})
+	sink.Record(context.Background(), audit.Event{Type: audit.PasswordChanged, UserID: env.user.ID + 1, Time: env.now})
+	refreshToken := env.withRefreshToken(t)
+
+	rec := env.export(t, env.freshSession(t, "fresh-session"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d, want: %d", rec.Code, http.StatusOK)
+	}
+	if got := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(got, "attachment") {
+		t.Errorf("Content-Disposition got: %q, want: attachment", got)
+	}
+
+	doc := decodeMap(t, rec)
+	for _, section := range []string{"user", "profile", "consents", "sessions", "audit_events"} {
+		if _, ok := doc[section]; !ok {
+			t.Errorf("missing section %q", section)
+		}
+	}
+	if sessions, _ := doc["sessions"].([]any); len(sessions) != 2 {
+		t.Errorf("sessions got: %v, want: 2", doc["sessions"])
+	}
+	if consents, _ := doc["consents"].([]any); len(consents) != 1 {
+		t.Errorf("consents got: %v, want: 1", doc["consents"])
+	}
+	if events, _ := doc["audit_events"].([]any); len(events) != 1 {
+		t.Errorf("audit_events got: %v, want: 1", doc["audit_events"])
+	}
+
+	user, err := env.provider.Users.GetUserByID(context.Background(), env.user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := rec.Body.String()
+	for _, secret := range []string{user.PasswordHash, testSessionID, "fresh-session", refreshToken, "password_hash", "secret"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("export contains %q", secret)
+		}
+	}
+}
+
+func TestExportRequiresRecentAuth(t *testing.T) {
+	env := newTestEnv(t)
+
+	// withSession authenticated an hour ago.
+	rec := env.export(t, env.withSession(t))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusUnauthorized)
+	}
+}
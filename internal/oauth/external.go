@@ -0,0 +1,170 @@
+package oauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/audit"
+	"github.com/ehubscher/goidp/internal/authn"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const defaultExternalVerifierTimeout = 5 * time.Second
+
+// ExternalVerifier checks passwords against an identity source outside the
+// provider, such as the directory users are being migrated from.
+type ExternalVerifier interface {
+	// VerifyPassword reports whether password is right for email. An
+	// unknown email is a mismatch, not an error; errors mean the source
+	// couldn't be asked.
+	VerifyPassword(ctx context.Context, email, password string) (match bool, err error)
+}
+
+// HTTPVerifier is an ExternalVerifier that posts the credentials as JSON,
+// {"email": ..., "password": ...}, to URL, typically a small service in
+// front of an LDAP directory. 200 or 204 is a match and 401, 403 or 404 a
+// mismatch; any other status is an error.
+type HTTPVerifier struct {
+	URL string
+	// Token, if set, is sent as a bearer token so the service can tell the
+	// provider from anyone else.
+	Token string
+	// Client defaults to one with a 5 second timeout.
+	Client *http.Client
+}
+
+// ConfigureExternalVerifier reads EXTERNAL_VERIFIER_URL and the
+// EXTERNAL_VERIFIER_TOKEN secret. It returns nil when no URL is set.
+func ConfigureExternalVerifier() (ExternalVerifier, error) {
+	raw := os.Getenv("EXTERNAL_VERIFIER_URL")
+	if raw == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+		return nil, fmt.Errorf("EXTERNAL_VERIFIER_URL misconfigured: %q is not an absolute URL", raw)
+	}
+	token, err := lookupSecret("EXTERNAL_VERIFIER_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+
+	return &HTTPVerifier{URL: raw, Token: token}, nil
+}
+
+func (v *HTTPVerifier) VerifyPassword(ctx context.Context, email, password string) (match bool, err error) {
+	body, err := json.Marshal(map[string]string{"email": email, "password": password})
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if v.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+v.Token)
+	}
+
+	client := v.Client
+	if client == nil {
+		client = &http.Client{Timeout: defaultExternalVerifierTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return true, nil
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("external verifier answered %s", resp.Status)
+	}
+}
+
+// verifyExternal checks password with the ExternalVerifier for a user who
+// has no local password, found or not, and on a match gives them one: an
+// existing user's hash is set and a missing user is created. From then on
+// they sign in locally. An unreachable source is store.ErrUnavailable, as
+// it is for any other backend during an outage.
+func (p *Provider) verifyExternal(ctx context.Context, user store.User, found bool, email, password, remoteIP string) (store.User, bool, error) {
+	match, err := p.External.VerifyPassword(ctx, email, password)
+	if err != nil {
+		return store.User{}, false, fmt.Errorf("%w: cannot verify password externally: %w", store.ErrUnavailable, err)
+	}
+	if !match {
+		return store.User{}, false, nil
+	}
+
+	hash, err := authn.GenerateHash(ctx, p.hashAlgorithm(), password)
+	if err != nil {
+		return store.User{}, false, fmt.Errorf("cannot hash password: %w", unavailableIfBusy(err))
+	}
+	if found {
+		err = p.Users.UpdatePasswordHash(ctx, user.ID, hash)
+		if err != nil {
+			return store.User{}, false, err
+		}
+		user.PasswordHash = hash
+	} else {
+		user, err = p.provisionUser(ctx, email, hash)
+		// The address belongs to a deactivated user, or to a local one.
+		if errors.Is(err, store.ErrNotFound) || errors.Is(err, ErrInvalidCredentials) {
+			return store.User{}, false, nil
+		}
+		if err != nil {
+			return store.User{}, false, err
+		}
+	}
+
+	err = p.recordPassword(ctx, user.ID, hash)
+	if err != nil {
+		slog.Error("Cannot record password history.", "user_id", user.ID, "err", err)
+	}
+	p.audit().Record(ctx, audit.Event{
+		Type:       audit.UserProvisioned,
+		UserID:     user.ID,
+		RemoteAddr: remoteIP,
+		Time:       p.now(),
+		Detail:     map[string]string{"created": strconv.FormatBool(!found)},
+	})
+
+	return user, true, nil
+}
+
+// provisionUser creates the user an external match was for. If the address
+// is taken by a user without a password, that user is used. One holding a
+// password, even one a concurrent login just provisioned, is
+// ErrInvalidCredentials: the external match is no proof of who owns it.
+func (p *Provider) provisionUser(ctx context.Context, email, hash string) (store.User, error) {
+	normalized, err := p.Email.Normalize(ctx, email)
+	if err != nil {
+		return store.User{}, fmt.Errorf("cannot provision user: %w", err)
+	}
+
+	user, err := p.Users.CreateUser(ctx, normalized, hash)
+	if errors.Is(err, store.ErrConflict) {
+		user, err = p.Users.GetUserByEmail(ctx, normalized)
+		if err == nil && user.PasswordHash != "" {
+			return store.User{}, ErrInvalidCredentials
+		}
+	}
+
+	return user, err
+}
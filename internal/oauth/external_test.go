@@ -0,0 +1,165 @@
+package oauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/authn"
+	"github.com/ehubscher/goidp/internal/oauth"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+// directory is an ExternalVerifier holding passwords by email.
+type directory struct {
+	passwords map[string]string
+	calls     int
+	err       error
+}
+
+func (d *directory) VerifyPassword(ctx context.Context, email, password string) (bool, error) {
+	d.calls++
+	if d.err != nil {
+		return false, d.err
+	}
+	want, ok := d.passwords[email]
+
+	return ok && want == password, nil
+}
+
+func (env *testEnv) loginAs(t *testing.T, email, password string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	return env.do(postForm("/login", url.Values{"email": {email}, "password": {password}, "return_to": {"/account"}}))
+}
+
+func TestExternalVerifierProvisions(t *testing.T) {
+	env := newTestEnv(t)
+	dir := &directory{passwords: map[string]string{"migrated@email.com": "directory password"}}
+	env.provider.External = dir
+
+	rec := env.loginAs(t, "migrated@email.com", "wrong password")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password got: %d, want: %d", rec.Code, http.StatusUnauthorized)
+	}
+	_, err := env.provider.Users.GetUserByEmail(context.Background(), "migrated@email.com")
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("got: %v, want: no user after a mismatch", err)
+	}
+
+	rec = env.loginAs(t, "migrated@email.com", "directory password")
+	if rec.Code != http.StatusFound {
+		t.Fatalf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusFound)
+	}
+	user, err := env.provider.Users.GetUserByEmail(context.Background(), "migrated@email.com")
+	if err != nil {
+		t.Fatalf("got: %v, want: a provisioned user", err)
+	}
+	match, err := authn.VerifyPassword(context.Background(), "directory password", user.PasswordHash)
+	if err != nil || !match {
+		t.Errorf("got: %v, %v, want: the password hashed locally", match, err)
+	}
+
+	// Provisioned users sign in locally from then on.
+	dir.calls = 0
+	dir.err = errors.New("directory is down")
+	rec = env.loginAs(t, "migrated@email.com", "directory password")
+	if rec.Code != http.StatusFound || dir.calls != 0 {
+		t.Errorf("got: %d after %d external calls, want: %d locally", rec.Code, dir.calls, http.StatusFound)
+	}
+}
+
+func TestExternalVerifierLocalPrecedence(t *testing.T) {
+	env := newTestEnv(t)
+	dir := &directory{passwords: map[string]string{testEmail: "directory password"}}
+	env.provider.External = dir
+
+	rec := env.loginAs(t, testEmail, "directory password")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("directory password got: %d, want: %d", rec.Code, http.StatusUnauthorized)
+	}
+	rec = env.loginAs(t, testEmail, testPassword)
+	if rec.Code != http.StatusFound {
+		t.Errorf("local password got: %d, want: %d", rec.Code, http.StatusFound)
+	}
+	if dir.calls != 0 {
+		t.Errorf("got: %d external calls, want: none for a user with a local password", dir.calls)
+	}
+}
+
+func TestExternalVerifierAddressVariant(t *testing.T) {
+	env := newTestEnv(t)
+	var variant string = " " + testEmail + " "
+	dir := &directory{passwords: map[string]string{variant: "directory password"}}
+	env.provider.External = dir
+
+	rec := env.loginAs(t, variant, "directory password")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("got: %d, want: %d for a variant of a local address", rec.Code, http.StatusUnauthorized)
+	}
+	if dir.calls != 0 {
+		t.Errorf("got: %d external calls, want: none for a user with a local password", dir.calls)
+	}
+	user, err := env.provider.Users.GetUserByEmail(context.Background(), testEmail)
+	if err != nil || user.PasswordHash != testPasswordHash {
+		t.Errorf("got: %v, %v, want: the local password kept", user, err)
+	}
+}
+
+func TestExternalVerifierUnavailable(t *testing.T) {
+	env := newTestEnv(t)
+	withLockout(t, env)
+	env.provider.External = &directory{err: errors.New("directory is down")}
+
+	for range 3 {
+		rec := env.loginAs(t, "migrated@email.com", "directory password")
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("got: %d, want: %d", rec.Code, http.StatusServiceUnavailable)
+		}
+	}
+
+	// None of those counted toward a lockout.
+	env.provider.External = &directory{passwords: map[string]string{"migrated@email.com": "directory password"}}
+	rec := env.loginAs(t, "migrated@email.com", "directory password")
+	if rec.Code != http.StatusFound {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusFound)
+	}
+}
+
+func TestHTTPVerifier(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var creds struct{ Email, Password string }
+		err := json.NewDecoder(r.Body).Decode(&creds)
+		switch {
+		case err != nil || r.Header.Get("Authorization") != "Bearer verifier-token":
+			w.WriteHeader(http.StatusBadRequest)
+		case creds.Email == "down@email.com":
+			w.WriteHeader(http.StatusBadGateway)
+		case creds.Password == "directory password":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	v := &oauth.HTTPVerifier{URL: srv.URL, Token: "verifier-token"}
+	var cases = []struct {
+		email, password string
+		match, err      bool
+	}{
+		{"migrated@email.com", "directory password", true, false},
+		{"migrated@email.com", "wrong password", false, false},
+		{"down@email.com", "directory password", false, true},
+	}
+	for _, c := range cases {
+		match, err := v.VerifyPassword(context.Background(), c.email, c.password)
+		if match != c.match || (err != nil) != c.err {
+			t.Errorf("%s %q got: %v, %v, want: %v and error %v", c.email, c.password, match, err, c.match, c.err)
+		}
+	}
+}
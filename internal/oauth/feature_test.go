@@ -0,0 +1,68 @@
+package oauth_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/feature"
+)
+
+func TestDisabledFeatures(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.Keys = newFlakyKeys(t)
+	env.provider.Features = feature.Flags{feature.Token: false, feature.ClaimsParameter: false}
+	env.mux = http.NewServeMux()
+	env.provider.RegisterHandlers(env.mux)
+
+	rec := env.do(httptest.NewRequest(http.MethodPost, "/token", strings.NewReader("grant_type=authorization_code")))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusNotFound)
+	}
+
+	rec = env.do(httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+	var doc map[string]any
+	err := json.NewDecoder(rec.Body).Decode(&doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"token_endpoint", "grant_types_supported", "claims_parameter_supported"} {
+		if _, ok := doc[name]; ok {
+			t.Errorf("got: %s in discovery, want: omitted", name)
+		}
+	}
+
+	// Still-enabled features are unaffected.
+	if rec := env.register(t, "new.user@example.com", "correct horse"); rec.Code != http.StatusCreated {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusCreated)
+	}
+}
+
+func TestSetFeatures(t *testing.T) {
+	env := newTestEnv(t)
+	keys := newFlakyKeys(t)
+	env.provider.Keys = keys
+	discovery := func() map[string]any {
+		var doc map[string]any
+		err := json.NewDecoder(env.do(httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil)).Body).Decode(&doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return doc
+	}
+	if _, ok := discovery()["token_endpoint"]; !ok {
+		t.Fatal("got: no token_endpoint, want: advertised before the change")
+	}
+
+	env.provider.SetFeatures(feature.Flags{feature.Token: false})
+	keys.calls = 0
+	rec := env.do(httptest.NewRequest(http.MethodPost, "/token", strings.NewReader("grant_type=authorization_code")))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusNotFound)
+	}
+	if _, ok := discovery()["token_endpoint"]; ok {
+		t.Error("got: token_endpoint, want: omitted once disabled")
+	}
+}
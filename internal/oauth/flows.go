@@ -0,0 +1,96 @@
+package oauth
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The grant and response types this provider implements.
+var (
+	supportedGrantTypes    = []string{"authorization_code", "refresh_token", "password"}
+	supportedResponseTypes = []string{"code"}
+)
+
+// Flows narrows the grant and response types the provider accepts,
+// deployment wide. It sits above the client's own GrantTypes: a type turned
+// off here is refused, and left out of discovery, whatever a client is
+// allowed. Nil fields mean every supported type, except that the password
+// grant also needs PasswordGrant.
+type Flows struct {
+	GrantTypes    []string
+	ResponseTypes []string
+
+	// PasswordGrant turns on the resource owner password credentials
+	// grant. It is deprecated (OAuth 2.0 Security BCP section 2.4) and
+	// exists only to migrate first-party clients off it.
+	PasswordGrant bool
+}
+
+// ConfigureFlows reads GRANT_TYPES and RESPONSE_TYPES, each a
+// comma-separated list such as "authorization_code,refresh_token". Unset
+// means every supported type; naming a type this provider doesn't
+// implement is an error, so a typo can't silently turn a flow off.
+// PASSWORD_GRANT, which defaults to false, turns on the password grant.
+func ConfigureFlows() (f Flows, err error) {
+	for _, c := range []struct {
+		env       string
+		supported []string
+		v         *[]string
+	}{
+		{"GRANT_TYPES", supportedGrantTypes, &f.GrantTypes},
+		{"RESPONSE_TYPES", supportedResponseTypes, &f.ResponseTypes},
+	} {
+		raw := os.Getenv(c.env)
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+
+		*c.v = []string{}
+		for _, name := range strings.Split(raw, ",") {
+			name = strings.TrimSpace(name)
+			if !slices.Contains(c.supported, name) {
+				return Flows{}, fmt.Errorf("%s misconfigured: %q is not one of %s", c.env, name, strings.Join(c.supported, ", "))
+			}
+			*c.v = append(*c.v, name)
+		}
+	}
+
+	if raw := os.Getenv("PASSWORD_GRANT"); raw != "" {
+		f.PasswordGrant, err = strconv.ParseBool(raw)
+		if err != nil {
+			return Flows{}, fmt.Errorf("PASSWORD_GRANT misconfigured: %w", err)
+		}
+	}
+	if f.PasswordGrant {
+		slog.Warn("The password grant is deprecated. Move its clients to the authorization code grant and turn PASSWORD_GRANT off.")
+	}
+
+	return f, nil
+}
+
+func (f Flows) grantTypeEnabled(grantType string) bool {
+	if grantType == "password" && !f.PasswordGrant {
+		return false
+	}
+	return slices.Contains(supportedGrantTypes, grantType) && (f.GrantTypes == nil || slices.Contains(f.GrantTypes, grantType))
+}
+
+func (f Flows) responseTypeEnabled(responseType string) bool {
+	return slices.Contains(supportedResponseTypes, responseType) && (f.ResponseTypes == nil || slices.Contains(f.ResponseTypes, responseType))
+}
+
+// responseTypes returns the enabled response types, for discovery.
+func (f Flows) responseTypes() []string {
+	types := []string{}
+	for _, t := range supportedResponseTypes {
+		if f.responseTypeEnabled(t) {
+			types = append(types, t)
+		}
+	}
+
+	return types
+}
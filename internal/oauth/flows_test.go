@@ -0,0 +1,99 @@
+package oauth_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/oauth"
+)
+
+func (env *testEnv) discoveryList(t *testing.T, name string) []string {
+	t.Helper()
+
+	rec := env.do(httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+	var doc map[string]json.RawMessage
+	err := json.NewDecoder(rec.Body).Decode(&doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list []string
+	err = json.Unmarshal(doc[name], &list)
+	if err != nil {
+		t.Fatalf("%s got: %s, want: a list", name, doc[name])
+	}
+
+	return list
+}
+
+func TestFlowsDisableGrantType(t *testing.T) {
+	env := newTestEnv(t)
+	refreshToken := env.withRefreshToken(t)
+	env.provider.Flows = oauth.Flows{GrantTypes: []string{"authorization_code"}}
+
+	// The test client allows every grant type, the deployment doesn't.
+	rec := env.refresh(t, refreshToken, "")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusBadRequest)
+	}
+	if resp := decodeTokenResult(t, rec); resp.Error != "unsupported_grant_type" {
+		t.Errorf("got: %q, want: %q", resp.Error, "unsupported_grant_type")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(nil), nil)
+	r.AddCookie(env.freshSession(t, "second"))
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {redirectParams(t, env.do(r)).Get("code")},
+		"redirect_uri": {testRedirectURI},
+	}
+	rec = env.exchange(t, basicAuth(testClientID, testClientSecret), form)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusOK)
+	}
+	if resp := decodeTokenResult(t, rec); resp.RefreshToken != "" {
+		t.Error("got: a refresh_token, want: none while the grant is off")
+	}
+
+	if got := env.discoveryList(t, "grant_types_supported"); !slices.Equal(got, []string{"authorization_code"}) {
+		t.Errorf("got: %v, want: [authorization_code]", got)
+	}
+}
+
+func TestFlowsDisableResponseType(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.Flows = oauth.Flows{ResponseTypes: []string{}}
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(nil), nil)
+	r.AddCookie(env.withSession(t))
+	if got := redirectParams(t, env.do(r)).Get("error"); got != "unsupported_response_type" {
+		t.Errorf("got: %q, want: %q", got, "unsupported_response_type")
+	}
+
+	if got := env.discoveryList(t, "response_types_supported"); len(got) != 0 {
+		t.Errorf("got: %v, want: none", got)
+	}
+}
+
+func TestConfigureFlows(t *testing.T) {
+	t.Setenv("GRANT_TYPES", "authorization_code")
+	t.Setenv("RESPONSE_TYPES", "")
+
+	flows, err := oauth.ConfigureFlows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(flows.GrantTypes, []string{"authorization_code"}) || flows.ResponseTypes != nil {
+		t.Errorf("got: %+v, want: only authorization_code, every response type", flows)
+	}
+
+	for _, raw := range []string{"client_credentials", "authorization_code,implicit"} {
+		t.Setenv("GRANT_TYPES", raw)
+		if _, err := oauth.ConfigureFlows(); err == nil {
+			t.Errorf("%q got: nil, want: an error", raw)
+		}
+	}
+}
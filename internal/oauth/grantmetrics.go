@@ -0,0 +1,145 @@
+package oauth
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultMaxGrantClients = 100
+	// otherLabel replaces a label value outside the bounded set.
+	otherLabel = "other"
+	// unauthenticatedClient labels requests whose client was never
+	// authenticated, since their client_id is whatever the caller sent.
+	unauthenticatedClient = "unauthenticated"
+	grantSuccess          = "success"
+)
+
+// grantOutcomes are the outcomes RecordGrant is given: success or one of
+// the error codes the token endpoint answers with.
+var grantOutcomes = []string{
+	grantSuccess, "invalid_request", "invalid_client", "invalid_grant", "unauthorized_client",
+	"unsupported_grant_type", "invalid_scope", "temporarily_unavailable", "server_error",
+}
+
+// GrantRecorder is told the outcome of every token request, for capacity
+// planning and spotting abuse. grantType is one of the supported grant
+// types or "other", outcome is "success" or the OAuth error code, and
+// clientID is "unauthenticated" when client authentication failed.
+type GrantRecorder interface {
+	RecordGrant(clientID, grantType, outcome string)
+}
+
+// GrantCounters is a GrantRecorder counting grants in memory and serving
+// them in the Prometheus text format. Only the first MaxClients clients
+// seen get a label of their own; the rest are counted under "other".
+type GrantCounters struct {
+	// MaxClients caps the distinct client_id labels. Zero means 100.
+	MaxClients int
+
+	mu      sync.Mutex
+	counts  map[grantLabels]uint64
+	clients map[string]bool
+}
+
+type grantLabels struct {
+	clientID, grantType, outcome string
+}
+
+func (c *GrantCounters) maxClients() int {
+	if c.MaxClients > 0 {
+		return c.MaxClients
+	}
+
+	return defaultMaxGrantClients
+}
+
+func (c *GrantCounters) RecordGrant(clientID, grantType, outcome string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts == nil {
+		c.counts = make(map[grantLabels]uint64)
+		c.clients = make(map[string]bool)
+	}
+	if !c.clients[clientID] && clientID != unauthenticatedClient {
+		if len(c.clients) >= c.maxClients() {
+			clientID = otherLabel
+		} else {
+			c.clients[clientID] = true
+		}
+	}
+	c.counts[grantLabels{clientID, grantType, outcome}]++
+}
+
+// ServeHTTP writes the counters as goidp_token_grants_total.
+func (c *GrantCounters) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	lines := make([]string, 0, len(c.counts))
+	for l, n := range c.counts {
+		lines = append(lines, fmt.Sprintf(
+			"goidp_token_grants_total{client_id=%s,grant_type=%s,outcome=%s} %d\n",
+			promLabel(l.clientID), promLabel(l.grantType), promLabel(l.outcome), n,
+		))
+	}
+	c.mu.Unlock()
+	slices.Sort(lines)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprint(w, "# HELP goidp_token_grants_total Token requests by client, grant type and outcome.\n")
+	fmt.Fprint(w, "# TYPE goidp_token_grants_total counter\n")
+	for _, line := range lines {
+		fmt.Fprint(w, line)
+	}
+}
+
+// promLabel quotes a label value as the Prometheus text format escapes it.
+func promLabel(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v) + `"`
+}
+
+// outcomeWriter notes the status and OAuth error code of a token response,
+// which tokenError fills in.
+type outcomeWriter struct {
+	http.ResponseWriter
+	status int
+	code   string
+}
+
+func (w *outcomeWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *outcomeWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// recordGrant reports a finished token request to GrantMetrics, with the
+// grant type and outcome reduced to their bounded sets.
+func (p *Provider) recordGrant(clientID, grantType string, w *outcomeWriter) {
+	if clientID == "" {
+		clientID = unauthenticatedClient
+	}
+	if !slices.Contains(supportedGrantTypes, grantType) {
+		grantType = otherLabel
+	}
+
+	outcome := w.code
+	if w.status == http.StatusOK {
+		outcome = grantSuccess
+	}
+	if !slices.Contains(grantOutcomes, outcome) {
+		outcome = otherLabel
+	}
+
+	p.GrantMetrics.RecordGrant(clientID, grantType, outcome)
+}
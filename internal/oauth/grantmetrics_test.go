@@ -0,0 +1,65 @@
+package oauth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/oauth"
+)
+
+func scrapeGrants(t *testing.T, counters *oauth.GrantCounters) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	counters.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	return rec.Body.String()
+}
+
+func TestGrantMetrics(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	counters := &oauth.GrantCounters{}
+	env.provider.GrantMetrics = counters
+
+	auth := basicAuth(testClientID, testClientSecret)
+	if rec := env.exchange(t, auth, env.codeGrant(t)); rec.Code != http.StatusOK {
+		t.Fatalf("got: %d, want: %d", rec.Code, http.StatusOK)
+	}
+	env.exchange(t, auth, url.Values{"grant_type": {"authorization_code"}, "code": {"spent"}, "redirect_uri": {testRedirectURI}})
+	env.exchange(t, auth, url.Values{"grant_type": {"authorization_code"}, "code": {"spent"}, "redirect_uri": {testRedirectURI}})
+	env.exchange(t, basicAuth(testClientID, "wrong"), url.Values{"grant_type": {"refresh_token"}})
+	env.exchange(t, auth, url.Values{"grant_type": {"made-up:" + strings.Repeat("x", 40)}})
+
+	got := scrapeGrants(t, counters)
+	for _, want := range []string{
+		`goidp_token_grants_total{client_id="client1",grant_type="authorization_code",outcome="success"} 1`,
+		`goidp_token_grants_total{client_id="client1",grant_type="authorization_code",outcome="invalid_grant"} 2`,
+		`goidp_token_grants_total{client_id="unauthenticated",grant_type="refresh_token",outcome="invalid_client"} 1`,
+		`goidp_token_grants_total{client_id="client1",grant_type="other",outcome="unsupported_grant_type"} 1`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("got:\n%s\nwant: %s", got, want)
+		}
+	}
+}
+
+func TestGrantCountersCapClients(t *testing.T) {
+	counters := &oauth.GrantCounters{MaxClients: 2}
+	for _, clientID := range []string{"a", "b", "c", "d", "a"} {
+		counters.RecordGrant(clientID, "authorization_code", "success")
+	}
+
+	got := scrapeGrants(t, counters)
+	for _, want := range []string{
+		`goidp_token_grants_total{client_id="a",grant_type="authorization_code",outcome="success"} 2`,
+		`goidp_token_grants_total{client_id="b",grant_type="authorization_code",outcome="success"} 1`,
+		`goidp_token_grants_total{client_id="other",grant_type="authorization_code",outcome="success"} 2`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("got:\n%s\nwant: %s", got, want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/ehubscher/goidp/internal/store"
+	"github.com/ehubscher/goidp/internal/token"
+)
+
+// introspectionResponse is the RFC 7662 response. Everything but active is
+// left out for inactive tokens.
+type introspectionResponse struct {
+	Active    bool           `json:"active"`
+	Scope     string         `json:"scope,omitempty"`
+	ClientID  string         `json:"client_id,omitempty"`
+	AZP       string         `json:"azp,omitempty"`
+	Subject   string         `json:"sub,omitempty"`
+	Audience  token.Audience `json:"aud,omitempty"`
+	Issuer    string         `json:"iss,omitempty"`
+	ExpiresAt int64          `json:"exp,omitempty"`
+	IssuedAt  int64          `json:"iat,omitempty"`
+	NotBefore int64          `json:"nbf,omitempty"`
+	ID        string         `json:"jti,omitempty"`
+	TokenType string         `json:"token_type,omitempty"`
+
+	// userInfoClaims stays between the token and /userinfo.
+	userInfoClaims string
+}
+
+// Introspect serves POST /introspect (RFC 7662) for access tokens, whether
+// opaque or JWT. Any authenticated client may ask; a token that fails
+// validation for whatever reason is simply inactive.
+func (p *Provider) Introspect(w http.ResponseWriter, r *http.Request) {
+	if !p.introspectionClient(w, r) {
+		return
+	}
+
+	var raw string = r.PostForm.Get("token")
+	if raw == "" {
+		tokenError(w, http.StatusBadRequest, "invalid_request", "The token parameter is required.")
+		return
+	}
+
+	resp, err := p.introspect(r.Context(), raw)
+	if err != nil {
+		slog.Error("Cannot look up access token.", "err", err)
+		tokenServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// IntrospectBatch serves POST /introspect/batch, a non-standard extension
+// of Introspect for gateways validating many tokens at once. It takes the
+// token parameter repeated, up to MaxIntrospectionBatch times, and answers
+// with a JSON array of RFC 7662 responses in the same order. The client is
+// authenticated, and rate limited, once for the whole batch.
+func (p *Provider) IntrospectBatch(w http.ResponseWriter, r *http.Request) {
+	if p.MaxIntrospectionBatch <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+	if !p.introspectionClient(w, r) {
+		return
+	}
+
+	var raws []string = r.PostForm["token"]
+	if len(raws) == 0 || slices.Contains(raws, "") {
+		tokenError(w, http.StatusBadRequest, "invalid_request", "At least one token is required, and none may be empty.")
+		return
+	}
+	if len(raws) > p.MaxIntrospectionBatch {
+		tokenError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("At most %d tokens may be introspected at once.", p.MaxIntrospectionBatch))
+		return
+	}
+
+	resps := make([]introspectionResponse, len(raws))
+	for i, raw := range raws {
+		var err error
+		resps[i], err = p.introspect(r.Context(), raw)
+		if err != nil {
+			slog.Error("Cannot look up access token.", "err", err)
+			tokenServerError(w, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resps)
+}
+
+// ConfigureIntrospectionBatch reads INTROSPECTION_BATCH_MAX, the value of
+// Provider.MaxIntrospectionBatch, which defaults to 0: the batch endpoint is
+// opt-in.
+func ConfigureIntrospectionBatch() (max int, err error) {
+	raw := os.Getenv("INTROSPECTION_BATCH_MAX")
+	if raw == "" {
+		return 0, nil
+	}
+
+	max, err = strconv.Atoi(raw)
+	if err != nil || max < 0 {
+		return 0, fmt.Errorf("INTROSPECTION_BATCH_MAX misconfigured: %q", raw)
+	}
+
+	return max, nil
+}
+
+// introspectionClient authenticates the client of an introspection request,
+// answering the request itself if that fails.
+func (p *Provider) introspectionClient(w http.ResponseWriter, r *http.Request) bool {
+	client, ok := p.clientRequest(w, r)
+	if !ok {
+		return false
+	}
+	// A public client's id is no secret, so it can't vouch for anyone.
+	if client.TokenEndpointAuthMethod == AuthMethodNone {
+		tokenError(w, http.StatusUnauthorized, "invalid_client", "Public clients may not introspect tokens.")
+		return false
+	}
+
+	return true
+}
+
+// introspect looks raw up as an opaque access token, and failing that
+// validates it as a JWT. The sub is the one the token's client knows the
+// user by, so a pairwise client's resource servers never see the user's id.
+func (p *Provider) introspect(ctx context.Context, raw string) (introspectionResponse, error) {
+	resp, ok, err := p.introspectOpaque(ctx, raw)
+	if err != nil {
+		return introspectionResponse{}, err
+	}
+	if !ok {
+		resp = p.introspectJWT(raw)
+	}
+	if !resp.Active {
+		return resp, nil
+	}
+
+	userID, err := strconv.ParseInt(resp.Subject, 10, 64)
+	if err != nil {
+		return resp, nil
+	}
+	client, err := p.lookupClient(ctx, resp.ClientID)
+	if err != nil {
+		return introspectionResponse{}, err
+	}
+	resp.Subject, err = p.subject(client, userID)
+	if err != nil {
+		return introspectionResponse{}, err
+	}
+
+	return resp, nil
+}
+
+func (p *Provider) introspectJWT(raw string) introspectionResponse {
+	claims, err := p.Tokens.ValidateAccessToken(raw)
+	if err != nil {
+		return introspectionResponse{}
+	}
+
+	return introspectionResponse{
+		Active:    true,
+		Scope:     normalizeScope(claims.Scope),
+		ClientID:  claims.ClientID,
+		AZP:       claims.AuthorizedParty,
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		ExpiresAt: claims.ExpiresAt,
+		IssuedAt:  claims.IssuedAt,
+		NotBefore: claims.NotBefore,
+		ID:        claims.ID,
+		TokenType: "Bearer",
+
+		userInfoClaims: claims.UserInfoClaims,
+	}
+}
+
+// introspectOpaque looks raw up as an opaque access token. ok is false if it
+// isn't one or has expired.
+func (p *Provider) introspectOpaque(ctx context.Context, raw string) (resp introspectionResponse, ok bool, err error) {
+	if p.AccessTokens == nil {
+		return introspectionResponse{}, false, nil
+	}
+
+	stored, err := p.AccessTokens.GetAccessToken(ctx, hashRememberToken(raw))
+	if errors.Is(err, store.ErrNotFound) {
+		return introspectionResponse{}, false, nil
+	}
+	if err != nil {
+		return introspectionResponse{}, false, err
+	}
+	if !p.now().Before(stored.ExpiresAt) {
+		return introspectionResponse{}, false, nil
+	}
+	// The audience is the one a JWT for the client would carry.
+	client, err := p.lookupClient(ctx, stored.ClientID)
+	if err != nil {
+		return introspectionResponse{}, false, err
+	}
+	var audience []string = token.AudienceFor(stored.ClientID, client.Audiences)
+	var azp string
+	if len(audience) > 1 || p.Tokens != nil && p.Tokens.AlwaysAuthorizedParty {
+		azp = stored.ClientID
+	}
+
+	return introspectionResponse{
+		Active:    true,
+		Scope:     normalizeScope(stored.Scope),
+		ClientID:  stored.ClientID,
+		AZP:       azp,
+		Subject:   strconv.FormatInt(stored.UserID, 10),
+		Audience:  audience,
+		Issuer:    p.Issuer,
+		ExpiresAt: stored.ExpiresAt.Unix(),
+		IssuedAt:  stored.IssuedAt.Unix(),
+		TokenType: "Bearer",
+
+		userInfoClaims: stored.Claims,
+	}, true, nil
+}
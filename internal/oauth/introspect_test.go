@@ -0,0 +1,147 @@
+package oauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/ratelimit"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const otherClientID = "client2"
+
+func TestIntrospect(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+
+	tok, _, err := env.provider.Tokens.IssueAccessToken("1", testClientID, nil, []string{"openid", "email"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := postForm("/introspect", url.Values{"token": {tok}})
+	r.Header.Set("Authorization", basicAuth(testClientID, testClientSecret))
+	resp := decodeMap(t, env.do(r))
+	if resp["active"] != true || resp["scope"] != "openid email" || resp["sub"] != "1" || resp["client_id"] != testClientID {
+		t.Errorf("got: %v, want: the active token's claims", resp)
+	}
+
+	env.now = env.now.Add(time.Hour)
+	r = postForm("/introspect", url.Values{"token": {tok}})
+	r.Header.Set("Authorization", basicAuth(testClientID, testClientSecret))
+	if resp := decodeMap(t, env.do(r)); len(resp) != 1 || resp["active"] != false {
+		t.Errorf("got: %v, want: only active false", resp)
+	}
+}
+
+func TestIntrospectBatch(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+
+	introspect := func(tokens ...string) *httptest.ResponseRecorder {
+		r := postForm("/introspect/batch", url.Values{"token": tokens})
+		r.Header.Set("Authorization", basicAuth(testClientID, testClientSecret))
+		return env.do(r)
+	}
+	if rec := introspect("a"); rec.Code != http.StatusNotFound {
+		t.Errorf("got: %d, want: %d while off", rec.Code, http.StatusNotFound)
+	}
+
+	env.provider.MaxIntrospectionBatch = 3
+	expiring, _, err := env.provider.Tokens.IssueAccessToken("1", testClientID, nil, []string{"openid"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.now = env.now.Add(2 * time.Hour)
+	active, _, err := env.provider.Tokens.IssueAccessToken("2", testClientID, nil, []string{"openid", "email"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := introspect(active, expiring, "unknown")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d, want: %d", rec.Code, http.StatusOK)
+	}
+	var resps []map[string]any
+	err = json.NewDecoder(rec.Body).Decode(&resps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resps) != 3 {
+		t.Fatalf("got: %v, want: 3 results", resps)
+	}
+	if resps[0]["active"] != true || resps[0]["sub"] != "2" || resps[0]["scope"] != "openid email" {
+		t.Errorf("got: %v, want: the active token's claims", resps[0])
+	}
+	for _, resp := range resps[1:] {
+		if len(resp) != 1 || resp["active"] != false {
+			t.Errorf("got: %v, want: only active false", resp)
+		}
+	}
+
+	rec = introspect(active, active, active, active)
+	if rec.Code != http.StatusBadRequest || decodeMap(t, rec)["error"] != "invalid_request" {
+		t.Errorf("got: %d, want: %d invalid_request for a batch over the limit", rec.Code, http.StatusBadRequest)
+	}
+
+	r := postForm("/introspect/batch", url.Values{"token": {active}})
+	r.Header.Set("Authorization", basicAuth(testClientID, "wrong"))
+	if rec := env.do(r); rec.Code != http.StatusUnauthorized {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func decodeMap(t *testing.T, rec *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+
+	var resp map[string]any
+	err := json.NewDecoder(rec.Body).Decode(&resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp
+}
+
+func TestClientRateLimit(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	env.provider.ClientRateLimit = &ratelimit.Limiter{
+		Default: ratelimit.Limit{Events: 2, Per: time.Minute},
+		Now:     env.provider.Now,
+	}
+
+	client, err := env.provider.Clients.GetClient(context.Background(), testClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.ID = otherClientID
+	err = env.provider.Clients.(*store.MemoryClientStore).PutClient(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	introspect := func(clientID string) int {
+		r := postForm("/introspect", url.Values{"token": {"not-a-token"}})
+		r.Header.Set("Authorization", basicAuth(clientID, testClientSecret))
+		return env.do(r).Code
+	}
+
+	introspect(testClientID)
+	introspect(testClientID)
+	r := postForm("/token", url.Values{"grant_type": {"authorization_code"}, "code": {"x"}, "redirect_uri": {testRedirectURI}})
+	r.Header.Set("Authorization", basicAuth(testClientID, testClientSecret))
+	rec := env.do(r)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "30" {
+		t.Errorf("got: %d with Retry-After %q, want: %d with 30", rec.Code, rec.Header().Get("Retry-After"), http.StatusTooManyRequests)
+	}
+
+	if code := introspect(otherClientID); code != http.StatusOK {
+		t.Errorf("other client got: %d, want: %d", code, http.StatusOK)
+	}
+}
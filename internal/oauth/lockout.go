@@ -0,0 +1,148 @@
+package oauth
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/clientip"
+)
+
+const defaultLockoutDuration = 15 * time.Minute
+
+// Lockout locks an email address after repeated failed logins, whoever
+// they come from. It is separate from the per-IP rate limit, which isn't
+// relaxed for trusted networks. The zero value never locks accounts.
+type Lockout struct {
+	// Threshold is how many consecutive failed logins lock the account.
+	// Zero means no lockout.
+	Threshold int
+	// Duration is how long the account stays locked. Zero means 15
+	// minutes.
+	Duration time.Duration
+
+	// TrustedNetworks are networks, such as office ranges, that get
+	// TrustedThreshold instead of Threshold. Client IPs are found through
+	// the provider's TrustedProxies.
+	TrustedNetworks clientip.Networks
+	// TrustedThreshold is Threshold for logins from TrustedNetworks. Zero
+	// means those logins are never locked out.
+	TrustedThreshold int
+}
+
+// ConfigureLockout reads LOCKOUT_THRESHOLD, LOCKOUT_DURATION,
+// LOCKOUT_TRUSTED_NETWORKS, a list of CIDRs as for TRUSTED_PROXIES, and
+// LOCKOUT_TRUSTED_THRESHOLD.
+func ConfigureLockout() (lockout Lockout, err error) {
+	if v := os.Getenv("LOCKOUT_THRESHOLD"); v != "" {
+		lockout.Threshold, err = strconv.Atoi(v)
+		if err != nil || lockout.Threshold < 0 {
+			return Lockout{}, fmt.Errorf("lockout threshold misconfigured: %q", v)
+		}
+	}
+
+	if v := os.Getenv("LOCKOUT_DURATION"); v != "" {
+		lockout.Duration, err = time.ParseDuration(v)
+		if err != nil || lockout.Duration < 0 {
+			return Lockout{}, fmt.Errorf("lockout duration misconfigured: %q", v)
+		}
+	}
+
+	lockout.TrustedNetworks, err = clientip.ParseNetworks(os.Getenv("LOCKOUT_TRUSTED_NETWORKS"))
+	if err != nil {
+		return Lockout{}, fmt.Errorf("LOCKOUT_TRUSTED_NETWORKS misconfigured: %w", err)
+	}
+
+	if v := os.Getenv("LOCKOUT_TRUSTED_THRESHOLD"); v != "" {
+		lockout.TrustedThreshold, err = strconv.Atoi(v)
+		if err != nil || lockout.TrustedThreshold < 0 {
+			return Lockout{}, fmt.Errorf("lockout trusted threshold misconfigured: %q", v)
+		}
+	}
+
+	return lockout, nil
+}
+
+func (l Lockout) duration() time.Duration {
+	if l.Duration > 0 {
+		return l.Duration
+	}
+
+	return defaultLockoutDuration
+}
+
+func (l Lockout) enabled() bool {
+	return l.Threshold > 0 || l.TrustedThreshold > 0
+}
+
+// threshold is the threshold for a login from ip, zero meaning none.
+func (l Lockout) threshold(ip string) int {
+	if l.TrustedNetworks.Contains(ip) {
+		return l.TrustedThreshold
+	}
+
+	return l.Threshold
+}
+
+type loginFailures struct {
+	count int
+	last  time.Time
+}
+
+// lockoutKey is what failures of a login as email are counted under. The
+// address is hashed so unknown ones tried by an attacker aren't kept.
+func lockoutKey(email string) string {
+	return hashRememberToken(strings.ToLower(strings.TrimSpace(email)))
+}
+
+// lockoutTracker counts consecutive failed logins per lockoutKey. A count is
+// forgotten once the lockout duration has passed since the last failure, so
+// a lock lifts by itself and the map doesn't grow without bound.
+type lockoutTracker struct {
+	mu       sync.Mutex
+	failures map[string]loginFailures
+}
+
+// lockedFor is how long key stays locked, or zero if it isn't locked.
+func (t *lockoutTracker) lockedFor(key string, threshold int, now time.Time, duration time.Duration) time.Duration {
+	if threshold <= 0 {
+		return 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	f, ok := t.failures[key]
+	if !ok || f.count < threshold {
+		return 0
+	}
+
+	return max(duration-now.Sub(f.last), 0)
+}
+
+func (t *lockoutTracker) fail(key string, now time.Time, duration time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.failures == nil {
+		t.failures = make(map[string]loginFailures)
+	}
+	for k, f := range t.failures {
+		if now.Sub(f.last) >= duration {
+			delete(t.failures, k)
+		}
+	}
+
+	f := t.failures[key]
+	t.failures[key] = loginFailures{count: f.count + 1, last: now}
+}
+
+func (t *lockoutTracker) reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.failures, key)
+}
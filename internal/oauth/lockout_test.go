@@ -0,0 +1,99 @@
+package oauth_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/clientip"
+	"github.com/ehubscher/goidp/internal/oauth"
+)
+
+func (env *testEnv) loginFrom(t *testing.T, remoteAddr, password string) int {
+	t.Helper()
+
+	r := postForm("/login", url.Values{
+		"email":     {testEmail},
+		"password":  {password},
+		"return_to": {authorizeURL(nil)},
+	})
+	r.RemoteAddr = remoteAddr
+
+	return env.do(r).Code
+}
+
+func withLockout(t *testing.T, env *testEnv) {
+	t.Helper()
+
+	trusted, err := clientip.ParseNetworks("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.provider.Lockout = oauth.Lockout{Threshold: 3, Duration: time.Minute, TrustedNetworks: trusted}
+}
+
+func TestLockout(t *testing.T) {
+	env := newTestEnv(t)
+	withLockout(t, env)
+
+	for range 3 {
+		if code := env.loginFrom(t, "192.0.2.1:1234", "wrong password"); code != http.StatusUnauthorized {
+			t.Fatalf("got: %d, want: %d", code, http.StatusUnauthorized)
+		}
+	}
+	if code := env.loginFrom(t, "192.0.2.1:1234", testPassword); code != http.StatusTooManyRequests {
+		t.Errorf("locked got: %d, want: %d", code, http.StatusTooManyRequests)
+	}
+
+	env.now = env.now.Add(time.Minute)
+	if code := env.loginFrom(t, "192.0.2.1:1234", testPassword); code != http.StatusFound {
+		t.Errorf("after the lockout got: %d, want: %d", code, http.StatusFound)
+	}
+}
+
+func TestLockoutTrustedNetwork(t *testing.T) {
+	env := newTestEnv(t)
+	withLockout(t, env)
+
+	for range 5 {
+		if code := env.loginFrom(t, "10.1.2.3:1234", "wrong password"); code != http.StatusUnauthorized {
+			t.Fatalf("got: %d, want: %d", code, http.StatusUnauthorized)
+		}
+	}
+	if code := env.loginFrom(t, "10.1.2.3:1234", testPassword); code != http.StatusFound {
+		t.Errorf("trusted got: %d, want: %d", code, http.StatusFound)
+	}
+
+	// The same attempts from outside lock the account, and the lock doesn't
+	// reach the trusted network.
+	for range 3 {
+		env.loginFrom(t, "192.0.2.1:1234", "wrong password")
+	}
+	if code := env.loginFrom(t, "192.0.2.1:1234", testPassword); code != http.StatusTooManyRequests {
+		t.Errorf("untrusted got: %d, want: %d", code, http.StatusTooManyRequests)
+	}
+	if code := env.loginFrom(t, "10.1.2.3:1234", testPassword); code != http.StatusFound {
+		t.Errorf("trusted after the lock got: %d, want: %d", code, http.StatusFound)
+	}
+}
+
+func TestConfigureLockout(t *testing.T) {
+	t.Setenv("LOCKOUT_THRESHOLD", "5")
+	t.Setenv("LOCKOUT_DURATION", "30m")
+	t.Setenv("LOCKOUT_TRUSTED_NETWORKS", "10.0.0.0/8, 192.0.2.7")
+	t.Setenv("LOCKOUT_TRUSTED_THRESHOLD", "20")
+
+	lockout, err := oauth.ConfigureLockout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lockout.Threshold != 5 || lockout.Duration != 30*time.Minute || len(lockout.TrustedNetworks) != 2 || lockout.TrustedThreshold != 20 {
+		t.Errorf("got: %+v, want: the configured lockout", lockout)
+	}
+
+	t.Setenv("LOCKOUT_TRUSTED_NETWORKS", "office")
+	if _, err := oauth.ConfigureLockout(); err == nil {
+		t.Errorf("got: nil, want: an error for a bad network")
+	}
+}
@@ -0,0 +1,226 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/render"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const defaultVerificationResendInterval = 5 * time.Minute
+
+// renderLogin shows the login page. The email field is prefilled from a
+// login_hint on the authorization request only; a failed login never echoes
+// what was submitted.
+func (p *Provider) renderLogin(w http.ResponseWriter, r *http.Request, status int, page render.LoginPage) {
+	page.UI = p.uiContext(r.Form)
+	page.CSRFToken = p.csrfToken(w, r)
+	page.OfferRememberMe = p.RememberTokens != nil
+
+	p.pages().Login(w, status, page)
+}
+
+func (p *Provider) Login(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Malformed login request.", http.StatusBadRequest)
+		return
+	}
+
+	var returnTo string = r.Form.Get("return_to")
+	if !isLocalPath(returnTo) {
+		returnTo = "/"
+	}
+
+	if r.Method != http.MethodPost {
+		p.renderLogin(w, r, http.StatusOK, render.LoginPage{ReturnTo: returnTo})
+		return
+	}
+
+	if !p.validCSRF(r) {
+		p.loginFailed(w, r, http.StatusForbidden, LoginResult{Status: LoginRejected, Message: csrfFailedMessage}, returnTo)
+		return
+	}
+
+	user, err := p.authenticateUser(r.Context(), r.PostForm.Get("email"), r.PostForm.Get("password"), p.TrustedProxies.ClientIP(r))
+	if errors.Is(err, ErrInvalidCredentials) {
+		p.invalidCredentials(w, r, returnTo)
+		return
+	}
+	var locked lockedError
+	if errors.As(err, &locked) {
+		p.accountLocked(w, r, locked.remaining, returnTo)
+		return
+	}
+	if err != nil {
+		slog.Error("Cannot load user.", "err", err)
+		internalError(w, err)
+		return
+	}
+
+	if p.RequireVerifiedEmail && !user.EmailVerified {
+		p.loginFailed(w, r, http.StatusForbidden, LoginResult{
+			Status:  LoginEmailUnverified,
+			Message: p.resendVerification(r.Context(), user),
+		}, returnTo)
+		return
+	}
+
+	required, enrollment, err := p.mfaRequired(r.Context(), user)
+	if err != nil {
+		slog.Error("Cannot load MFA enrollment.", "err", err)
+		internalError(w, err)
+		return
+	}
+	if required {
+		p.promptMFA(w, r, user, enrollment, returnTo)
+		return
+	}
+
+	p.finishLogin(w, r, user.ID, []string{"pwd"}, returnTo, r.PostForm.Get("remember_me") != "")
+}
+
+// resendVerification calls UnverifiedEmail for user unless it was called
+// for them within the resend interval, and returns the message for the
+// refused login.
+func (p *Provider) resendVerification(ctx context.Context, user store.User) string {
+	const unverified = "Verify your email address before signing in."
+	if p.UnverifiedEmail == nil {
+		return unverified
+	}
+
+	var now time.Time = p.now()
+	var key string = strconv.FormatInt(user.ID, 10)
+	if p.resends.lockedFor(key, 1, now, p.verificationResendInterval()) > 0 {
+		return unverified + " We sent you a verification email recently, check your inbox."
+	}
+	p.resends.fail(key, now, p.verificationResendInterval())
+
+	err := p.UnverifiedEmail(ctx, user)
+	if err != nil {
+		slog.Error("Cannot send verification email.", "user_id", user.ID, "err", err)
+		return unverified
+	}
+
+	return unverified + " Check your inbox for the verification email."
+}
+
+func (p *Provider) verificationResendInterval() time.Duration {
+	if p.VerificationResendInterval > 0 {
+		return p.VerificationResendInterval
+	}
+
+	return defaultVerificationResendInterval
+}
+
+// finishLogin starts the session of a user who has presented every factor
+// asked of them and sends them on to returnTo.
+func (p *Provider) finishLogin(w http.ResponseWriter, r *http.Request, userID int64, amr []string, returnTo string, rememberMe bool) {
+	// Always start a new session on login so a previous session id, and its
+	// auth_time, is never carried over. Sessions of other accounts signed
+	// in on this browser are kept.
+	for _, old := range p.accountSessions(r.Context(), r) {
+		// A sealed session isn't in the store; dropping it from the cookie
+		// is all that can be done.
+		if old.UserID != userID || isSealedSession(old.ID) {
+			continue
+		}
+		err := p.Sessions.DeleteSession(r.Context(), p.SessionIDKeys.hash(old.ID))
+		if err != nil {
+			slog.Error("Cannot delete previous session.", "err", err)
+		}
+	}
+
+	var session store.Session
+	err := p.makeRoom(r.Context(), userID, func() (err error) {
+		session, err = p.startSession(w, r, userID, p.now(), amr)
+		return err
+	})
+	if errors.Is(err, ErrSessionLimit) {
+		p.loginFailed(w, r, http.StatusForbidden, LoginResult{
+			Status:  LoginRejected,
+			Message: "You are signed in on too many devices. Sign out on one of them first.",
+		}, returnTo)
+		return
+	}
+	if err != nil {
+		slog.Error("Cannot create session.", "err", err)
+		internalError(w, err)
+		return
+	}
+
+	if p.RememberTokens != nil && rememberMe {
+		err = p.remember(w, r, session)
+		if err != nil {
+			// The login itself still succeeded, it just won't persist.
+			slog.Error("Cannot create remember-me token.", "err", err)
+		}
+	}
+
+	var redirect string = withSelectedAccount(returnTo, userID)
+	if wantsJSON(r) {
+		writeLoginResult(w, http.StatusOK, LoginResult{Status: LoginOK, Redirect: redirect})
+		return
+	}
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// invalidCredentials renders the login failure. It deliberately doesn't echo
+// the submitted email so that the response is the same byte for byte
+// whether the account exists or not.
+func (p *Provider) invalidCredentials(w http.ResponseWriter, r *http.Request, returnTo string) {
+	p.loginFailed(w, r, http.StatusUnauthorized, LoginResult{Status: LoginInvalidCredentials, Message: p.invalidCredentialsMessage()}, returnTo)
+}
+
+// startSession creates a session and makes it the active one in the session
+// cookie, ahead of the other accounts signed in on this browser. The cookie
+// has no expiry so it ends with the browser session; persistence across
+// restarts is the job of the separate remember-me cookie.
+func (p *Provider) startSession(w http.ResponseWriter, r *http.Request, userID int64, authTime time.Time, amr []string) (store.Session, error) {
+	session := store.Session{
+		UserID:    userID,
+		AuthTime:  authTime,
+		AMR:       amr,
+		ExpiresAt: p.now().Add(p.sessionTTL()),
+		CreatedAt: p.now(),
+	}
+
+	var err error
+	if p.SessionKeys.enabled() {
+		session.ID, err = p.SessionKeys.seal(session)
+	} else {
+		session.ID, err = randomToken(32)
+		if err == nil {
+			stored := session
+			stored.ID = p.SessionIDKeys.hash(session.ID)
+			err = p.Sessions.CreateSession(r.Context(), stored)
+		}
+	}
+	if err != nil {
+		return store.Session{}, err
+	}
+
+	sessions := []store.Session{session}
+	for _, other := range p.accountSessions(r.Context(), r) {
+		if other.UserID != userID {
+			sessions = append(sessions, other)
+		}
+	}
+	p.setSessionCookie(w, sessions)
+
+	return session, nil
+}
+
+// isLocalPath reports whether target is a path on this server, so a login can
+// never be used as an open redirect.
+func isLocalPath(target string) bool {
+	return strings.HasPrefix(target, "/") &&
+		!strings.HasPrefix(target, "//") &&
+		!strings.Contains(target, `\`)
+}
@@ -0,0 +1,83 @@
+package oauth
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/render"
+	"github.com/ehubscher/goidp/internal/retryafter"
+)
+
+// Login result statuses.
+const (
+	LoginOK                 = "ok"
+	LoginInvalidCredentials = "invalid_credentials"
+	LoginLocked             = "locked"
+	LoginMFARequired        = "mfa_required"
+	LoginEmailUnverified    = "email_unverified"
+	// LoginRejected covers everything else that stops a login, such as a
+	// failed CSRF check or an expired MFA challenge. Message says which.
+	LoginRejected = "rejected"
+)
+
+const accountLockedMessage = "Too many failed sign-in attempts. Try again later."
+
+// LoginResult is the outcome of POST /login and POST /login/mfa, sent as
+// JSON to clients that ask for it with Accept: application/json. Form posts
+// get the same status code with a page instead. An unknown email and a
+// wrong password give identical results, and a lock applies to any email
+// address, so no result tells which accounts exist.
+type LoginResult struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	// RetryAfter is how many seconds a lock has left, also given in the
+	// Retry-After header.
+	RetryAfter int `json:"retry_after,omitempty"`
+	// Challenge is what to post to /login/mfa along with the code. It is
+	// empty when the user has no second factor enrolled.
+	Challenge string `json:"challenge,omitempty"`
+	// Redirect is where a successful login continues.
+	Redirect string `json:"redirect,omitempty"`
+}
+
+// wantsJSON reports whether the client's Accept prefers application/json
+// to text/html. Anything else, a browser's form post included, gets the
+// page.
+func wantsJSON(r *http.Request) bool {
+	return render.NegotiateOr(r, render.HTML) == render.JSON
+}
+
+func writeLoginResult(w http.ResponseWriter, status int, result LoginResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// loginFailed answers a login that didn't go through with result, as JSON
+// or as the login page showing its message.
+func (p *Provider) loginFailed(w http.ResponseWriter, r *http.Request, status int, result LoginResult, returnTo string) {
+	if result.RetryAfter > 0 {
+		retryafter.Set(w.Header(), time.Duration(result.RetryAfter)*time.Second)
+	}
+	if wantsJSON(r) {
+		writeLoginResult(w, status, result)
+		return
+	}
+
+	p.renderLogin(w, r, status, render.LoginPage{
+		Page:     render.Page{Error: result.Message},
+		ReturnTo: returnTo,
+	})
+}
+
+// accountLocked answers a login refused by a lockout with remaining left.
+func (p *Provider) accountLocked(w http.ResponseWriter, r *http.Request, remaining time.Duration, returnTo string) {
+	p.loginFailed(w, r, http.StatusTooManyRequests, LoginResult{
+		Status:     LoginLocked,
+		Message:    accountLockedMessage,
+		RetryAfter: int(math.Ceil(remaining.Seconds())),
+	}, returnTo)
+}
@@ -0,0 +1,143 @@
+package oauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/oauth"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+// jsonLogin posts a login that asks for a JSON result.
+func (env *testEnv) jsonLogin(t *testing.T, email, password string) (*httptest.ResponseRecorder, oauth.LoginResult) {
+	t.Helper()
+
+	r := postForm("/login", url.Values{"email": {email}, "password": {password}, "return_to": {"/account"}})
+	r.Header.Set("Accept", "application/json")
+	r.RemoteAddr = "192.0.2.1:1234"
+	rec := env.do(r)
+
+	var result oauth.LoginResult
+	err := json.Unmarshal(rec.Body.Bytes(), &result)
+	if err != nil {
+		t.Fatalf("got: %q, want: a JSON login result", rec.Body)
+	}
+
+	return rec, result
+}
+
+func TestLoginResultOK(t *testing.T) {
+	env := newTestEnv(t)
+
+	rec, result := env.jsonLogin(t, testEmail, testPassword)
+	if rec.Code != http.StatusOK || result.Status != oauth.LoginOK || result.Redirect == "" {
+		t.Errorf("got: %d %+v, want: %d ok with a redirect", rec.Code, result, http.StatusOK)
+	}
+	if responseCookie(rec, "goidp_session") == nil {
+		t.Error("got: no session cookie, want: one")
+	}
+}
+
+func TestLoginResultInvalidCredentialsIndistinguishable(t *testing.T) {
+	env := newTestEnv(t)
+
+	unknownRec, unknown := env.jsonLogin(t, "nobody@email.com", testPassword)
+	wrongRec, _ := env.jsonLogin(t, testEmail, "not the password")
+	if unknownRec.Code != http.StatusUnauthorized || unknown.Status != oauth.LoginInvalidCredentials || unknown.Message == "" {
+		t.Errorf("got: %d %+v, want: %d invalid_credentials", unknownRec.Code, unknown, http.StatusUnauthorized)
+	}
+	if unknownRec.Code != wrongRec.Code || unknownRec.Body.String() != wrongRec.Body.String() {
+		t.Errorf("got: %d %s and %d %s, want: identical", unknownRec.Code, unknownRec.Body, wrongRec.Code, wrongRec.Body)
+	}
+}
+
+func TestLoginResultLocked(t *testing.T) {
+	env := newTestEnv(t)
+	withLockout(t, env)
+
+	for range 3 {
+		env.jsonLogin(t, testEmail, "not the password")
+		env.jsonLogin(t, "nobody@email.com", "not the password")
+	}
+
+	env.now = env.now.Add(20 * time.Second)
+	knownRec, known := env.jsonLogin(t, testEmail, testPassword)
+	unknownRec, _ := env.jsonLogin(t, "nobody@email.com", testPassword)
+	if knownRec.Code != http.StatusTooManyRequests || known.Status != oauth.LoginLocked || known.RetryAfter != 40 {
+		t.Errorf("got: %d %+v, want: %d locked for 40s", knownRec.Code, known, http.StatusTooManyRequests)
+	}
+	if got := knownRec.Header().Get("Retry-After"); got != "40" {
+		t.Errorf("got: Retry-After %q, want: 40", got)
+	}
+	if unknownRec.Code != knownRec.Code || unknownRec.Body.String() != knownRec.Body.String() {
+		t.Errorf("got: %d %s and %d %s, want: identical", unknownRec.Code, unknownRec.Body, knownRec.Code, knownRec.Body)
+	}
+}
+
+func TestLoginResultEmailUnverified(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.RequireVerifiedEmail = true
+
+	rec, result := env.jsonLogin(t, testEmail, testPassword)
+	if rec.Code != http.StatusForbidden || result.Status != oauth.LoginEmailUnverified {
+		t.Errorf("got: %d %+v, want: %d email_unverified", rec.Code, result, http.StatusForbidden)
+	}
+
+	// Only the right password gets that far.
+	rec, result = env.jsonLogin(t, testEmail, "not the password")
+	if rec.Code != http.StatusUnauthorized || result.Status != oauth.LoginInvalidCredentials {
+		t.Errorf("got: %d %+v, want: %d invalid_credentials", rec.Code, result, http.StatusUnauthorized)
+	}
+}
+
+func TestLoginResultMFARequired(t *testing.T) {
+	env := newTestEnv(t)
+	env.withMFA(t, true)
+
+	rec, result := env.jsonLogin(t, testEmail, testPassword)
+	if rec.Code != http.StatusOK || result.Status != oauth.LoginMFARequired || result.Challenge == "" {
+		t.Fatalf("got: %d %+v, want: %d mfa_required with a challenge", rec.Code, result, http.StatusOK)
+	}
+	if responseCookie(rec, "goidp_session") != nil {
+		t.Error("got: a session cookie, want: none before the second factor")
+	}
+
+	err := env.provider.MFA.DeleteMFAEnrollment(context.Background(), env.user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.provider.MFAPolicy = oauth.MFAPolicy{Roles: []string{"admin"}, UserRoles: func(context.Context, store.User) ([]string, error) {
+		return []string{"admin"}, nil
+	}}
+	rec, result = env.jsonLogin(t, testEmail, testPassword)
+	if rec.Code != http.StatusForbidden || result.Status != oauth.LoginMFARequired || result.Challenge != "" {
+		t.Errorf("not enrolled got: %d %+v, want: %d mfa_required without a challenge", rec.Code, result, http.StatusForbidden)
+	}
+}
+
+func TestLoginResultNegotiated(t *testing.T) {
+	var cases = []struct {
+		accept   string
+		wantJSON bool
+	}{
+		{"", false},
+		{"text/html,application/xhtml+xml,*/*;q=0.8", false},
+		{"application/json;q=0, text/html", false},
+		{"text/html;q=0.5, application/json", true},
+	}
+	for _, c := range cases {
+		env := newTestEnv(t)
+		r := postForm("/login", url.Values{"email": {testEmail}, "password": {"not the password"}, "return_to": {"/account"}})
+		r.Header.Set("Accept", c.accept)
+		rec := env.do(r)
+
+		if got := rec.Header().Get("Content-Type") == "application/json"; got != c.wantJSON {
+			t.Errorf("%q got: %s, want JSON: %v", c.accept, rec.Header().Get("Content-Type"), c.wantJSON)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package oauth
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/render"
+	"github.com/ehubscher/goidp/internal/store"
+	"github.com/ehubscher/goidp/internal/token"
+)
+
+const logoutChallengeTTL = 5 * time.Minute
+
+type pendingLogout struct {
+	userID      int64
+	redirectURI string
+	state       string
+	expires     time.Time
+}
+
+// logoutChallenges holds logout requests waiting on the user's
+// confirmation. The challenge is the short-lived token the confirmation
+// form posts back.
+type logoutChallenges struct {
+	mu      sync.Mutex
+	pending map[string]pendingLogout
+}
+
+func (c *logoutChallenges) add(id string, pending pendingLogout, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pending == nil {
+		c.pending = make(map[string]pendingLogout)
+	}
+	for k, v := range c.pending {
+		if !now.Before(v.expires) {
+			delete(c.pending, k)
+		}
+	}
+	c.pending[id] = pending
+}
+
+func (c *logoutChallenges) take(id string, now time.Time) (pending pendingLogout, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pending, ok = c.pending[id]
+	delete(c.pending, id)
+	if !ok || !now.Before(pending.expires) {
+		return pendingLogout{}, false
+	}
+
+	return pending, true
+}
+
+// EndSession serves /end_session, RP-initiated logout as in OpenID Connect
+// RP-Initiated Logout 1.0. A valid id_token_hint signs its user out straight
+// away; without one the signed-in user is asked to confirm first, so that a
+// link on any site can't sign them out. The confirmation itself is posted
+// back here with its challenge.
+func (p *Provider) EndSession(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Malformed logout request.", http.StatusBadRequest)
+		return
+	}
+	if r.Method == http.MethodPost && r.PostForm.Has("challenge") {
+		p.confirmLogout(w, r)
+		return
+	}
+
+	var clientID string = r.Form.Get("client_id")
+	var hinted bool
+	var subject string
+	if hint := r.Form.Get("id_token_hint"); hint != "" {
+		claims, err := p.idTokenHint(hint)
+		if err != nil {
+			slog.Warn("Invalid id_token_hint at logout.", "err", err)
+			http.Error(w, "Invalid id_token_hint.", http.StatusBadRequest)
+			return
+		}
+		if clientID != "" && !slices.Contains(claims.Audience, clientID) {
+			http.Error(w, "The id_token_hint wasn't issued to client_id.", http.StatusBadRequest)
+			return
+		}
+		if clientID == "" {
+			clientID = claims.AuthorizedParty
+		}
+		if clientID == "" {
+			clientID = claims.Audience[0]
+		}
+		subject = claims.Subject
+		hinted = true
+	}
+
+	var client store.Client
+	if clientID != "" {
+		client, err = p.Clients.GetClient(r.Context(), clientID)
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "Unknown client.", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			slog.Error("Cannot load client.", "err", err)
+			internalError(w, err)
+			return
+		}
+	}
+
+	// Without a client to check it against, any post_logout_redirect_uri
+	// is refused, or this would be an open redirect.
+	var redirectURI string = r.Form.Get("post_logout_redirect_uri")
+	if redirectURI != "" && !slices.Contains(client.PostLogoutRedirectURIs, redirectURI) {
+		http.Error(w, "Unregistered post_logout_redirect_uri.", http.StatusBadRequest)
+		return
+	}
+	var state string = r.Form.Get("state")
+
+	if !hinted {
+		session, ok := p.currentSession(r.Context(), r)
+		if !ok {
+			p.loggedOut(w, r, redirectURI, state)
+			return
+		}
+		p.promptLogout(w, r, pendingLogout{userID: session.UserID, redirectURI: redirectURI, state: state}, client)
+		return
+	}
+
+	err = p.endSession(w, r, p.hintedUser(r, client, subject))
+	if err != nil {
+		slog.Error("Cannot end session.", "err", err)
+		internalError(w, err)
+		return
+	}
+	p.loggedOut(w, r, redirectURI, state)
+}
+
+// idTokenHint validates an ID token we issued. It may have expired, as
+// logout tends to come long after sign-in.
+func (p *Provider) idTokenHint(hint string) (token.Claims, error) {
+	if p.Tokens == nil {
+		return token.Claims{}, fmt.Errorf("%w: no token issuer", token.ErrInvalid)
+	}
+	claims, err := p.Tokens.ValidateHint(hint)
+	if err != nil {
+		return token.Claims{}, err
+	}
+	if len(claims.Audience) == 0 {
+		return token.Claims{}, fmt.Errorf("%w: no audience", token.ErrInvalid)
+	}
+
+	return claims, nil
+}
+
+func (p *Provider) promptLogout(w http.ResponseWriter, r *http.Request, pending pendingLogout, client store.Client) {
+	challenge, err := randomToken(32)
+	if err != nil {
+		slog.Error("Cannot generate logout challenge.", "err", err)
+		internalError(w, err)
+		return
+	}
+
+	var now = p.now()
+	pending.expires = now.Add(logoutChallengeTTL)
+	p.logoutChallenges.add(challenge, pending, now)
+
+	var name string = client.Name
+	if name == "" {
+		name = client.ID
+	}
+
+	p.pages().Logout(w, http.StatusOK, render.LogoutPage{
+		Page: render.Page{
+			UI:        p.uiContext(r.Form),
+			CSRFToken: p.csrfToken(w, r),
+		},
+		ClientName: name,
+		Challenge:  challenge,
+	})
+}
+
+func (p *Provider) confirmLogout(w http.ResponseWriter, r *http.Request) {
+	if !p.validCSRF(r) {
+		http.Error(w, csrfFailedMessage, http.StatusForbidden)
+		return
+	}
+
+	pending, ok := p.logoutChallenges.take(r.PostForm.Get("challenge"), p.now())
+	if !ok {
+		http.Error(w, "Logout request is invalid or has expired.", http.StatusBadRequest)
+		return
+	}
+
+	err := p.endSession(w, r, pending.userID)
+	if err != nil {
+		slog.Error("Cannot end session.", "err", err)
+		internalError(w, err)
+		return
+	}
+	p.loggedOut(w, r, pending.redirectURI, pending.state)
+}
+
+// endSession signs userID out of this browser: their session is deleted
+// and dropped from the session cookie, and so is a remember-me token of
+// theirs. Other accounts signed in on the browser stay signed in.
+func (p *Provider) endSession(w http.ResponseWriter, r *http.Request, userID int64) error {
+	var remaining []store.Session
+	for _, s := range p.accountSessions(r.Context(), r) {
+		if s.UserID != userID {
+			remaining = append(remaining, s)
+			continue
+		}
+		if isSealedSession(s.ID) {
+			continue
+		}
+		err := p.Sessions.DeleteSession(r.Context(), p.SessionIDKeys.hash(s.ID))
+		if err != nil {
+			return err
+		}
+	}
+	if len(remaining) > 0 {
+		p.setSessionCookie(w, remaining)
+	} else {
+		clearCookie(w, sessionCookieName)
+	}
+
+	return p.forgetRemembered(w, r, userID)
+}
+
+// hintedUser is the id of the user known to client as subject. A pairwise
+// subject can't be reversed, so it is looked for among the users signed in
+// on this browser, which are the only ones logout could sign out anyway.
+func (p *Provider) hintedUser(r *http.Request, client store.Client, subject string) int64 {
+	if !p.Subjects.pairwise(client) {
+		userID, _ := strconv.ParseInt(subject, 10, 64)
+		return userID
+	}
+
+	for _, s := range p.accountSessions(r.Context(), r) {
+		sub, err := p.subject(client, s.UserID)
+		if err == nil && sub == subject {
+			return s.UserID
+		}
+	}
+
+	return 0
+}
+
+func (p *Provider) forgetRemembered(w http.ResponseWriter, r *http.Request, userID int64) error {
+	if p.RememberTokens == nil {
+		return nil
+	}
+	cookie, err := r.Cookie(rememberCookieName)
+	if err != nil {
+		return nil
+	}
+	series, _, _ := strings.Cut(cookie.Value, ":")
+
+	remembered, err := p.RememberTokens.GetRememberToken(r.Context(), series)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if remembered.UserID != userID {
+		return nil
+	}
+
+	clearCookie(w, rememberCookieName)
+	return p.RememberTokens.DeleteRememberSeries(r.Context(), series)
+}
+
+// loggedOut sends the user back to the client's post_logout_redirect_uri,
+// or tells them they are signed out when there is none.
+func (p *Provider) loggedOut(w http.ResponseWriter, r *http.Request, redirectURI, state string) {
+	if redirectURI == "" {
+		p.pages().Logout(w, http.StatusOK, render.LogoutPage{
+			Page:      render.Page{UI: p.uiContext(r.Form)},
+			SignedOut: true,
+		})
+		return
+	}
+
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "Invalid post_logout_redirect_uri.", http.StatusBadRequest)
+		return
+	}
+	if state != "" {
+		params := target.Query()
+		params.Set("state", state)
+		target.RawQuery = params.Encode()
+	}
+
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
@@ -0,0 +1,134 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const testPostLogoutURI = "https://client.example/signed-out"
+
+// withLogout registers testPostLogoutURI for the test client and returns an
+// ID token for the test user that has already expired.
+func (env *testEnv) withLogout(t *testing.T) string {
+	t.Helper()
+
+	env.withTokens(t)
+	clients := env.provider.Clients.(*store.MemoryClientStore)
+	client, err := clients.GetClient(context.Background(), testClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.PostLogoutRedirectURIs = []string{testPostLogoutURI}
+	err = clients.PutClient(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idToken, err := env.provider.Tokens.Sign(map[string]any{
+		"iss": "https://idp.example",
+		"sub": strconv.FormatInt(env.user.ID, 10),
+		"aud": testClientID,
+		"iat": env.now.Add(-2 * time.Hour).Unix(),
+		"exp": env.now.Add(-time.Hour).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return idToken
+}
+
+func endSessionURL(params url.Values) string {
+	return "/end_session?" + params.Encode()
+}
+
+func TestEndSession(t *testing.T) {
+	env := newTestEnv(t)
+	idToken := env.withLogout(t)
+	cookie := env.withSession(t)
+
+	r := httptest.NewRequest(http.MethodGet, endSessionURL(url.Values{
+		"id_token_hint":            {idToken},
+		"post_logout_redirect_uri": {testPostLogoutURI},
+		"state":                    {"abc"},
+	}), nil)
+	r.AddCookie(cookie)
+
+	rec := env.do(r)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusFound)
+	}
+	if got := rec.Header().Get("Location"); got != testPostLogoutURI+"?state=abc" {
+		t.Errorf("got: %s, want: %s?state=abc", got, testPostLogoutURI)
+	}
+	if c := responseCookie(rec, "goidp_session"); c == nil || c.MaxAge >= 0 {
+		t.Errorf("got: %v, want: the session cookie cleared", c)
+	}
+	if _, err := env.sessions.GetSession(context.Background(), testSessionID); err != store.ErrNotFound {
+		t.Errorf("got: %v, want: %v", err, store.ErrNotFound)
+	}
+}
+
+func TestEndSessionUnregisteredRedirect(t *testing.T) {
+	env := newTestEnv(t)
+	idToken := env.withLogout(t)
+	cookie := env.withSession(t)
+
+	for _, params := range []url.Values{
+		{"id_token_hint": {idToken}, "post_logout_redirect_uri": {"https://evil.example/"}},
+		// Without a client, no URI can be checked.
+		{"post_logout_redirect_uri": {testPostLogoutURI}},
+	} {
+		r := httptest.NewRequest(http.MethodGet, endSessionURL(params), nil)
+		r.AddCookie(cookie)
+
+		rec := env.do(r)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%v got: %d, want: %d", params, rec.Code, http.StatusBadRequest)
+		}
+	}
+	if _, err := env.sessions.GetSession(context.Background(), testSessionID); err != nil {
+		t.Errorf("got: %v, want: the session kept", err)
+	}
+}
+
+func TestEndSessionConfirm(t *testing.T) {
+	env := newTestEnv(t)
+	env.withLogout(t)
+	cookie := env.withSession(t)
+
+	r := httptest.NewRequest(http.MethodGet, endSessionURL(url.Values{
+		"client_id":                {testClientID},
+		"post_logout_redirect_uri": {testPostLogoutURI},
+		"state":                    {"a b"},
+	}), nil)
+	r.AddCookie(cookie)
+
+	rec := env.do(r)
+	match := challengeField.FindStringSubmatch(rec.Body.String())
+	if rec.Code != http.StatusOK || match == nil {
+		t.Fatalf("got: %d %s, want: a confirmation page", rec.Code, rec.Body)
+	}
+	if _, err := env.sessions.GetSession(context.Background(), testSessionID); err != nil {
+		t.Fatalf("got: %v, want: the session kept until confirmed", err)
+	}
+
+	r = postForm("/end_session", url.Values{"challenge": {match[1]}})
+	r.AddCookie(cookie)
+	rec = env.do(r)
+	location, _ := url.Parse(rec.Header().Get("Location"))
+	if rec.Code != http.StatusFound || !strings.HasPrefix(location.String(), testPostLogoutURI) || location.Query().Get("state") != "a b" {
+		t.Errorf("got: %d %s, want: a redirect with state %q", rec.Code, location, "a b")
+	}
+	if _, err := env.sessions.GetSession(context.Background(), testSessionID); err != store.ErrNotFound {
+		t.Errorf("got: %v, want: %v", err, store.ErrNotFound)
+	}
+}
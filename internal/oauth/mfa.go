@@ -0,0 +1,330 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/audit"
+	"github.com/ehubscher/goidp/internal/authn"
+	"github.com/ehubscher/goidp/internal/errs"
+	"github.com/ehubscher/goidp/internal/render"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const (
+	mfaChallengeTTL = 5 * time.Minute
+	// maxMFAAttempts is how many wrong codes a login can take before the
+	// password has to be entered again, and how many a user can get wrong
+	// in a row before codes are refused for the lockout duration.
+	maxMFAAttempts = 5
+)
+
+// The amr of a session whose user also presented a TOTP code, per RFC 8176.
+var mfaAMR = []string{"pwd", "otp", "mfa"}
+
+// MFAPolicy decides which users must present a second factor at login, on
+// top of those whose MFAEnrollment is marked Required.
+type MFAPolicy struct {
+	// Roles require a second factor of users holding any of them.
+	Roles []string
+	// UserRoles returns the roles of user. Nil means users have none, so
+	// only the per-user flag applies.
+	UserRoles func(ctx context.Context, user store.User) ([]string, error)
+}
+
+// ConfigureMFAPolicy reads MFA_REQUIRED_ROLES, a comma-separated list of
+// roles. UserRoles is left for the caller to set.
+func ConfigureMFAPolicy() MFAPolicy {
+	var policy MFAPolicy
+	for _, role := range strings.Split(os.Getenv("MFA_REQUIRED_ROLES"), ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			policy.Roles = append(policy.Roles, role)
+		}
+	}
+
+	return policy
+}
+
+// mfaRequired reports whether user must present a second factor, along
+// with their enrollment. It is always false without an MFA store.
+func (p *Provider) mfaRequired(ctx context.Context, user store.User) (required bool, enrollment store.MFAEnrollment, err error) {
+	if p.MFA == nil {
+		return false, store.MFAEnrollment{}, nil
+	}
+
+	enrollment, err = p.MFA.GetMFAEnrollment(ctx, user.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		enrollment, err = store.MFAEnrollment{UserID: user.ID}, nil
+	}
+	if err != nil {
+		return false, store.MFAEnrollment{}, err
+	}
+	if enrollment.Required {
+		return true, enrollment, nil
+	}
+
+	if len(p.MFAPolicy.Roles) == 0 || p.MFAPolicy.UserRoles == nil {
+		return false, enrollment, nil
+	}
+	roles, err := p.MFAPolicy.UserRoles(ctx, user)
+	if err != nil {
+		return false, store.MFAEnrollment{}, err
+	}
+	for _, role := range roles {
+		if slices.Contains(p.MFAPolicy.Roles, role) {
+			return true, enrollment, nil
+		}
+	}
+
+	return false, enrollment, nil
+}
+
+type pendingMFA struct {
+	userID     int64
+	returnTo   string
+	rememberMe bool
+	attempts   int
+	expires    time.Time
+}
+
+// mfaChallenges holds logins whose password was accepted and that wait on
+// the second factor. No session exists until the second factor is given.
+type mfaChallenges struct {
+	mu      sync.Mutex
+	pending map[string]pendingMFA
+}
+
+func (c *mfaChallenges) add(id string, pending pendingMFA, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pending == nil {
+		c.pending = make(map[string]pendingMFA)
+	}
+	for k, v := range c.pending {
+		if !now.Before(v.expires) {
+			delete(c.pending, k)
+		}
+	}
+	c.pending[id] = pending
+}
+
+func (c *mfaChallenges) take(id string, now time.Time) (pending pendingMFA, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pending, ok = c.pending[id]
+	delete(c.pending, id)
+	if !ok || !now.Before(pending.expires) {
+		return pendingMFA{}, false
+	}
+
+	return pending, true
+}
+
+// promptMFA answers a correct password of a user who must also present a
+// second factor, with the page asking for it.
+func (p *Provider) promptMFA(w http.ResponseWriter, r *http.Request, user store.User, enrollment store.MFAEnrollment, returnTo string) {
+	if len(enrollment.TOTPSecret) == 0 {
+		slog.Warn("Refused login of a user without the second factor they need.", "user_id", user.ID)
+		p.loginFailed(w, r, http.StatusForbidden, LoginResult{
+			Status:  LoginMFARequired,
+			Message: "Your account needs two-step verification, which isn't set up yet. Contact your administrator.",
+		}, returnTo)
+		return
+	}
+
+	challenge, err := randomToken(32)
+	if err != nil {
+		slog.Error("Cannot generate MFA challenge.", "err", err)
+		internalError(w, err)
+		return
+	}
+
+	var now = p.now()
+	p.mfaChallenges.add(challenge, pendingMFA{
+		userID:     user.ID,
+		returnTo:   returnTo,
+		rememberMe: r.PostForm.Get("remember_me") != "",
+		expires:    now.Add(mfaChallengeTTL),
+	}, now)
+
+	p.renderMFA(w, r, http.StatusOK, challenge, "")
+}
+
+func (p *Provider) renderMFA(w http.ResponseWriter, r *http.Request, status int, challenge, message string) {
+	if wantsJSON(r) {
+		writeLoginResult(w, status, LoginResult{Status: LoginMFARequired, Message: message, Challenge: challenge})
+		return
+	}
+
+	p.pages().MFA(w, status, render.MFAPage{
+		Page: render.Page{
+			UI:        p.uiContext(r.Form),
+			Error:     message,
+			CSRFToken: p.csrfToken(w, r),
+		},
+		Challenge: challenge,
+	})
+}
+
+// LoginMFA serves POST /login/mfa, the second step of a login that needs a
+// second factor.
+func (p *Provider) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Malformed login request.", http.StatusBadRequest)
+		return
+	}
+
+	if !p.validCSRF(r) {
+		http.Error(w, csrfFailedMessage, http.StatusForbidden)
+		return
+	}
+
+	var now = p.now()
+	var challenge string = r.PostForm.Get("challenge")
+	pending, ok := p.mfaChallenges.take(challenge, now)
+	if !ok || p.MFA == nil {
+		p.loginFailed(w, r, http.StatusBadRequest, LoginResult{Status: LoginRejected, Message: "Your sign-in has expired. Sign in again."}, "/")
+		return
+	}
+
+	// Wrong codes also count per user, so signing in with the password
+	// again doesn't buy a fresh set of guesses.
+	var key string = strconv.FormatInt(pending.userID, 10)
+	if p.mfaFailures.lockedFor(key, maxMFAAttempts, now, p.Lockout.duration()) > 0 {
+		slog.Warn("Refused MFA code of a locked user.", "user_id", pending.userID)
+		p.loginFailed(w, r, http.StatusUnauthorized, LoginResult{Status: LoginRejected, Message: "Too many wrong codes. Try again later."}, pending.returnTo)
+		return
+	}
+
+	enrollment, err := p.MFA.GetMFAEnrollment(r.Context(), pending.userID)
+	if err != nil {
+		slog.Error("Cannot load MFA enrollment.", "err", err)
+		internalError(w, err)
+		return
+	}
+
+	step, ok := authn.VerifyTOTP(enrollment.TOTPSecret, strings.TrimSpace(r.PostForm.Get("code")), now, enrollment.TOTPLastStep)
+	if ok {
+		err = p.MFA.UseTOTPStep(r.Context(), pending.userID, step)
+		if errors.Is(err, store.ErrConflict) {
+			ok = false
+		} else if err != nil {
+			slog.Error("Cannot record TOTP use.", "err", err)
+			internalError(w, err)
+			return
+		}
+	}
+	if !ok {
+		p.mfaFailures.fail(key, now, p.Lockout.duration())
+		pending.attempts++
+		if pending.attempts >= maxMFAAttempts {
+			slog.Warn("Too many wrong MFA codes, login abandoned.", "user_id", pending.userID)
+			p.loginFailed(w, r, http.StatusUnauthorized, LoginResult{Status: LoginRejected, Message: "Too many wrong codes. Sign in again."}, pending.returnTo)
+			return
+		}
+		p.mfaChallenges.add(challenge, pending, now)
+		p.renderMFA(w, r, http.StatusUnauthorized, challenge, "The code is wrong or has expired.")
+		return
+	}
+	p.mfaFailures.reset(key)
+
+	p.finishLogin(w, r, pending.userID, slices.Clone(mfaAMR), pending.returnTo, pending.rememberMe)
+}
+
+type totpDisable struct {
+	Code string `json:"code"`
+}
+
+// DisableTOTP serves POST /account/2fa/disable, which removes the user's
+// authenticator app. A session alone isn't enough: it must have
+// authenticated recently and the request must carry a current code, so a
+// stolen session cookie can't strip the second factor. Users whose second
+// factor is required can't disable it. Wrong codes count towards a lock
+// like wrong passwords do, so the code can't be guessed.
+func (p *Provider) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	session, ok := p.session(w, r)
+	if !ok {
+		errs.WriteError(w, r, errs.Unauthorized("Authentication required."))
+		return
+	}
+	var now = p.now()
+	if now.Sub(session.AuthTime) > p.recentAuthMaxAge() {
+		errs.WriteError(w, r, errs.Unauthorized("Recent authentication required, sign in again."))
+		return
+	}
+
+	var req totpDisable
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req)
+	if err != nil {
+		errs.WriteError(w, r, errs.Invalid("Malformed request."))
+		return
+	}
+
+	user, err := p.Users.GetUserByID(r.Context(), session.UserID)
+	if err != nil {
+		errs.WriteError(w, r, errs.Internal(fmt.Errorf("cannot load user %d: %w", session.UserID, err)))
+		return
+	}
+	required, enrollment, err := p.mfaRequired(r.Context(), user)
+	if err != nil {
+		errs.WriteError(w, r, errs.Internal(fmt.Errorf("cannot load MFA enrollment of user %d: %w", user.ID, err)))
+		return
+	}
+	if len(enrollment.TOTPSecret) == 0 {
+		errs.WriteError(w, r, errs.Invalid("Two-step verification isn't enabled."))
+		return
+	}
+	if required {
+		errs.WriteError(w, r, errs.Forbidden("Your account requires two-step verification."))
+		return
+	}
+
+	var key string = strconv.FormatInt(user.ID, 10)
+	if p.mfaFailures.lockedFor(key, maxMFAAttempts, now, p.Lockout.duration()) > 0 {
+		errs.WriteError(w, r, errs.Forbidden("Too many wrong codes. Try again later."))
+		return
+	}
+	step, ok := authn.VerifyTOTP(enrollment.TOTPSecret, strings.TrimSpace(req.Code), now, enrollment.TOTPLastStep)
+	if ok {
+		err = p.MFA.UseTOTPStep(r.Context(), user.ID, step)
+		if errors.Is(err, store.ErrConflict) {
+			ok = false
+		} else if err != nil {
+			errs.WriteError(w, r, errs.Internal(fmt.Errorf("cannot record TOTP use of user %d: %w", user.ID, err)))
+			return
+		}
+	}
+	if !ok {
+		p.mfaFailures.fail(key, now, p.Lockout.duration())
+		errs.WriteError(w, r, errs.Forbidden("The code is wrong or has expired."))
+		return
+	}
+	p.mfaFailures.reset(key)
+
+	err = p.MFA.DeleteMFAEnrollment(r.Context(), user.ID)
+	if err != nil {
+		errs.WriteError(w, r, errs.Internal(fmt.Errorf("cannot delete MFA enrollment of user %d: %w", user.ID, err)))
+		return
+	}
+	p.audit().Record(r.Context(), audit.Event{
+		Type:       audit.TOTPDisabled,
+		UserID:     user.ID,
+		RemoteAddr: p.TrustedProxies.ClientIP(r),
+		Time:       now,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
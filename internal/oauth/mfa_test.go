@@ -0,0 +1,257 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/audit"
+	"github.com/ehubscher/goidp/internal/authn"
+	"github.com/ehubscher/goidp/internal/oauth"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+var (
+	testTOTPSecret = []byte("12345678901234567890")
+	challengeField = regexp.MustCompile(`name="challenge" value="([^"]+)"`)
+)
+
+// withMFA enrolls the test user's authenticator app, requiring it at login
+// if required is set.
+func (env *testEnv) withMFA(t *testing.T, required bool) {
+	t.Helper()
+
+	mfa := store.NewMemoryMFAStore()
+	err := mfa.PutMFAEnrollment(context.Background(), store.MFAEnrollment{
+		UserID:     env.user.ID,
+		Required:   required,
+		TOTPSecret: testTOTPSecret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.provider.MFA = mfa
+}
+
+// mfaChallenge logs in with the password and returns the challenge of the
+// second step.
+func (env *testEnv) mfaChallenge(t *testing.T) string {
+	t.Helper()
+
+	rec := env.login(t, nil)
+	if rec.Code != http.StatusOK || responseCookie(rec, "goidp_session") != nil {
+		t.Fatalf("got: %d and a session, want: %d asking for a second factor", rec.Code, http.StatusOK)
+	}
+	match := challengeField.FindStringSubmatch(rec.Body.String())
+	if match == nil {
+		t.Fatalf("got: %s, want: a challenge in the form", rec.Body)
+	}
+
+	return match[1]
+}
+
+func (env *testEnv) presentTOTP(challenge, code string) *http.Response {
+	return env.do(postForm("/login/mfa", url.Values{"challenge": {challenge}, "code": {code}})).Result()
+}
+
+func TestMFARequired(t *testing.T) {
+	env := newTestEnv(t)
+	env.withMFA(t, true)
+
+	challenge := env.mfaChallenge(t)
+	resp := env.presentTOTP(challenge, authn.TOTPCode(testTOTPSecret, env.now))
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("got: %d, want: %d", resp.StatusCode, http.StatusFound)
+	}
+
+	sessions, err := env.sessions.ListUserSessions(context.Background(), env.user.ID, env.now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || !slices.Contains(sessions[0].AMR, "mfa") {
+		t.Errorf("got: %+v, want: one session with amr mfa", sessions)
+	}
+
+	// The challenge is spent, and so is the code.
+	resp = env.presentTOTP(challenge, authn.TOTPCode(testTOTPSecret, env.now))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got: %d, want: %d for a spent challenge", resp.StatusCode, http.StatusBadRequest)
+	}
+	resp = env.presentTOTP(env.mfaChallenge(t), authn.TOTPCode(testTOTPSecret, env.now))
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got: %d, want: %d for a reused code", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestMFAWrongCode(t *testing.T) {
+	env := newTestEnv(t)
+	env.withMFA(t, true)
+
+	challenge := env.mfaChallenge(t)
+	for range 4 {
+		if resp := env.presentTOTP(challenge, "000000"); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("got: %d, want: %d", resp.StatusCode, http.StatusUnauthorized)
+		}
+	}
+	env.presentTOTP(challenge, "000000")
+
+	// Out of attempts, even the right code needs the password again.
+	if resp := env.presentTOTP(challenge, authn.TOTPCode(testTOTPSecret, env.now)); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got: %d, want: %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestMFAWrongCodesAcrossLogins(t *testing.T) {
+	env := newTestEnv(t)
+	env.withMFA(t, true)
+
+	for range 5 {
+		env.presentTOTP(env.mfaChallenge(t), "000000")
+	}
+
+	// Entering the password again doesn't reset the count.
+	if resp := env.presentTOTP(env.mfaChallenge(t), authn.TOTPCode(testTOTPSecret, env.now)); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got: %d, want: %d while locked", resp.StatusCode, http.StatusUnauthorized)
+	}
+	sessions, err := env.sessions.ListUserSessions(context.Background(), env.user.ID, env.now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("got: %+v, want: no session", sessions)
+	}
+}
+
+func TestRememberMeWithoutMFA(t *testing.T) {
+	env := newTestEnv(t)
+	tokens := store.NewMemoryRememberTokenStore()
+	env.provider.RememberTokens = tokens
+
+	remember := responseCookie(env.login(t, url.Values{"remember_me": {"1"}}), "goidp_remember")
+	if remember == nil {
+		t.Fatal("got: no cookie, want: a remember-me cookie")
+	}
+	env.withMFA(t, true)
+
+	rec := env.authorizeWith(t, remember)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `action="/login"`) {
+		t.Errorf("got: %d, want: the login form", rec.Code)
+	}
+	series, _, _ := strings.Cut(remember.Value, ":")
+	if _, err := tokens.GetRememberToken(context.Background(), series); err != store.ErrNotFound {
+		t.Errorf("got: %v, want: %v", err, store.ErrNotFound)
+	}
+}
+
+func TestMFAPolicyRoles(t *testing.T) {
+	env := newTestEnv(t)
+	env.withMFA(t, false)
+
+	if rec := env.login(t, nil); rec.Code != http.StatusFound {
+		t.Fatalf("got: %d, want: %d without MFA required", rec.Code, http.StatusFound)
+	}
+
+	env.provider.MFAPolicy = oauth.MFAPolicy{
+		Roles: []string{"admin"},
+		UserRoles: func(ctx context.Context, user store.User) ([]string, error) {
+			return []string{"admin"}, nil
+		},
+	}
+	env.mfaChallenge(t)
+}
+
+func TestMFARequiredNotEnrolled(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.MFA = store.NewMemoryMFAStore()
+	env.provider.MFA.PutMFAEnrollment(context.Background(), store.MFAEnrollment{UserID: env.user.ID, Required: true})
+
+	rec := env.login(t, nil)
+	if rec.Code != http.StatusForbidden || responseCookie(rec, "goidp_session") != nil {
+		t.Errorf("got: %d, want: %d and no session", rec.Code, http.StatusForbidden)
+	}
+}
+
+func (env *testEnv) disableTOTP(cookie *http.Cookie, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/account/2fa/disable", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	return env.do(r)
+}
+
+func TestDisableTOTP(t *testing.T) {
+	env := newTestEnv(t)
+	env.withMFA(t, false)
+	events := &audit.Memory{}
+	env.provider.Audit = events
+	stale := env.withSession(t)
+	cookie := env.freshSession(t, "fresh-session")
+	code := authn.TOTPCode(testTOTPSecret, env.now)
+
+	var refused = []struct {
+		name   string
+		cookie *http.Cookie
+		body   string
+		status int
+	}{
+		{"no session", nil, `{"code":"` + code + `"}`, http.StatusUnauthorized},
+		{"stale session", stale, `{"code":"` + code + `"}`, http.StatusUnauthorized},
+		{"session only", cookie, `{}`, http.StatusForbidden},
+		{"wrong code", cookie, `{"code":"000000"}`, http.StatusForbidden},
+	}
+	for _, c := range refused {
+		if rec := env.disableTOTP(c.cookie, c.body); rec.Code != c.status {
+			t.Errorf("%s got: %d, want: %d", c.name, rec.Code, c.status)
+		}
+	}
+	if _, err := env.provider.MFA.GetMFAEnrollment(context.Background(), env.user.ID); err != nil {
+		t.Fatalf("got: %v, want: the enrollment kept after refusals", err)
+	}
+	if len(events.Events()) != 0 {
+		t.Errorf("got: %+v, want: no events", events.Events())
+	}
+
+	if rec := env.disableTOTP(cookie, `{"code":"`+code+`"}`); rec.Code != http.StatusNoContent {
+		t.Fatalf("got: %d, want: %d", rec.Code, http.StatusNoContent)
+	}
+	if _, err := env.provider.MFA.GetMFAEnrollment(context.Background(), env.user.ID); err != store.ErrNotFound {
+		t.Errorf("got: %v, want: the enrollment deleted", err)
+	}
+	got := events.Events()
+	if len(got) != 1 || got[0].Type != audit.TOTPDisabled || got[0].UserID != env.user.ID {
+		t.Errorf("got: %+v, want: a TOTP disabled event", got)
+	}
+	if rec := env.login(t, nil); rec.Code != http.StatusFound {
+		t.Errorf("got: %d, want: login with the password alone", rec.Code)
+	}
+}
+
+func TestDisableTOTPRefusals(t *testing.T) {
+	env := newTestEnv(t)
+	env.withMFA(t, true)
+	cookie := env.freshSession(t, "fresh-session")
+
+	rec := env.disableTOTP(cookie, `{"code":"`+authn.TOTPCode(testTOTPSecret, env.now)+`"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("got: %d, want: %d when the second factor is required", rec.Code, http.StatusForbidden)
+	}
+
+	env = newTestEnv(t)
+	env.withMFA(t, false)
+	cookie = env.freshSession(t, "fresh-session")
+	for range 5 {
+		env.disableTOTP(cookie, `{"code":"000000"}`)
+	}
+	env.now = env.now.Add(time.Minute)
+	rec = env.disableTOTP(cookie, `{"code":"`+authn.TOTPCode(testTOTPSecret, env.now)+`"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("got: %d, want: %d after too many wrong codes", rec.Code, http.StatusForbidden)
+	}
+}
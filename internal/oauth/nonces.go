@@ -0,0 +1,67 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const defaultNonceReplayWindow = 10 * time.Minute
+
+var errNonceReplayed = errors.New("nonce already used")
+
+// Kinds of single-use value kept in the replay cache, so that one kind
+// can't be mistaken for another.
+const (
+	replayNonce       = "nonce"
+	replayAssertionID = "assertion_jti"
+)
+
+// defaultReplayCache is the in-memory cache used without Provider.Replay.
+// Each kind gets a cache of its own, so a client spending assertion ids
+// can't fill the room authorize nonces need.
+type defaultReplayCache struct {
+	once   sync.Once
+	caches map[string]*store.MemoryReplayCache
+}
+
+func (p *Provider) replayCache(kind string) store.ReplayCache {
+	if p.Replay != nil {
+		return p.Replay
+	}
+
+	p.defaultReplay.once.Do(func() {
+		p.defaultReplay.caches = make(map[string]*store.MemoryReplayCache)
+		for _, kind := range []string{replayNonce, replayAssertionID} {
+			p.defaultReplay.caches[kind] = &store.MemoryReplayCache{Size: p.NonceCacheSize, Now: p.now}
+		}
+	})
+	return p.defaultReplay.caches[kind]
+}
+
+// spend records value, of the given kind, as used by clientID until window
+// has passed. It fails with errNonceReplayed if it already was, and with
+// the replay cache's error, such as store.ErrReplayCacheFull, if it can't
+// tell.
+func (p *Provider) spend(ctx context.Context, kind, clientID, value string, window time.Duration) error {
+	seen, err := p.replayCache(kind).Seen(ctx, kind+"\x00"+clientID+"\x00"+value, window)
+	if err != nil {
+		return err
+	}
+	if seen {
+		return errNonceReplayed
+	}
+
+	return nil
+}
+
+func (p *Provider) nonceReplayWindow() time.Duration {
+	if p.NonceReplayWindow == 0 {
+		return defaultNonceReplayWindow
+	}
+
+	return p.NonceReplayWindow
+}
@@ -0,0 +1,132 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+func (env *testEnv) authorizeNonce(t *testing.T, cookie *http.Cookie, nonce string) url.Values {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{"nonce": {nonce}}), nil)
+	r.AddCookie(cookie)
+
+	return redirectParams(t, env.do(r))
+}
+
+func TestAuthorizeNonceReplay(t *testing.T) {
+	env := newTestEnv(t)
+	cookie := env.withSession(t)
+
+	params := env.authorizeNonce(t, cookie, "n-0S6_WzA2Mj")
+	if params.Get("code") == "" {
+		t.Fatalf("got: %v, want: a code", params)
+	}
+
+	env.now = env.now.Add(5 * time.Minute)
+	params = env.authorizeNonce(t, cookie, "n-0S6_WzA2Mj")
+	if params.Get("error") != "invalid_request" {
+		t.Errorf("got: %v, want: error %s", params, "invalid_request")
+	}
+	if params.Get("state") != "xyz" {
+		t.Errorf("got: %s, want: %s", params.Get("state"), "xyz")
+	}
+
+	params = env.authorizeNonce(t, cookie, "another-nonce")
+	if params.Get("code") == "" {
+		t.Errorf("got: %v, want: a code", params)
+	}
+
+	env.now = env.now.Add(5 * time.Minute)
+	params = env.authorizeNonce(t, cookie, "n-0S6_WzA2Mj")
+	if params.Get("code") == "" {
+		t.Errorf("got: %v, want: a code once the window has passed", params)
+	}
+}
+
+func TestAuthorizeNonceReplayScopedToClient(t *testing.T) {
+	env := newTestEnv(t)
+	cookie := env.withSession(t)
+	other := store.Client{ID: "other-client", RedirectURIs: []string{testRedirectURI}}
+	err := env.provider.Clients.(*store.MemoryClientStore).PutClient(context.Background(), other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.provider.Consents.SaveConsent(context.Background(), store.Consent{
+		UserID:   env.user.ID,
+		ClientID: other.ID,
+		Scopes:   []string{"openid"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.authorizeNonce(t, cookie, "shared")
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{
+		"client_id": {other.ID},
+		"nonce":     {"shared"},
+	}), nil)
+	r.AddCookie(cookie)
+	params := redirectParams(t, env.do(r))
+	if params.Get("code") == "" {
+		t.Errorf("got: %v, want: a code", params)
+	}
+}
+
+func TestAuthorizeNonceReuseAllowed(t *testing.T) {
+	env := newTestEnv(t)
+	cookie := env.withSession(t)
+	env.provider.Clients = store.NewMemoryClientStore(store.Client{
+		ID:              testClientID,
+		RedirectURIs:    []string{testRedirectURI},
+		AllowNonceReuse: true,
+	})
+
+	for range 2 {
+		params := env.authorizeNonce(t, cookie, "fixed")
+		if params.Get("code") == "" {
+			t.Errorf("got: %v, want: a code", params)
+		}
+	}
+}
+
+func TestAuthorizeNonceCacheFull(t *testing.T) {
+	env := newTestEnv(t)
+	cookie := env.withSession(t)
+	env.provider.NonceCacheSize = 1
+
+	env.authorizeNonce(t, cookie, "first")
+	params := env.authorizeNonce(t, cookie, "second")
+	if params.Get("error") != "temporarily_unavailable" {
+		t.Errorf("got: %v, want: error %s", params, "temporarily_unavailable")
+	}
+
+	env.now = env.now.Add(10 * time.Minute)
+	params = env.authorizeNonce(t, cookie, "second")
+	if params.Get("code") == "" {
+		t.Errorf("got: %v, want: a code once the first entry expired", params)
+	}
+}
+
+func TestAuthorizeNonceReplaySharedCache(t *testing.T) {
+	shared := &store.MemoryReplayCache{}
+	first, second := newTestEnv(t), newTestEnv(t)
+	first.provider.Replay = shared
+	second.provider.Replay = shared
+
+	params := first.authorizeNonce(t, first.withSession(t), "n-0S6_WzA2Mj")
+	if params.Get("code") == "" {
+		t.Fatalf("got: %v, want: a code", params)
+	}
+	params = second.authorizeNonce(t, second.withSession(t), "n-0S6_WzA2Mj")
+	if params.Get("error") != "invalid_request" {
+		t.Errorf("other instance got: %v, want: error %s", params, "invalid_request")
+	}
+}
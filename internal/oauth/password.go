@@ -0,0 +1,183 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ehubscher/goidp/internal/audit"
+	"github.com/ehubscher/goidp/internal/authn"
+	"github.com/ehubscher/goidp/internal/errs"
+	"github.com/ehubscher/goidp/internal/problem"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const (
+	defaultPasswordHistoryDepth = 5
+	defaultRecentAuthMaxAge     = 10 * time.Minute
+	minPasswordLength           = 8
+)
+
+func (p *Provider) passwordHistoryDepth() int {
+	if p.PasswordHistoryDepth > 0 {
+		return p.PasswordHistoryDepth
+	}
+
+	return defaultPasswordHistoryDepth
+}
+
+// SetPassword replaces the user's password, as a change or reset does. When
+// PasswordHistory is set the new password must not match the current one or
+// any of the last PasswordHistoryDepth, otherwise authn.ErrPasswordReused is
+// returned and nothing is changed.
+func (p *Provider) SetPassword(ctx context.Context, user store.User, password string) error {
+	if p.PasswordHistory != nil {
+		recent, err := p.PasswordHistory.RecentPasswordHashes(ctx, user.ID, p.passwordHistoryDepth())
+		if err != nil {
+			return err
+		}
+
+		// The current hash predates the history for users created before it
+		// was enabled, so it is always checked as well.
+		err = authn.CheckPasswordReuse(ctx, password, append([]string{user.PasswordHash}, recent...))
+		if err != nil {
+			return err
+		}
+	}
+
+	hash, err := authn.GenerateHash(ctx, p.hashAlgorithm(), password)
+	if err != nil {
+		return unavailableIfBusy(err)
+	}
+
+	err = p.Users.UpdatePasswordHash(ctx, user.ID, hash)
+	if err != nil {
+		return err
+	}
+
+	return p.recordPassword(ctx, user.ID, hash)
+}
+
+func (p *Provider) recordPassword(ctx context.Context, userID int64, hash string) error {
+	if p.PasswordHistory == nil {
+		return nil
+	}
+
+	return p.PasswordHistory.AddPasswordHash(ctx, userID, hash, p.passwordHistoryDepth())
+}
+
+// passwordPolicyViolation returns why password is unacceptable as a new
+// password, or "" if it is fine. userInputs are passed on to the strength
+// estimator and the contextual rules.
+func (p *Provider) passwordPolicyViolation(password string, userInputs ...string) string {
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		return "Must be at least " + strconv.Itoa(minPasswordLength) + " characters."
+	}
+	if feedback, ok := p.PasswordContext.Check(password, userInputs...); !ok {
+		return strings.Join(append([]string{"Not allowed by the password policy."}, feedback...), " ")
+	}
+	if feedback, ok := p.PasswordStrength.Check(password, userInputs...); !ok {
+		return strings.Join(append([]string{"Too easy to guess."}, feedback...), " ")
+	}
+
+	return ""
+}
+
+type passwordChange struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ChangePassword serves POST /account/password. Besides the current
+// password it requires the session to have authenticated recently, and on
+// success every other session and remember-me login of the user is revoked.
+func (p *Provider) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	session, ok := p.session(w, r)
+	if !ok {
+		errs.WriteError(w, r, errs.Unauthorized("Authentication required."))
+		return
+	}
+	if p.now().Sub(session.AuthTime) > p.recentAuthMaxAge() {
+		errs.WriteError(w, r, errs.Unauthorized("Recent authentication required, sign in again."))
+		return
+	}
+
+	var req passwordChange
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req)
+	if err != nil {
+		errs.WriteError(w, r, errs.Invalid("Malformed password change."))
+		return
+	}
+
+	user, err := p.Users.GetUserByID(r.Context(), session.UserID)
+	if err != nil {
+		errs.WriteError(w, r, errs.Internal(fmt.Errorf("cannot load user %d: %w", session.UserID, err)))
+		return
+	}
+	match, err := p.verifySecret(r.Context(), req.CurrentPassword, user.PasswordHash)
+	if err != nil {
+		errs.WriteError(w, r, errs.Internal(err))
+		return
+	}
+	if !match {
+		errs.WriteError(w, r, errs.Forbidden("The current password is incorrect."))
+		return
+	}
+
+	if reason := p.passwordPolicyViolation(req.NewPassword, user.Email); reason != "" {
+		invalidNewPassword(w, r, reason)
+		return
+	}
+	err = p.SetPassword(r.Context(), user, req.NewPassword)
+	if errors.Is(err, authn.ErrPasswordReused) {
+		invalidNewPassword(w, r, "Must not be one of your recent passwords.")
+		return
+	}
+	if err != nil {
+		errs.WriteError(w, r, errs.Internal(fmt.Errorf("cannot change password of user %d: %w", user.ID, err)))
+		return
+	}
+
+	err = p.Sessions.DeleteUserSessions(r.Context(), user.ID, p.SessionIDKeys.hash(session.ID))
+	if err != nil {
+		slog.Error("Cannot revoke other sessions.", "user_id", user.ID, "err", err)
+	}
+	if p.RememberTokens != nil {
+		err = p.RememberTokens.DeleteUserRememberTokens(r.Context(), user.ID)
+		if err != nil {
+			slog.Error("Cannot revoke remember-me logins.", "user_id", user.ID, "err", err)
+		}
+		clearCookie(w, rememberCookieName)
+	}
+
+	p.audit().Record(r.Context(), audit.Event{
+		Type:       audit.PasswordChanged,
+		UserID:     user.ID,
+		RemoteAddr: p.TrustedProxies.ClientIP(r),
+		Time:       p.now(),
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func invalidNewPassword(w http.ResponseWriter, r *http.Request, reason string) {
+	prob := problem.New(http.StatusBadRequest, "The new password is not acceptable.")
+	prob.Instance = r.URL.Path
+	prob.InvalidParams = []problem.InvalidParam{{Name: "new_password", Reason: reason}}
+	problem.Write(w, prob)
+}
+
+func (p *Provider) recentAuthMaxAge() time.Duration {
+	if p.RecentAuthMaxAge > 0 {
+		return p.RecentAuthMaxAge
+	}
+
+	return defaultRecentAuthMaxAge
+}
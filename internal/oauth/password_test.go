@@ -0,0 +1,201 @@
+package oauth_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/audit"
+	"github.com/ehubscher/goidp/internal/authn"
+	"github.com/ehubscher/goidp/internal/clientip"
+	"github.com/ehubscher/goidp/internal/problem"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+func TestSetPasswordHistory(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.PasswordHistory = store.NewMemoryPasswordHistoryStore()
+	env.provider.PasswordHistoryDepth = 2
+	ctx := context.Background()
+
+	setPassword := func(password string) error {
+		user, err := env.provider.Users.GetUserByID(ctx, env.user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return env.provider.SetPassword(ctx, user, password)
+	}
+
+	// The current password counts even though it was never recorded.
+	err := setPassword(testPassword)
+	if !errors.Is(err, authn.ErrPasswordReused) {
+		t.Errorf("got: %v, want: %v", err, authn.ErrPasswordReused)
+	}
+
+	for _, password := range []string{"first new one", "second new one"} {
+		err = setPassword(password)
+		if err != nil {
+			t.Fatalf("got: %v, want: nil", err)
+		}
+	}
+
+	err = setPassword("first new one")
+	if !errors.Is(err, authn.ErrPasswordReused) {
+		t.Errorf("got: %v, want: %v", err, authn.ErrPasswordReused)
+	}
+
+	// Only the last two are kept, so the original is allowed again.
+	err = setPassword(testPassword)
+	if err != nil {
+		t.Errorf("got: %v, want: nil", err)
+	}
+
+	user, err := env.provider.Users.GetUserByID(ctx, env.user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	match, err := authn.VerifyPassword(context.Background(), testPassword, user.PasswordHash)
+	if err != nil || !match {
+		t.Errorf("got: %v, %v, want: the new password to be stored", match, err)
+	}
+}
+
+func (env *testEnv) changePassword(t *testing.T, cookie *http.Cookie, current, next string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	body, err := json.Marshal(map[string]string{"current_password": current, "new_password": next})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/account/password", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.AddCookie(cookie)
+
+	return env.do(r)
+}
+
+// freshSession stores a session that has just authenticated.
+func (env *testEnv) freshSession(t *testing.T, id string) *http.Cookie {
+	t.Helper()
+
+	err := env.sessions.CreateSession(context.Background(), store.Session{
+		ID:        id,
+		UserID:    env.user.ID,
+		AuthTime:  env.now,
+		ExpiresAt: env.now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &http.Cookie{Name: "goidp_session", Value: id}
+}
+
+func TestChangePassword(t *testing.T) {
+	env := newTestEnv(t)
+	events := &audit.Memory{}
+	env.provider.Audit = events
+	other := env.withSession(t)
+	cookie := env.freshSession(t, "fresh-session")
+
+	rec := env.changePassword(t, cookie, testPassword, "a brand new password")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("got: %d, want: %d", rec.Code, http.StatusNoContent)
+	}
+
+	_, err := env.sessions.GetSession(context.Background(), other.Value)
+	if err != store.ErrNotFound {
+		t.Errorf("got: %v, want: the other session revoked", err)
+	}
+	_, err = env.sessions.GetSession(context.Background(), cookie.Value)
+	if err != nil {
+		t.Errorf("got: %v, want: the current session kept", err)
+	}
+
+	got := events.Events()
+	if len(got) != 1 || got[0].Type != audit.PasswordChanged || got[0].UserID != env.user.ID {
+		t.Errorf("got: %+v, want: a password change event", got)
+	}
+
+	if rec := env.login(t, url.Values{"password": {"a brand new password"}}); rec.Code != http.StatusFound {
+		t.Errorf("got: %d, want: login with the new password", rec.Code)
+	}
+}
+
+func TestChangePasswordAuditsClientIP(t *testing.T) {
+	var proxies = []struct {
+		trusted clientip.Proxies
+		want    string
+	}{
+		{nil, "192.0.2.1"},
+		{clientip.Proxies{netip.MustParsePrefix("192.0.2.0/24")}, "198.51.100.9"},
+	}
+
+	for _, c := range proxies {
+		env := newTestEnv(t)
+		events := &audit.Memory{}
+		env.provider.Audit = events
+		env.provider.TrustedProxies = c.trusted
+
+		body := `{"current_password":"` + testPassword + `","new_password":"a brand new password"}`
+		r := httptest.NewRequest(http.MethodPost, "/account/password", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("X-Forwarded-For", "198.51.100.9")
+		r.AddCookie(env.freshSession(t, "fresh-session"))
+		env.do(r)
+
+		if got := events.Events(); len(got) != 1 || got[0].RemoteAddr != c.want {
+			t.Errorf("trusting %v got: %+v, want: an event from %s", c.trusted, got, c.want)
+		}
+	}
+}
+
+func TestChangePasswordWrongCurrent(t *testing.T) {
+	env := newTestEnv(t)
+	cookie := env.freshSession(t, "fresh-session")
+
+	rec := env.changePassword(t, cookie, "not the password", "a brand new password")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestChangePasswordPolicy(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.PasswordHistory = store.NewMemoryPasswordHistoryStore()
+	cookie := env.freshSession(t, "fresh-session")
+
+	for _, next := range []string{"short", testPassword} {
+		rec := env.changePassword(t, cookie, testPassword, next)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%q got: %d, want: %d", next, rec.Code, http.StatusBadRequest)
+		}
+
+		var prob problem.Problem
+		err := json.NewDecoder(rec.Body).Decode(&prob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(prob.InvalidParams) != 1 || prob.InvalidParams[0].Name != "new_password" {
+			t.Errorf("got: %+v, want: a new_password field error", prob.InvalidParams)
+		}
+	}
+}
+
+func TestChangePasswordRequiresRecentAuth(t *testing.T) {
+	env := newTestEnv(t)
+
+	// withSession authenticated an hour ago.
+	rec := env.changePassword(t, env.withSession(t), testPassword, "a brand new password")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusUnauthorized)
+	}
+}
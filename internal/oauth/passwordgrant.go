@@ -0,0 +1,102 @@
+package oauth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+// passwordGrant serves grant_type=password. The grant hands the user's
+// password to the client, so on top of Flows.PasswordGrant and the client's
+// GrantTypes it is limited to first-party clients. Failed attempts count
+// towards the account lockout as failed logins do, and the client rate
+// limit has already been applied by clientRequest.
+func (p *Provider) passwordGrant(w http.ResponseWriter, r *http.Request, client store.Client) {
+	if !client.FirstParty {
+		tokenError(w, http.StatusBadRequest, "unauthorized_client", "The client may not use this grant type.")
+		return
+	}
+	slog.Warn("Deprecated password grant used.", "client_id", client.ID)
+
+	username, password := r.PostForm.Get("username"), r.PostForm.Get("password")
+	if username == "" || password == "" {
+		tokenError(w, http.StatusBadRequest, "invalid_request", "username and password are required.")
+		return
+	}
+	var scopes []string = p.ScopePolicy.apply(strings.Fields(r.PostForm.Get("scope")))
+	if unknown := p.scopes().Unknown(scopes); len(unknown) > 0 {
+		tokenError(w, http.StatusBadRequest, "invalid_scope", "Unsupported scope: "+strings.Join(unknown, " "))
+		return
+	}
+	binding, err := p.requestBinding(w, r, client)
+	if err != nil {
+		return
+	}
+
+	user, err := p.authenticateUser(r.Context(), username, password, p.TrustedProxies.ClientIP(r))
+	if errors.Is(err, ErrInvalidCredentials) {
+		tokenError(w, http.StatusBadRequest, "invalid_grant", p.invalidCredentialsMessage())
+		return
+	}
+	if errors.Is(err, ErrAccountLocked) {
+		tokenError(w, http.StatusBadRequest, "invalid_grant", accountLockedMessage)
+		return
+	}
+	if err != nil {
+		slog.Error("Cannot load user.", "err", err)
+		tokenServerError(w, err)
+		return
+	}
+	if p.RequireVerifiedEmail && !user.EmailVerified {
+		tokenError(w, http.StatusBadRequest, "invalid_grant", emailUnverifiedDescription)
+		return
+	}
+	// The grant has no way to ask for a second factor, so it can't be
+	// used by anyone who needs one.
+	mfa, _, err := p.mfaRequired(r.Context(), user)
+	if err != nil {
+		slog.Error("Cannot load MFA enrollment.", "err", err)
+		tokenServerError(w, err)
+		return
+	}
+	if mfa {
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "The user must sign in with two-step verification.")
+		return
+	}
+
+	var authTime = p.now()
+	accessToken, expiresIn, err := p.issueAccessToken(r.Context(), client, user.ID, scopes, "")
+	if err != nil {
+		slog.Error("Cannot issue access token.", "err", err)
+		tokenServerError(w, err)
+		return
+	}
+
+	resp := tokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(expiresIn.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}
+	if slices.Contains(scopes, "openid") {
+		resp.IDToken, err = p.issueIDToken(r, client, store.AuthCode{UserID: user.ID, AuthTime: authTime}, expiresIn.Seconds())
+		if err != nil {
+			slog.Error("Cannot issue ID token.", "err", err)
+			tokenServerError(w, err)
+			return
+		}
+	}
+
+	resp.RefreshToken, err = p.issueRefreshToken(r.Context(), client.ID, user.ID, resp.Scope, "", binding, authTime)
+	if err != nil {
+		slog.Error("Cannot issue refresh token.", "err", err)
+		tokenServerError(w, err)
+		return
+	}
+
+	writeTokenResponse(w, resp)
+}
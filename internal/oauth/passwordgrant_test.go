@@ -0,0 +1,94 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/oauth"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+// withPasswordGrant lets the test client use the password grant when
+// firstParty is set, and turns the grant on deployment wide.
+func (env *testEnv) withPasswordGrant(t *testing.T, firstParty bool) {
+	t.Helper()
+
+	env.withTokens(t)
+	clients := env.provider.Clients.(*store.MemoryClientStore)
+	client, err := clients.GetClient(context.Background(), testClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.FirstParty = firstParty
+	client.GrantTypes = []string{"password"}
+	err = clients.PutClient(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.provider.Flows = oauth.Flows{PasswordGrant: true}
+}
+
+func passwordForm(password string) url.Values {
+	return url.Values{
+		"grant_type": {"password"},
+		"username":   {testEmail},
+		"password":   {password},
+		"scope":      {"openid"},
+	}
+}
+
+func TestPasswordGrant(t *testing.T) {
+	env := newTestEnv(t)
+	env.withPasswordGrant(t, true)
+
+	rec := env.exchange(t, basicAuth(testClientID, testClientSecret), passwordForm(testPassword))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusOK)
+	}
+	if resp := decodeTokenResult(t, rec); resp.AccessToken == "" || resp.Scope != "openid" {
+		t.Errorf("got: %+v, want: an access token for openid", resp)
+	}
+
+	rec = env.exchange(t, basicAuth(testClientID, testClientSecret), passwordForm("wrong"))
+	if resp := decodeTokenResult(t, rec); rec.Code != http.StatusBadRequest || resp.Error != "invalid_grant" {
+		t.Errorf("got: %d %q, want: %d %q", rec.Code, resp.Error, http.StatusBadRequest, "invalid_grant")
+	}
+}
+
+func TestPasswordGrantLockout(t *testing.T) {
+	env := newTestEnv(t)
+	env.withPasswordGrant(t, true)
+	env.provider.Lockout = oauth.Lockout{Threshold: 2}
+
+	for range 2 {
+		env.exchange(t, basicAuth(testClientID, testClientSecret), passwordForm("wrong"))
+	}
+
+	rec := env.exchange(t, basicAuth(testClientID, testClientSecret), passwordForm(testPassword))
+	if resp := decodeTokenResult(t, rec); resp.Error != "invalid_grant" {
+		t.Errorf("got: %q, want: %q for a locked account", resp.Error, "invalid_grant")
+	}
+}
+
+func TestPasswordGrantRefused(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		firstParty bool
+		enabled    bool
+		want       string
+	}{
+		{"off", true, false, "unsupported_grant_type"},
+		{"third party", false, true, "unauthorized_client"},
+	} {
+		env := newTestEnv(t)
+		env.withPasswordGrant(t, c.firstParty)
+		env.provider.Flows.PasswordGrant = c.enabled
+
+		rec := env.exchange(t, basicAuth(testClientID, testClientSecret), passwordForm(testPassword))
+		if resp := decodeTokenResult(t, rec); rec.Code != http.StatusBadRequest || resp.Error != c.want {
+			t.Errorf("%s got: %d %q, want: %d %q", c.name, rec.Code, resp.Error, http.StatusBadRequest, c.want)
+		}
+	}
+}
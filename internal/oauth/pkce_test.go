@@ -0,0 +1,118 @@
+package oauth_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testCodeVerifier = "dBjftJeZ4CVP-mJ0kJSdFxFKkXGTWfqx2c8cRk5Tcup"
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// pkceCodeGrant is codeGrant for a code requested with the challenge of
+// testCodeVerifier.
+func (env *testEnv) pkceCodeGrant(t *testing.T) url.Values {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{
+		"code_challenge":        {codeChallenge(testCodeVerifier)},
+		"code_challenge_method": {"S256"},
+	}), nil)
+	r.AddCookie(env.withSession(t))
+	params := redirectParams(t, env.do(r))
+	if params.Get("code") == "" {
+		t.Fatalf("got: %v, want: a code", params)
+	}
+
+	return url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {params.Get("code")},
+		"redirect_uri": {testRedirectURI},
+	}
+}
+
+func TestPKCE(t *testing.T) {
+	var verifiers = []struct {
+		name     string
+		verifier string
+		status   int
+	}{
+		{"matching", testCodeVerifier, http.StatusOK},
+		{"missing", "", http.StatusBadRequest},
+		{"other", strings.Repeat("a", 43), http.StatusBadRequest},
+		{"one character off", testCodeVerifier[:42] + "q", http.StatusBadRequest},
+		{"too short", testCodeVerifier[:42], http.StatusBadRequest},
+	}
+
+	for _, c := range verifiers {
+		env := newTestEnv(t)
+		env.withTokens(t)
+
+		grant := env.pkceCodeGrant(t)
+		if c.verifier != "" {
+			grant.Set("code_verifier", c.verifier)
+		}
+		rec := env.exchange(t, basicAuth(testClientID, testClientSecret), grant)
+		if rec.Code != c.status {
+			t.Errorf("%s got: %d %s, want: %d", c.name, rec.Code, rec.Body, c.status)
+			continue
+		}
+		if c.status != http.StatusOK && decodeMap(t, rec)["error"] != "invalid_grant" {
+			t.Errorf("%s got: %s, want: invalid_grant", c.name, rec.Body)
+		}
+	}
+}
+
+// A verifier for a code requested without a challenge is a downgrade
+// attempt, not something to ignore.
+func TestPKCEVerifierWithoutChallenge(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+
+	grant := env.codeGrant(t)
+	grant.Set("code_verifier", testCodeVerifier)
+	rec := env.exchange(t, basicAuth(testClientID, testClientSecret), grant)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestPKCEComparesChallenge(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	compared := watchSecretsEqual(t)
+
+	grant := env.pkceCodeGrant(t)
+	var verifier string = strings.Repeat("a", 43)
+	grant.Set("code_verifier", verifier)
+	env.exchange(t, basicAuth(testClientID, testClientSecret), grant)
+	if !compared(codeChallenge(verifier), codeChallenge(testCodeVerifier)) {
+		t.Error("got: no comparison, want: the challenge compared with SecretsEqual")
+	}
+}
+
+func TestPKCEInvalidChallenge(t *testing.T) {
+	var params = []url.Values{
+		{"code_challenge": {codeChallenge(testCodeVerifier)}},
+		{"code_challenge": {testCodeVerifier}, "code_challenge_method": {"plain"}},
+		{"code_challenge": {"not a hash"}, "code_challenge_method": {"S256"}},
+		{"code_challenge_method": {"S256"}},
+	}
+
+	for _, extra := range params {
+		env := newTestEnv(t)
+		r := httptest.NewRequest(http.MethodGet, authorizeURL(extra), nil)
+		r.AddCookie(env.withSession(t))
+		if got := redirectParams(t, env.do(r)); got.Get("error") != "invalid_request" {
+			t.Errorf("%v got: %v, want: error invalid_request", extra, got)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package oauth
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// promptValues are the prompt values of OIDC Core 3.1.2.1.
+var promptValues = []string{"none", "login", "consent", "select_account"}
+
+var ErrInvalidPrompt = errors.New("invalid prompt")
+
+// Prompt is a parsed prompt parameter. Each field forces its step of the
+// authorization even when it could otherwise be skipped, except None, which
+// forbids every interactive step.
+type Prompt struct {
+	None          bool
+	Login         bool
+	Consent       bool
+	SelectAccount bool
+}
+
+// ParsePrompt parses the space-separated prompt parameter. Unknown values
+// and none combined with anything else are errors; repeated values are
+// harmless and ignored.
+func ParsePrompt(raw string) (prompt Prompt, err error) {
+	values := strings.Fields(raw)
+	for _, v := range values {
+		switch v {
+		case "none":
+			prompt.None = true
+		case "login":
+			prompt.Login = true
+		case "consent":
+			prompt.Consent = true
+		case "select_account":
+			prompt.SelectAccount = true
+		default:
+			return Prompt{}, fmt.Errorf("%w: unsupported value %q", ErrInvalidPrompt, v)
+		}
+	}
+	if prompt.None && slices.ContainsFunc(values, func(v string) bool { return v != "none" }) {
+		return Prompt{}, fmt.Errorf("%w: none cannot be combined with other values", ErrInvalidPrompt)
+	}
+
+	return prompt, nil
+}
+
+// dropPrompt removes value from the prompt in params, once the step it asks
+// for has been satisfied and the request is about to be resumed.
+func dropPrompt(params url.Values, value string) {
+	var prompt []string = slices.DeleteFunc(strings.Fields(params.Get("prompt")), func(v string) bool {
+		return v == value
+	})
+	if len(prompt) > 0 {
+		params.Set("prompt", strings.Join(prompt, " "))
+	} else {
+		params.Del("prompt")
+	}
+}
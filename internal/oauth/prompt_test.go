@@ -0,0 +1,56 @@
+package oauth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/oauth"
+)
+
+func TestParsePrompt(t *testing.T) {
+	var prompts = []struct {
+		raw  string
+		want oauth.Prompt
+	}{
+		{"", oauth.Prompt{}},
+		{"none", oauth.Prompt{None: true}},
+		{"login consent", oauth.Prompt{Login: true, Consent: true}},
+		{"select_account  consent", oauth.Prompt{Consent: true, SelectAccount: true}},
+		{"login login", oauth.Prompt{Login: true}},
+		{"none none", oauth.Prompt{None: true}},
+	}
+
+	for _, c := range prompts {
+		got, err := oauth.ParsePrompt(c.raw)
+		if err != nil {
+			t.Errorf("%q got: %v, want: nil", c.raw, err)
+		}
+		if got != c.want {
+			t.Errorf("%q got: %+v, want: %+v", c.raw, got, c.want)
+		}
+	}
+}
+
+func TestParsePromptInvalid(t *testing.T) {
+	for _, raw := range []string{"none login", "consent none", "create", "login Login"} {
+		_, err := oauth.ParsePrompt(raw)
+		if !errors.Is(err, oauth.ErrInvalidPrompt) {
+			t.Errorf("%q got: %v, want: %v", raw, err, oauth.ErrInvalidPrompt)
+		}
+	}
+}
+
+func TestAuthorizeUnknownPrompt(t *testing.T) {
+	env := newTestEnv(t)
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{"prompt": {"login create"}}), nil)
+	r.AddCookie(env.withSession(t))
+
+	params := redirectParams(t, env.do(r))
+	if params.Get("error") != "invalid_request" || params.Get("code") != "" {
+		t.Errorf("got: %v, want: invalid_request and no code", params)
+	}
+}
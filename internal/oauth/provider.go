@@ -0,0 +1,344 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/audit"
+	"github.com/ehubscher/goidp/internal/authn"
+	"github.com/ehubscher/goidp/internal/clientip"
+	"github.com/ehubscher/goidp/internal/feature"
+	"github.com/ehubscher/goidp/internal/ratelimit"
+	"github.com/ehubscher/goidp/internal/render"
+	"github.com/ehubscher/goidp/internal/retryafter"
+	"github.com/ehubscher/goidp/internal/store"
+	"github.com/ehubscher/goidp/internal/token"
+)
+
+const (
+	defaultSessionTTL = 24 * time.Hour
+	retryAfter        = 5 * time.Second
+)
+
+// Provider implements the OAuth 2.0 / OpenID Connect endpoints on top of the
+// stores it is given.
+type Provider struct {
+	Users    store.UserStore
+	Clients  store.ClientStore
+	Sessions store.SessionStore
+	Codes    store.AuthCodeStore
+	Profiles store.ProfileStore
+	Consents store.ConsentStore
+	// RememberTokens enables the remember-me option on login when set.
+	RememberTokens store.RememberTokenStore
+	// PasswordHistory enables refusing recently used passwords when set.
+	PasswordHistory store.PasswordHistoryStore
+	// MFA enables second factors at login when set. Who must present one
+	// is decided by MFAPolicy and each user's enrollment.
+	MFA       store.MFAStore
+	MFAPolicy MFAPolicy
+	// RefreshTokens enables issuing refresh tokens at /token when set.
+	RefreshTokens store.RefreshTokenStore
+	// AccessTokens holds the opaque access tokens issued to clients whose
+	// AccessTokenFormat is opaque or whose subjects are pairwise, and must
+	// be set if any client is.
+	AccessTokens store.AccessTokenStore
+	Keys         KeySource
+	// Tokens signs the access and ID tokens issued at /token.
+	Tokens *token.Issuer
+	// ClientRateLimit limits authenticated clients at /token and
+	// /introspect, keyed by client id. Nil means no limit. The per-IP
+	// limit is applied separately, as middleware.
+	ClientRateLimit *ratelimit.Limiter
+	// MaxIntrospectionBatch is how many tokens one request to
+	// /introspect/batch may hold. Zero means the endpoint is off.
+	MaxIntrospectionBatch int
+	// GrantMetrics is told the outcome of every token request. Nil means
+	// none are recorded.
+	GrantMetrics GrantRecorder
+
+	// Scopes is the set of supported scopes. Requests for anything else are
+	// rejected. Nil means DefaultScopeRegistry.
+	Scopes ScopeRegistry
+	// ScopePolicy adds default and mandatory scopes to requests.
+	ScopePolicy ScopePolicy
+
+	// Issuer is the issuer identifier, also used as the base URL for the
+	// endpoints advertised in discovery.
+	Issuer string
+	// Subjects decides whether clients see public or pairwise subject
+	// identifiers. The zero value gives every client public ones.
+	Subjects Subjects
+
+	// Email validates and normalizes addresses at registration.
+	Email authn.EmailValidator
+	// HashAlgorithm is passed to authn.GenerateHash for new passwords. Empty
+	// means argon2id.
+	HashAlgorithm string
+	// PasswordStrength refuses new passwords that are too easy to guess, at
+	// registration and password change. The zero value only enforces the
+	// minimum length.
+	PasswordStrength authn.StrengthPolicy
+	// PasswordContext refuses new passwords containing the user's email,
+	// blocked terms or trivial patterns, alongside PasswordStrength.
+	PasswordContext authn.ContextPolicy
+	// PasswordHistoryDepth is how many previous passwords can't be reused.
+	// Zero means 5.
+	PasswordHistoryDepth int
+	// External checks the passwords of users who have none locally,
+	// including users that don't exist yet, who are then created. Nil means
+	// only local passwords are checked.
+	External ExternalVerifier
+	// IncompatibleHash is called on every login attempt by a user whose
+	// password hash can never be verified, such as one made by an older
+	// argon2 version, so operators can flag the user for a forced reset.
+	// The attempt itself fails like any wrong password. Nil means such
+	// hashes are only logged.
+	IncompatibleHash func(ctx context.Context, user store.User)
+	// RequireVerifiedEmail refuses logins and tokens to users whose email
+	// address isn't verified.
+	RequireVerifiedEmail bool
+	// UnverifiedEmail, if set, is called when a login is refused under
+	// RequireVerifiedEmail, for example to send the verification email
+	// again. It returns nil once the email is queued.
+	UnverifiedEmail func(ctx context.Context, user store.User) error
+	// VerificationResendInterval is how long after calling UnverifiedEmail
+	// for a user it isn't called for them again, so the verification email
+	// can't be used to flood their inbox. Zero means 5 minutes.
+	VerificationResendInterval time.Duration
+	// InvalidCredentialsMessage is shown for any failed login. Empty means
+	// "Invalid email or password.".
+	InvalidCredentialsMessage string
+
+	// Audit receives security events. Nil means audit.SlogSink{}.
+	Audit audit.Sink
+	// TrustedProxies are believed about the client IP they forward, which
+	// audit events record. Nil means the connection's peer is the client.
+	TrustedProxies clientip.Proxies
+
+	// CookieKeys sign the session and CSRF cookies. The zero value leaves
+	// them unsigned.
+	CookieKeys CookieKeys
+
+	// SessionKeys seal sessions into the session cookie rather than keeping
+	// them in Sessions. The zero value keeps them in Sessions, which must be
+	// set either way.
+	SessionKeys SessionKeys
+
+	// SessionIDKeys hash session ids before they go into Sessions. The
+	// zero value stores them as they are.
+	SessionIDKeys SessionIDKeys
+
+	// Pages renders the login and consent pages. Nil means the embedded
+	// default templates.
+	Pages *render.Renderer
+
+	// UILocales are the locales the login and consent pages can be shown
+	// in, matched against ui_locales. The first is the default. Nil means
+	// English only.
+	UILocales []string
+
+	// Features switches optional endpoints off. Routes of disabled
+	// features answer 404 and are left out of discovery. SetFeatures
+	// replaces them on a running provider.
+	Features feature.Flags
+
+	// RequireEssentialClaims makes authorization fail with access_denied
+	// when a claim requested as essential has no value for the user. By
+	// default such claims are simply left out, as OIDC Core 5.5.1 allows.
+	RequireEssentialClaims bool
+
+	// AllowInsecureRedirectURIs accepts plain http redirect URIs on any
+	// host rather than only on loopback addresses. For development only;
+	// see ConfigureInsecureRedirectURIs.
+	AllowInsecureRedirectURIs bool
+
+	// Flows turns grant and response types off for the whole deployment,
+	// see ConfigureFlows. The zero value leaves them all on.
+	Flows Flows
+
+	SessionTTL    time.Duration
+	SessionLimit  SessionLimit
+	Lockout       Lockout
+	RememberMeTTL time.Duration
+	// RefreshTokenTTL is how long a refresh token can be used. Zero means
+	// 30 days.
+	RefreshTokenTTL time.Duration
+	// RecentAuthMaxAge is how long after signing in sensitive account
+	// changes are allowed without signing in again. Zero means 10 minutes.
+	RecentAuthMaxAge time.Duration
+	CodePolicy       CodePolicy
+	// NonceReplayWindow is how long a nonce can't be reused by the same
+	// client at /authorize. Zero means 10 minutes; a negative value turns
+	// the check off. Clients can opt out with AllowNonceReuse.
+	NonceReplayWindow time.Duration
+	// Replay remembers used nonces and client assertion ids. Nil means a
+	// store.MemoryReplayCache of NonceCacheSize entries for each, which
+	// only catches replays to the same instance.
+	Replay store.ReplayCache
+	// NonceCacheSize bounds how many used nonces, and separately how many
+	// assertion ids, the default replay cache remembers. Once one is full,
+	// requests that need it fail until entries expire. Zero means 100000.
+	NonceCacheSize int
+
+	// HTTPClient fetches the jwks_uri of clients using private_key_jwt.
+	// Nil means a client with a 5 second timeout.
+	HTTPClient *http.Client
+
+	// Now is used as the clock for everything time-sensitive. It defaults to
+	// time.Now and exists so tests can control time.
+	Now func() time.Time
+
+	liveFeatures   atomic.Pointer[feature.Flags]
+	discoveryCache documentCache
+	jwksCache      documentCache
+
+	consentChallenges consentChallenges
+	mfaChallenges     mfaChallenges
+	logoutChallenges  logoutChallenges
+	dummyHash         dummyHash
+	sessionLimiter    sessionLimiter
+	lockouts          lockoutTracker
+	mfaFailures       lockoutTracker
+	resends           lockoutTracker
+	defaultReplay     defaultReplayCache
+	clientJWKS        clientJWKSCache
+}
+
+func (p *Provider) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.Discovery)
+	mux.HandleFunc("GET /jwks", p.JWKS)
+	mux.HandleFunc("GET /authorize", p.Authorize)
+	mux.HandleFunc("POST /authorize", p.Authorize)
+	mux.HandleFunc("POST /consent", p.Consent)
+	mux.HandleFunc("GET /login", p.Login)
+	mux.HandleFunc("POST /login", p.Login)
+	mux.HandleFunc("POST /login/mfa", p.LoginMFA)
+	mux.HandleFunc("POST /account/2fa/disable", p.DisableTOTP)
+	mux.HandleFunc("GET /end_session", p.EndSession)
+	mux.HandleFunc("POST /end_session", p.EndSession)
+	mux.HandleFunc("GET /account/profile", p.Profile)
+	mux.HandleFunc("PUT /account/profile", p.Profile)
+	mux.HandleFunc("GET /account/export", p.Export)
+
+	mux.Handle("POST /token", p.gated(feature.Token, http.HandlerFunc(p.Token)))
+	mux.Handle("GET /userinfo", p.gated(feature.Token, p.userInfoHandler()))
+	mux.Handle("POST /userinfo", p.gated(feature.Token, p.userInfoHandler()))
+	mux.Handle("POST /introspect", p.gated(feature.Introspection, http.HandlerFunc(p.Introspect)))
+	mux.Handle("POST /introspect/batch", p.gated(feature.Introspection, http.HandlerFunc(p.IntrospectBatch)))
+	mux.Handle("POST /register", p.gated(feature.Registration, http.HandlerFunc(p.Register)))
+	mux.Handle("POST /account/password", p.gated(feature.PasswordChange, http.HandlerFunc(p.ChangePassword)))
+}
+
+// gated serves h while the named feature is enabled and answers 404, as if
+// the route didn't exist, while it isn't.
+func (p *Provider) gated(name string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !p.features().Enabled(name) {
+			http.NotFound(w, r)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// SetFeatures replaces Features while the provider is serving, as a config
+// reload does. The discovery document is rebuilt on its next request.
+func (p *Provider) SetFeatures(flags feature.Flags) {
+	p.liveFeatures.Store(&flags)
+	p.discoveryCache.reset()
+}
+
+func (p *Provider) features() feature.Flags {
+	if flags := p.liveFeatures.Load(); flags != nil {
+		return *flags
+	}
+
+	return p.Features
+}
+
+func (p *Provider) now() time.Time {
+	if p.Now != nil {
+		return p.Now()
+	}
+
+	return time.Now()
+}
+
+func (p *Provider) audit() audit.Sink {
+	if p.Audit != nil {
+		return p.Audit
+	}
+
+	return audit.SlogSink{}
+}
+
+func (p *Provider) sessionTTL() time.Duration {
+	if p.SessionTTL > 0 {
+		return p.SessionTTL
+	}
+
+	return defaultSessionTTL
+}
+
+// currentSession returns the active session: the first unexpired one
+// referenced by the request's session cookie, if there is one.
+func (p *Provider) currentSession(ctx context.Context, r *http.Request) (session store.Session, ok bool) {
+	for _, id := range p.sessionCookieIDs(r) {
+		session, ok = p.lookupSession(ctx, id)
+		if ok {
+			return session, true
+		}
+	}
+
+	return store.Session{}, false
+}
+
+func (p *Provider) lookupSession(ctx context.Context, id string) (session store.Session, ok bool) {
+	if id == "" {
+		return store.Session{}, false
+	}
+
+	var err error
+	if p.SessionKeys.enabled() && isSealedSession(id) {
+		session, _, err = p.SessionKeys.open(id)
+	} else {
+		session, err = p.getStoredSession(ctx, id)
+	}
+	if err != nil {
+		return store.Session{}, false
+	}
+	if !p.now().Before(session.ExpiresAt) {
+		return store.Session{}, false
+	}
+
+	return session, true
+}
+
+// internalError writes a plain error response for err, using 503 with
+// Retry-After when the store is only temporarily unavailable.
+func internalError(w http.ResponseWriter, err error) {
+	if errors.Is(err, store.ErrUnavailable) {
+		retryafter.Set(w.Header(), retryAfter)
+		http.Error(w, "Service temporarily unavailable.", http.StatusServiceUnavailable)
+		return
+	}
+
+	http.Error(w, "Internal server error.", http.StatusInternalServerError)
+}
+
+func randomToken(n int) (token string, err error) {
+	b := make([]byte, n)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
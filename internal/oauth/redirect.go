@@ -0,0 +1,99 @@
+package oauth
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+var ErrInsecureRedirectURI = errors.New("insecure redirect_uri")
+
+// ValidateRedirectURI checks a redirect URI against the OAuth security BCP
+// (RFC 9700 section 4.1): it must be absolute, carry no fragment, and use
+// https, except that native apps may use http on a loopback IP address
+// (RFC 8252 section 7.3). allowHTTP relaxes the https requirement for any
+// host, for development only.
+func ValidateRedirectURI(raw string, allowHTTP bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return fmt.Errorf("%w: %q is not an absolute URL", ErrInsecureRedirectURI, raw)
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("%w: %q has a fragment", ErrInsecureRedirectURI, raw)
+	}
+
+	switch {
+	case u.Scheme == "https":
+		return nil
+	case u.Scheme == "http" && (allowHTTP || isLoopback(u.Hostname())):
+		return nil
+	}
+
+	return fmt.Errorf("%w: %q must use https unless it is a loopback address", ErrInsecureRedirectURI, raw)
+}
+
+// isLoopback reports whether host is a loopback IP literal. The name
+// localhost is deliberately not accepted: it can resolve elsewhere, and
+// RFC 8252 section 8.3 advises against it.
+func isLoopback(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// ValidateClient checks every redirect URI of client, its access token
+// format, its keys and auth method, its refresh token binding and its
+// subject type, and should be called before a client is registered in a
+// ClientStore.
+func ValidateClient(client store.Client, allowHTTP bool) error {
+	err := validateAccessTokenFormat(client.AccessTokenFormat)
+	if err != nil {
+		return fmt.Errorf("client %s: %w", client.ID, err)
+	}
+	err = validateClientKeys(client)
+	if err != nil {
+		return fmt.Errorf("client %s: %w", client.ID, err)
+	}
+	err = validateAuthMethod(client)
+	if err != nil {
+		return fmt.Errorf("client %s: %w", client.ID, err)
+	}
+	err = validateRefreshBinding(client.RefreshTokenBinding)
+	if err != nil {
+		return fmt.Errorf("client %s: %w", client.ID, err)
+	}
+	err = validateSubjectType(client.SubjectType)
+	if err != nil {
+		return fmt.Errorf("client %s: %w", client.ID, err)
+	}
+
+	for _, uri := range slices.Concat(client.RedirectURIs, client.PostLogoutRedirectURIs) {
+		err := ValidateRedirectURI(uri, allowHTTP)
+		if err != nil {
+			return fmt.Errorf("client %s: %w", client.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// ConfigureInsecureRedirectURIs reports whether plain http redirect URIs are
+// allowed for any host, which is only the case when DEV_MODE is true.
+func ConfigureInsecureRedirectURIs() (bool, error) {
+	raw := os.Getenv("DEV_MODE")
+	if raw == "" {
+		return false, nil
+	}
+
+	devMode, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("DEV_MODE misconfigured: %w", err)
+	}
+
+	return devMode, nil
+}
@@ -0,0 +1,97 @@
+package oauth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/oauth"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+var redirectURIs = []struct {
+	uri       string
+	allowHTTP bool
+	ok        bool
+}{
+	{"https://client.example/cb", false, true},
+	{"http://client.example/cb", false, false},
+	{"http://127.0.0.1:49152/cb", false, true},
+	{"http://[::1]/cb", false, true},
+	{"http://localhost/cb", false, false},
+	{"https://client.example/cb#frag", false, false},
+	{"/cb", false, false},
+	{"com.example.app:/cb", false, false},
+	{"http://client.example/cb", true, true},
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	for _, c := range redirectURIs {
+		err := oauth.ValidateRedirectURI(c.uri, c.allowHTTP)
+		if c.ok && err != nil {
+			t.Errorf("%s got: %v, want: nil", c.uri, err)
+		}
+		if !c.ok && !errors.Is(err, oauth.ErrInsecureRedirectURI) {
+			t.Errorf("%s got: %v, want: %v", c.uri, err, oauth.ErrInsecureRedirectURI)
+		}
+	}
+}
+
+func TestValidateClient(t *testing.T) {
+	native := store.Client{ID: "native", RedirectURIs: []string{"http://127.0.0.1/cb"}}
+	if err := oauth.ValidateClient(native, false); err != nil {
+		t.Errorf("got: %v, want: nil", err)
+	}
+
+	web := store.Client{ID: "web", RedirectURIs: []string{testRedirectURI, "http://client.example/cb"}}
+	if err := oauth.ValidateClient(web, false); !errors.Is(err, oauth.ErrInsecureRedirectURI) {
+		t.Errorf("got: %v, want: %v", err, oauth.ErrInsecureRedirectURI)
+	}
+
+	typo := store.Client{ID: "typo", RedirectURIs: []string{testRedirectURI}, AccessTokenFormat: "opague"}
+	if err := oauth.ValidateClient(typo, false); !errors.Is(err, oauth.ErrUnsupportedTokenFormat) {
+		t.Errorf("got: %v, want: %v", err, oauth.ErrUnsupportedTokenFormat)
+	}
+}
+
+func TestAuthorizeRedirectURIScheme(t *testing.T) {
+	var clients = []struct {
+		redirectURI string
+		allowHTTP   bool
+		code        int
+	}{
+		{testRedirectURI, false, http.StatusFound},
+		{"http://client.example/cb", false, http.StatusBadRequest},
+		{"http://127.0.0.1:8400/cb", false, http.StatusFound},
+		{"http://client.example/cb", true, http.StatusFound},
+	}
+
+	for _, c := range clients {
+		env := newTestEnv(t)
+		env.provider.AllowInsecureRedirectURIs = c.allowHTTP
+		env.provider.Clients = store.NewMemoryClientStore(store.Client{
+			ID:           testClientID,
+			RedirectURIs: []string{c.redirectURI},
+		})
+
+		r := httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{"redirect_uri": {c.redirectURI}}), nil)
+		r.AddCookie(env.withSession(t))
+		if rec := env.do(r); rec.Code != c.code {
+			t.Errorf("%s got: %d, want: %d", c.redirectURI, rec.Code, c.code)
+		}
+	}
+}
+
+func TestConfigureInsecureRedirectURIs(t *testing.T) {
+	t.Setenv("DEV_MODE", "true")
+	if allow, err := oauth.ConfigureInsecureRedirectURIs(); err != nil || !allow {
+		t.Errorf("got: %t, %v, want: true", allow, err)
+	}
+
+	t.Setenv("DEV_MODE", "")
+	if allow, err := oauth.ConfigureInsecureRedirectURIs(); err != nil || allow {
+		t.Errorf("got: %t, %v, want: false", allow, err)
+	}
+}
@@ -0,0 +1,203 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/audit"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const defaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+func (p *Provider) refreshTokenTTL() time.Duration {
+	if p.RefreshTokenTTL > 0 {
+		return p.RefreshTokenTTL
+	}
+
+	return defaultRefreshTokenTTL
+}
+
+// issueRefreshToken stores a new refresh token for scope, bound to binding,
+// and returns it. It returns an empty token when refresh tokens are disabled
+// or the refresh_token grant is turned off.
+func (p *Provider) issueRefreshToken(ctx context.Context, clientID string, userID int64, scope, claims, binding string, authTime time.Time) (string, error) {
+	if p.RefreshTokens == nil || !p.Flows.grantTypeEnabled("refresh_token") {
+		return "", nil
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = p.RefreshTokens.CreateRefreshToken(ctx, store.RefreshToken{
+		TokenHash: hashRememberToken(token),
+		ClientID:  clientID,
+		UserID:    userID,
+		Scope:     scope,
+		Claims:    claims,
+		Binding:   binding,
+		AuthTime:  authTime,
+		ExpiresAt: p.now().Add(p.refreshTokenTTL()),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// refreshTokenGrant serves grant_type=refresh_token. The client may ask for
+// a subset of the scope the refresh token was granted (RFC 6749 section 6);
+// the access token then carries only that subset, while the rotated refresh
+// token keeps the original scope so later refreshes can ask for it again.
+func (p *Provider) refreshTokenGrant(w http.ResponseWriter, r *http.Request, client store.Client) {
+	if p.RefreshTokens == nil {
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+
+	var tokenHash string = hashRememberToken(r.PostForm.Get("refresh_token"))
+	refresh, err := p.RefreshTokens.GetRefreshToken(r.Context(), tokenHash)
+	if errors.Is(err, store.ErrNotFound) {
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "The refresh token is invalid or expired.")
+		return
+	}
+	if err != nil {
+		slog.Error("Cannot load refresh token.", "err", err)
+		tokenServerError(w, err)
+		return
+	}
+	if refresh.ClientID != client.ID || !p.now().Before(refresh.ExpiresAt) {
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "The refresh token is invalid or expired.")
+		return
+	}
+	// The binding recorded at issuance is what counts, so changing a
+	// client's binding only affects the refresh tokens issued after.
+	binding, err := p.requestBinding(w, r, client)
+	if err != nil {
+		return
+	}
+	if refresh.Binding != "" && binding != refresh.Binding {
+		slog.Warn("Refresh token used from another context.", "client_id", client.ID, "user_id", refresh.UserID)
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "The refresh token was issued in another context.")
+		return
+	}
+	active, unverified, err := p.activeUser(r.Context(), refresh.UserID)
+	if err != nil {
+		slog.Error("Cannot load user.", "err", err)
+		tokenServerError(w, err)
+		return
+	}
+	if unverified {
+		tokenError(w, http.StatusBadRequest, "invalid_grant", emailUnverifiedDescription)
+		return
+	}
+	if !active {
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "The refresh token is invalid or expired.")
+		return
+	}
+
+	var granted []string = normalizeScopes(strings.Fields(refresh.Scope))
+	var scopes []string = granted
+	if raw := r.PostForm.Get("scope"); raw != "" {
+		scopes = normalizeScopes(strings.Fields(raw))
+		for _, scope := range scopes {
+			if !slices.Contains(granted, scope) {
+				tokenError(w, http.StatusBadRequest, "invalid_scope", "The requested scope exceeds the scope originally granted.")
+				return
+			}
+		}
+		// Narrowing keeps the mandatory scopes the grant holds, and can't
+		// add ones that became mandatory since.
+		for _, scope := range p.ScopePolicy.Mandatory {
+			if slices.Contains(granted, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+		scopes = normalizeScopes(scopes)
+	}
+
+	// Consuming only after validation means a rejected request leaves the
+	// refresh token usable.
+	err = p.RefreshTokens.ConsumeRefreshToken(r.Context(), tokenHash)
+	if errors.Is(err, store.ErrNotFound) {
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "The refresh token is invalid or expired.")
+		return
+	}
+	if err != nil {
+		slog.Error("Cannot consume refresh token.", "err", err)
+		tokenServerError(w, err)
+		return
+	}
+
+	if removed := scopeDifference(granted, scopes); len(removed) > 0 {
+		p.audit().Record(r.Context(), audit.Event{
+			Type:       audit.RefreshScopeReduced,
+			UserID:     refresh.UserID,
+			ClientID:   client.ID,
+			RemoteAddr: p.TrustedProxies.ClientIP(r),
+			Time:       p.now(),
+			Detail: map[string]string{
+				"granted_scope":   refresh.Scope,
+				"requested_scope": strings.Join(scopes, " "),
+				"removed_scope":   strings.Join(removed, " "),
+			},
+		})
+	}
+
+	accessToken, expiresIn, err := p.issueAccessToken(r.Context(), client, refresh.UserID, scopes, refresh.Claims)
+	if err != nil {
+		slog.Error("Cannot issue access token.", "err", err)
+		tokenServerError(w, err)
+		return
+	}
+	next, err := p.issueRefreshToken(r.Context(), client.ID, refresh.UserID, refresh.Scope, refresh.Claims, refresh.Binding, refresh.AuthTime)
+	if err != nil {
+		slog.Error("Cannot issue refresh token.", "err", err)
+		tokenServerError(w, err)
+		return
+	}
+
+	writeTokenResponse(w, tokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(expiresIn.Seconds()),
+		Scope:        strings.Join(scopes, " "),
+		RefreshToken: next,
+	})
+}
+
+// requestBinding is refreshBinding for a token request, writing the error
+// response itself when the binding can't be determined.
+func (p *Provider) requestBinding(w http.ResponseWriter, r *http.Request, client store.Client) (string, error) {
+	binding, err := p.refreshBinding(r, client)
+	if errors.Is(err, errMissingDeviceID) {
+		tokenError(w, http.StatusBadRequest, "invalid_request", "The device_id parameter is required.")
+		return "", err
+	}
+	if err != nil {
+		slog.Error("Cannot determine refresh token binding.", "err", err)
+		tokenServerError(w, err)
+		return "", err
+	}
+
+	return binding, nil
+}
+
+// scopeDifference returns the scopes in granted that aren't in requested.
+func scopeDifference(granted, requested []string) (removed []string) {
+	for _, scope := range granted {
+		if !slices.Contains(requested, scope) {
+			removed = append(removed, scope)
+		}
+	}
+
+	return removed
+}
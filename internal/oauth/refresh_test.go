@@ -0,0 +1,166 @@
+package oauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/audit"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const grantedScope = "openid email profile"
+
+type tokenResult struct {
+	AccessToken  string `json:"access_token"`
+	Scope        string `json:"scope"`
+	RefreshToken string `json:"refresh_token"`
+	Error        string `json:"error"`
+}
+
+func decodeTokenResult(t *testing.T, rec *httptest.ResponseRecorder) tokenResult {
+	t.Helper()
+
+	var resp tokenResult
+	err := json.NewDecoder(rec.Body).Decode(&resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp
+}
+
+// withRefreshToken enables refresh tokens and returns one granted
+// grantedScope.
+func (env *testEnv) withRefreshToken(t *testing.T) string {
+	t.Helper()
+
+	env.withTokens(t)
+	env.provider.RefreshTokens = store.NewMemoryRefreshTokenStore()
+	err := env.provider.Consents.SaveConsent(context.Background(), store.Consent{
+		UserID:   env.user.ID,
+		ClientID: testClientID,
+		Scopes:   []string{"openid", "profile", "email"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{"scope": {grantedScope}}), nil)
+	r.AddCookie(env.withSession(t))
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {redirectParams(t, env.do(r)).Get("code")},
+		"redirect_uri": {testRedirectURI},
+	}
+
+	rec := env.exchange(t, basicAuth(testClientID, testClientSecret), form)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusOK)
+	}
+	resp := decodeTokenResult(t, rec)
+	if resp.RefreshToken == "" {
+		t.Fatal("got: no refresh_token, want: one")
+	}
+
+	return resp.RefreshToken
+}
+
+func (env *testEnv) refresh(t *testing.T, refreshToken, scope string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}}
+	if scope != "" {
+		form.Set("scope", scope)
+	}
+
+	return env.exchange(t, basicAuth(testClientID, testClientSecret), form)
+}
+
+func TestRefreshDownScope(t *testing.T) {
+	env := newTestEnv(t)
+	sink := &audit.Memory{}
+	env.provider.Audit = sink
+
+	rec := env.refresh(t, env.withRefreshToken(t), "openid email")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusOK)
+	}
+	resp := decodeTokenResult(t, rec)
+	if resp.Scope != "openid email" {
+		t.Errorf("got: scope %q, want: %q", resp.Scope, "openid email")
+	}
+
+	claims, err := env.provider.Tokens.Validate(resp.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Scope != "openid email" {
+		t.Errorf("got: access token scope %q, want: %q", claims.Scope, "openid email")
+	}
+
+	events := sink.Events()
+	if len(events) != 1 || events[0].Type != audit.RefreshScopeReduced || events[0].Detail["removed_scope"] != "profile" {
+		t.Errorf("got: %+v, want: one %s event removing profile", events, audit.RefreshScopeReduced)
+	}
+
+	// The rotated refresh token keeps the original grant.
+	rec = env.refresh(t, resp.RefreshToken, "")
+	if got := decodeTokenResult(t, rec); got.Scope != grantedScope {
+		t.Errorf("got: scope %q, want: %q", got.Scope, grantedScope)
+	}
+}
+
+func TestRefreshWideningRejected(t *testing.T) {
+	env := newTestEnv(t)
+	refreshToken := env.withRefreshToken(t)
+
+	rec := env.refresh(t, refreshToken, "openid offline_access")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusBadRequest)
+	}
+	if resp := decodeTokenResult(t, rec); resp.Error != "invalid_scope" {
+		t.Errorf("got: %q, want: invalid_scope", resp.Error)
+	}
+
+	// A rejected refresh doesn't burn the token.
+	if rec = env.refresh(t, refreshToken, ""); rec.Code != http.StatusOK {
+		t.Errorf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusOK)
+	}
+}
+
+func TestRefreshDefaultsToGrantedScope(t *testing.T) {
+	env := newTestEnv(t)
+	sink := &audit.Memory{}
+	env.provider.Audit = sink
+
+	rec := env.refresh(t, env.withRefreshToken(t), "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusOK)
+	}
+	resp := decodeTokenResult(t, rec)
+	claims, err := env.provider.Tokens.Validate(resp.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Scope != grantedScope || claims.Scope != grantedScope {
+		t.Errorf("got: %q, %q, want: %q", resp.Scope, claims.Scope, grantedScope)
+	}
+	if events := sink.Events(); len(events) != 0 {
+		t.Errorf("got: %+v, want: no audit events", events)
+	}
+}
+
+func TestRefreshTokenSingleUse(t *testing.T) {
+	env := newTestEnv(t)
+	refreshToken := env.withRefreshToken(t)
+
+	env.refresh(t, refreshToken, "")
+	rec := env.refresh(t, refreshToken, "")
+	if resp := decodeTokenResult(t, rec); resp.Error != "invalid_grant" {
+		t.Errorf("got: %d %q, want: invalid_grant", rec.Code, resp.Error)
+	}
+}
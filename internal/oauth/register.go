@@ -0,0 +1,100 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/ehubscher/goidp/internal/authn"
+	"github.com/ehubscher/goidp/internal/errs"
+	"github.com/ehubscher/goidp/internal/problem"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const defaultHashAlgorithm = "argon2id"
+
+type registration struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type registeredUser struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email"`
+}
+
+// Register serves POST /register, creating a user from an email address and
+// password. The address is normalized before the uniqueness check so the
+// same mailbox can't be registered twice in different spellings.
+func (p *Provider) Register(w http.ResponseWriter, r *http.Request) {
+	var req registration
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req)
+	if err != nil {
+		errs.WriteError(w, r, errs.Invalid("Malformed registration."))
+		return
+	}
+
+	var invalid []problem.InvalidParam
+	email, err := p.Email.Normalize(r.Context(), req.Email)
+	switch {
+	case errors.Is(err, authn.ErrInvalidEmail):
+		invalid = append(invalid, problem.InvalidParam{Name: "email", Reason: "Not a valid email address."})
+	case errors.Is(err, authn.ErrEmailDomain):
+		invalid = append(invalid, problem.InvalidParam{Name: "email", Reason: "The email domain does not accept mail."})
+	case err != nil:
+		errs.WriteError(w, r, errs.Internal(fmt.Errorf("cannot validate email address: %w", err)))
+		return
+	}
+	if reason := p.passwordPolicyViolation(req.Password, req.Email); reason != "" {
+		invalid = append(invalid, problem.InvalidParam{Name: "password", Reason: reason})
+	}
+	if len(invalid) > 0 {
+		prob := problem.New(http.StatusBadRequest, "The registration has invalid fields.")
+		prob.Instance = r.URL.Path
+		prob.InvalidParams = invalid
+		problem.Write(w, prob)
+		return
+	}
+
+	hash, err := authn.GenerateHash(r.Context(), p.hashAlgorithm(), req.Password)
+	if err != nil {
+		errs.WriteError(w, r, errs.Internal(fmt.Errorf("cannot hash password: %w", unavailableIfBusy(err))))
+		return
+	}
+
+	user, err := p.Users.CreateUser(r.Context(), email, hash)
+	if errors.Is(err, store.ErrConflict) {
+		errs.WriteError(w, r, errs.Conflict("An account with this email address already exists."))
+		return
+	}
+	if err != nil {
+		errs.WriteError(w, r, errs.Internal(fmt.Errorf("cannot create user: %w", err)))
+		return
+	}
+
+	err = p.recordPassword(r.Context(), user.ID, hash)
+	if err != nil {
+		// The account exists either way; its first password just won't be
+		// in the history.
+		slog.Error("Cannot record password history.", "user_id", user.ID, "err", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(registeredUser{
+		Subject: strconv.FormatInt(user.ID, 10),
+		Email:   user.Email,
+	})
+}
+
+func (p *Provider) hashAlgorithm() string {
+	if p.HashAlgorithm != "" {
+		return p.HashAlgorithm
+	}
+
+	return defaultHashAlgorithm
+}
@@ -0,0 +1,132 @@
+package oauth_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/authn"
+	"github.com/ehubscher/goidp/internal/problem"
+)
+
+func (env *testEnv) register(t *testing.T, email, password string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	body, err := json.Marshal(map[string]string{"email": email, "password": password})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(string(body)))
+	r.Header.Set("Content-Type", "application/json")
+
+	return env.do(r)
+}
+
+func TestRegisterNormalizesEmail(t *testing.T) {
+	env := newTestEnv(t)
+
+	rec := env.register(t, "  New.User@Example.COM ", "correct horse")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got: %d, want: %d", rec.Code, http.StatusCreated)
+	}
+
+	var user struct {
+		Email string `json:"email"`
+	}
+	err := json.NewDecoder(rec.Body).Decode(&user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "new.user@example.com" {
+		t.Errorf("got: %s, want: %s", user.Email, "new.user@example.com")
+	}
+
+	// The same mailbox spelled differently is caught by the uniqueness check.
+	rec = env.register(t, "new.user@example.com\n", "correct horse")
+	if rec.Code != http.StatusConflict {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusConflict)
+	}
+}
+
+func TestRegisterRejectsInvalidEmail(t *testing.T) {
+	env := newTestEnv(t)
+
+	rec := env.register(t, "not an email", "correct horse")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusBadRequest)
+	}
+
+	var prob problem.Problem
+	err := json.NewDecoder(rec.Body).Decode(&prob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prob.InvalidParams) != 1 || prob.InvalidParams[0].Name != "email" {
+		t.Errorf("got: %+v, want: an email field error", prob.InvalidParams)
+	}
+}
+
+type fixedStrength int
+
+func (s fixedStrength) Estimate(password string, userInputs ...string) authn.Strength {
+	if strings.Contains(password, " ") {
+		return authn.Strength{Score: authn.MaxStrengthScore}
+	}
+	return authn.Strength{Score: int(s), Feedback: []string{"Add more words."}}
+}
+
+func TestRegisterRejectsWeakPassword(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.PasswordStrength = authn.StrengthPolicy{Estimator: fixedStrength(1), MinScore: 3}
+
+	rec := env.register(t, "new.user@example.com", "Password1")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got: %d, want: %d", rec.Code, http.StatusBadRequest)
+	}
+	var prob problem.Problem
+	err := json.NewDecoder(rec.Body).Decode(&prob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prob.InvalidParams) != 1 || prob.InvalidParams[0].Reason != "Too easy to guess. Add more words." {
+		t.Errorf("got: %+v, want: a password error with the feedback", prob.InvalidParams)
+	}
+
+	rec = env.register(t, "new.user@example.com", "correct horse battery staple")
+	if rec.Code != http.StatusCreated {
+		t.Errorf("got: %d, want: %d for a strong passphrase", rec.Code, http.StatusCreated)
+	}
+}
+
+func TestRegisterRejectsContextualPassword(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.PasswordContext = authn.ContextPolicy{RejectEmail: true, BlockedTerms: []string{"acme"}}
+
+	var cases = []struct {
+		password, reason string
+	}{
+		{"new.user is my passphrase", "Not allowed by the password policy. Don't include your email address."},
+		{"I work for ACME corporation", `Not allowed by the password policy. Don't include "acme".`},
+	}
+	for _, c := range cases {
+		rec := env.register(t, "new.user@example.com", c.password)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%q got: %d, want: %d", c.password, rec.Code, http.StatusBadRequest)
+		}
+		var prob problem.Problem
+		err := json.NewDecoder(rec.Body).Decode(&prob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(prob.InvalidParams) != 1 || prob.InvalidParams[0].Reason != c.reason {
+			t.Errorf("%q got: %+v, want: %s", c.password, prob.InvalidParams, c.reason)
+		}
+	}
+
+	rec := env.register(t, "new.user@example.com", "correct horse battery staple")
+	if rec.Code != http.StatusCreated {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusCreated)
+	}
+}
@@ -0,0 +1,191 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/authn"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const (
+	rememberCookieName   = "goidp_remember"
+	defaultRememberMeTTL = 30 * 24 * time.Hour
+)
+
+func (p *Provider) rememberMeTTL() time.Duration {
+	if p.RememberMeTTL > 0 {
+		return p.RememberMeTTL
+	}
+
+	return defaultRememberMeTTL
+}
+
+func hashRememberToken(token string) string {
+	var sum [32]byte = sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// remember starts a new persistent login series for session.
+func (p *Provider) remember(w http.ResponseWriter, r *http.Request, session store.Session) error {
+	series, err := randomToken(16)
+	if err != nil {
+		return err
+	}
+	token, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+
+	var expiresAt time.Time = p.now().Add(p.rememberMeTTL())
+	err = p.RememberTokens.CreateRememberToken(r.Context(), store.RememberToken{
+		Series:    series,
+		TokenHash: hashRememberToken(token),
+		UserID:    session.UserID,
+		AuthTime:  session.AuthTime,
+		AMR:       session.AMR,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	setRememberCookie(w, series, token, expiresAt)
+
+	return nil
+}
+
+// session returns the current session, falling back to a remember-me token
+// when the browser session has gone, e.g. after a restart. Using the token
+// rotates it and starts a fresh browser session for the same login.
+func (p *Provider) session(w http.ResponseWriter, r *http.Request) (session store.Session, ok bool) {
+	session, ok = p.currentSession(r.Context(), r)
+	if ok {
+		if p.sessionCookieStale(r) {
+			p.setSessionCookie(w, p.accountSessions(r.Context(), r))
+		}
+		return session, true
+	}
+	if p.RememberTokens == nil {
+		return store.Session{}, false
+	}
+
+	cookie, err := r.Cookie(rememberCookieName)
+	if err != nil {
+		return store.Session{}, false
+	}
+	series, token, found := strings.Cut(cookie.Value, ":")
+	if !found {
+		clearCookie(w, rememberCookieName)
+		return store.Session{}, false
+	}
+
+	remembered, err := p.RememberTokens.GetRememberToken(r.Context(), series)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			slog.Error("Cannot load remember-me token.", "err", err)
+		}
+		clearCookie(w, rememberCookieName)
+		return store.Session{}, false
+	}
+
+	var now time.Time = p.now()
+	var presented string = hashRememberToken(token)
+	if !authn.SecretsEqual(presented, remembered.TokenHash) {
+		// A valid series with a stale token means the cookie was copied and
+		// used elsewhere, so neither copy can be trusted anymore.
+		slog.Warn("Remember-me token reuse detected, revoking series.", "user_id", remembered.UserID)
+		err = p.RememberTokens.DeleteRememberSeries(r.Context(), series)
+		if err != nil {
+			slog.Error("Cannot revoke remember-me series.", "err", err)
+		}
+		clearCookie(w, rememberCookieName)
+		return store.Session{}, false
+	}
+	if !now.Before(remembered.ExpiresAt) {
+		p.RememberTokens.DeleteRememberSeries(r.Context(), series)
+		clearCookie(w, rememberCookieName)
+		return store.Session{}, false
+	}
+
+	// A token from before the user needed a second factor, or from a login
+	// without one, mustn't stand in for it.
+	if !slices.Contains(remembered.AMR, "mfa") {
+		user, err := p.Users.GetUserByID(r.Context(), remembered.UserID)
+		if err != nil {
+			slog.Error("Cannot load remembered user.", "user_id", remembered.UserID, "err", err)
+			return store.Session{}, false
+		}
+		required, _, err := p.mfaRequired(r.Context(), user)
+		if err != nil {
+			slog.Error("Cannot load MFA enrollment.", "user_id", user.ID, "err", err)
+			return store.Session{}, false
+		}
+		if required {
+			slog.Info("Refused remember-me token without the second factor now required.", "user_id", user.ID)
+			err = p.RememberTokens.DeleteRememberSeries(r.Context(), series)
+			if err != nil {
+				slog.Error("Cannot revoke remember-me series.", "err", err)
+			}
+			clearCookie(w, rememberCookieName)
+			return store.Session{}, false
+		}
+	}
+
+	next, err := randomToken(32)
+	if err != nil {
+		slog.Error("Cannot generate remember-me token.", "err", err)
+		return store.Session{}, false
+	}
+	var expiresAt time.Time = now.Add(p.rememberMeTTL())
+	err = p.RememberTokens.RotateRememberToken(r.Context(), series, remembered.TokenHash, hashRememberToken(next), expiresAt)
+	if err != nil {
+		slog.Error("Cannot rotate remember-me token.", "err", err)
+		return store.Session{}, false
+	}
+	setRememberCookie(w, series, next, expiresAt)
+
+	err = p.makeRoom(r.Context(), remembered.UserID, func() (err error) {
+		session, err = p.startSession(w, r, remembered.UserID, remembered.AuthTime, remembered.AMR)
+		return err
+	})
+	if errors.Is(err, ErrSessionLimit) {
+		slog.Info("Refused remember-me login over the per-user session limit.", "user_id", remembered.UserID)
+		return store.Session{}, false
+	}
+	if err != nil {
+		slog.Error("Cannot create session.", "err", err)
+		return store.Session{}, false
+	}
+
+	return session, true
+}
+
+func setRememberCookie(w http.ResponseWriter, series, token string, expiresAt time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     rememberCookieName,
+		Value:    series + ":" + token,
+		Path:     "/",
+		Expires:  expiresAt,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
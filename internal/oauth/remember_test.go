@@ -0,0 +1,131 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+func (env *testEnv) login(t *testing.T, extra url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+
+	form := url.Values{
+		"email":     {testEmail},
+		"password":  {testPassword},
+		"return_to": {authorizeURL(nil)},
+	}
+	for k, v := range extra {
+		form[k] = v
+	}
+
+	r := postForm("/login", form)
+
+	return env.do(r)
+}
+
+func responseCookie(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+
+	return nil
+}
+
+func (env *testEnv) authorizeWith(t *testing.T, cookie *http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(nil), nil)
+	r.AddCookie(cookie)
+
+	return env.do(r)
+}
+
+func TestLoginWithoutRememberMe(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.RememberTokens = store.NewMemoryRememberTokenStore()
+
+	rec := env.login(t, nil)
+	session := responseCookie(rec, "goidp_session")
+	if session == nil || !session.Expires.IsZero() || session.MaxAge != 0 {
+		t.Errorf("got: %v, want: a browser session cookie", session)
+	}
+	if c := responseCookie(rec, "goidp_remember"); c != nil {
+		t.Errorf("got: %v, want: no remember-me cookie", c)
+	}
+}
+
+func TestRememberMe(t *testing.T) {
+	env := newTestEnv(t)
+	tokens := store.NewMemoryRememberTokenStore()
+	env.provider.RememberTokens = tokens
+
+	remember := responseCookie(env.login(t, url.Values{"remember_me": {"1"}}), "goidp_remember")
+	if remember == nil {
+		t.Fatal("got: no cookie, want: a remember-me cookie")
+	}
+	if !remember.Expires.After(env.now.Add(29 * 24 * time.Hour)) {
+		t.Errorf("got: %v, want: a long-lived cookie", remember.Expires)
+	}
+
+	series, raw, _ := strings.Cut(remember.Value, ":")
+	stored, err := tokens.GetRememberToken(context.Background(), series)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.TokenHash == raw || stored.UserID != env.user.ID {
+		t.Errorf("got: %+v, want: a hashed token for the user", stored)
+	}
+
+	// With only the remember-me cookie, e.g. after a browser restart, the
+	// user is still logged in and the token is rotated.
+	compared := watchSecretsEqual(t)
+	rec := env.authorizeWith(t, remember)
+	if !compared(stored.TokenHash, stored.TokenHash) {
+		t.Error("got: no comparison, want: the token hash compared with SecretsEqual")
+	}
+	if params := redirectParams(t, rec); params.Get("code") == "" {
+		t.Errorf("got: %v, want: a code", params)
+	}
+	rotated := responseCookie(rec, "goidp_remember")
+	if rotated == nil || rotated.Value == remember.Value || !strings.HasPrefix(rotated.Value, series+":") {
+		t.Fatalf("got: %v, want: a rotated token in the same series", rotated)
+	}
+	if responseCookie(rec, "goidp_session") == nil {
+		t.Errorf("got: no session cookie, want: a new session")
+	}
+}
+
+func TestRememberMeTheftRevokesSeries(t *testing.T) {
+	env := newTestEnv(t)
+	tokens := store.NewMemoryRememberTokenStore()
+	env.provider.RememberTokens = tokens
+
+	stolen := responseCookie(env.login(t, url.Values{"remember_me": {"1"}}), "goidp_remember")
+	rotated := responseCookie(env.authorizeWith(t, stolen), "goidp_remember")
+
+	// Replaying the old token must not log in, and must revoke the series so
+	// the legitimate, rotated token stops working as well.
+	rec := env.authorizeWith(t, stolen)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `action="/login"`) {
+		t.Errorf("got: %d, want: the login form", rec.Code)
+	}
+
+	series, _, _ := strings.Cut(stolen.Value, ":")
+	_, err := tokens.GetRememberToken(context.Background(), series)
+	if err != store.ErrNotFound {
+		t.Errorf("got: %v, want: %v", err, store.ErrNotFound)
+	}
+
+	rec = env.authorizeWith(t, rotated)
+	if rec.Code != http.StatusOK {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusOK)
+	}
+}
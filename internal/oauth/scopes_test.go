@@ -0,0 +1,209 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/oauth"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+var challengePattern = regexp.MustCompile(`name="challenge" value="([^"]+)"`)
+
+func TestScopeRegistry(t *testing.T) {
+	registry := oauth.NewScopeRegistry(
+		oauth.Scope{Name: "openid", DisplayName: "OpenID", Description: "Sign you in"},
+		oauth.Scope{Name: "email", DisplayName: "Email", Description: "Access your email address"},
+	)
+
+	unknown := registry.Unknown([]string{"openid", "admin", "email", "admin"})
+	if len(unknown) != 1 || unknown[0] != "admin" {
+		t.Errorf("got: %v, want: [admin]", unknown)
+	}
+
+	described := registry.Describe([]string{"email", "openid"})
+	if len(described) != 2 || described[0].Description != "Access your email address" {
+		t.Errorf("got: %v, want: email then openid with descriptions", described)
+	}
+}
+
+func TestAuthorizeRejectsUnknownScope(t *testing.T) {
+	env := newTestEnv(t)
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{"scope": {"openid admin"}}), nil)
+	r.AddCookie(env.withSession(t))
+
+	params := redirectParams(t, env.do(r))
+	if params.Get("error") != "invalid_scope" {
+		t.Errorf("got: %s, want: %s", params.Get("error"), "invalid_scope")
+	}
+}
+
+func (env *testEnv) consent(t *testing.T, cookie *http.Cookie, action string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{"scope": {"openid email"}}), nil)
+	r.AddCookie(cookie)
+
+	rec := env.do(r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d, want: %d", rec.Code, http.StatusOK)
+	}
+	if !strings.Contains(rec.Body.String(), "Access your email address") {
+		t.Errorf("got: %s, want: the email scope description", rec.Body.String())
+	}
+	match := challengePattern.FindStringSubmatch(rec.Body.String())
+	if match == nil {
+		t.Fatalf("got: %s, want: a consent challenge", rec.Body.String())
+	}
+
+	form := url.Values{"challenge": {match[1]}, "action": {action}}
+	r = postForm("/consent", form)
+	r.AddCookie(cookie)
+
+	return env.do(r)
+}
+
+func TestConsentApprove(t *testing.T) {
+	env := newTestEnv(t)
+	cookie := env.withSession(t)
+
+	params := redirectParams(t, env.consent(t, cookie, "approve"))
+	if params.Get("code") == "" {
+		t.Errorf("got: %v, want: a code", params)
+	}
+
+	// The approval is remembered so the next request goes straight through.
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{"scope": {"openid email"}}), nil)
+	r.AddCookie(cookie)
+	params = redirectParams(t, env.do(r))
+	if params.Get("code") == "" {
+		t.Errorf("got: %v, want: a code", params)
+	}
+}
+
+func TestConsentDeny(t *testing.T) {
+	env := newTestEnv(t)
+
+	params := redirectParams(t, env.consent(t, env.withSession(t), "deny"))
+	if params.Get("error") != "access_denied" {
+		t.Errorf("got: %s, want: %s", params.Get("error"), "access_denied")
+	}
+}
+
+func TestConfigureScopes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scopes.json")
+	err := os.WriteFile(path, []byte(`[{"name":"openid","display_name":"OpenID","description":"Sign you in"},{"name":"orders","display_name":"Orders","description":"View your orders"}]`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SCOPES_FILE", path)
+
+	registry, err := oauth.ConfigureScopes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registry["orders"].Description != "View your orders" {
+		t.Errorf("got: %v, want: the orders scope", registry)
+	}
+	if unknown := registry.Unknown([]string{"email"}); len(unknown) != 1 {
+		t.Errorf("got: %v, want: [email]", unknown)
+	}
+}
+
+func TestScopesNormalized(t *testing.T) {
+	var requested = []string{
+		"openid email profile",
+		"profile openid email",
+		"email profile email openid  profile",
+	}
+
+	for _, scope := range requested {
+		env := newTestEnv(t)
+		env.withTokens(t)
+		err := env.provider.Consents.SaveConsent(context.Background(), store.Consent{
+			UserID:   env.user.ID,
+			ClientID: testClientID,
+			Scopes:   []string{"profile", "openid", "email"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{"scope": {scope}}), nil)
+		r.AddCookie(env.withSession(t))
+		form := url.Values{
+			"grant_type":   {"authorization_code"},
+			"code":         {redirectParams(t, env.do(r)).Get("code")},
+			"redirect_uri": {testRedirectURI},
+		}
+
+		resp := decodeTokenResult(t, env.exchange(t, basicAuth(testClientID, testClientSecret), form))
+		if resp.Scope != "openid email profile" {
+			t.Errorf("%q got: %q, want: %q", scope, resp.Scope, "openid email profile")
+		}
+	}
+}
+
+func TestScopePolicy(t *testing.T) {
+	var cases = []struct {
+		requested, want string
+	}{
+		{"", "openid profile"},
+		{"email", "openid email"},
+		{"openid profile", "openid profile"},
+	}
+
+	for _, c := range cases {
+		env := newTestEnv(t)
+		env.withTokens(t)
+		env.provider.ScopePolicy = oauth.ScopePolicy{Default: []string{"profile"}, Mandatory: []string{"openid"}}
+		err := env.provider.Consents.SaveConsent(context.Background(), store.Consent{
+			UserID:   env.user.ID,
+			ClientID: testClientID,
+			Scopes:   []string{"openid", "email", "profile"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{"scope": {c.requested}}), nil)
+		r.AddCookie(env.withSession(t))
+		form := url.Values{
+			"grant_type":   {"authorization_code"},
+			"code":         {redirectParams(t, env.do(r)).Get("code")},
+			"redirect_uri": {testRedirectURI},
+		}
+
+		resp := decodeTokenResult(t, env.exchange(t, basicAuth(testClientID, testClientSecret), form))
+		if resp.Scope != c.want {
+			t.Errorf("%q got: %q, want: %q", c.requested, resp.Scope, c.want)
+		}
+	}
+}
+
+func TestConfigureScopePolicy(t *testing.T) {
+	t.Setenv("DEFAULT_SCOPES", "openid profile")
+	t.Setenv("MANDATORY_SCOPES", "openid")
+
+	policy, err := oauth.ConfigureScopePolicy(oauth.DefaultScopeRegistry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policy.Default) != 2 || len(policy.Mandatory) != 1 {
+		t.Errorf("got: %+v, want: two default and one mandatory scope", policy)
+	}
+
+	t.Setenv("MANDATORY_SCOPES", "openid orders")
+	_, err = oauth.ConfigureScopePolicy(oauth.DefaultScopeRegistry)
+	if err == nil {
+		t.Error("got: nil, want: an error for the unsupported orders scope")
+	}
+}
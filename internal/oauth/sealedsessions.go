@@ -0,0 +1,218 @@
+package oauth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const (
+	// sealedSessionSeparator separates a sealed session's key id from its
+	// ciphertext. It isn't in the base64url alphabet, sessionIDSeparator or
+	// signatureSeparator.
+	sealedSessionSeparator = "*"
+	// maxSealedSessionLength bounds a sealed session so that maxAccounts of
+	// them, signed, still fit the 4096 bytes browsers keep per cookie.
+	maxSealedSessionLength = 900
+	sessionKeyLength       = 32
+)
+
+var (
+	ErrSealedSessionTooLarge = errors.New("sealed session too large")
+	errSealedSessionInvalid  = errors.New("sealed session invalid")
+)
+
+// SessionKey is an AES-256 key sessions are sealed with. The id is written
+// into every sealed session so the right key can be found after a rotation.
+type SessionKey struct {
+	ID  string
+	Key []byte
+}
+
+// SessionKeys make sessions stateless: instead of an id looked up in the
+// session store, the session cookie carries the session itself, sealed with
+// AES-GCM, which saves a store read on every request. New sessions are
+// sealed with Current and ones sealed with any of Previous are still
+// opened, then resealed with Current, as CookieKeys rotate. The zero
+// SessionKeys keeps sessions in the store.
+//
+// A stateless session can't be revoked before it expires: signing out
+// elsewhere, changing the password and SessionLimit don't reach it. Sessions
+// that were in the store when stateless sessions were turned on stay valid
+// until they expire.
+type SessionKeys struct {
+	Current  SessionKey
+	Previous []SessionKey
+}
+
+// ConfigureSessionKeys reads the current key from the SESSION_KEY secret
+// and the keys still accepted from PREVIOUS_SESSION_KEYS, both as id:key
+// with the key base64url encoded and the previous ones comma separated.
+func ConfigureSessionKeys() (keys SessionKeys, err error) {
+	previous, err := lookupSecret("PREVIOUS_SESSION_KEYS")
+	if err != nil {
+		return SessionKeys{}, err
+	}
+	for _, v := range strings.Split(previous, ",") {
+		if v == "" {
+			continue
+		}
+		key, err := parseSessionKey(v)
+		if err != nil {
+			return SessionKeys{}, fmt.Errorf("PREVIOUS_SESSION_KEYS misconfigured: %w", err)
+		}
+		keys.Previous = append(keys.Previous, key)
+	}
+
+	v, err := lookupSecret("SESSION_KEY")
+	if err != nil {
+		return SessionKeys{}, err
+	}
+	if v == "" {
+		if len(keys.Previous) > 0 {
+			return SessionKeys{}, errors.New("PREVIOUS_SESSION_KEYS is set without SESSION_KEY")
+		}
+		return SessionKeys{}, nil
+	}
+	keys.Current, err = parseSessionKey(v)
+	if err != nil {
+		return SessionKeys{}, fmt.Errorf("SESSION_KEY misconfigured: %w", err)
+	}
+
+	return keys, nil
+}
+
+func parseSessionKey(v string) (SessionKey, error) {
+	id, encoded, ok := strings.Cut(v, ":")
+	key, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if !ok || id == "" || err != nil || len(key) != sessionKeyLength {
+		return SessionKey{}, fmt.Errorf("expected id:key with a base64url key of %d bytes", sessionKeyLength)
+	}
+	if strings.ContainsAny(id, sealedSessionSeparator+signatureSeparator+sessionIDSeparator+",") {
+		return SessionKey{}, fmt.Errorf("session key id %q contains a reserved character", id)
+	}
+
+	return SessionKey{ID: id, Key: key}, nil
+}
+
+func (k SessionKeys) enabled() bool {
+	return len(k.Current.Key) > 0
+}
+
+func (k SessionKey) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(k.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// sealedSession is what a sealed session carries. Times are Unix seconds.
+type sealedSession struct {
+	UserID    int64    `json:"sub"`
+	AuthTime  int64    `json:"auth_time"`
+	AMR       []string `json:"amr,omitempty"`
+	CreatedAt int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+// seal returns session sealed with the current key as id*ciphertext, the
+// ciphertext being the base64url nonce and AES-GCM output. The key id is
+// authenticated as additional data, so it can't be swapped.
+func (k SessionKeys) seal(session store.Session) (string, error) {
+	plaintext, err := json.Marshal(sealedSession{
+		UserID:    session.UserID,
+		AuthTime:  session.AuthTime.Unix(),
+		AMR:       session.AMR,
+		CreatedAt: session.CreatedAt.Unix(),
+		ExpiresAt: session.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := k.Current.aead()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	sealed := k.Current.ID + sealedSessionSeparator +
+		base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, []byte(k.Current.ID)))
+	if len(sealed) > maxSealedSessionLength {
+		return "", fmt.Errorf("%w: %d bytes", ErrSealedSessionTooLarge, len(sealed))
+	}
+
+	return sealed, nil
+}
+
+// open returns the session sealed in sealed, whose ID is sealed itself.
+// stale reports that it was sealed with a previous key.
+func (k SessionKeys) open(sealed string) (session store.Session, stale bool, err error) {
+	if len(sealed) > maxSealedSessionLength {
+		return store.Session{}, false, errSealedSessionInvalid
+	}
+	id, encoded, ok := strings.Cut(sealed, sealedSessionSeparator)
+	if !ok {
+		return store.Session{}, false, errSealedSessionInvalid
+	}
+	ciphertext, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return store.Session{}, false, errSealedSessionInvalid
+	}
+
+	for i, key := range append([]SessionKey{k.Current}, k.Previous...) {
+		if key.ID != id {
+			continue
+		}
+
+		aead, err := key.aead()
+		if err != nil {
+			return store.Session{}, false, err
+		}
+		if len(ciphertext) < aead.NonceSize() {
+			return store.Session{}, false, errSealedSessionInvalid
+		}
+		nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+		plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(key.ID))
+		if err != nil {
+			return store.Session{}, false, errSealedSessionInvalid
+		}
+
+		var payload sealedSession
+		err = json.Unmarshal(plaintext, &payload)
+		if err != nil {
+			return store.Session{}, false, errSealedSessionInvalid
+		}
+
+		return store.Session{
+			ID:        sealed,
+			UserID:    payload.UserID,
+			AuthTime:  time.Unix(payload.AuthTime, 0),
+			AMR:       payload.AMR,
+			CreatedAt: time.Unix(payload.CreatedAt, 0),
+			ExpiresAt: time.Unix(payload.ExpiresAt, 0),
+		}, i > 0, nil
+	}
+
+	return store.Session{}, false, errSealedSessionInvalid
+}
+
+// isSealedSession reports whether id is a sealed session rather than the id
+// of one in the store.
+func isSealedSession(id string) bool {
+	return strings.Contains(id, sealedSessionSeparator)
+}
@@ -0,0 +1,115 @@
+package oauth_test
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/oauth"
+)
+
+var (
+	oldSessionKey = oauth.SessionKey{ID: "s1", Key: []byte("first-key-first-key-first-key-32")}
+	newSessionKey = oauth.SessionKey{ID: "s2", Key: []byte("second-key-second-key-second-k32")}
+)
+
+// sealedLogin logs in with sessions sealed by keys and returns the session
+// cookie.
+func (env *testEnv) sealedLogin(t *testing.T, keys oauth.SessionKeys) *http.Cookie {
+	t.Helper()
+
+	env.provider.SessionKeys = keys
+	csrf, token := env.csrfFromPage(t)
+	session := responseCookie(env.signedLogin(t, csrf, token), "goidp_session")
+	if session == nil || !strings.HasPrefix(session.Value, keys.Current.ID+"*") {
+		t.Fatalf("got: %v, want: a session sealed with %s", session, keys.Current.ID)
+	}
+
+	return session
+}
+
+func TestSealedSessionRoundTrip(t *testing.T) {
+	env := newTestEnv(t)
+	session := env.sealedLogin(t, oauth.SessionKeys{Current: oldSessionKey})
+
+	n, err := env.sessions.CountUserSessions(context.Background(), env.user.ID, env.now)
+	if err != nil || n != 0 {
+		t.Errorf("got: %d, %v, want: no session in the store", n, err)
+	}
+	if strings.Contains(session.Value, testEmail) {
+		t.Errorf("got: %s, want: an opaque cookie", session.Value)
+	}
+
+	rec := env.authorizeWith(t, session)
+	if code := redirectParams(t, rec).Get("code"); code == "" {
+		t.Fatalf("got: %d %s, want: a code for the sealed session", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestSealedSessionTampered(t *testing.T) {
+	env := newTestEnv(t)
+	session := env.sealedLogin(t, oauth.SessionKeys{Current: oldSessionKey})
+
+	id, encoded, _ := strings.Cut(session.Value, "*")
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw[len(raw)/2] ^= 1
+	tampered := &http.Cookie{Name: session.Name, Value: id + "*" + base64.RawURLEncoding.EncodeToString(raw)}
+	if rec := env.authorizeWith(t, tampered); rec.Code != http.StatusOK {
+		t.Errorf("tampered got: %d, want: the login page", rec.Code)
+	}
+
+	// Sealed with another key under the same id.
+	env.provider.SessionKeys = oauth.SessionKeys{Current: oauth.SessionKey{ID: oldSessionKey.ID, Key: newSessionKey.Key}}
+	if rec := env.authorizeWith(t, session); rec.Code != http.StatusOK {
+		t.Errorf("wrong key got: %d, want: the login page", rec.Code)
+	}
+}
+
+func TestSealedSessionKeyRotation(t *testing.T) {
+	env := newTestEnv(t)
+	session := env.sealedLogin(t, oauth.SessionKeys{Current: oldSessionKey})
+
+	env.provider.SessionKeys = oauth.SessionKeys{Current: newSessionKey, Previous: []oauth.SessionKey{oldSessionKey}}
+	rec := env.authorizeWith(t, session)
+	if code := redirectParams(t, rec).Get("code"); code == "" {
+		t.Fatalf("got: %s, want: a code for the session sealed with the previous key", rec.Header().Get("Location"))
+	}
+	resealed := responseCookie(rec, "goidp_session")
+	if resealed == nil || !strings.HasPrefix(resealed.Value, "s2*") {
+		t.Fatalf("got: %v, want: the session resealed with s2", resealed)
+	}
+
+	env.provider.SessionKeys = oauth.SessionKeys{Current: newSessionKey}
+	if rec := env.authorizeWith(t, session); rec.Code != http.StatusOK {
+		t.Errorf("got: %d, want: the login page once s1 is retired", rec.Code)
+	}
+	if rec := env.authorizeWith(t, resealed); rec.Code != http.StatusFound {
+		t.Errorf("got: %d, want: %d for the resealed session", rec.Code, http.StatusFound)
+	}
+}
+
+func TestConfigureSessionKeys(t *testing.T) {
+	encode := func(key oauth.SessionKey) string {
+		return key.ID + ":" + base64.RawURLEncoding.EncodeToString(key.Key)
+	}
+	t.Setenv("SESSION_KEY", encode(newSessionKey))
+	t.Setenv("PREVIOUS_SESSION_KEYS", encode(oldSessionKey))
+
+	keys, err := oauth.ConfigureSessionKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys.Current.ID != "s2" || len(keys.Previous) != 1 || string(keys.Previous[0].Key) != string(oldSessionKey.Key) {
+		t.Errorf("got: %+v, want: s2 current and s1 previous", keys)
+	}
+
+	t.Setenv("SESSION_KEY", "s3:"+base64.RawURLEncoding.EncodeToString([]byte("too short")))
+	if _, err := oauth.ConfigureSessionKeys(); err == nil {
+		t.Error("got: nil, want: an error for a short key")
+	}
+}
@@ -0,0 +1,125 @@
+package oauth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const minSessionIDKeyLength = 32
+
+// SessionIDKeys key the HMAC-SHA-256 hash that session ids are stored
+// under in Sessions, so the contents of a leaked session store can't be
+// presented as session cookies. New sessions are stored under the hash
+// with Current; sessions found under the hash with any of Previous are
+// moved to the Current one, so keys can be rotated without signing anyone
+// out. The zero SessionIDKeys stores the ids themselves.
+//
+// Turning hashing on for the first time invalidates the sessions stored
+// under their plain ids.
+type SessionIDKeys struct {
+	Current  []byte
+	Previous [][]byte
+}
+
+// ConfigureSessionIDKeys reads the current key from the SESSION_ID_KEY
+// secret and the keys still accepted from PREVIOUS_SESSION_ID_KEYS, comma
+// separated. Each must be at least 32 bytes.
+func ConfigureSessionIDKeys() (keys SessionIDKeys, err error) {
+	previous, err := lookupSecret("PREVIOUS_SESSION_ID_KEYS")
+	if err != nil {
+		return SessionIDKeys{}, err
+	}
+	for _, v := range strings.Split(previous, ",") {
+		if v == "" {
+			continue
+		}
+		if len(v) < minSessionIDKeyLength {
+			return SessionIDKeys{}, fmt.Errorf("PREVIOUS_SESSION_ID_KEYS misconfigured: keys must be at least %d bytes", minSessionIDKeyLength)
+		}
+		keys.Previous = append(keys.Previous, []byte(v))
+	}
+
+	v, err := lookupSecret("SESSION_ID_KEY")
+	if err != nil {
+		return SessionIDKeys{}, err
+	}
+	if v == "" {
+		if len(keys.Previous) > 0 {
+			return SessionIDKeys{}, errors.New("PREVIOUS_SESSION_ID_KEYS is set without SESSION_ID_KEY")
+		}
+		return SessionIDKeys{}, nil
+	}
+	if len(v) < minSessionIDKeyLength {
+		return SessionIDKeys{}, fmt.Errorf("SESSION_ID_KEY misconfigured: must be at least %d bytes", minSessionIDKeyLength)
+	}
+	keys.Current = []byte(v)
+
+	return keys, nil
+}
+
+func (k SessionIDKeys) enabled() bool {
+	return len(k.Current) > 0
+}
+
+// hash returns what the session id is stored under: its hash with Current,
+// or id itself when hashing is off.
+func (k SessionIDKeys) hash(id string) string {
+	if !k.enabled() {
+		return id
+	}
+
+	return hashSessionID(k.Current, id)
+}
+
+func hashSessionID(key []byte, id string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// getStoredSession looks the session with id up by its hash, moving it
+// over to the Current key if it was found under a previous one. The
+// session returned carries id, not the hash.
+func (p *Provider) getStoredSession(ctx context.Context, id string) (store.Session, error) {
+	session, err := p.Sessions.GetSession(ctx, p.SessionIDKeys.hash(id))
+	if err == nil {
+		session.ID = id
+	}
+	if !errors.Is(err, store.ErrNotFound) || !p.SessionIDKeys.enabled() {
+		return session, err
+	}
+
+	for _, key := range p.SessionIDKeys.Previous {
+		var old string = hashSessionID(key, id)
+		session, err = p.Sessions.GetSession(ctx, old)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return store.Session{}, err
+		}
+
+		session.ID = p.SessionIDKeys.hash(id)
+		err = p.Sessions.CreateSession(ctx, session)
+		if err != nil && !errors.Is(err, store.ErrConflict) {
+			return store.Session{}, err
+		}
+		err = p.Sessions.DeleteSession(ctx, old)
+		if err != nil {
+			return store.Session{}, err
+		}
+
+		session.ID = id
+		return session, nil
+	}
+
+	return store.Session{}, store.ErrNotFound
+}
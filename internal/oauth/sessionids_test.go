@@ -0,0 +1,87 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/oauth"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+var (
+	oldSessionIDKey = []byte(strings.Repeat("o", 32))
+	newSessionIDKey = []byte(strings.Repeat("n", 32))
+)
+
+func (env *testEnv) authorizesWith(t *testing.T, cookie *http.Cookie) bool {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, authorizeURL(nil), nil)
+	r.AddCookie(cookie)
+	rec := env.do(r)
+
+	return rec.Code == http.StatusFound && redirectParams(t, rec).Get("code") != ""
+}
+
+func TestSessionIDsHashed(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.SessionIDKeys = oauth.SessionIDKeys{Current: newSessionIDKey}
+
+	cookie := responseCookie(env.login(t, nil), "goidp_session")
+	if cookie == nil {
+		t.Fatal("got: no session cookie, want: one")
+	}
+	_, err := env.sessions.GetSession(context.Background(), cookie.Value)
+	if err != store.ErrNotFound {
+		t.Errorf("got: %v, want: the session not stored under its id", err)
+	}
+	sessions, err := env.sessions.ListUserSessions(context.Background(), env.user.ID, env.now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].ID == cookie.Value {
+		t.Errorf("got: %+v, want: one session stored under a hash", sessions)
+	}
+
+	if !env.authorizesWith(t, cookie) {
+		t.Error("got: no code, want: the session found by its id")
+	}
+}
+
+func TestSessionIDKeyRotation(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.SessionIDKeys = oauth.SessionIDKeys{Current: oldSessionIDKey}
+	cookie := responseCookie(env.login(t, nil), "goidp_session")
+
+	env.provider.SessionIDKeys = oauth.SessionIDKeys{Current: newSessionIDKey, Previous: [][]byte{oldSessionIDKey}}
+	if !env.authorizesWith(t, cookie) {
+		t.Fatal("got: no code, want: the session under the previous key still valid")
+	}
+
+	// The session has moved to the new key, so the old one can be retired.
+	env.provider.SessionIDKeys = oauth.SessionIDKeys{Current: newSessionIDKey}
+	if !env.authorizesWith(t, cookie) {
+		t.Error("got: no code, want: the session moved to the current key")
+	}
+}
+
+func TestConfigureSessionIDKeys(t *testing.T) {
+	t.Setenv("SESSION_ID_KEY", string(newSessionIDKey))
+	t.Setenv("PREVIOUS_SESSION_ID_KEYS", string(oldSessionIDKey))
+
+	keys, err := oauth.ConfigureSessionIDKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(keys.Current) != string(newSessionIDKey) || len(keys.Previous) != 1 {
+		t.Errorf("got: %+v, want: the configured keys", keys)
+	}
+
+	t.Setenv("SESSION_ID_KEY", "short")
+	if _, err := oauth.ConfigureSessionIDKeys(); err == nil {
+		t.Error("got: nil, want: an error for a short key")
+	}
+}
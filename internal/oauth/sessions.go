@@ -0,0 +1,94 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// SessionLimitMode says what happens to a login that would take a user past
+// SessionLimit.Max.
+type SessionLimitMode int
+
+const (
+	// SessionLimitReject refuses the login.
+	SessionLimitReject SessionLimitMode = iota
+	// SessionLimitEvict ends the user's oldest sessions to make room.
+	SessionLimitEvict
+)
+
+var ErrSessionLimit = errors.New("too many active sessions")
+
+// SessionLimit caps the number of concurrent sessions per user. A zero Max
+// means no limit.
+type SessionLimit struct {
+	Max  int
+	Mode SessionLimitMode
+}
+
+// ConfigureSessionLimit reads MAX_SESSIONS_PER_USER and SESSION_LIMIT_MODE,
+// which is "reject" (the default) or "evict".
+func ConfigureSessionLimit() (limit SessionLimit, err error) {
+	if v := os.Getenv("MAX_SESSIONS_PER_USER"); v != "" {
+		limit.Max, err = strconv.Atoi(v)
+		if err != nil || limit.Max < 0 {
+			return SessionLimit{}, fmt.Errorf("max sessions per user misconfigured: %q", v)
+		}
+	}
+
+	switch v := os.Getenv("SESSION_LIMIT_MODE"); v {
+	case "", "reject":
+		limit.Mode = SessionLimitReject
+	case "evict":
+		limit.Mode = SessionLimitEvict
+	default:
+		return SessionLimit{}, fmt.Errorf("session limit mode misconfigured: %q", v)
+	}
+
+	return limit, nil
+}
+
+// sessionLimiter makes checking the limit and creating the session one step.
+// The session stores have no transactions of their own, so concurrent logins
+// of one user are serialized here instead.
+type sessionLimiter struct {
+	mu sync.Mutex
+}
+
+// makeRoom ensures the user can have one more session under the limit,
+// evicting or failing with ErrSessionLimit depending on the mode, then runs
+// create while still holding the limiter.
+func (p *Provider) makeRoom(ctx context.Context, userID int64, create func() error) error {
+	var limit SessionLimit = p.SessionLimit
+	if limit.Max <= 0 {
+		return create()
+	}
+
+	p.sessionLimiter.mu.Lock()
+	defer p.sessionLimiter.mu.Unlock()
+
+	switch limit.Mode {
+	case SessionLimitEvict:
+		evicted, err := p.Sessions.EvictUserSessions(ctx, userID, limit.Max-1, p.now())
+		if err != nil {
+			return err
+		}
+		if len(evicted) > 0 {
+			slog.Info("Evicted sessions over the per-user limit.", "user_id", userID, "count", len(evicted))
+		}
+	default:
+		n, err := p.Sessions.CountUserSessions(ctx, userID, p.now())
+		if err != nil {
+			return err
+		}
+		if n >= limit.Max {
+			return ErrSessionLimit
+		}
+	}
+
+	return create()
+}
@@ -0,0 +1,89 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/oauth"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+func TestSessionLimitReject(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.SessionLimit = oauth.SessionLimit{Max: 2, Mode: oauth.SessionLimitReject}
+	env.withSession(t)
+
+	if rec := env.login(t, nil); rec.Code != http.StatusFound {
+		t.Fatalf("got: %d, want: %d below the cap", rec.Code, http.StatusFound)
+	}
+
+	rec := env.login(t, nil)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("got: %d, want: %d at the cap", rec.Code, http.StatusForbidden)
+	}
+	if c := responseCookie(rec, "goidp_session"); c != nil {
+		t.Errorf("got: %v, want: no session cookie", c)
+	}
+
+	n, err := env.sessions.CountUserSessions(context.Background(), env.user.ID, env.now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("got: %d sessions, want: 2", n)
+	}
+}
+
+func TestSessionLimitEvict(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.SessionLimit = oauth.SessionLimit{Max: 2, Mode: oauth.SessionLimitEvict}
+	oldest := env.withSession(t)
+
+	var newest []string
+	for i := 0; i < 2; i++ {
+		rec := env.login(t, nil)
+		if rec.Code != http.StatusFound {
+			t.Fatalf("got: %d, want: %d", rec.Code, http.StatusFound)
+		}
+		newest = append(newest, responseCookie(rec, "goidp_session").Value)
+		env.now = env.now.Add(1)
+	}
+
+	_, err := env.sessions.GetSession(context.Background(), oldest.Value)
+	if err != store.ErrNotFound {
+		t.Errorf("got: %v, want: the oldest session evicted", err)
+	}
+	for _, id := range newest {
+		_, err = env.sessions.GetSession(context.Background(), id)
+		if err != nil {
+			t.Errorf("got: %v, want: the newer sessions kept", err)
+		}
+	}
+}
+
+func TestSessionLimitRememberMe(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.RememberTokens = store.NewMemoryRememberTokenStore()
+	env.provider.SessionLimit = oauth.SessionLimit{Max: 2, Mode: oauth.SessionLimitEvict}
+	oldest := env.withSession(t)
+
+	remember := responseCookie(env.login(t, url.Values{"remember_me": {"1"}}), "goidp_remember")
+	if remember == nil {
+		t.Fatal("got: no cookie, want: a remember-me cookie")
+	}
+	env.now = env.now.Add(1)
+	if params := redirectParams(t, env.authorizeWith(t, remember)); params.Get("code") == "" {
+		t.Fatalf("got: %v, want: a code", params)
+	}
+
+	_, err := env.sessions.GetSession(context.Background(), oldest.Value)
+	if err != store.ErrNotFound {
+		t.Errorf("got: %v, want: the oldest session evicted", err)
+	}
+	n, err := env.sessions.CountUserSessions(context.Background(), env.user.ID, env.now)
+	if err != nil || n != 2 {
+		t.Errorf("got: %d, %v, want: 2 sessions", n, err)
+	}
+}
@@ -0,0 +1,134 @@
+package oauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+// Subject identifier types, per OIDC Core section 8.
+const (
+	// SubjectPublic gives every client the same sub for a user: their id.
+	SubjectPublic = "public"
+	// SubjectPairwise gives each sector its own sub for a user, so clients
+	// in different sectors can't correlate their users.
+	SubjectPairwise = "pairwise"
+)
+
+const minPairwiseSaltLength = 32
+
+var (
+	ErrUnsupportedSubjectType = errors.New("unsupported subject type")
+	errNoPairwiseSalt         = errors.New("pairwise subjects need a PairwiseSalt")
+)
+
+// Subjects decides the sub users are identified by in ID tokens, at
+// /userinfo and in introspection responses. Clients with pairwise subjects
+// get opaque access tokens, which only introspection can resolve.
+type Subjects struct {
+	// Type applies to clients whose SubjectType is empty. Empty means
+	// public.
+	Type string
+	// PairwiseSalt keys the hash pairwise subjects are derived with. It
+	// must stay secret and never change: a new salt gives every user new
+	// pairwise subjects.
+	PairwiseSalt []byte
+}
+
+// ConfigureSubjects reads SUBJECT_TYPE and the PAIRWISE_SUBJECT_SALT secret,
+// which must be at least 32 bytes if set and is required when SUBJECT_TYPE
+// is pairwise.
+func ConfigureSubjects() (s Subjects, err error) {
+	s.Type = os.Getenv("SUBJECT_TYPE")
+	err = validateSubjectType(s.Type)
+	if err != nil {
+		return Subjects{}, fmt.Errorf("SUBJECT_TYPE misconfigured: %w", err)
+	}
+
+	salt, err := lookupSecret("PAIRWISE_SUBJECT_SALT")
+	if err != nil {
+		return Subjects{}, err
+	}
+	if salt != "" && len(salt) < minPairwiseSaltLength {
+		return Subjects{}, fmt.Errorf("PAIRWISE_SUBJECT_SALT misconfigured: must be at least %d bytes", minPairwiseSaltLength)
+	}
+	if salt == "" && s.Type == SubjectPairwise {
+		return Subjects{}, errors.New("SUBJECT_TYPE is pairwise without PAIRWISE_SUBJECT_SALT")
+	}
+	s.PairwiseSalt = []byte(salt)
+
+	return s, nil
+}
+
+func validateSubjectType(subjectType string) error {
+	switch subjectType {
+	case "", SubjectPublic, SubjectPairwise:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedSubjectType, subjectType)
+	}
+}
+
+// types lists the subject types clients can get, for discovery.
+func (s Subjects) types() []string {
+	if len(s.PairwiseSalt) == 0 && s.Type != SubjectPairwise {
+		return []string{SubjectPublic}
+	}
+
+	return []string{SubjectPublic, SubjectPairwise}
+}
+
+func (s Subjects) pairwise(client store.Client) bool {
+	if client.SubjectType != "" {
+		return client.SubjectType == SubjectPairwise
+	}
+
+	return s.Type == SubjectPairwise
+}
+
+// subject returns the sub client knows the user with userID by.
+func (p *Provider) subject(client store.Client, userID int64) (string, error) {
+	var id string = strconv.FormatInt(userID, 10)
+	if !p.Subjects.pairwise(client) {
+		return id, nil
+	}
+	if len(p.Subjects.PairwiseSalt) == 0 {
+		return "", errNoPairwiseSalt
+	}
+
+	mac := hmac.New(sha256.New, p.Subjects.PairwiseSalt)
+	mac.Write([]byte(sectorIdentifier(client)))
+	mac.Write([]byte{0})
+	mac.Write([]byte(id))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// sectorIdentifier is what client's pairwise subjects are derived from: its
+// SectorIdentifier, else the host all its redirect URIs share, else its id.
+func sectorIdentifier(client store.Client) string {
+	if client.SectorIdentifier != "" {
+		return client.SectorIdentifier
+	}
+
+	var host string
+	for _, uri := range client.RedirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || host != "" && u.Hostname() != host {
+			return client.ID
+		}
+		host = u.Hostname()
+	}
+	if host == "" {
+		return client.ID
+	}
+
+	return host
+}
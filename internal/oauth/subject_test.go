@@ -0,0 +1,127 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/oauth"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const testPairwiseSalt = "0123456789abcdef0123456789abcdef"
+
+// userInfoSub returns the sub /userinfo gives clientID for the test user.
+func (env *testEnv) userInfoSub(t *testing.T, clientID string) string {
+	t.Helper()
+
+	tok, _, err := env.provider.Tokens.IssueAccessToken(strconv.FormatInt(env.user.ID, 10), clientID, nil, []string{"openid"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+	r.Header.Set("Authorization", "Bearer "+tok)
+	rec := env.do(r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusOK)
+	}
+
+	sub, _ := decodeMap(t, rec)["sub"].(string)
+	return sub
+}
+
+// idTokenSub returns the sub of an ID token issued to the test client, and
+// the access token issued with it.
+func (env *testEnv) idTokenSub(t *testing.T) (sub, accessToken string) {
+	t.Helper()
+
+	rec := env.exchange(t, basicAuth(testClientID, testClientSecret), env.codeGrant(t))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusOK)
+	}
+	resp := decodeMap(t, rec)
+	idToken, _ := resp["id_token"].(string)
+	claims, err := env.provider.Tokens.Validate(idToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessToken, _ = resp["access_token"].(string)
+
+	return claims.Subject, accessToken
+}
+
+func TestPairwiseSubjects(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	env.provider.Issuer = "https://idp.example"
+	env.provider.Subjects = oauth.Subjects{Type: oauth.SubjectPairwise, PairwiseSalt: []byte(testPairwiseSalt)}
+	env.provider.AccessTokens = store.NewMemoryAccessTokenStore()
+	err := env.provider.Clients.(*store.MemoryClientStore).PutClient(context.Background(), store.Client{
+		ID:           "other",
+		RedirectURIs: []string{"https://other.example/cb"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub, accessToken := env.idTokenSub(t)
+	if sub == "" || sub == strconv.FormatInt(env.user.ID, 10) {
+		t.Errorf("got: %q, want: a pairwise sub", sub)
+	}
+	// The access token mustn't give the user's id away either.
+	if strings.Contains(accessToken, ".") {
+		t.Errorf("got: %s, want: an opaque access token", accessToken)
+	}
+	if claims := env.introspect(t, accessToken); claims["sub"] != sub {
+		t.Errorf("introspection got: %v, want: sub %q", claims, sub)
+	}
+	for range 2 {
+		if userInfo := env.userInfoSub(t, testClientID); userInfo != sub {
+			t.Errorf("userinfo got: %q, want: the id_token's %q", userInfo, sub)
+		}
+	}
+	if other := env.userInfoSub(t, "other"); other == sub || other == "" {
+		t.Errorf("other client got: %q, want: a sub other than %q", other, sub)
+	}
+}
+
+func TestPairwiseSubjectsPerClient(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	env.provider.Subjects = oauth.Subjects{PairwiseSalt: []byte(testPairwiseSalt)}
+	clients := env.provider.Clients.(*store.MemoryClientStore)
+	for _, c := range []store.Client{
+		{ID: "pairwise", RedirectURIs: []string{"https://a.example/cb"}, SubjectType: oauth.SubjectPairwise},
+		{ID: "same-sector", RedirectURIs: []string{"https://b.example/cb"}, SubjectType: oauth.SubjectPairwise, SectorIdentifier: "a.example"},
+	} {
+		err := clients.PutClient(context.Background(), c)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := env.userInfoSub(t, testClientID); got != strconv.FormatInt(env.user.ID, 10) {
+		t.Errorf("public client got: %q, want: the user id", got)
+	}
+	pairwise := env.userInfoSub(t, "pairwise")
+	if pairwise == strconv.FormatInt(env.user.ID, 10) {
+		t.Errorf("pairwise client got: %q, want: a pairwise sub", pairwise)
+	}
+	if got := env.userInfoSub(t, "same-sector"); got != pairwise {
+		t.Errorf("same sector got: %q, want: %q", got, pairwise)
+	}
+	if got := env.discoveryList(t, "subject_types_supported"); len(got) != 2 {
+		t.Errorf("got: %v, want: public and pairwise", got)
+	}
+}
+
+func TestValidateClientSubjectType(t *testing.T) {
+	client := store.Client{ID: "c", RedirectURIs: []string{testRedirectURI}, SubjectType: "random"}
+	err := oauth.ValidateClient(client, false)
+	if err == nil {
+		t.Error("got: nil, want: an error for an unknown subject type")
+	}
+}
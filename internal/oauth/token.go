@@ -0,0 +1,247 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/ehubscher/goidp/internal/ratelimit"
+	"github.com/ehubscher/goidp/internal/retryafter"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Scope        string `json:"scope,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+type tokenErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// Token serves POST /token.
+func (p *Provider) Token(w http.ResponseWriter, r *http.Request) {
+	if p.GrantMetrics == nil {
+		p.token(w, r)
+		return
+	}
+
+	ow := &outcomeWriter{ResponseWriter: w}
+	clientID := p.token(ow, r)
+	p.recordGrant(clientID, r.PostForm.Get("grant_type"), ow)
+}
+
+// token answers a token request and returns the id of the client, or "" if
+// it wasn't authenticated.
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) (clientID string) {
+	client, ok := p.clientRequest(w, r)
+	if !ok {
+		return ""
+	}
+
+	grantType := r.PostForm.Get("grant_type")
+	if !p.Flows.grantTypeEnabled(grantType) {
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		return client.ID
+	}
+	if !client.AllowsGrant(grantType) {
+		tokenError(w, http.StatusBadRequest, "unauthorized_client", "The client may not use this grant type.")
+		return client.ID
+	}
+
+	switch grantType {
+	case "authorization_code":
+		p.authorizationCodeGrant(w, r, client)
+	case "refresh_token":
+		p.refreshTokenGrant(w, r, client)
+	case "password":
+		p.passwordGrant(w, r, client)
+	default:
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+	}
+
+	return client.ID
+}
+
+// clientRequest parses a form post from a client and authenticates it for
+// the token and introspection endpoints, answering in the OAuth error format
+// when that fails or the client is over its rate limit.
+func (p *Provider) clientRequest(w http.ResponseWriter, r *http.Request) (client store.Client, ok bool) {
+	err := r.ParseForm()
+	if err != nil {
+		tokenError(w, http.StatusBadRequest, "invalid_request", "Malformed request.")
+		return store.Client{}, false
+	}
+
+	client, err = p.authenticateClient(r)
+	if errors.Is(err, ErrInvalidCredentials) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="goidp"`)
+		tokenError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed.")
+		return store.Client{}, false
+	}
+	if err != nil {
+		slog.Error("Cannot authenticate client.", "err", err)
+		tokenServerError(w, err)
+		return store.Client{}, false
+	}
+
+	if p.ClientRateLimit != nil {
+		status := p.ClientRateLimit.Take(client.ID)
+		if p.ClientRateLimit.Headers {
+			ratelimit.SetHeaders(w.Header(), status)
+		}
+		if !status.Allowed {
+			slog.Warn("Client over its rate limit.", "client_id", client.ID, "path", r.URL.Path)
+			retryafter.Set(w.Header(), status.RetryAfter)
+			tokenError(w, http.StatusTooManyRequests, "temporarily_unavailable", "Too many requests from this client.")
+			return store.Client{}, false
+		}
+	}
+
+	return client, true
+}
+
+func (p *Provider) authorizationCodeGrant(w http.ResponseWriter, r *http.Request, client store.Client) {
+	// The binding is worked out before the code is spent, so a request
+	// missing its device_id can be retried.
+	binding, err := p.requestBinding(w, r, client)
+	if err != nil {
+		return
+	}
+
+	code, err := p.RedeemCode(r.Context(), r.PostForm.Get("code"), client.ID, r.PostForm.Get("redirect_uri"))
+	if errors.Is(err, ErrCodeInvalid) || errors.Is(err, ErrCodeExpired) {
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "The authorization code is invalid or expired.")
+		return
+	}
+	if err != nil {
+		slog.Error("Cannot redeem authorization code.", "err", err)
+		tokenServerError(w, err)
+		return
+	}
+	// The code is spent either way, so a verifier can't be guessed at.
+	if !verifyCodeVerifier(r.PostForm.Get("code_verifier"), code) {
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "The code_verifier doesn't match the code_challenge.")
+		return
+	}
+	active, unverified, err := p.activeUser(r.Context(), code.UserID)
+	if err != nil {
+		slog.Error("Cannot load user.", "err", err)
+		tokenServerError(w, err)
+		return
+	}
+	if unverified {
+		tokenError(w, http.StatusBadRequest, "invalid_grant", emailUnverifiedDescription)
+		return
+	}
+	if !active {
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "The authorization code is invalid or expired.")
+		return
+	}
+
+	var scopes []string = normalizeScopes(strings.Fields(code.Scope))
+	var claims string = userInfoClaims(code.Claims)
+	accessToken, expiresIn, err := p.issueAccessToken(r.Context(), client, code.UserID, scopes, claims)
+	if err != nil {
+		slog.Error("Cannot issue access token.", "err", err)
+		tokenServerError(w, err)
+		return
+	}
+
+	resp := tokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(expiresIn.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}
+	if slices.Contains(scopes, "openid") {
+		resp.IDToken, err = p.issueIDToken(r, client, code, expiresIn.Seconds())
+		if err != nil {
+			slog.Error("Cannot issue ID token.", "err", err)
+			tokenServerError(w, err)
+			return
+		}
+	}
+
+	resp.RefreshToken, err = p.issueRefreshToken(r.Context(), client.ID, code.UserID, code.Scope, claims, binding, code.AuthTime)
+	if err != nil {
+		slog.Error("Cannot issue refresh token.", "err", err)
+		tokenServerError(w, err)
+		return
+	}
+
+	writeTokenResponse(w, resp)
+}
+
+func writeTokenResponse(w http.ResponseWriter, resp tokenResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// issueIDToken signs the ID token for a redeemed code. It carries the
+// identity claims requested for it through the claims parameter, as far as
+// the granted scopes allow; the scope claims are served from userinfo.
+func (p *Provider) issueIDToken(r *http.Request, client store.Client, code store.AuthCode, ttlSeconds float64) (string, error) {
+	user, err := p.Users.GetUserByID(r.Context(), code.UserID)
+	if err != nil {
+		return "", err
+	}
+	profile, err := p.Profiles.GetProfile(r.Context(), code.UserID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return "", err
+	}
+	req, err := ParseClaimsRequest(code.Claims)
+	if err != nil {
+		return "", err
+	}
+
+	var now = p.now()
+	claims := ReleaseClaims(user, profile, strings.Fields(code.Scope), req.IDToken)
+	claims["sub"], err = p.subject(client, user.ID)
+	if err != nil {
+		return "", err
+	}
+	claims["iss"] = p.Issuer
+	p.Tokens.SetAudience(claims, client.ID, client.Audiences)
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Unix() + int64(ttlSeconds)
+	claims["auth_time"] = code.AuthTime.Unix()
+	if code.Nonce != "" {
+		claims["nonce"] = code.Nonce
+	}
+
+	return p.Tokens.SignAs(client.IDTokenSignedResponseAlg, claims)
+}
+
+func tokenError(w http.ResponseWriter, status int, code, description string) {
+	if ow, ok := w.(*outcomeWriter); ok {
+		ow.code = code
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(tokenErrorResponse{Error: code, ErrorDescription: description})
+}
+
+// tokenServerError is internalError for endpoints that answer in the OAuth
+// JSON error format.
+func tokenServerError(w http.ResponseWriter, err error) {
+	if errors.Is(err, store.ErrUnavailable) {
+		retryafter.Set(w.Header(), retryAfter)
+		tokenError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+		return
+	}
+
+	tokenError(w, http.StatusInternalServerError, "server_error", "")
+}
@@ -0,0 +1,330 @@
+package oauth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/authn"
+	"github.com/ehubscher/goidp/internal/jose"
+	"github.com/ehubscher/goidp/internal/store"
+	"github.com/ehubscher/goidp/internal/token"
+)
+
+// testClientSecret has characters that must be form-encoded for Basic.
+const testClientSecret = "p%ss: w+rd&="
+
+// withTokens makes the test client confidential and sets up token issuance.
+func (env *testEnv) withTokens(t *testing.T) {
+	t.Helper()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jose.NewKey(jose.ES256, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := jose.NewKeyManager(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.provider.Tokens = &token.Issuer{Keys: keys, Issuer: "https://idp.example", Now: env.provider.Now}
+
+	hash, err := authn.GenerateHash(context.Background(), "bcrypt", testClientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.provider.Clients.(*store.MemoryClientStore).PutClient(context.Background(), store.Client{
+		ID:           testClientID,
+		SecretHash:   hash,
+		RedirectURIs: []string{testRedirectURI},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func basicAuth(id, secret string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(id+":"+secret))
+}
+
+func (env *testEnv) exchange(t *testing.T, authorization string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+
+	return env.do(r)
+}
+
+func (env *testEnv) codeGrant(t *testing.T) url.Values {
+	return url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {env.issueCode(t)},
+		"redirect_uri": {testRedirectURI},
+	}
+}
+
+func TestTokenBasicAuthEncodedSecret(t *testing.T) {
+	var headers = []struct {
+		name, header string
+	}{
+		{"form-encoded", basicAuth(url.QueryEscape(testClientID), url.QueryEscape(testClientSecret))},
+		{"raw", basicAuth(testClientID, testClientSecret)},
+		{"lowercase scheme", "basic " + strings.TrimPrefix(basicAuth(testClientID, url.QueryEscape(testClientSecret)), "Basic ")},
+	}
+
+	for _, c := range headers {
+		env := newTestEnv(t)
+		env.withTokens(t)
+
+		rec := env.exchange(t, c.header, env.codeGrant(t))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s got: %d %s, want: %d", c.name, rec.Code, rec.Body, http.StatusOK)
+			continue
+		}
+
+		var resp struct {
+			AccessToken string `json:"access_token"`
+			IDToken     string `json:"id_token"`
+		}
+		err := json.NewDecoder(rec.Body).Decode(&resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := env.provider.Tokens.Validate(resp.AccessToken)
+		if err != nil || claims.ClientID != testClientID {
+			t.Errorf("%s got: %+v, %v, want: a valid access token", c.name, claims, err)
+		}
+		if resp.IDToken == "" {
+			t.Errorf("%s got: no id_token, want: one for the openid scope", c.name)
+		}
+	}
+}
+
+func TestTokenMalformedBasicAuth(t *testing.T) {
+	var headers = []string{
+		"Basic",
+		"Basic    ",
+		"Basic !!!not-base64",
+		"Basic " + base64.StdEncoding.EncodeToString([]byte("no-colon")),
+		"Basic " + base64.StdEncoding.EncodeToString([]byte(":secret")),
+		basicAuth(testClientID, "wrong"),
+		basicAuth("unknown", testClientSecret),
+	}
+
+	env := newTestEnv(t)
+	env.withTokens(t)
+	for _, header := range headers {
+		rec := env.exchange(t, header, url.Values{"grant_type": {"authorization_code"}})
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%q got: %d, want: %d", header, rec.Code, http.StatusUnauthorized)
+		}
+
+		var resp map[string]string
+		err := json.NewDecoder(rec.Body).Decode(&resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp["error"] != "invalid_client" {
+			t.Errorf("%q got: %v, want: invalid_client", header, resp)
+		}
+	}
+}
+
+func TestTokenClientSecretPost(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+
+	form := env.codeGrant(t)
+	form.Set("client_id", testClientID)
+	form.Set("client_secret", testClientSecret)
+	if rec := env.exchange(t, "", form); rec.Code != http.StatusOK {
+		t.Errorf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusOK)
+	}
+}
+
+func TestTokenGrantTypeNotAllowed(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	clients := env.provider.Clients.(*store.MemoryClientStore)
+	client, err := clients.GetClient(context.Background(), testClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.GrantTypes = []string{"refresh_token"}
+	err = clients.PutClient(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := env.exchange(t, basicAuth(testClientID, testClientSecret), env.codeGrant(t))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got: %d %s, want: %d", rec.Code, rec.Body, http.StatusBadRequest)
+	}
+	if resp := decodeTokenResult(t, rec); resp.Error != "unauthorized_client" {
+		t.Errorf("got: %q, want: %q", resp.Error, "unauthorized_client")
+	}
+}
+
+func TestIDTokenSignedResponseAlg(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	env.provider.Issuer = "https://idp.example"
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs256, err := jose.NewKey(jose.RS256, rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.provider.Tokens.Keys, err = jose.NewKeyManager(env.provider.Tokens.Keys.SigningKey(), rs256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.provider.Keys = env.provider.Tokens.Keys
+
+	clients := env.provider.Clients.(*store.MemoryClientStore)
+	client, err := clients.GetClient(context.Background(), testClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cookie := env.withSession(t)
+	for _, alg := range []string{"", jose.RS256, jose.ES256} {
+		client.IDTokenSignedResponseAlg = alg
+		err = clients.PutClient(context.Background(), client)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := httptest.NewRequest(http.MethodGet, authorizeURL(nil), nil)
+		r.AddCookie(cookie)
+		form := url.Values{
+			"grant_type":   {"authorization_code"},
+			"code":         {redirectParams(t, env.do(r)).Get("code")},
+			"redirect_uri": {testRedirectURI},
+		}
+
+		rec := env.exchange(t, basicAuth(testClientID, testClientSecret), form)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%q got: %d %s, want: %d", alg, rec.Code, rec.Body, http.StatusOK)
+		}
+		var resp struct {
+			IDToken string `json:"id_token"`
+		}
+		err = json.NewDecoder(rec.Body).Decode(&resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		jws, err := jose.Parse(resp.IDToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want string = alg
+		if want == "" {
+			want = jose.ES256
+		}
+		if jws.Header.Alg != want {
+			t.Errorf("%q got: %s, want: %s", alg, jws.Header.Alg, want)
+		}
+		if _, err = env.provider.Tokens.Validate(resp.IDToken); err != nil {
+			t.Errorf("%q got: %v, want: a valid ID token", alg, err)
+		}
+	}
+
+	rec := env.do(httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+	var doc struct {
+		Algs []string `json:"id_token_signing_alg_values_supported"`
+	}
+	err = json.NewDecoder(rec.Body).Decode(&doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Algs) != 2 || doc.Algs[0] != jose.ES256 || doc.Algs[1] != jose.RS256 {
+		t.Errorf("got: %v, want: [ES256 RS256]", doc.Algs)
+	}
+}
+
+func TestAuthorizedParty(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	env.provider.Issuer = "https://idp.example"
+
+	clients := env.provider.Clients.(*store.MemoryClientStore)
+	client, err := clients.GetClient(context.Background(), testClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cases = []struct {
+		audiences []string
+		always    bool
+		wantAZP   string
+	}{
+		{nil, false, ""},
+		{nil, true, testClientID},
+		{[]string{testClientID}, false, ""},
+		{[]string{"https://api.example"}, false, testClientID},
+	}
+
+	cookie := env.withSession(t)
+	for _, c := range cases {
+		client.Audiences = c.audiences
+		err = clients.PutClient(context.Background(), client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		env.provider.Tokens.AlwaysAuthorizedParty = c.always
+
+		r := httptest.NewRequest(http.MethodGet, authorizeURL(nil), nil)
+		r.AddCookie(cookie)
+		form := url.Values{
+			"grant_type":   {"authorization_code"},
+			"code":         {redirectParams(t, env.do(r)).Get("code")},
+			"redirect_uri": {testRedirectURI},
+		}
+		rec := env.exchange(t, basicAuth(testClientID, testClientSecret), form)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%v got: %d %s, want: %d", c.audiences, rec.Code, rec.Body, http.StatusOK)
+		}
+		var resp struct {
+			AccessToken string `json:"access_token"`
+			IDToken     string `json:"id_token"`
+		}
+		err = json.NewDecoder(rec.Body).Decode(&resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for name, raw := range map[string]string{"id_token": resp.IDToken, "access_token": resp.AccessToken} {
+			claims, err := env.provider.Tokens.Validate(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.AuthorizedParty != c.wantAZP {
+				t.Errorf("%s for %v, always %t got: azp %q, want: %q", name, c.audiences, c.always, claims.AuthorizedParty, c.wantAZP)
+			}
+			if err := claims.CheckAuthorizedParty(testClientID); err != nil {
+				t.Errorf("%s for %v got: %v, want: nil", name, c.audiences, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package oauth
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/ehubscher/goidp/internal/render"
+)
+
+// displayValues are the display parameter values of OIDC Core 3.1.2.1. The
+// first is the default.
+var displayValues = []string{"page", "popup", "touch", "wap"}
+
+var defaultUILocales = []string{"en"}
+
+func (p *Provider) pages() *render.Renderer {
+	if p.Pages != nil {
+		return p.Pages
+	}
+
+	return render.Default()
+}
+
+func (p *Provider) uiLocales() []string {
+	if len(p.UILocales) > 0 {
+		return p.UILocales
+	}
+
+	return defaultUILocales
+}
+
+// uiContext reads display and ui_locales from form. Unsupported display
+// values fall back to page and unsupported locales are skipped.
+func (p *Provider) uiContext(form url.Values) render.UI {
+	ui := render.UI{
+		Display:   displayValues[0],
+		UILocales: form.Get("ui_locales"),
+	}
+	if d := form.Get("display"); slices.Contains(displayValues, d) {
+		ui.Display = d
+	}
+	ui.Locale = matchLocale(strings.Fields(ui.UILocales), p.uiLocales())
+
+	return ui
+}
+
+// matchLocale returns the supported locale best matching the requested BCP
+// 47 tags, which are in order of preference. A tag matches exactly, then by
+// its language alone, so "fr-CA" is served "fr" when that is all there is.
+// With no match the first supported locale is used.
+func matchLocale(requested, supported []string) string {
+	for _, tag := range requested {
+		for _, s := range supported {
+			if strings.EqualFold(tag, s) {
+				return s
+			}
+		}
+
+		lang, _, _ := strings.Cut(tag, "-")
+		for _, s := range supported {
+			if strings.EqualFold(lang, s) {
+				return s
+			}
+		}
+	}
+
+	return supported[0]
+}
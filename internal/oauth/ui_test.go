@@ -0,0 +1,59 @@
+package oauth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+var uiParams = []struct {
+	display, uiLocales string
+	wantDisplay        string
+	wantLang           string
+}{
+	{"popup", "fr-CA en", "popup", "fr"},
+	{"touch", "de-DE", "touch", "en"},
+	{"hologram", "es", "page", "es"},
+	{"", "", "page", "en"},
+}
+
+func TestAuthorizeDisplayAndUILocales(t *testing.T) {
+	for _, c := range uiParams {
+		env := newTestEnv(t)
+		env.provider.UILocales = []string{"en", "fr", "es"}
+
+		r := httptest.NewRequest(http.MethodGet, authorizeURL(url.Values{
+			"display":    {c.display},
+			"ui_locales": {c.uiLocales},
+		}), nil)
+		rec := env.do(r)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got: %d, want: the login page", rec.Code)
+		}
+
+		var body string = rec.Body.String()
+		if !strings.Contains(body, `lang="`+c.wantLang+`"`) {
+			t.Errorf("ui_locales %q got: %s, want: lang %s", c.uiLocales, body, c.wantLang)
+		}
+		if !strings.Contains(body, `data-display="`+c.wantDisplay+`"`) {
+			t.Errorf("display %q got: %s, want: display %s", c.display, body, c.wantDisplay)
+		}
+	}
+}
+
+func TestLoginKeepsUIParameters(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.UILocales = []string{"en", "fr"}
+
+	rec := env.login(t, url.Values{
+		"password":   {"not the password"},
+		"display":    {"popup"},
+		"ui_locales": {"fr"},
+	})
+	var body string = rec.Body.String()
+	if !strings.Contains(body, `lang="fr"`) || !strings.Contains(body, `data-display="popup"`) {
+		t.Errorf("got: %s, want: the failed login page in French as a popup", body)
+	}
+}
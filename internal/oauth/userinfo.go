@@ -0,0 +1,132 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ehubscher/goidp/internal/server"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+var errInactiveToken = errors.New("access token is not active")
+
+// userInfoHandler serves GET and POST /userinfo (OIDC Core 5.3). It sits
+// behind the same RequireAuth and RequireScope middlewares as any other
+// bearer-protected route, so its WWW-Authenticate challenges are the same.
+func (p *Provider) userInfoHandler() http.Handler {
+	return server.Chain(
+		http.HandlerFunc(p.UserInfo),
+		server.RequireAuth(p.validateAccessToken),
+		server.RequireScope("openid"),
+	)
+}
+
+// UserInfo returns the claims released for the token's scopes, and those
+// requested for userinfo through the claims parameter as far as the scopes
+// allow. Essential claims the user had no value for were refused at
+// /authorize under RequireEssentialClaims. It expects the token RequireAuth
+// put in the request context. A comma-separated fields query parameter
+// narrows the response to those claims, of the ones released, plus sub;
+// unknown fields are ignored.
+func (p *Provider) UserInfo(w http.ResponseWriter, r *http.Request) {
+	token, ok := server.TokenFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized.", http.StatusUnauthorized)
+		return
+	}
+	userID, err := strconv.ParseInt(token.Subject, 10, 64)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	user, err := p.Users.GetUserByID(r.Context(), userID)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	profile, err := p.Profiles.GetProfile(r.Context(), userID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		internalError(w, err)
+		return
+	}
+	// The sub must be the one in the client's ID tokens.
+	client, err := p.lookupClient(r.Context(), token.ClientID)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	released := UserClaims(user, profile, token.Scopes)
+	for name, v := range ReleaseClaims(user, profile, token.Scopes, requestedClaims(token.Claims)) {
+		released[name] = v
+	}
+	claims := selectClaims(released, r.URL.Query().Get("fields"))
+	claims["sub"], err = p.subject(client, user.ID)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(claims)
+}
+
+// selectClaims keeps only sub and the claims named in the comma-separated
+// fields. Empty fields keeps every claim.
+func selectClaims(claims map[string]any, fields string) map[string]any {
+	if strings.TrimSpace(fields) == "" {
+		return claims
+	}
+
+	selected := map[string]any{"sub": claims["sub"]}
+	for _, name := range strings.Split(fields, ",") {
+		name = strings.TrimSpace(name)
+		if v, ok := claims[name]; ok {
+			selected[name] = v
+		}
+	}
+
+	return selected
+}
+
+// validateAccessToken accepts an active access token, opaque or JWT, whose
+// user still exists and may sign in.
+func (p *Provider) validateAccessToken(ctx context.Context, raw string) (server.Token, error) {
+	resp, ok, err := p.introspectOpaque(ctx, raw)
+	if err != nil {
+		slog.Error("Cannot look up access token.", "err", err)
+		return server.Token{}, err
+	}
+	if !ok {
+		resp = p.introspectJWT(raw)
+	}
+	if !resp.Active {
+		return server.Token{}, errInactiveToken
+	}
+
+	userID, err := strconv.ParseInt(resp.Subject, 10, 64)
+	if err != nil {
+		return server.Token{}, errInactiveToken
+	}
+	active, _, err := p.activeUser(ctx, userID)
+	if err != nil {
+		slog.Error("Cannot look up user.", "err", err)
+		return server.Token{}, err
+	}
+	if !active {
+		return server.Token{}, errInactiveToken
+	}
+
+	return server.Token{
+		Subject:  resp.Subject,
+		ClientID: resp.ClientID,
+		Scopes:   strings.Fields(resp.Scope),
+		Claims:   strings.Fields(resp.userInfoClaims),
+	}, nil
+}
@@ -0,0 +1,134 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+func TestUserInfo(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+
+	sub := strconv.FormatInt(env.user.ID, 10)
+	tok, _, err := env.provider.Tokens.IssueAccessToken(sub, testClientID, nil, []string{"openid", "email"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+	r.Header.Set("Authorization", "Bearer "+tok)
+	rec := env.do(r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got: %d, want: %d", rec.Code, http.StatusOK)
+	}
+	if resp := decodeMap(t, rec); resp["sub"] != sub || resp["email"] != testEmail {
+		t.Errorf("got: %v, want: sub and email", resp)
+	}
+}
+
+func TestUserInfoFields(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+	err := env.provider.Profiles.UpdateProfile(context.Background(), store.Profile{UserID: env.user.ID, Name: "Ex Ample", Locale: "en"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := strconv.FormatInt(env.user.ID, 10)
+	tok, _, err := env.provider.Tokens.IssueAccessToken(sub, testClientID, nil, []string{"openid", "email"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cases = []struct {
+		fields string
+		want   []string
+	}{
+		{"", []string{"sub", "email", "email_verified"}},
+		{"email", []string{"sub", "email"}},
+		{" email , unknown", []string{"sub", "email"}},
+		// Named fields are still gated by the token's scopes.
+		{"name,locale", []string{"sub"}},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/userinfo?fields="+url.QueryEscape(c.fields), nil)
+		r.Header.Set("Authorization", "Bearer "+tok)
+		rec := env.do(r)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%q got: %d, want: %d", c.fields, rec.Code, http.StatusOK)
+		}
+
+		resp := decodeMap(t, rec)
+		if len(resp) != len(c.want) {
+			t.Errorf("%q got: %v, want: %v", c.fields, resp, c.want)
+		}
+		for _, name := range c.want {
+			if _, ok := resp[name]; !ok {
+				t.Errorf("%q got: %v, want: %s", c.fields, resp, name)
+			}
+		}
+		if resp["sub"] != sub {
+			t.Errorf("%q got: %v, want: %s", c.fields, resp["sub"], sub)
+		}
+	}
+}
+
+func TestUserInfoChallenges(t *testing.T) {
+	env := newTestEnv(t)
+	env.withTokens(t)
+
+	sub := strconv.FormatInt(env.user.ID, 10)
+	noOpenID, _, err := env.provider.Tokens.IssueAccessToken(sub, testClientID, nil, []string{"email"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Scoped like an access token, so only its typ gives it away.
+	idToken, err := env.provider.Tokens.Sign(map[string]any{"iss": "https://idp.example", "sub": sub, "aud": testClientID, "scope": "openid", "iat": env.now.Unix(), "exp": env.now.Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiring, _, err := env.provider.Tokens.IssueAccessToken(sub, testClientID, nil, []string{"openid"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cases = []struct {
+		name      string
+		header    string
+		advance   time.Duration
+		status    int
+		challenge string
+	}{
+		{"missing", "", 0, http.StatusUnauthorized, `Bearer realm="goidp"`},
+		{"other scheme", basicAuth(testClientID, testClientSecret), 0, http.StatusUnauthorized, `Bearer realm="goidp"`},
+		{"malformed", "Bearer a b", 0, http.StatusBadRequest, `Bearer realm="goidp", error="invalid_request", error_description="The Authorization header is malformed."`},
+		{"unknown", "Bearer not-a-token", 0, http.StatusUnauthorized, `Bearer realm="goidp", error="invalid_token", error_description="The access token is invalid or expired."`},
+		{"scope", "Bearer " + noOpenID, 0, http.StatusForbidden, `Bearer realm="goidp", error="insufficient_scope", error_description="The access token lacks the required scope.", scope="openid"`},
+		{"id_token", "Bearer " + idToken, 0, http.StatusUnauthorized, `Bearer realm="goidp", error="invalid_token", error_description="The access token is invalid or expired."`},
+		{"expired", "Bearer " + expiring, time.Hour, http.StatusUnauthorized, `Bearer realm="goidp", error="invalid_token", error_description="The access token is invalid or expired."`},
+	}
+
+	for _, c := range cases {
+		env.now = env.now.Add(c.advance)
+		r := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+		if c.header != "" {
+			r.Header.Set("Authorization", c.header)
+		}
+
+		rec := env.do(r)
+		if rec.Code != c.status {
+			t.Errorf("%s got: %d, want: %d", c.name, rec.Code, c.status)
+		}
+		if got := rec.Header().Get("WWW-Authenticate"); got != c.challenge {
+			t.Errorf("%s got: %s, want: %s", c.name, got, c.challenge)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package oauth_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+func TestRequireVerifiedEmailLogin(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.RequireVerifiedEmail = true
+	var resent []int64
+	env.provider.UnverifiedEmail = func(_ context.Context, user store.User) error {
+		resent = append(resent, user.ID)
+		return nil
+	}
+
+	rec := env.login(t, nil)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("unverified got: %d, want: %d", rec.Code, http.StatusForbidden)
+	}
+	if !strings.Contains(rec.Body.String(), "Check your inbox") {
+		t.Errorf("got: %s, want: pointed at the email just sent", rec.Body)
+	}
+	if len(resent) != 1 || resent[0] != env.user.ID {
+		t.Errorf("got: %v, want: the verification email resent to %d", resent, env.user.ID)
+	}
+
+	err := env.provider.Users.SetEmailVerified(context.Background(), env.user.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := env.login(t, nil); rec.Code != http.StatusFound {
+		t.Errorf("verified got: %d, want: %d", rec.Code, http.StatusFound)
+	}
+}
+
+func TestVerificationResendThrottled(t *testing.T) {
+	env := newTestEnv(t)
+	env.provider.RequireVerifiedEmail = true
+	var resent int
+	env.provider.UnverifiedEmail = func(context.Context, store.User) error {
+		resent++
+		return nil
+	}
+
+	for range 3 {
+		env.login(t, nil)
+	}
+	if resent != 1 {
+		t.Errorf("got: %d emails, want: 1 within the resend interval", resent)
+	}
+
+	env.now = env.now.Add(5 * time.Minute)
+	env.login(t, nil)
+	if resent != 2 {
+		t.Errorf("got: %d emails, want: 2 after the resend interval", resent)
+	}
+}
+
+func TestVerificationNotSent(t *testing.T) {
+	for _, hook := range []func(context.Context, store.User) error{
+		nil,
+		func(context.Context, store.User) error { return errors.New("queue full") },
+	} {
+		env := newTestEnv(t)
+		env.provider.RequireVerifiedEmail = true
+		env.provider.UnverifiedEmail = hook
+
+		rec := env.login(t, nil)
+		if rec.Code != http.StatusForbidden || strings.Contains(rec.Body.String(), "inbox") {
+			t.Errorf("got: %d %s, want: %d without pointing at an inbox", rec.Code, rec.Body, http.StatusForbidden)
+		}
+	}
+}
+
+func TestRequireVerifiedEmailToken(t *testing.T) {
+	env := newTestEnv(t)
+	refreshToken := env.withRefreshToken(t)
+	env.provider.RequireVerifiedEmail = true
+
+	rec := env.refresh(t, refreshToken, "")
+	doc := decodeMap(t, rec)
+	if doc["error"] != "invalid_grant" || doc["error_description"] != "The user's email address is not verified." {
+		t.Errorf("unverified got: %v, want: invalid_grant for the unverified email", doc)
+	}
+
+	err := env.provider.Users.SetEmailVerified(context.Background(), env.user.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := decodeTokenResult(t, env.refresh(t, refreshToken, "")); resp.AccessToken == "" {
+		t.Errorf("verified got: %+v, want: an access token", resp)
+	}
+}
+
+func TestVerifiedEmailIgnoredByDefault(t *testing.T) {
+	env := newTestEnv(t)
+
+	if rec := env.login(t, nil); rec.Code != http.StatusFound {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusFound)
+	}
+}
@@ -0,0 +1,58 @@
+// Package problem writes RFC 9457 problem details for the non-OAuth
+// endpoints. OAuth endpoints keep the error format their specs mandate.
+package problem
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+const ContentType = "application/problem+json"
+
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	// InvalidParams lists per-field validation failures, using the
+	// extension member from the example in RFC 9457 section 3.
+	InvalidParams []InvalidParam `json:"invalid-params,omitempty"`
+}
+
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// New returns a problem of the default about:blank type, whose title is the
+// status text per RFC 9457 section 4.2.1.
+func New(status int, detail string) Problem {
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// Error writes a problem for status with detail, using the request path as
+// the instance.
+func Error(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	p := New(status, detail)
+	p.Instance = r.URL.Path
+	Write(w, p)
+}
+
+func Write(w http.ResponseWriter, p Problem) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(p.Status)
+
+	err := json.NewEncoder(w).Encode(p)
+	if err != nil {
+		slog.Error("Cannot write problem response.", "err", err)
+	}
+}
@@ -0,0 +1,43 @@
+package problem_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/problem"
+)
+
+func TestError(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPut, "/account/profile", nil)
+	rec := httptest.NewRecorder()
+
+	problem.Error(rec, r, http.StatusBadRequest, "Malformed profile.")
+
+	if got := rec.Header().Get("Content-Type"); got != problem.ContentType {
+		t.Errorf("got: %s, want: %s", got, problem.ContentType)
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusBadRequest)
+	}
+
+	var fields map[string]any
+	err := json.NewDecoder(rec.Body).Decode(&fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want = map[string]any{
+		"type":     "about:blank",
+		"title":    "Bad Request",
+		"status":   float64(http.StatusBadRequest),
+		"detail":   "Malformed profile.",
+		"instance": "/account/profile",
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("%s got: %v, want: %v", k, fields[k], v)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+// Package ratelimit implements token bucket rate limiting keyed by an
+// arbitrary string, such as a client IP or client id.
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/clientip"
+	"github.com/ehubscher/goidp/internal/retryafter"
+)
+
+// sweepInterval is how often idle buckets are dropped.
+const sweepInterval = time.Minute
+
+var ErrInvalidLimit = errors.New("invalid rate limit")
+
+// Limit allows Events per Per, all of which may be used in a burst. The zero
+// Limit means unlimited.
+type Limit struct {
+	Events int
+	Per    time.Duration
+}
+
+func (l Limit) unlimited() bool {
+	return l.Events <= 0 || l.Per <= 0
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Events, l.Per)
+}
+
+var units = map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+
+// ParseLimit parses limits written like "30/m", with a unit of s, m or h.
+func ParseLimit(raw string) (Limit, error) {
+	events, unit, ok := strings.Cut(strings.TrimSpace(raw), "/")
+	per, known := units[unit]
+	n, err := strconv.Atoi(events)
+	if !ok || !known || err != nil || n < 1 {
+		return Limit{}, fmt.Errorf("%w: %q, want e.g. 30/m", ErrInvalidLimit, raw)
+	}
+
+	return Limit{Events: n, Per: per}, nil
+}
+
+// Configure reads a limit from env and per-key overrides from
+// env_OVERRIDES, a comma-separated list of key=limit pairs such as
+// "client1=100/m,client2=5/s". An unset env means no default limit, though
+// overrides still apply. env_HEADERS enables the RateLimit-* headers and
+// defaults to false.
+func Configure(env string) (*Limiter, error) {
+	return ConfigureFrom(env, os.Getenv)
+}
+
+// ConfigureFrom is Configure reading settings through getenv, such as the
+// values of a config file being reloaded.
+func ConfigureFrom(env string, getenv func(string) string) (*Limiter, error) {
+	l := &Limiter{}
+
+	if raw := getenv(env + "_HEADERS"); raw != "" {
+		headers, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s_HEADERS misconfigured: %w", env, err)
+		}
+		l.Headers = headers
+	}
+
+	if raw := getenv(env); raw != "" {
+		limit, err := ParseLimit(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s misconfigured: %w", env, err)
+		}
+		l.Default = limit
+	}
+
+	if raw := getenv(env + "_OVERRIDES"); raw != "" {
+		l.Overrides = make(map[string]Limit)
+		for _, pair := range strings.Split(raw, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || key == "" {
+				return nil, fmt.Errorf("%s_OVERRIDES misconfigured: %q is not key=limit", env, pair)
+			}
+			limit, err := ParseLimit(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s_OVERRIDES misconfigured: %w", env, err)
+			}
+			l.Overrides[key] = limit
+		}
+	}
+
+	return l, nil
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+// Limiter tracks one bucket per key. Buckets that have refilled completely
+// carry no state worth keeping and are dropped periodically, so memory is
+// bounded by the keys active within one refill period. Its limits must only
+// be changed through Update once it is in use.
+type Limiter struct {
+	Default   Limit
+	Overrides map[string]Limit
+
+	// Headers makes Middleware describe the bucket in the RateLimit-Limit,
+	// RateLimit-Remaining and RateLimit-Reset headers of the IETF
+	// RateLimit header fields draft, on allowed and limited responses alike.
+	Headers bool
+
+	// Now defaults to time.Now and exists so tests can control time.
+	Now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func (l *Limiter) now() time.Time {
+	if l.Now != nil {
+		return l.Now()
+	}
+
+	return time.Now()
+}
+
+// Update takes over the limits and Headers setting of from, as a config
+// reload does. Buckets whose limit changed start over full.
+func (l *Limiter) Update(from *Limiter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.Default = from.Default
+	l.Overrides = from.Overrides
+	l.Headers = from.Headers
+}
+
+func (l *Limiter) headers() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.Headers
+}
+
+// limit must be called with mu held.
+func (l *Limiter) limit(key string) Limit {
+	if limit, ok := l.Overrides[key]; ok {
+		return limit
+	}
+
+	return l.Default
+}
+
+// Status is the state of a key's bucket after a request was counted
+// against it.
+type Status struct {
+	Allowed bool
+	Limit   Limit
+	// Remaining is the number of whole tokens left in the bucket.
+	Remaining int
+	// RetryAfter is how long until a token is available, when the request
+	// was not allowed.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// Allow takes a token from key's bucket. When the bucket is empty it
+// reports how long until a token is available.
+func (l *Limiter) Allow(key string) (ok bool, retryAfter time.Duration) {
+	status := l.Take(key)
+	return status.Allowed, status.RetryAfter
+}
+
+// Take is Allow, also reporting the state of key's bucket. The Limit of an
+// unlimited key's Status is the zero Limit.
+func (l *Limiter) Take(key string) Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit := l.limit(key)
+	if limit.unlimited() {
+		return Status{Allowed: true}
+	}
+
+	var now time.Time = l.now()
+	l.sweep(now)
+
+	b, found := l.buckets[key]
+	if !found || b.limit != limit {
+		b = &bucket{tokens: float64(limit.Events), updated: now, limit: limit}
+		l.buckets[key] = b
+	}
+	b.refill(now)
+
+	var perToken time.Duration = limit.Per / time.Duration(limit.Events)
+	status := Status{Allowed: b.tokens >= 1, Limit: limit}
+	if status.Allowed {
+		b.tokens--
+	} else {
+		status.RetryAfter = time.Duration((1 - b.tokens) * float64(perToken))
+	}
+	status.Remaining = int(b.tokens)
+	status.Reset = time.Duration((float64(limit.Events) - b.tokens) * float64(perToken))
+
+	return status
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated)
+	if elapsed <= 0 {
+		return
+	}
+	b.tokens = math.Min(float64(b.limit.Events), b.tokens+float64(b.limit.Events)*elapsed.Seconds()/b.limit.Per.Seconds())
+	b.updated = now
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	if l.buckets == nil {
+		l.buckets = make(map[string]*bucket)
+	}
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= b.limit.Per {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RetryAfter formats d as delta-seconds for the RateLimit-* headers,
+// rounding up to whole seconds so clients never retry too early. The
+// Retry-After header itself is written by retryafter.Set, in whichever
+// format is configured.
+func RetryAfter(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// SetHeaders describes status in the RateLimit-* headers of h. The policy
+// window is given in whole seconds. Unlimited statuses set nothing.
+func SetHeaders(h http.Header, status Status) {
+	if status.Limit.unlimited() {
+		return
+	}
+
+	h.Set("RateLimit-Limit", strconv.Itoa(status.Limit.Events))
+	h.Set("RateLimit-Remaining", strconv.Itoa(status.Remaining))
+	h.Set("RateLimit-Reset", RetryAfter(status.Reset))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%s", status.Limit.Events, RetryAfter(status.Limit.Per)))
+}
+
+// RemoteIP returns the IP the request came from, without the port. Behind
+// reverse proxies, key by clientip.Proxies.ClientIP instead so clients
+// aren't all limited as the proxy.
+func RemoteIP(r *http.Request) string {
+	return clientip.Proxies(nil).ClientIP(r)
+}
+
+// Middleware rejects requests over the limit for key(r) with 429. Requests
+// for which key returns "" aren't limited.
+func (l *Limiter) Middleware(key func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			if k == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			status := l.Take(k)
+			if l.headers() {
+				SetHeaders(w.Header(), status)
+			}
+			if !status.Allowed {
+				retryafter.Set(w.Header(), status.RetryAfter)
+				w.Header().Set("Cache-Control", "no-store")
+				http.Error(w, "Too many requests, retry later.", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package ratelimit_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/clientip"
+	"github.com/ehubscher/goidp/internal/ratelimit"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l := &ratelimit.Limiter{
+		Default: ratelimit.Limit{Events: 2, Per: time.Minute},
+		Now:     func() time.Time { return now },
+	}
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d got: limited, want: allowed", i+1)
+		}
+	}
+	ok, retryAfter := l.Allow("a")
+	if ok || retryAfter != 30*time.Second {
+		t.Errorf("got: %t, %s, want: limited for 30s", ok, retryAfter)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("other key got: limited, want: allowed")
+	}
+
+	now = now.Add(30 * time.Second)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("after refill got: limited, want: allowed")
+	}
+}
+
+func TestLimiterOverrides(t *testing.T) {
+	l := &ratelimit.Limiter{
+		Default:   ratelimit.Limit{Events: 1, Per: time.Hour},
+		Overrides: map[string]ratelimit.Limit{"big": {Events: 3, Per: time.Hour}, "free": {}},
+	}
+
+	var allowed = map[string]int{}
+	for i := 0; i < 5; i++ {
+		for _, key := range []string{"small", "big", "free"} {
+			if ok, _ := l.Allow(key); ok {
+				allowed[key]++
+			}
+		}
+	}
+	if allowed["small"] != 1 || allowed["big"] != 3 || allowed["free"] != 5 {
+		t.Errorf("got: %v, want: small 1, big 3, free 5", allowed)
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	limit, err := ratelimit.ParseLimit("30/m")
+	if err != nil || limit != (ratelimit.Limit{Events: 30, Per: time.Minute}) {
+		t.Errorf("got: %v, %v, want: 30/m", limit, err)
+	}
+
+	for _, raw := range []string{"", "30", "30/d", "0/s", "x/s"} {
+		_, err = ratelimit.ParseLimit(raw)
+		if !errors.Is(err, ratelimit.ErrInvalidLimit) {
+			t.Errorf("%q got: %v, want: %v", raw, err, ratelimit.ErrInvalidLimit)
+		}
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	t.Setenv("CLIENT_RATE_LIMIT", "10/s")
+	t.Setenv("CLIENT_RATE_LIMIT_OVERRIDES", "client1=100/m, client2=1/h")
+	t.Setenv("CLIENT_RATE_LIMIT_HEADERS", "true")
+
+	l, err := ratelimit.Configure("CLIENT_RATE_LIMIT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Default != (ratelimit.Limit{Events: 10, Per: time.Second}) || len(l.Overrides) != 2 || l.Overrides["client2"].Per != time.Hour || !l.Headers {
+		t.Errorf("got: %+v, want: 10/s with two overrides and headers", l)
+	}
+
+	t.Setenv("CLIENT_RATE_LIMIT_OVERRIDES", "client1")
+	if _, err = ratelimit.Configure("CLIENT_RATE_LIMIT"); err == nil {
+		t.Error("got: nil, want: an error")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	l := &ratelimit.Limiter{Default: ratelimit.Limit{Events: 1, Per: time.Minute}}
+	h := l.Middleware(ratelimit.RemoteIP)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	do := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	do("192.0.2.1:1000")
+	rec := do("192.0.2.1:2000")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "60" {
+		t.Errorf("got: %d with Retry-After %q, want: %d with 60", rec.Code, rec.Header().Get("Retry-After"), http.StatusTooManyRequests)
+	}
+	if rec := do("192.0.2.2:1000"); rec.Code != http.StatusOK {
+		t.Errorf("other IP got: %d, want: %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestMiddlewareHeaders(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l := &ratelimit.Limiter{
+		Default: ratelimit.Limit{Events: 3, Per: time.Minute},
+		Headers: true,
+		Now:     func() time.Time { return now },
+	}
+	h := l.Middleware(ratelimit.RemoteIP)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var requests = []struct {
+		code             int
+		remaining, reset string
+	}{
+		{http.StatusOK, "2", "20"},
+		{http.StatusOK, "1", "40"},
+		{http.StatusOK, "0", "60"},
+		{http.StatusTooManyRequests, "0", "60"},
+	}
+	for i, want := range requests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		var got = []string{
+			rec.Header().Get("RateLimit-Limit"),
+			rec.Header().Get("RateLimit-Remaining"),
+			rec.Header().Get("RateLimit-Reset"),
+		}
+		if rec.Code != want.code || got[0] != "3" || got[1] != want.remaining || got[2] != want.reset {
+			t.Errorf("request %d got: %d %v, want: %d [3 %s %s]", i+1, rec.Code, got, want.code, want.remaining, want.reset)
+		}
+	}
+
+	l.Headers = false
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := rec.Header().Get("RateLimit-Limit"); got != "" {
+		t.Errorf("disabled got: %q, want: no headers", got)
+	}
+}
+
+func TestMiddlewareBehindProxy(t *testing.T) {
+	proxies, err := clientip.Parse("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &ratelimit.Limiter{Default: ratelimit.Limit{Events: 1, Per: time.Minute}}
+	h := l.Middleware(proxies.ClientIP)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	do := func(remoteAddr, xff string) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("X-Forwarded-For", xff)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	// Through the proxy, clients are limited separately.
+	if do("10.0.0.1:80", "198.51.100.1") != http.StatusOK || do("10.0.0.1:80", "198.51.100.2") != http.StatusOK {
+		t.Error("got: limited, want: each forwarded client allowed once")
+	}
+	// A direct client can't dodge its limit by varying a spoofed header.
+	if do("203.0.113.5:1000", "1.1.1.1") != http.StatusOK || do("203.0.113.5:1000", "2.2.2.2") != http.StatusTooManyRequests {
+		t.Error("got: allowed, want: the spoofed header ignored")
+	}
+}
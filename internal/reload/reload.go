@@ -0,0 +1,201 @@
+// Package reload re-reads the config file while the server runs, typically
+// on SIGHUP, and applies the settings that are safe to change without a
+// restart: the log level, rate limits, feature flags and maintenance mode.
+// Everything else, notably keys, secrets and database settings, is only
+// read at startup.
+package reload
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/ehubscher/goidp/internal/feature"
+	"github.com/ehubscher/goidp/internal/logging"
+	"github.com/ehubscher/goidp/internal/ratelimit"
+	"github.com/ehubscher/goidp/internal/server"
+	"github.com/joho/godotenv"
+)
+
+const defaultPath = ".env"
+
+// Reloader applies the hot-reloadable settings of a config file. A reload
+// is validated as a whole before anything is applied, so a file with any
+// error leaves every running setting as it was.
+type Reloader struct {
+	// Path is the config file loaded at startup. Empty means ".env".
+	Path string
+
+	// Features receives the FEATURES flags, such as
+	// oauth.Provider.SetFeatures. Nil leaves feature flags alone.
+	Features func(feature.Flags)
+
+	// RateLimits maps the env var each limiter was configured from, as
+	// given to ratelimit.Configure, to the limiter in use.
+	RateLimits map[string]*ratelimit.Limiter
+
+	// Maintenance is switched by MAINTENANCE when the file sets it, so
+	// that the admin endpoint's choice otherwise stands.
+	Maintenance *server.Maintenance
+
+	mu   sync.Mutex
+	last map[string]string
+}
+
+// settings is a validated reload, ready to apply.
+type settings struct {
+	level       slog.Level
+	features    feature.Flags
+	limits      map[string]*ratelimit.Limiter
+	maintenance *bool
+}
+
+func (rl *Reloader) path() string {
+	if rl.Path != "" {
+		return rl.Path
+	}
+
+	return defaultPath
+}
+
+// Reload reads the config file and applies it. A setting missing from the
+// file keeps the value of the process environment, as at startup. Changed
+// settings that need a restart are only logged.
+func (rl *Reloader) Reload() error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	env, err := godotenv.Read(rl.path())
+	if err != nil {
+		return fmt.Errorf("cannot read config: %w", err)
+	}
+
+	s, err := rl.parse(env)
+	if err != nil {
+		return err
+	}
+
+	rl.warnRestartRequired(env)
+	rl.apply(s)
+	rl.last = env
+	slog.Info("Config reloaded.", "path", rl.path())
+
+	return nil
+}
+
+func (rl *Reloader) parse(env map[string]string) (s settings, err error) {
+	getenv := func(key string) string {
+		if v, ok := env[key]; ok {
+			return v
+		}
+		return os.Getenv(key)
+	}
+
+	s.level, err = logging.ParseLevel(getenv("LOG_LEVEL"))
+	if err != nil {
+		return settings{}, err
+	}
+
+	if rl.Features != nil {
+		s.features, err = feature.Parse(getenv("FEATURES"))
+		if err != nil {
+			return settings{}, err
+		}
+	}
+
+	s.limits = make(map[string]*ratelimit.Limiter, len(rl.RateLimits))
+	for name := range rl.RateLimits {
+		s.limits[name], err = ratelimit.ConfigureFrom(name, getenv)
+		if err != nil {
+			return settings{}, err
+		}
+	}
+
+	if raw, ok := env["MAINTENANCE"]; ok && rl.Maintenance != nil {
+		on, err := strconv.ParseBool(raw)
+		if err != nil {
+			return settings{}, fmt.Errorf("MAINTENANCE misconfigured: %w", err)
+		}
+		s.maintenance = &on
+	}
+
+	return s, nil
+}
+
+func (rl *Reloader) apply(s settings) {
+	logging.SetLevel(s.level)
+	if rl.Features != nil {
+		rl.Features(s.features)
+	}
+	for name, l := range s.limits {
+		rl.RateLimits[name].Update(l)
+	}
+	if s.maintenance != nil {
+		rl.Maintenance.Set(*s.maintenance)
+	}
+}
+
+// reloadable reports whether key is applied by a reload.
+func (rl *Reloader) reloadable(key string) bool {
+	if slices.Contains([]string{"LOG_LEVEL", "FEATURES", "MAINTENANCE"}, key) {
+		return true
+	}
+	for name := range rl.RateLimits {
+		if key == name || key == name+"_OVERRIDES" || key == name+"_HEADERS" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// warnRestartRequired logs each setting that changed since the last read
+// but isn't reloadable. Values aren't logged since they may be secrets.
+func (rl *Reloader) warnRestartRequired(env map[string]string) {
+	if rl.last == nil {
+		return
+	}
+
+	for key, v := range env {
+		if old, ok := rl.last[key]; (!ok || old != v) && !rl.reloadable(key) {
+			slog.Warn("Setting changed but only takes effect after a restart.", "key", key)
+		}
+	}
+}
+
+// OnSignal reloads each time one of sigs arrives, e.g. SIGHUP. Rejected
+// reloads are logged and change nothing. It returns a function that stops
+// listening.
+func (rl *Reloader) OnSignal(sigs ...os.Signal) (stop func()) {
+	// The file as of startup is the baseline for restart warnings.
+	rl.mu.Lock()
+	rl.last, _ = godotenv.Read(rl.path())
+	rl.mu.Unlock()
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ch:
+				err := rl.Reload()
+				if err != nil {
+					slog.Error("Config reload rejected, keeping the running settings.", "err", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
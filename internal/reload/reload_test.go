@@ -0,0 +1,95 @@
+package reload_test
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/feature"
+	"github.com/ehubscher/goidp/internal/logging"
+	"github.com/ehubscher/goidp/internal/ratelimit"
+	"github.com/ehubscher/goidp/internal/reload"
+	"github.com/ehubscher/goidp/internal/server"
+)
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newReloader(t *testing.T) (rl *reload.Reloader, flags *feature.Flags) {
+	t.Helper()
+
+	t.Setenv("LOG_LEVEL", "")
+	t.Setenv("FEATURES", "")
+	t.Setenv("CLIENT_RATE_LIMIT", "")
+	logging.SetLevel(slog.LevelInfo)
+	t.Cleanup(func() { logging.SetLevel(slog.LevelInfo) })
+
+	flags = new(feature.Flags)
+	return &reload.Reloader{
+		Path:        filepath.Join(t.TempDir(), ".env"),
+		Features:    func(f feature.Flags) { *flags = f },
+		RateLimits:  map[string]*ratelimit.Limiter{"CLIENT_RATE_LIMIT": {}},
+		Maintenance: &server.Maintenance{},
+	}, flags
+}
+
+func TestReload(t *testing.T) {
+	rl, flags := newReloader(t)
+	writeConfig(t, rl.Path, "LOG_LEVEL=debug\nFEATURES=registration=false\nCLIENT_RATE_LIMIT=5/s\nMAINTENANCE=true\n")
+
+	err := rl.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := logging.Level(); got != slog.LevelDebug {
+		t.Errorf("got: %s, want: %s", got, slog.LevelDebug)
+	}
+	if flags.Enabled(feature.Registration) {
+		t.Errorf("got: registration enabled, want: disabled")
+	}
+	if got := rl.RateLimits["CLIENT_RATE_LIMIT"].Default; got != (ratelimit.Limit{Events: 5, Per: time.Second}) {
+		t.Errorf("got: %s, want: 5/s", got)
+	}
+	if !rl.Maintenance.Enabled() {
+		t.Error("got: maintenance off, want: on")
+	}
+}
+
+func TestReloadInvalid(t *testing.T) {
+	rl, flags := newReloader(t)
+	writeConfig(t, rl.Path, "LOG_LEVEL=warn\nCLIENT_RATE_LIMIT=5/s\n")
+	err := rl.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, content := range []string{
+		"LOG_LEVEL=loud\n",
+		"LOG_LEVEL=debug\nFEATURES=regisration=false\n",
+		"LOG_LEVEL=debug\nCLIENT_RATE_LIMIT=often\n",
+		"LOG_LEVEL=debug\nMAINTENANCE=maybe\n",
+	} {
+		writeConfig(t, rl.Path, content)
+		if err = rl.Reload(); err == nil {
+			t.Errorf("%q got: nil, want: an error", content)
+		}
+
+		if got := logging.Level(); got != slog.LevelWarn {
+			t.Errorf("%q got: %s, want: %s kept", content, got, slog.LevelWarn)
+		}
+		if got := rl.RateLimits["CLIENT_RATE_LIMIT"].Default; got != (ratelimit.Limit{Events: 5, Per: time.Second}) {
+			t.Errorf("%q got: %s, want: 5/s kept", content, got)
+		}
+		if !flags.Enabled(feature.Registration) || rl.Maintenance.Enabled() {
+			t.Errorf("%q got: flags or maintenance changed, want: kept", content)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Format is a representation WriteDocument can serve.
+type Format string
+
+const (
+	JSON Format = "json"
+	// HTML is the JSON document, indented, on a bare page, for looking at
+	// responses in a browser while debugging.
+	HTML Format = "html"
+)
+
+var defaultFormat atomic.Pointer[Format]
+
+var documentTemplate = template.Must(template.New("document").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body><pre>{{.Body}}</pre></body>
+</html>
+`))
+
+// ConfigureFormat reads RESPONSE_FORMAT, "json" or "html", the format for
+// requests whose Accept header prefers neither. It defaults to json.
+func ConfigureFormat() (Format, error) {
+	raw := os.Getenv("RESPONSE_FORMAT")
+	switch f := Format(raw); f {
+	case "":
+		return JSON, nil
+	case JSON, HTML:
+		return f, nil
+	default:
+		return "", fmt.Errorf("RESPONSE_FORMAT misconfigured: %q", raw)
+	}
+}
+
+// SetDefaultFormat replaces the format WriteDocument falls back to. It is
+// safe to call while responses are being written.
+func SetDefaultFormat(f Format) {
+	defaultFormat.Store(&f)
+}
+
+// DefaultFormat is the format WriteDocument falls back to.
+func DefaultFormat() Format {
+	if f := defaultFormat.Load(); f != nil {
+		return *f
+	}
+
+	return JSON
+}
+
+// Negotiate picks JSON or HTML by whichever of application/json and
+// text/html the Accept header gives the higher quality. Wildcards, ties and
+// a missing header leave it to DefaultFormat.
+func Negotiate(r *http.Request) Format {
+	return NegotiateOr(r, DefaultFormat())
+}
+
+// NegotiateOr is Negotiate falling back to fallback, for handlers whose
+// default, such as the login page's HTML, doesn't follow DefaultFormat.
+func NegotiateOr(r *http.Request, fallback Format) Format {
+	var jsonQ, htmlQ float64
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if raw, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(raw, 64)
+			if err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		case "text/html":
+			htmlQ = max(htmlQ, q)
+		}
+	}
+
+	switch {
+	case htmlQ > jsonQ:
+		return HTML
+	case jsonQ > htmlQ:
+		return JSON
+	default:
+		return fallback
+	}
+}
+
+// WriteDocument writes v with status in the format Negotiate picks. The
+// endpoints OAuth and OIDC specify keep writing JSON themselves; this is for
+// the account and admin APIs.
+func WriteDocument(w http.ResponseWriter, r *http.Request, status int, v any) {
+	w.Header().Add("Vary", "Accept")
+	if Negotiate(r) == JSON {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+		return
+	}
+
+	// The template escapes the document, so the encoder needn't.
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(v)
+	if err != nil {
+		slog.Error("Cannot encode document.", "path", r.URL.Path, "err", err)
+		http.Error(w, "Internal server error.", http.StatusInternalServerError)
+		return
+	}
+	var buf bytes.Buffer
+	err = documentTemplate.Execute(&buf, struct{ Title, Body string }{r.URL.Path, body.String()})
+	if err != nil {
+		slog.Error("Cannot render document.", "path", r.URL.Path, "err", err)
+		http.Error(w, "Internal server error.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; base-uri 'none'; frame-ancestors 'none'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
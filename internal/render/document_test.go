@@ -0,0 +1,58 @@
+package render_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/render"
+)
+
+func TestNegotiate(t *testing.T) {
+	var cases = []struct {
+		accept     string
+		defaultFmt render.Format
+		want       render.Format
+	}{
+		{"", render.JSON, render.JSON},
+		{"", render.HTML, render.HTML},
+		{"*/*", render.JSON, render.JSON},
+		{"application/json", render.HTML, render.JSON},
+		{"text/html", render.JSON, render.HTML},
+		{"text/html;q=0.5, application/json", render.HTML, render.JSON},
+		{"text/html, application/json;q=0.9", render.JSON, render.HTML},
+		{"text/html, application/json", render.JSON, render.JSON},
+		{"text/html;q=0", render.JSON, render.JSON},
+		{"text/html;q=bogus", render.JSON, render.JSON},
+	}
+
+	t.Cleanup(func() { render.SetDefaultFormat(render.JSON) })
+	for _, c := range cases {
+		render.SetDefaultFormat(c.defaultFmt)
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", c.accept)
+
+		if got := render.Negotiate(r); got != c.want {
+			t.Errorf("%q with default %s got: %s, want: %s", c.accept, c.defaultFmt, got, c.want)
+		}
+	}
+}
+
+func TestNegotiateOr(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if got := render.NegotiateOr(r, render.HTML); got != render.HTML {
+		t.Errorf("no Accept got: %s, want: %s", got, render.HTML)
+	}
+	r.Header.Set("Accept", "application/json;q=0, text/html")
+	if got := render.NegotiateOr(r, render.JSON); got != render.HTML {
+		t.Errorf("%q got: %s, want: %s", r.Header.Get("Accept"), got, render.HTML)
+	}
+}
+
+func TestConfigureFormat(t *testing.T) {
+	t.Setenv("RESPONSE_FORMAT", "xml")
+	_, err := render.ConfigureFormat()
+	if err == nil {
+		t.Errorf("got: nil, want: error")
+	}
+}
@@ -0,0 +1,244 @@
+// Package render renders the HTML pages users see during sign-in. Each page
+// has a default template embedded in the binary, which deployments can
+// replace by putting a file of the same name in a template directory. It
+// also negotiates between JSON and an HTML debugging view for the account
+// and admin APIs.
+package render
+
+import (
+	"bytes"
+	"crypto/rand"
+	"embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+//go:embed templates/*.html
+var defaultTemplates embed.FS
+
+// Template names, which are also the file names overrides are read from.
+const (
+	loginTemplate    = "login.html"
+	consentTemplate  = "consent.html"
+	deviceTemplate   = "device.html"
+	accountsTemplate = "accounts.html"
+	mfaTemplate      = "mfa.html"
+	logoutTemplate   = "logout.html"
+)
+
+var templateNames = []string{loginTemplate, consentTemplate, deviceTemplate, accountsTemplate, mfaTemplate, logoutTemplate}
+
+// UI is what a page gets to adapt its layout and language. It carries the raw
+// ui_locales parameter as well so it survives a form post.
+type UI struct {
+	Display   string
+	Locale    string
+	UILocales string
+}
+
+// Page holds the fields every page has. Nonce is set by the Renderer.
+type Page struct {
+	UI        UI
+	Error     string
+	CSRFToken string
+	// Nonce allows the page's inline styles and scripts under the
+	// Content-Security-Policy sent with it.
+	Nonce string
+}
+
+type LoginPage struct {
+	Page
+	ReturnTo        string
+	LoginHint       string
+	OfferRememberMe bool
+}
+
+type Scope struct {
+	Name        string
+	DisplayName string
+	Description string
+}
+
+type ConsentPage struct {
+	Page
+	ClientName string
+	Scopes     []Scope
+	Challenge  string
+}
+
+type DevicePage struct {
+	Page
+	ClientName string
+	UserCode   string
+}
+
+// MFAPage asks for the second factor after the password was accepted.
+// Challenge identifies the login waiting on it.
+type MFAPage struct {
+	Page
+	Challenge string
+}
+
+// LogoutPage asks the user to confirm signing out when the logout request
+// can't be trusted to come from them, and tells them it is done when there
+// is nowhere to send them back to.
+type LogoutPage struct {
+	Page
+	ClientName string
+	Challenge  string
+	SignedOut  bool
+}
+
+// Account is one signed-in account on the account chooser. URL continues
+// the authorization as that account.
+type Account struct {
+	Email string
+	URL   string
+}
+
+type AccountsPage struct {
+	Page
+	ClientName    string
+	Accounts      []Account
+	AddAccountURL string
+}
+
+// Renderer executes the page templates. html/template escapes every value
+// for the context it appears in, so overrides get the same protection as the
+// defaults.
+type Renderer struct {
+	templates map[string]*template.Template
+}
+
+var defaultRenderer = must(New(""))
+
+func must(r *Renderer, err error) *Renderer {
+	if err != nil {
+		panic(err)
+	}
+
+	return r
+}
+
+// Default returns the renderer for the embedded templates.
+func Default() *Renderer {
+	return defaultRenderer
+}
+
+// New parses the page templates, taking each from dir when it has a file of
+// that name and from the embedded defaults otherwise. An empty dir means the
+// defaults only.
+func New(dir string) (*Renderer, error) {
+	r := &Renderer{templates: make(map[string]*template.Template)}
+
+	var overrides fs.FS
+	if dir != "" {
+		overrides = os.DirFS(dir)
+	}
+
+	for _, name := range templateNames {
+		var source fs.FS = defaultTemplates
+		var path string = "templates/" + name
+		if overrides != nil {
+			_, err := fs.Stat(overrides, name)
+			if err == nil {
+				source, path = overrides, name
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("cannot read template %s: %w", name, err)
+			}
+		}
+
+		tmpl, err := template.New(name).ParseFS(source, path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse template %s: %w", name, err)
+		}
+		r.templates[name] = tmpl
+	}
+
+	return r, nil
+}
+
+// Configure reads TEMPLATE_DIR, the directory template overrides are read
+// from.
+func Configure() (*Renderer, error) {
+	dir := os.Getenv("TEMPLATE_DIR")
+	if dir == "" {
+		return Default(), nil
+	}
+
+	r, err := New(dir)
+	if err != nil {
+		return nil, fmt.Errorf("TEMPLATE_DIR misconfigured: %w", err)
+	}
+
+	return r, nil
+}
+
+func (r *Renderer) Login(w http.ResponseWriter, status int, page LoginPage) {
+	r.render(w, status, loginTemplate, &page.Page, &page)
+}
+
+func (r *Renderer) Consent(w http.ResponseWriter, status int, page ConsentPage) {
+	r.render(w, status, consentTemplate, &page.Page, &page)
+}
+
+func (r *Renderer) Device(w http.ResponseWriter, status int, page DevicePage) {
+	r.render(w, status, deviceTemplate, &page.Page, &page)
+}
+
+func (r *Renderer) Accounts(w http.ResponseWriter, status int, page AccountsPage) {
+	r.render(w, status, accountsTemplate, &page.Page, &page)
+}
+
+func (r *Renderer) MFA(w http.ResponseWriter, status int, page MFAPage) {
+	r.render(w, status, mfaTemplate, &page.Page, &page)
+}
+
+func (r *Renderer) Logout(w http.ResponseWriter, status int, page LogoutPage) {
+	r.render(w, status, logoutTemplate, &page.Page, &page)
+}
+
+// render executes the template into a buffer first, so a failing template
+// becomes a 500 rather than half a page.
+func (r *Renderer) render(w http.ResponseWriter, status int, name string, common *Page, data any) {
+	nonce, err := newNonce()
+	if err != nil {
+		slog.Error("Cannot generate CSP nonce.", "err", err)
+		http.Error(w, "Internal server error.", http.StatusInternalServerError)
+		return
+	}
+	common.Nonce = nonce
+
+	var buf bytes.Buffer
+	err = r.templates[name].Execute(&buf, data)
+	if err != nil {
+		slog.Error("Cannot render page.", "template", name, "err", err)
+		http.Error(w, "Internal server error.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Security-Policy", fmt.Sprintf(
+		"default-src 'none'; style-src 'nonce-%[1]s'; script-src 'nonce-%[1]s'; img-src 'self'; form-action 'self'; base-uri 'none'; frame-ancestors 'none'",
+		nonce,
+	))
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+func newNonce() (string, error) {
+	var b [16]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b[:]), nil
+}
@@ -0,0 +1,144 @@
+package render_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/render"
+)
+
+var nonceHeader = regexp.MustCompile(`'nonce-([A-Za-z0-9_-]+)'`)
+
+func TestDefaultLogin(t *testing.T) {
+	rec := httptest.NewRecorder()
+	render.Default().Login(rec, http.StatusUnauthorized, render.LoginPage{
+		Page: render.Page{
+			UI:        render.UI{Display: "popup", Locale: "fr"},
+			Error:     "Invalid <email> or password.",
+			CSRFToken: "csrf123",
+		},
+		ReturnTo:        "/authorize?a=1&b=2",
+		LoginHint:       `"><script>alert(1)</script>`,
+		OfferRememberMe: true,
+	})
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	var body string = rec.Body.String()
+	for _, want := range []string{
+		`lang="fr"`,
+		`data-display="popup"`,
+		`Invalid &lt;email&gt; or password.`,
+		`name="csrf_token" value="csrf123"`,
+		`value="/authorize?a=1&amp;b=2"`,
+		`name="remember_me"`,
+		`value="&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("got: %s, want: %s", body, want)
+		}
+	}
+
+	match := nonceHeader.FindStringSubmatch(rec.Header().Get("Content-Security-Policy"))
+	if match == nil {
+		t.Fatalf("got: %q, want: a CSP with a nonce", rec.Header().Get("Content-Security-Policy"))
+	}
+	if !strings.Contains(body, `<style nonce="`+match[1]+`">`) {
+		t.Errorf("got: %s, want: the style allowed by nonce %s", body, match[1])
+	}
+}
+
+func TestDefaultConsent(t *testing.T) {
+	rec := httptest.NewRecorder()
+	render.Default().Consent(rec, http.StatusOK, render.ConsentPage{
+		Page:       render.Page{CSRFToken: "csrf123"},
+		ClientName: "Example App",
+		Scopes:     []render.Scope{{Name: "email", DisplayName: "Email", Description: "Access your email address"}},
+		Challenge:  "challenge123",
+	})
+
+	var body string = rec.Body.String()
+	for _, want := range []string{
+		"Example App would like to:",
+		"<strong>Email</strong>: Access your email address",
+		`name="challenge" value="challenge123"`,
+		`name="csrf_token" value="csrf123"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("got: %s, want: %s", body, want)
+		}
+	}
+}
+
+func TestDefaultDevice(t *testing.T) {
+	rec := httptest.NewRecorder()
+	render.Default().Device(rec, http.StatusOK, render.DevicePage{ClientName: "TV", UserCode: "ABCD-EFGH"})
+
+	if body := rec.Body.String(); !strings.Contains(body, `value="ABCD-EFGH"`) || !strings.Contains(body, "Connect TV") {
+		t.Errorf("got: %s, want: the device form", body)
+	}
+}
+
+func TestOverride(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "login.html"), []byte(`<p class="custom">{{.Error}} {{.LoginHint}}</p>`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := render.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	r.Login(rec, http.StatusOK, render.LoginPage{Page: render.Page{Error: "<b>"}, LoginHint: "hint"})
+	if got, want := rec.Body.String(), `<p class="custom">&lt;b&gt; hint</p>`; got != want {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+
+	// Pages without an override keep the default.
+	rec = httptest.NewRecorder()
+	r.Consent(rec, http.StatusOK, render.ConsentPage{ClientName: "Example App"})
+	if !strings.Contains(rec.Body.String(), "Example App would like to:") {
+		t.Errorf("got: %s, want: the default consent page", rec.Body)
+	}
+}
+
+func TestOverrideParseError(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "consent.html"), []byte(`{{.Broken`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = render.New(dir)
+	if err == nil {
+		t.Error("got: nil, want: a parse error")
+	}
+}
+
+func TestRenderFailureIsInternalError(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "device.html"), []byte(`before {{.Missing}}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := render.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	r.Device(rec, http.StatusOK, render.DevicePage{})
+	if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "before") {
+		t.Errorf("got: %d %s, want: a 500 without partial output", rec.Code, rec.Body)
+	}
+}
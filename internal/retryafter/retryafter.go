@@ -0,0 +1,80 @@
+// Package retryafter writes the Retry-After header in the one format the
+// deployment has chosen, so every 429 and 503 the server sends reads the
+// same way to clients.
+package retryafter
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Format is how a Retry-After value is written, per RFC 9110 section 10.2.3.
+type Format string
+
+const (
+	// Seconds writes delta-seconds, such as "120".
+	Seconds Format = "seconds"
+	// HTTPDate writes an IMF-fixdate, such as
+	// "Sun, 06 Nov 1994 08:49:37 GMT".
+	HTTPDate Format = "http-date"
+)
+
+var format atomic.Pointer[Format]
+
+// Configure reads RETRY_AFTER_FORMAT, "seconds" or "http-date", which
+// defaults to seconds.
+func Configure() (Format, error) {
+	raw := os.Getenv("RETRY_AFTER_FORMAT")
+	switch f := Format(raw); f {
+	case "":
+		return Seconds, nil
+	case Seconds, HTTPDate:
+		return f, nil
+	default:
+		return "", fmt.Errorf("RETRY_AFTER_FORMAT misconfigured: %q", raw)
+	}
+}
+
+// SetFormat replaces the format Set writes. It is safe to call while
+// responses are being written.
+func SetFormat(f Format) {
+	format.Store(&f)
+}
+
+// CurrentFormat is the format Set writes.
+func CurrentFormat() Format {
+	if f := format.Load(); f != nil {
+		return *f
+	}
+
+	return Seconds
+}
+
+// Set sets the Retry-After header of h to tell clients to retry after d.
+func Set(h http.Header, d time.Duration) {
+	h.Set("Retry-After", Value(CurrentFormat(), time.Now(), d))
+}
+
+// Value formats the Retry-After value for a retry d after now. Both formats
+// are worked out from the same retry instant, rounded up to the whole
+// second, so neither lets a client retry too early.
+func Value(f Format, now time.Time, d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+
+	if f == HTTPDate {
+		at := now.Add(d)
+		if rounded := at.Truncate(time.Second); !rounded.Equal(at) {
+			at = rounded.Add(time.Second)
+		}
+		return at.UTC().Format(http.TimeFormat)
+	}
+
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
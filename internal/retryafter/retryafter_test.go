@@ -0,0 +1,96 @@
+package retryafter_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/retryafter"
+	"github.com/ehubscher/goidp/internal/server"
+)
+
+// retryAt parses a Retry-After value back into the instant it names.
+func retryAt(t *testing.T, now time.Time, value string) time.Time {
+	t.Helper()
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return now.Add(time.Duration(seconds) * time.Second)
+	}
+	at, err := http.ParseTime(value)
+	if err != nil {
+		t.Fatalf("got: %q, want: delta-seconds or an HTTP-date", value)
+	}
+
+	return at
+}
+
+func TestValueFormatsAgree(t *testing.T) {
+	now := time.Date(2024, 6, 1, 9, 0, 0, 250*int(time.Millisecond), time.UTC)
+
+	for _, d := range []time.Duration{0, 500 * time.Millisecond, 5 * time.Second, 2*time.Minute + 100*time.Millisecond} {
+		want := now.Add(d)
+		seconds := retryafter.Value(retryafter.Seconds, now, d)
+		date := retryafter.Value(retryafter.HTTPDate, now, d)
+
+		for _, value := range []string{seconds, date} {
+			got := retryAt(t, now, value)
+			// Rounding up to whole seconds may add up to a second, never
+			// take any away.
+			if got.Before(want) || got.Sub(want) > time.Second {
+				t.Errorf("%s: %q is %v, want: within a second after %v", d, value, got, want)
+			}
+		}
+	}
+}
+
+func TestValueFormats(t *testing.T) {
+	now := time.Date(2024, 6, 1, 9, 0, 0, 0, time.FixedZone("EDT", -4*60*60))
+
+	if got := retryafter.Value(retryafter.Seconds, now, 1500*time.Millisecond); got != "2" {
+		t.Errorf("seconds got: %q, want: %q", got, "2")
+	}
+	if got, want := retryafter.Value(retryafter.HTTPDate, now, 2*time.Minute), "Sat, 01 Jun 2024 13:02:00 GMT"; got != want {
+		t.Errorf("http-date got: %q, want: %q", got, want)
+	}
+}
+
+func TestSetUsesFormat(t *testing.T) {
+	defer retryafter.SetFormat(retryafter.CurrentFormat())
+	retryafter.SetFormat(retryafter.HTTPDate)
+
+	var m server.Maintenance
+	m.Set(true)
+	rec := httptest.NewRecorder()
+	m.Middleware()(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	got, err := http.ParseTime(rec.Header().Get("Retry-After"))
+	if err != nil {
+		t.Fatalf("got: %q, want: an HTTP-date", rec.Header().Get("Retry-After"))
+	}
+	if until := time.Until(got); until < time.Minute || until > 3*time.Minute {
+		t.Errorf("got: retry in %v, want: about two minutes", until)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	var configs = []struct {
+		env  string
+		want retryafter.Format
+		ok   bool
+	}{
+		{"", retryafter.Seconds, true},
+		{"seconds", retryafter.Seconds, true},
+		{"http-date", retryafter.HTTPDate, true},
+		{"rfc1123", "", false},
+	}
+
+	for _, c := range configs {
+		t.Setenv("RETRY_AFTER_FORMAT", c.env)
+		got, err := retryafter.Configure()
+		if got != c.want || (err == nil) != c.ok {
+			t.Errorf("%q got: %q, %v, want: %q", c.env, got, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+var ErrNotFound = errors.New("secret not found")
+
+// Source looks up secrets by name, e.g. PEPPER.
+type Source interface {
+	Get(name string) (string, error)
+}
+
+// Env reads secrets from environment variables of the same name.
+type Env struct{}
+
+func (Env) Get(name string) (string, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return "", ErrNotFound
+	}
+
+	return v, nil
+}
+
+// Dir reads secrets from files in a directory, one secret per file, as
+// Kubernetes mounts them. The file may be named exactly like the secret or in
+// lower case; a single trailing newline is dropped.
+type Dir struct {
+	Path string
+}
+
+func (d Dir) Get(name string) (string, error) {
+	if strings.ContainsAny(name, `/\`) || name == "" || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid secret name %q", name)
+	}
+
+	for _, file := range []string{name, strings.ToLower(name)} {
+		contents, err := os.ReadFile(filepath.Join(d.Path, file))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimSuffix(strings.TrimSuffix(string(contents), "\n"), "\r"), nil
+	}
+
+	return "", ErrNotFound
+}
+
+// Chain tries each source in turn, returning the first secret found.
+type Chain []Source
+
+func (c Chain) Get(name string) (string, error) {
+	for _, s := range c {
+		v, err := s.Get(name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+
+		return v, err
+	}
+
+	return "", ErrNotFound
+}
+
+var defaultSource atomic.Value
+
+func init() {
+	SetDefault(Env{})
+}
+
+func SetDefault(s Source) {
+	defaultSource.Store(&s)
+}
+
+func Default() Source {
+	return *defaultSource.Load().(*Source)
+}
+
+// Get looks up name in the default source.
+func Get(name string) (string, error) {
+	return Default().Get(name)
+}
+
+// Configure returns the source described by SECRETS_DIR: secrets mounted as
+// files there are preferred, falling back to the environment.
+func Configure() Source {
+	var dir string = os.Getenv("SECRETS_DIR")
+	if dir == "" {
+		return Env{}
+	}
+
+	return Chain{Dir{Path: dir}, Env{}}
+}
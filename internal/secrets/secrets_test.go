@@ -0,0 +1,79 @@
+package secrets_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/secrets"
+)
+
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "smtp_password"), []byte("s3cret\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := secrets.Dir{Path: dir}
+	v, err := source.Get("SMTP_PASSWORD")
+	if v != "s3cret" || err != nil {
+		t.Errorf("got: %q, %v, want: %q, nil", v, err, "s3cret")
+	}
+
+	_, err = source.Get("PEPPER")
+	if !errors.Is(err, secrets.ErrNotFound) {
+		t.Errorf("got: %v, want: %v", err, secrets.ErrNotFound)
+	}
+
+	_, err = source.Get("../smtp_password")
+	if err == nil || errors.Is(err, secrets.ErrNotFound) {
+		t.Errorf("got: %v, want: an invalid name error", err)
+	}
+}
+
+func TestChain(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "PEPPER"), []byte("v1:from-file"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PEPPER", "v1:from-env")
+	t.Setenv("DATA_KEY", "from-env")
+
+	var lookups = []struct {
+		name string
+		want string
+		err  error
+	}{
+		{"PEPPER", "v1:from-file", nil},
+		{"DATA_KEY", "from-env", nil},
+		{"MISSING", "", secrets.ErrNotFound},
+	}
+
+	chain := secrets.Chain{secrets.Dir{Path: dir}, secrets.Env{}}
+	for _, l := range lookups {
+		v, err := chain.Get(l.name)
+		if v != l.want || !errors.Is(err, l.err) {
+			t.Errorf("%s got: %q, %v, want: %q, %v", l.name, v, err, l.want, l.err)
+		}
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "pepper"), []byte("v1:from-file"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SECRETS_DIR", dir)
+
+	defer secrets.SetDefault(secrets.Default())
+	secrets.SetDefault(secrets.Configure())
+
+	v, err := secrets.Get("PEPPER")
+	if v != "v1:from-file" || err != nil {
+		t.Errorf("got: %q, %v, want: %q, nil", v, err, "v1:from-file")
+	}
+}
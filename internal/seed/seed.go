@@ -0,0 +1,182 @@
+// Package seed creates the first admin user and OAuth client of a fresh
+// install, so a new deployment can be logged into without hand-written SQL.
+// Seeding only ever adds to empty tables: once any user or client exists,
+// the matching half of the seed is skipped, so it is safe to leave enabled.
+package seed
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ehubscher/goidp/internal/authn"
+	"github.com/ehubscher/goidp/internal/oauth"
+	"github.com/ehubscher/goidp/internal/secrets"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+const clientSecretBytes = 32
+
+// errStop ends a store iteration early.
+var errStop = errors.New("stop")
+
+// Seed is what to create on first boot. The zero value seeds nothing.
+type Seed struct {
+	// AdminEmail and AdminPasswordHash make up the admin user. The
+	// password is given as an encoded hash, as authn.GenerateHash makes,
+	// so that the password itself never sits in config. Empty means no
+	// admin user.
+	AdminEmail        string
+	AdminPasswordHash string
+
+	// Client is the first OAuth client, without a secret: Run generates
+	// one. An empty ID means no client.
+	Client store.Client
+}
+
+// Result is what Run created. ClientSecret is the seeded client's secret,
+// which is stored only as a hash, so the caller has to show it now or never.
+type Result struct {
+	Admin        *store.User
+	Client       *store.Client
+	ClientSecret string
+}
+
+// Configure reads SEED_ON_FIRST_BOOT, which defaults to false. When it is
+// true, SEED_ADMIN_EMAIL and the SEED_ADMIN_PASSWORD_HASH secret give the
+// admin user, and SEED_CLIENT_ID, SEED_CLIENT_NAME and the comma-separated
+// SEED_CLIENT_REDIRECT_URIS the client. Either half may be left out.
+func Configure() (s Seed, err error) {
+	raw := os.Getenv("SEED_ON_FIRST_BOOT")
+	if raw == "" {
+		return Seed{}, nil
+	}
+	enabled, err := strconv.ParseBool(raw)
+	if err != nil {
+		return Seed{}, fmt.Errorf("SEED_ON_FIRST_BOOT misconfigured: %w", err)
+	}
+	if !enabled {
+		return Seed{}, nil
+	}
+
+	s.AdminPasswordHash, err = secrets.Get("SEED_ADMIN_PASSWORD_HASH")
+	if err != nil && !errors.Is(err, secrets.ErrNotFound) {
+		return Seed{}, err
+	}
+	if raw := os.Getenv("SEED_ADMIN_EMAIL"); raw != "" || s.AdminPasswordHash != "" {
+		s.AdminEmail, err = authn.EmailValidator{}.Normalize(context.Background(), raw)
+		if err != nil {
+			return Seed{}, fmt.Errorf("SEED_ADMIN_EMAIL misconfigured: %w", err)
+		}
+		_, err = authn.DescribeHash(s.AdminPasswordHash)
+		if err != nil {
+			return Seed{}, fmt.Errorf("SEED_ADMIN_PASSWORD_HASH misconfigured: %w", err)
+		}
+	}
+
+	s.Client.ID = os.Getenv("SEED_CLIENT_ID")
+	if s.Client.ID == "" {
+		return s, nil
+	}
+	s.Client.Name = os.Getenv("SEED_CLIENT_NAME")
+	for _, uri := range strings.Split(os.Getenv("SEED_CLIENT_REDIRECT_URIS"), ",") {
+		if uri = strings.TrimSpace(uri); uri != "" {
+			s.Client.RedirectURIs = append(s.Client.RedirectURIs, uri)
+		}
+	}
+
+	allowHTTP, err := oauth.ConfigureInsecureRedirectURIs()
+	if err != nil {
+		return Seed{}, err
+	}
+	err = oauth.ValidateClient(s.Client, allowHTTP)
+	if err != nil {
+		return Seed{}, fmt.Errorf("SEED_CLIENT_* misconfigured: %w", err)
+	}
+
+	return s, nil
+}
+
+// Run creates the admin user if users has none and the client if clients
+// has none. Existing data is never changed. A nil clients skips the client:
+// seeding a store that doesn't persist would make a new client, and print a
+// new secret, on every boot.
+func (s Seed) Run(ctx context.Context, users store.UserStore, clients store.ClientStore) (res Result, err error) {
+	if s.AdminEmail != "" {
+		res.Admin, err = s.seedAdmin(ctx, users)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	if s.Client.ID != "" && clients != nil {
+		res.Client, res.ClientSecret, err = s.seedClient(ctx, clients)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	return res, nil
+}
+
+func (s Seed) seedAdmin(ctx context.Context, users store.UserStore) (*store.User, error) {
+	err := users.EachUser(ctx, func(store.User) error { return errStop })
+	if errors.Is(err, errStop) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot check for existing users: %w", err)
+	}
+
+	user, err := users.CreateUser(ctx, s.AdminEmail, s.AdminPasswordHash)
+	if errors.Is(err, store.ErrConflict) {
+		// Another instance seeded it first.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot create admin user: %w", err)
+	}
+	// The address comes from the operator, not a signup form.
+	err = users.SetEmailVerified(ctx, user.ID, true)
+	if err != nil {
+		return nil, fmt.Errorf("cannot verify admin email: %w", err)
+	}
+	user.EmailVerified = true
+
+	return &user, nil
+}
+
+func (s Seed) seedClient(ctx context.Context, clients store.ClientStore) (*store.Client, string, error) {
+	existing, _, err := clients.ListClients(ctx, store.ClientFilter{}, 1, "")
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot check for existing clients: %w", err)
+	}
+	if len(existing) > 0 {
+		return nil, "", nil
+	}
+
+	b := make([]byte, clientSecretBytes)
+	_, err = rand.Read(b)
+	if err != nil {
+		return nil, "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+
+	client := s.Client
+	client.TokenEndpointAuthMethod = oauth.AuthMethodSecretBasic
+	client.SecretHash, err = authn.GenerateHash(ctx, "argon2id", secret)
+	if err != nil {
+		return nil, "", err
+	}
+	err = clients.PutClient(ctx, client)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot create client: %w", err)
+	}
+
+	return &client, secret, nil
+}
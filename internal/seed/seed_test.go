@@ -0,0 +1,149 @@
+package seed_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/authn"
+	"github.com/ehubscher/goidp/internal/seed"
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+// setSeedEnv configures a full seed and returns the admin password hash.
+func setSeedEnv(t *testing.T) (passwordHash string) {
+	t.Helper()
+
+	t.Setenv("BCRYPT_COST", "4")
+	t.Setenv("ARGON2ID_MEMORY", "1024")
+	t.Setenv("ARGON2ID_ITERATIONS", "1")
+	t.Setenv("ARGON2ID_PARALLELISM", "1")
+	t.Setenv("ARGON2ID_SALT_LENGTH", "16")
+	t.Setenv("ARGON2ID_KEY_LENGTH", "32")
+
+	passwordHash, err := authn.GenerateHash(context.Background(), "argon2id", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("SEED_ON_FIRST_BOOT", "true")
+	t.Setenv("SEED_ADMIN_EMAIL", " Admin@Example.com ")
+	t.Setenv("SEED_ADMIN_PASSWORD_HASH", passwordHash)
+	t.Setenv("SEED_CLIENT_ID", "console")
+	t.Setenv("SEED_CLIENT_NAME", "Admin console")
+	t.Setenv("SEED_CLIENT_REDIRECT_URIS", "https://console.example/callback, https://console.example/alt")
+
+	return passwordHash
+}
+
+func TestSeedEmpty(t *testing.T) {
+	hash := setSeedEnv(t)
+	s, err := seed.Configure()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	users, clients := store.NewMemoryUserStore(), store.NewMemoryClientStore()
+	res, err := s.Run(ctx, users, clients)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Admin == nil {
+		t.Fatal("got: no admin, want: admin")
+	}
+	admin, err := users.GetUserByEmail(ctx, "admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admin.PasswordHash != hash || !admin.EmailVerified {
+		t.Errorf("got: %+v, want: verified admin with the configured hash", admin)
+	}
+
+	if res.Client == nil || res.ClientSecret == "" {
+		t.Fatal("got: no client, want: client with secret")
+	}
+	client, err := clients.GetClient(ctx, "console")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(client.RedirectURIs) != 2 || client.Type() != store.ClientConfidential {
+		t.Errorf("got: %+v, want: confidential client with 2 redirect URIs", client)
+	}
+	match, err := authn.VerifyPassword(context.Background(), res.ClientSecret, client.SecretHash)
+	if err != nil || !match {
+		t.Errorf("got: %v, %v, want: secret matching its stored hash", match, err)
+	}
+}
+
+func TestSeedSkipsExistingData(t *testing.T) {
+	s := seed.Seed{
+		AdminEmail:        "admin@example.com",
+		AdminPasswordHash: "h1",
+		Client:            store.Client{ID: "console"},
+	}
+
+	ctx := context.Background()
+	users := store.NewMemoryUserStore()
+	existing, err := users.CreateUser(ctx, "someone@example.com", "h0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients := store.NewMemoryClientStore(store.Client{ID: "app", Name: "App"})
+
+	res, err := s.Run(ctx, users, clients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Admin != nil || res.Client != nil || res.ClientSecret != "" {
+		t.Errorf("got: %+v, want: nothing seeded", res)
+	}
+
+	_, err = users.GetUserByEmail(ctx, "admin@example.com")
+	if err != store.ErrNotFound {
+		t.Errorf("got: %v, want: %v", err, store.ErrNotFound)
+	}
+	got, err := users.GetUserByID(ctx, existing.ID)
+	if err != nil || got.PasswordHash != "h0" {
+		t.Errorf("got: %+v, %v, want: existing user untouched", got, err)
+	}
+	_, err = clients.GetClient(ctx, "console")
+	if err != store.ErrNotFound {
+		t.Errorf("got: %v, want: %v", err, store.ErrNotFound)
+	}
+}
+
+func TestSeedWithoutClientStore(t *testing.T) {
+	s := seed.Seed{Client: store.Client{ID: "console"}}
+
+	res, err := s.Run(context.Background(), store.NewMemoryUserStore(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Client != nil || res.ClientSecret != "" {
+		t.Errorf("got: %+v, want: no client seeded", res)
+	}
+}
+
+func TestConfigureSeed(t *testing.T) {
+	t.Setenv("SEED_ON_FIRST_BOOT", "")
+	s, err := seed.Configure()
+	if err != nil || s.AdminEmail != "" || s.Client.ID != "" {
+		t.Errorf("got: %+v, %v, want: zero seed", s, err)
+	}
+
+	for _, c := range []struct{ env, value string }{
+		{"SEED_ON_FIRST_BOOT", "maybe"},
+		{"SEED_ADMIN_EMAIL", "not-an-email"},
+		{"SEED_ADMIN_PASSWORD_HASH", "password123"},
+		{"SEED_CLIENT_REDIRECT_URIS", "http://console.example/callback"},
+	} {
+		setSeedEnv(t)
+		t.Setenv(c.env, c.value)
+
+		_, err := seed.Configure()
+		if err == nil {
+			t.Errorf("%s=%s: got: nil, want: error", c.env, c.value)
+		}
+	}
+}
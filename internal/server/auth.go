@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/ehubscher/goidp/internal/httpauth"
+)
+
+// TokenValidator checks a bearer token and returns what it grants. Any
+// error is reported to the client as invalid_token.
+type TokenValidator func(ctx context.Context, token string) (Token, error)
+
+// RequireAuth only lets requests through that carry a valid bearer token,
+// and attaches the token to the request context for RequireScope and the
+// handler. Responses follow RFC 6750 section 3.1: no credentials get a bare
+// challenge, a malformed header gets 400 invalid_request and a rejected
+// token 401 invalid_token.
+func RequireAuth(validate TokenValidator) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw, err := httpauth.ParseBearer(r.Header.Get("Authorization"))
+			if errors.Is(err, httpauth.ErrMissing) || errors.Is(err, httpauth.ErrScheme) {
+				challenge(w, http.StatusUnauthorized, "", "", "")
+				return
+			}
+			if err != nil {
+				challenge(w, http.StatusBadRequest, "invalid_request", "The Authorization header is malformed.", "")
+				return
+			}
+
+			token, err := validate(r.Context(), raw)
+			if err != nil {
+				slog.Debug("Rejected bearer token.", "err", err)
+				challenge(w, http.StatusUnauthorized, "invalid_token", "The access token is invalid or expired.", "")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithToken(r.Context(), token)))
+		})
+	}
+}
+
+// challenge writes the WWW-Authenticate header and JSON body of a bearer
+// error. An empty code is the bare challenge for missing credentials.
+func challenge(w http.ResponseWriter, status int, code, description, scope string) {
+	w.Header().Set("WWW-Authenticate", httpauth.BearerChallenge(realm, code, description, scope))
+	writeBearerError(w, status, code, description)
+}
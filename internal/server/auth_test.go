@@ -0,0 +1,63 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/server"
+)
+
+func validateTestToken(ctx context.Context, token string) (server.Token, error) {
+	if token != "good" {
+		return server.Token{}, errors.New("unknown token")
+	}
+
+	return server.Token{Subject: "1", Scopes: []string{"openid"}}, nil
+}
+
+const (
+	malformedChallenge = `Bearer realm="goidp", error="invalid_request", error_description="The Authorization header is malformed."`
+	invalidChallenge   = `Bearer realm="goidp", error="invalid_token", error_description="The access token is invalid or expired."`
+)
+
+var authHeaders = []struct {
+	header    string
+	status    int
+	challenge string
+}{
+	{"Bearer good", http.StatusOK, ""},
+	{"bearer   good ", http.StatusOK, ""},
+	{"", http.StatusUnauthorized, `Bearer realm="goidp"`},
+	{"Basic Z29vZDo=", http.StatusUnauthorized, `Bearer realm="goidp"`},
+	{"good", http.StatusUnauthorized, `Bearer realm="goidp"`},
+	{"Bearer", http.StatusBadRequest, malformedChallenge},
+	{"Bearer good extra", http.StatusBadRequest, malformedChallenge},
+	{"Bearer bad", http.StatusUnauthorized, invalidChallenge},
+}
+
+func TestRequireAuth(t *testing.T) {
+	h := server.RequireAuth(validateTestToken)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := server.TokenFromContext(r.Context()); !ok || token.Subject != "1" {
+			t.Errorf("got: %+v, want: the validated token in the context", token)
+		}
+	}))
+
+	for _, c := range authHeaders {
+		r := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+		if c.header != "" {
+			r.Header.Set("Authorization", c.header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+
+		if rec.Code != c.status {
+			t.Errorf("%q got: %d, want: %d", c.header, rec.Code, c.status)
+		}
+		if got := rec.Header().Get("WWW-Authenticate"); got != c.challenge {
+			t.Errorf("%q got: %s, want: %s", c.header, got, c.challenge)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/retryafter"
+)
+
+const concurrencyRetryAfter = time.Second
+
+// semaphore is a counting semaphore over a buffered channel: a request holds
+// a slot while its token sits in the buffer.
+type semaphore chan struct{}
+
+// acquire takes a slot, waiting up to wait for one to free up and giving up
+// early if r's context ends.
+func (s semaphore) acquire(r *http.Request, wait time.Duration) bool {
+	select {
+	case s <- struct{}{}:
+		return true
+	default:
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case s <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+func (s semaphore) release() {
+	<-s
+}
+
+// LimitConcurrency lets at most n requests through at once. A request that
+// finds every slot taken waits up to wait for one, as long as its context
+// lasts, and otherwise gets 503 with Retry-After, so a burst is shed rather
+// than queued without bound. An n of zero or less means no limit. Wrap
+// individual handlers to give endpoints their own limits, or use
+// ConcurrencyLimits for a whole mux.
+func LimitConcurrency(n int, wait time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		if n <= 0 {
+			return next
+		}
+
+		return limit(make(semaphore, n), wait, next)
+	}
+}
+
+func limit(sem semaphore, wait time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !sem.acquire(r, wait) {
+			retryafter.Set(w.Header(), concurrencyRetryAfter)
+			w.Header().Set("Cache-Control", "no-store")
+			http.Error(w, "Too many requests in flight, retry later.", http.StatusServiceUnavailable)
+			return
+		}
+		defer sem.release()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ConcurrencyLimits caps the requests in flight across the server at Max,
+// and on the paths in Overrides, typically the ones hashing passwords such
+// as /token and /login, at a tighter limit of their own on top. Unlike rate
+// limiting, which counts requests over time, this bounds the memory and CPU
+// held at any one moment, which is what a burst of argon2id hashes
+// exhausts. Wait is how long a request may wait for a slot; zero turns it
+// away at once.
+type ConcurrencyLimits struct {
+	Max       int
+	Overrides map[string]int
+	Wait      time.Duration
+}
+
+// ConfigureConcurrencyLimits reads MAX_IN_FLIGHT, which defaults to no
+// limit, MAX_IN_FLIGHT_OVERRIDES, a comma-separated list of path=limit
+// pairs such as "/token=8,/login=8", and MAX_IN_FLIGHT_WAIT.
+func ConfigureConcurrencyLimits() (c ConcurrencyLimits, err error) {
+	if raw := os.Getenv("MAX_IN_FLIGHT"); raw != "" {
+		c.Max, err = strconv.Atoi(raw)
+		if err != nil || c.Max < 0 {
+			return ConcurrencyLimits{}, fmt.Errorf("MAX_IN_FLIGHT misconfigured: %q", raw)
+		}
+	}
+
+	if raw := os.Getenv("MAX_IN_FLIGHT_OVERRIDES"); raw != "" {
+		c.Overrides = make(map[string]int)
+		for _, pair := range strings.Split(raw, ",") {
+			path, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			n, err := strconv.Atoi(value)
+			if !ok || !strings.HasPrefix(path, "/") || err != nil || n < 1 {
+				return ConcurrencyLimits{}, fmt.Errorf("MAX_IN_FLIGHT_OVERRIDES misconfigured: %q is not path=limit", pair)
+			}
+			c.Overrides[path] = n
+		}
+	}
+
+	if raw := os.Getenv("MAX_IN_FLIGHT_WAIT"); raw != "" {
+		c.Wait, err = time.ParseDuration(raw)
+		if err != nil || c.Wait < 0 {
+			return ConcurrencyLimits{}, fmt.Errorf("MAX_IN_FLIGHT_WAIT misconfigured: %q", raw)
+		}
+	}
+
+	return c, nil
+}
+
+// Middleware enforces the limits. The semaphores are made here, so every
+// handler wrapped by the returned Middleware shares the same slots. A
+// request on an overridden path takes its route's slot before a global one,
+// so a burst queued on /token never holds global slots the other paths
+// need.
+func (c ConcurrencyLimits) Middleware() Middleware {
+	var global semaphore
+	if c.Max > 0 {
+		global = make(semaphore, c.Max)
+	}
+	routes := make(map[string]semaphore, len(c.Overrides))
+	for path, n := range c.Overrides {
+		routes[path] = make(semaphore, n)
+	}
+
+	return func(next http.Handler) http.Handler {
+		if global != nil {
+			next = limit(global, c.Wait, next)
+		}
+		if len(routes) == 0 {
+			return next
+		}
+		limited := make(map[string]http.Handler, len(routes))
+		for path, sem := range routes {
+			limited[path] = limit(sem, c.Wait, next)
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if h, ok := limited[r.URL.Path]; ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
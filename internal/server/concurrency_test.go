@@ -0,0 +1,186 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/server"
+)
+
+// blocking is a handler whose requests hold their slot until release is
+// closed. entered receives one value per request that got in.
+type blocking struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newBlocking() *blocking {
+	return &blocking{entered: make(chan struct{}, 16), release: make(chan struct{})}
+}
+
+func (b *blocking) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.entered <- struct{}{}
+	<-b.release
+}
+
+// fill sends n requests for path to h and waits until they are all inside.
+func fill(t *testing.T, h http.Handler, b *blocking, path string, n int) *sync.WaitGroup {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+		}()
+	}
+	for range n {
+		<-b.entered
+	}
+
+	return &wg
+}
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestLimitConcurrencyRejectsWhenFull(t *testing.T) {
+	b := newBlocking()
+	h := server.LimitConcurrency(2, 0)(b)
+	wg := fill(t, h, b, "/token", 2)
+
+	rec := serve(h, httptest.NewRequest(http.MethodPost, "/token", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("got: no Retry-After, want: one")
+	}
+
+	close(b.release)
+	wg.Wait()
+}
+
+func TestLimitConcurrencyFreesSlot(t *testing.T) {
+	b := newBlocking()
+	h := server.LimitConcurrency(1, 0)(b)
+	wg := fill(t, h, b, "/token", 1)
+
+	close(b.release)
+	wg.Wait()
+
+	rec := serve(h, httptest.NewRequest(http.MethodPost, "/token", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestLimitConcurrencyWaitsForSlot(t *testing.T) {
+	b := newBlocking()
+	h := server.LimitConcurrency(1, time.Minute)(b)
+	wg := fill(t, h, b, "/token", 1)
+
+	done := make(chan int)
+	go func() {
+		done <- serve(h, httptest.NewRequest(http.MethodPost, "/token", nil)).Code
+	}()
+	close(b.release)
+	wg.Wait()
+
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("got: %d, want: %d", code, http.StatusOK)
+	}
+}
+
+func TestLimitConcurrencyWaiterHonorsContext(t *testing.T) {
+	b := newBlocking()
+	h := server.LimitConcurrency(1, time.Hour)(b)
+	wg := fill(t, h, b, "/token", 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	rec := serve(h, httptest.NewRequest(http.MethodPost, "/token", nil).WithContext(ctx))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	close(b.release)
+	wg.Wait()
+}
+
+func TestConcurrencyLimitsByPath(t *testing.T) {
+	b := newBlocking()
+	h := server.ConcurrencyLimits{Max: 4, Overrides: map[string]int{"/token": 1}}.Middleware()(b)
+	wg := fill(t, h, b, "/token", 1)
+
+	if rec := serve(h, httptest.NewRequest(http.MethodPost, "/token", nil)); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("/token got: %d, want: %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	// Other paths only count against the global limit, which has room.
+	other := fill(t, h, b, "/userinfo", 3)
+	if rec := serve(h, httptest.NewRequest(http.MethodGet, "/userinfo", nil)); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("/userinfo got: %d, want: %d once the global limit is reached", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	close(b.release)
+	wg.Wait()
+	other.Wait()
+}
+
+func TestConcurrencyLimitsRouteWaitersDontStarveOthers(t *testing.T) {
+	b := newBlocking()
+	h := server.ConcurrencyLimits{Max: 2, Overrides: map[string]int{"/token": 1}, Wait: time.Hour}.Middleware()(b)
+	wg := fill(t, h, b, "/token", 1)
+
+	// These queue for the /token slot and must not take the global one.
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve(h, httptest.NewRequest(http.MethodPost, "/token", nil))
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		serve(h, httptest.NewRequest(http.MethodGet, "/userinfo", nil))
+	}()
+	select {
+	case <-b.entered:
+	case <-time.After(5 * time.Second):
+		t.Error("/userinfo got: blocked behind /token waiters, want: a global slot")
+	}
+
+	close(b.release)
+	wg.Wait()
+}
+
+func TestConfigureConcurrencyLimits(t *testing.T) {
+	t.Setenv("MAX_IN_FLIGHT", "64")
+	t.Setenv("MAX_IN_FLIGHT_OVERRIDES", "/token=8, /login=4")
+	t.Setenv("MAX_IN_FLIGHT_WAIT", "250ms")
+
+	c, err := server.ConfigureConcurrencyLimits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Max != 64 || c.Overrides["/token"] != 8 || c.Overrides["/login"] != 4 || c.Wait != 250*time.Millisecond {
+		t.Errorf("got: %+v, want: 64, /token=8, /login=4, 250ms", c)
+	}
+
+	t.Setenv("MAX_IN_FLIGHT_OVERRIDES", "/token=0")
+	if _, err := server.ConfigureConcurrencyLimits(); err == nil {
+		t.Error("got: nil, want: an error for a zero limit")
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultDeregisterDelay = 5 * time.Second
+	defaultGracePeriod     = 30 * time.Second
+)
+
+// Readiness serves /readyz. It reports ready until draining starts, which
+// tells load balancers and orchestrators to stop routing new traffic here.
+type Readiness struct {
+	draining atomic.Bool
+}
+
+func (rd *Readiness) Draining() bool {
+	return rd.draining.Load()
+}
+
+func (rd *Readiness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if rd.Draining() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("draining\n"))
+		return
+	}
+
+	w.Write([]byte("ok\n"))
+}
+
+// Drain shuts a server down without dropping traffic: readiness fails
+// first, the server keeps serving for DeregisterDelay while it is taken out
+// of rotation, and only then stops accepting connections and waits up to
+// GracePeriod for requests in flight.
+type Drain struct {
+	Readiness *Readiness
+	// DeregisterDelay is how long to keep serving after readiness fails.
+	// Zero means 5 seconds.
+	DeregisterDelay time.Duration
+	// GracePeriod bounds the wait for requests in flight. Zero means 30
+	// seconds.
+	GracePeriod time.Duration
+}
+
+// ConfigureDrain reads SHUTDOWN_DEREGISTER_DELAY and SHUTDOWN_GRACE_PERIOD,
+// both Go durations.
+func ConfigureDrain(readiness *Readiness) (d Drain, err error) {
+	d.Readiness = readiness
+
+	for _, c := range []struct {
+		env string
+		v   *time.Duration
+	}{
+		{"SHUTDOWN_DEREGISTER_DELAY", &d.DeregisterDelay},
+		{"SHUTDOWN_GRACE_PERIOD", &d.GracePeriod},
+	} {
+		raw := os.Getenv(c.env)
+		if raw == "" {
+			continue
+		}
+		*c.v, err = time.ParseDuration(raw)
+		if err != nil || *c.v < 0 {
+			return Drain{}, fmt.Errorf("%s misconfigured: %q", c.env, raw)
+		}
+	}
+
+	return d, nil
+}
+
+func (d Drain) deregisterDelay() time.Duration {
+	if d.DeregisterDelay > 0 {
+		return d.DeregisterDelay
+	}
+
+	return defaultDeregisterDelay
+}
+
+func (d Drain) gracePeriod() time.Duration {
+	if d.GracePeriod > 0 {
+		return d.GracePeriod
+	}
+
+	return defaultGracePeriod
+}
+
+// Shutdown drains srv. Requests still running when the grace period ends
+// are cut off and reported in the error.
+func (d Drain) Shutdown(srv *http.Server) error {
+	d.Readiness.draining.Store(true)
+	slog.Info("Draining, readiness now failing.", "deregister_delay", d.deregisterDelay(), "grace_period", d.gracePeriod())
+	time.Sleep(d.deregisterDelay())
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.gracePeriod())
+	defer cancel()
+
+	err := srv.Shutdown(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn("Grace period ended with requests in flight, closing.")
+		return errors.Join(err, srv.Close())
+	}
+
+	return err
+}
+
+// ShutdownOnSignal drains srv when one of sigs arrives, such as SIGTERM.
+// The returned channel gets Shutdown's result.
+func (d Drain) ShutdownOnSignal(srv *http.Server, sigs ...os.Signal) <-chan error {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	done := make(chan error, 1)
+
+	go func() {
+		sig := <-ch
+		signal.Stop(ch)
+		slog.Info("Shutdown signal received.", "signal", sig.String())
+		done <- d.Shutdown(srv)
+	}()
+
+	return done
+}
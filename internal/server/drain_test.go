@@ -0,0 +1,88 @@
+package server_test
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/server"
+)
+
+func TestDrain(t *testing.T) {
+	var ready server.Readiness
+	started, release := make(chan struct{}), make(chan struct{})
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /readyz", &ready)
+	mux.HandleFunc("GET /slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+	var base string = "http://" + ln.Addr().String()
+
+	get := func(path string) (int, error) {
+		resp, err := http.Get(base + path)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	if code, err := get("/readyz"); err != nil || code != http.StatusOK {
+		t.Fatalf("before shutdown got: %d, %v, want: %d", code, err, http.StatusOK)
+	}
+
+	slow := make(chan int, 1)
+	go func() {
+		code, _ := get("/slow")
+		slow <- code
+	}()
+	<-started
+
+	drain := server.Drain{Readiness: &ready, DeregisterDelay: time.Second, GracePeriod: 5 * time.Second}
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- drain.Shutdown(srv) }()
+
+	for !ready.Draining() {
+		time.Sleep(time.Millisecond)
+	}
+	if code, err := get("/readyz"); err != nil || code != http.StatusServiceUnavailable {
+		t.Errorf("draining got: %d, %v, want: %d", code, err, http.StatusServiceUnavailable)
+	}
+
+	close(release)
+	if code := <-slow; code != http.StatusOK {
+		t.Errorf("in-flight request got: %d, want: %d", code, http.StatusOK)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("got: %v, want: nil", err)
+	}
+}
+
+func TestConfigureDrain(t *testing.T) {
+	t.Setenv("SHUTDOWN_DEREGISTER_DELAY", "10s")
+	t.Setenv("SHUTDOWN_GRACE_PERIOD", "1m")
+
+	d, err := server.ConfigureDrain(&server.Readiness{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.DeregisterDelay != 10*time.Second || d.GracePeriod != time.Minute {
+		t.Errorf("got: %+v, want: 10s and 1m", d)
+	}
+
+	t.Setenv("SHUTDOWN_GRACE_PERIOD", "soon")
+	if _, err = server.ConfigureDrain(&server.Readiness{}); err == nil {
+		t.Error("got: nil, want: an error")
+	}
+}
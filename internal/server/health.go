@@ -0,0 +1,11 @@
+package server
+
+import "net/http"
+
+// Healthz reports that the process is up and serving. It deliberately checks
+// nothing else, so it stays available in maintenance mode.
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte("ok\n"))
+}
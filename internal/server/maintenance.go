@@ -0,0 +1,109 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/retryafter"
+)
+
+const maintenanceRetryAfter = 2 * time.Minute
+
+// Maintenance is a switch for putting the server into maintenance mode. The
+// zero value is off.
+type Maintenance struct {
+	on atomic.Bool
+}
+
+func (m *Maintenance) Enabled() bool {
+	return m.on.Load()
+}
+
+func (m *Maintenance) Set(on bool) {
+	if m.on.Swap(on) != on {
+		slog.Warn("Maintenance mode changed.", "enabled", on)
+	}
+}
+
+// Middleware answers 503 with Retry-After while maintenance mode is on,
+// except for requests whose path starts with one of the exempt prefixes,
+// such as "/healthz". The flag is only checked as a request arrives, so
+// requests already in flight when it is switched on run to completion.
+func (m *Maintenance) Middleware(exempt ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !m.Enabled() || hasAnyPrefix(r.URL.Path, exempt) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			retryafter.Set(w.Header(), maintenanceRetryAfter)
+			w.Header().Set("Cache-Control", "no-store")
+			http.Error(w, "Down for maintenance, retry later.", http.StatusServiceUnavailable)
+		})
+	}
+}
+
+// ServeHTTP is the admin endpoint for the switch: GET reports the state,
+// PUT turns maintenance on and DELETE turns it off. It must be mounted
+// behind admin authentication and exempted from the middleware.
+func (m *Maintenance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		m.Set(true)
+	case http.MethodDelete:
+		m.Set(false)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "Method not allowed.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if m.Enabled() {
+		w.Write([]byte(`{"maintenance":true}` + "\n"))
+		return
+	}
+	w.Write([]byte(`{"maintenance":false}` + "\n"))
+}
+
+// ToggleOnSignal flips maintenance mode each time one of sigs arrives, e.g.
+// SIGUSR1. It returns a function that stops listening.
+func (m *Maintenance) ToggleOnSignal(sigs ...os.Signal) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ch:
+				m.Set(!m.Enabled())
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+func hasAnyPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
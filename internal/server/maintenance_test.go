@@ -0,0 +1,69 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/server"
+)
+
+func TestMaintenance(t *testing.T) {
+	var m server.Maintenance
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", server.Healthz)
+	mux.Handle("/admin/maintenance", &m)
+	mux.Handle("GET /authorize", ok)
+	h := server.Chain(mux, m.Middleware("/healthz", "/admin/"))
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	if rec := do(http.MethodGet, "/authorize"); rec.Code != http.StatusOK {
+		t.Errorf("off got: %d, want: %d", rec.Code, http.StatusOK)
+	}
+
+	do(http.MethodPut, "/admin/maintenance")
+	rec := do(http.MethodGet, "/authorize")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("on got: %d with Retry-After %q, want: %d with Retry-After", rec.Code, rec.Header().Get("Retry-After"), http.StatusServiceUnavailable)
+	}
+	if rec := do(http.MethodGet, "/healthz"); rec.Code != http.StatusOK {
+		t.Errorf("on /healthz got: %d, want: %d", rec.Code, http.StatusOK)
+	}
+
+	do(http.MethodDelete, "/admin/maintenance")
+	if rec := do(http.MethodGet, "/authorize"); rec.Code != http.StatusOK {
+		t.Errorf("off again got: %d, want: %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestMaintenanceSparesInFlightRequests(t *testing.T) {
+	var m server.Maintenance
+	started, release := make(chan struct{}), make(chan struct{})
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+	h := m.Middleware()(slow)
+
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/authorize", nil))
+		close(done)
+	}()
+
+	<-started
+	m.Set(true)
+	close(release)
+	<-done
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusOK)
+	}
+}
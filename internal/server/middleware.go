@@ -0,0 +1,14 @@
+package server
+
+import "net/http"
+
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h so that the first middleware given is the outermost.
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+
+	return h
+}
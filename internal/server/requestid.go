@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultRequestIDHeader = "X-Request-ID"
+	maxRequestIDLength     = 128
+)
+
+// RequestIDs tags every request with an ID for correlating logs across
+// services. The ID is taken from the inbound Header if the caller sent a
+// usable one, else from the trace ID of a W3C traceparent header if
+// Traceparent is set, and generated otherwise. It is echoed back in Header.
+type RequestIDs struct {
+	// Header is the header the ID is read from and written to. Empty means
+	// X-Request-ID.
+	Header      string
+	Traceparent bool
+}
+
+// ConfigureRequestIDs reads REQUEST_ID_HEADER and REQUEST_ID_TRACEPARENT,
+// which defaults to false.
+func ConfigureRequestIDs() (ids RequestIDs, err error) {
+	if raw := os.Getenv("REQUEST_ID_HEADER"); raw != "" {
+		if !validHeaderName(raw) {
+			return RequestIDs{}, fmt.Errorf("REQUEST_ID_HEADER misconfigured: %q is not a header name", raw)
+		}
+		ids.Header = raw
+	}
+
+	if raw := os.Getenv("REQUEST_ID_TRACEPARENT"); raw != "" {
+		ids.Traceparent, err = strconv.ParseBool(raw)
+		if err != nil {
+			return RequestIDs{}, fmt.Errorf("REQUEST_ID_TRACEPARENT misconfigured: %w", err)
+		}
+	}
+
+	return ids, nil
+}
+
+func (ids RequestIDs) header() string {
+	if ids.Header != "" {
+		return ids.Header
+	}
+
+	return defaultRequestIDHeader
+}
+
+// Middleware puts the request ID in the request context, where
+// RequestIDFromContext finds it, and in the response headers.
+func (ids RequestIDs) Middleware() Middleware {
+	header := ids.header()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(header)
+			if !validRequestID(id) {
+				id = ""
+			}
+			if id == "" && ids.Traceparent {
+				id = traceID(r.Header.Get("traceparent"))
+			}
+			if id == "" {
+				id = newRequestID()
+			}
+
+			w.Header().Set(header, id)
+			next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+		})
+	}
+}
+
+type requestIDKey struct{}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func RequestIDFromContext(ctx context.Context) (id string, ok bool) {
+	id, ok = ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
+
+// validRequestID accepts a non-empty ID of printable ASCII without spaces,
+// so a caller can't smuggle line breaks or padding into the logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// traceID returns the trace-id of a version 00 traceparent header, per W3C
+// Trace Context section 3.2, or "" if raw isn't one.
+func traceID(raw string) string {
+	parts := strings.Split(strings.TrimSpace(raw), "-")
+	if len(parts) != 4 || parts[0] != "00" || !lowerHex(parts[1], 32) || !lowerHex(parts[2], 16) || !lowerHex(parts[3], 2) {
+		return ""
+	}
+	// All zeros is an invalid trace-id.
+	if strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+		return ""
+	}
+
+	return parts[1]
+}
+
+func lowerHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validHeaderName reports whether name is an RFC 9110 token.
+func validHeaderName(name string) bool {
+	for _, c := range name {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || strings.ContainsRune("!#$%&'*+-.^_`|~", c)) {
+			return false
+		}
+	}
+
+	return name != ""
+}
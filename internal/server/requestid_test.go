@@ -0,0 +1,106 @@
+package server_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/server"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// echoRequestID writes the ID the middleware put in the context.
+var echoRequestID = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	id, _ := server.RequestIDFromContext(r.Context())
+	fmt.Fprint(w, id)
+})
+
+func TestRequestIDCustomHeader(t *testing.T) {
+	t.Setenv("REQUEST_ID_HEADER", "X-Correlation-ID")
+	ids, err := server.ConfigureRequestIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ids.Middleware()(echoRequestID)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Correlation-ID", "abc-123")
+	rec := serve(h, r)
+	if got := rec.Header().Get("X-Correlation-ID"); got != "abc-123" {
+		t.Errorf("got: %q, want: %q", got, "abc-123")
+	}
+	if got := rec.Body.String(); got != "abc-123" {
+		t.Errorf("got: %q, want: %q", got, "abc-123")
+	}
+	if got := rec.Header().Get("X-Request-ID"); got != "" {
+		t.Errorf("got: %q, want: no X-Request-ID", got)
+	}
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	h := server.RequestIDs{}.Middleware()(echoRequestID)
+
+	for _, inbound := range []string{"", "has space", "line\nbreak"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header["X-Request-Id"] = []string{inbound}
+		r.Header.Set("traceparent", testTraceparent)
+		rec := serve(h, r)
+
+		got := rec.Header().Get("X-Request-ID")
+		if len(got) != 32 || got == inbound || got == "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("%q got: %q, want: a generated ID", inbound, got)
+		}
+		if rec.Body.String() != got {
+			t.Errorf("%q got: %q in context, want: %q", inbound, rec.Body.String(), got)
+		}
+	}
+}
+
+func TestRequestIDTraceparent(t *testing.T) {
+	h := server.RequestIDs{Traceparent: true}.Middleware()(echoRequestID)
+
+	var cases = []struct {
+		header, traceparent, want string
+	}{
+		{"", testTraceparent, "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"abc-123", testTraceparent, "abc-123"},
+		{"", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", ""},
+		{"", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", ""},
+		{"", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", ""},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if c.header != "" {
+			r.Header.Set("X-Request-ID", c.header)
+		}
+		r.Header.Set("traceparent", c.traceparent)
+		got := serve(h, r).Header().Get("X-Request-ID")
+
+		if c.want != "" && got != c.want {
+			t.Errorf("%q got: %q, want: %q", c.traceparent, got, c.want)
+		}
+		// Invalid traceparents fall back to a generated ID.
+		if c.want == "" && (len(got) != 32 || got == "4bf92f3577b34da6a3ce929d0e0e4736") {
+			t.Errorf("%q got: %q, want: a generated ID", c.traceparent, got)
+		}
+	}
+}
+
+func TestConfigureRequestIDs(t *testing.T) {
+	for _, c := range []struct{ env, value string }{
+		{"REQUEST_ID_HEADER", "X Request"},
+		{"REQUEST_ID_TRACEPARENT", "sometimes"},
+	} {
+		t.Setenv("REQUEST_ID_HEADER", "")
+		t.Setenv("REQUEST_ID_TRACEPARENT", "")
+		t.Setenv(c.env, c.value)
+
+		_, err := server.ConfigureRequestIDs()
+		if err == nil {
+			t.Errorf("%s=%s: got: nil, want: error", c.env, c.value)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+var ErrNoRoutes = errors.New("router has no route registrars")
+
+// Registrar adds its routes to a mux, as oauth.Provider does.
+type Registrar interface {
+	RegisterHandlers(mux *http.ServeMux)
+}
+
+// Router is an http.Handler that builds its mux and middleware chain on
+// first use. The build runs exactly once even when the first requests arrive
+// concurrently, and after that ServeHTTP takes no locks. A failed build is
+// memoized, so every request gets the same error rather than a retry.
+type Router struct {
+	Registrars  []Registrar
+	Middlewares []Middleware
+
+	once    sync.Once
+	handler http.Handler
+	err     error
+}
+
+// Build builds the router if that hasn't happened yet, and returns the
+// resulting handler or build error. Calling it at startup surfaces
+// misconfiguration before the first request does.
+func (rt *Router) Build() (http.Handler, error) {
+	rt.once.Do(func() {
+		rt.handler, rt.err = rt.build()
+	})
+
+	return rt.handler, rt.err
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h, err := rt.Build()
+	if err != nil {
+		slog.Error("Cannot build router.", "err", err)
+		http.Error(w, "Internal server error.", http.StatusInternalServerError)
+		return
+	}
+
+	h.ServeHTTP(w, r)
+}
+
+func (rt *Router) build() (h http.Handler, err error) {
+	if len(rt.Registrars) == 0 {
+		return nil, ErrNoRoutes
+	}
+	for i, m := range rt.Middlewares {
+		if m == nil {
+			return nil, fmt.Errorf("middleware %d is nil", i)
+		}
+	}
+
+	mux, err := registerHandlers(rt.Registrars)
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapMiddlewares(mux, rt.Middlewares), nil
+}
+
+// registerHandlers turns the panic ServeMux raises for an invalid or
+// conflicting pattern into an error.
+func registerHandlers(registrars []Registrar) (mux *http.ServeMux, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			mux, err = nil, fmt.Errorf("cannot register handlers: %v", v)
+		}
+	}()
+
+	mux = http.NewServeMux()
+	for _, reg := range registrars {
+		reg.RegisterHandlers(mux)
+	}
+
+	return mux, nil
+}
+
+func wrapMiddlewares(h http.Handler, middlewares []Middleware) http.Handler {
+	return Chain(h, middlewares...)
+}
@@ -0,0 +1,81 @@
+package server_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/server"
+)
+
+type countingRegistrar struct {
+	calls    atomic.Int32
+	patterns []string
+}
+
+func (c *countingRegistrar) RegisterHandlers(mux *http.ServeMux) {
+	c.calls.Add(1)
+	for _, p := range c.patterns {
+		mux.HandleFunc(p, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+func TestRouterConcurrentBuild(t *testing.T) {
+	reg := &countingRegistrar{patterns: []string{"GET /ping"}}
+	var wraps atomic.Int32
+	rt := &server.Router{
+		Registrars: []server.Registrar{reg},
+		Middlewares: []server.Middleware{func(h http.Handler) http.Handler {
+			wraps.Add(1)
+			return h
+		}},
+	}
+
+	var wg sync.WaitGroup
+	codes := make([]int, 64)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			rt.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ping", nil))
+			codes[i] = rec.Code
+		}(i)
+	}
+	wg.Wait()
+
+	if reg.calls.Load() != 1 || wraps.Load() != 1 {
+		t.Errorf("got: %d registrations and %d wraps, want: 1 each", reg.calls.Load(), wraps.Load())
+	}
+	for _, code := range codes {
+		if code != http.StatusNoContent {
+			t.Errorf("got: %d, want: %d", code, http.StatusNoContent)
+		}
+	}
+}
+
+func TestRouterBuildError(t *testing.T) {
+	reg := &countingRegistrar{patterns: []string{"GET /ping", "GET /ping"}}
+	rt := &server.Router{Registrars: []server.Registrar{reg}}
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		rt.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ping", nil))
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("got: %d, want: %d", rec.Code, http.StatusInternalServerError)
+		}
+	}
+	if reg.calls.Load() != 1 {
+		t.Errorf("got: %d registrations, want: 1", reg.calls.Load())
+	}
+
+	_, err := (&server.Router{}).Build()
+	if !errors.Is(err, server.ErrNoRoutes) {
+		t.Errorf("got: %v, want: %v", err, server.ErrNoRoutes)
+	}
+}
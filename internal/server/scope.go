@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const realm = "goidp"
+
+// RequireScope only lets requests through whose token was granted scope.
+func RequireScope(scope string) Middleware {
+	return RequireAllScopes(scope)
+}
+
+func RequireAllScopes(scopes ...string) Middleware {
+	return requireScopes(scopes, func(granted []string) bool {
+		for _, s := range scopes {
+			if !slices.Contains(granted, s) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func RequireAnyScope(scopes ...string) Middleware {
+	return requireScopes(scopes, func(granted []string) bool {
+		for _, s := range scopes {
+			if slices.Contains(granted, s) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func requireScopes(scopes []string, satisfied func(granted []string) bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := TokenFromContext(r.Context())
+			if !ok {
+				// No token means the auth middleware didn't run or let an
+				// anonymous request through, so this is a 401 not a 403.
+				challenge(w, http.StatusUnauthorized, "", "", "")
+				return
+			}
+
+			if !satisfied(token.Scopes) {
+				challenge(w, http.StatusForbidden, "insufficient_scope", "The access token lacks the required scope.", strings.Join(scopes, " "))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func writeBearerError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if code == "" {
+		return
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description,omitempty"`
+	}{code, description})
+}
@@ -0,0 +1,57 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/server"
+)
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+var scopeChecks = []struct {
+	name       string
+	middleware server.Middleware
+	granted    []string
+	status     int
+	header     string
+}{
+	{"present", server.RequireScope("email"), []string{"openid", "email"}, http.StatusOK, ""},
+	{"missing", server.RequireScope("email"), []string{"openid"}, http.StatusForbidden, `Bearer realm="goidp", error="insufficient_scope", error_description="The access token lacks the required scope.", scope="email"`},
+	{"all present", server.RequireAllScopes("openid", "email"), []string{"email", "openid"}, http.StatusOK, ""},
+	{"all partial", server.RequireAllScopes("openid", "email"), []string{"openid"}, http.StatusForbidden, `Bearer realm="goidp", error="insufficient_scope", error_description="The access token lacks the required scope.", scope="openid email"`},
+	{"any one", server.RequireAnyScope("admin", "email"), []string{"email"}, http.StatusOK, ""},
+	{"any none", server.RequireAnyScope("admin", "email"), []string{"openid"}, http.StatusForbidden, `Bearer realm="goidp", error="insufficient_scope", error_description="The access token lacks the required scope.", scope="admin email"`},
+}
+
+func TestRequireScope(t *testing.T) {
+	for _, c := range scopeChecks {
+		r := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+		r = r.WithContext(server.WithToken(r.Context(), server.Token{Subject: "1", Scopes: c.granted}))
+		rec := httptest.NewRecorder()
+
+		c.middleware(ok).ServeHTTP(rec, r)
+		if rec.Code != c.status {
+			t.Errorf("%s got: %d, want: %d", c.name, rec.Code, c.status)
+		}
+		if got := rec.Header().Get("WWW-Authenticate"); got != c.header {
+			t.Errorf("%s got: %s, want: %s", c.name, got, c.header)
+		}
+	}
+}
+
+func TestRequireScopeWithoutToken(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+	rec := httptest.NewRecorder()
+
+	server.RequireScope("email")(ok).ServeHTTP(rec, r)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusUnauthorized)
+	}
+	if got := rec.Header().Get("WWW-Authenticate"); got != `Bearer realm="goidp"` {
+		t.Errorf("got: %s, want: %s", got, `Bearer realm="goidp"`)
+	}
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const timeoutMessage = "Request timed out."
+
+var errMalformedTimeout = errors.New("malformed request timeout")
+
+// Clients ask for a shorter deadline with the Request-Timeout header or the
+// request_timeout query parameter, in seconds, e.g. "2.5".
+const (
+	RequestTimeoutHeader = "Request-Timeout"
+	RequestTimeoutParam  = "request_timeout"
+)
+
+// Timeout gives each request a context that ends after d. Handlers see the
+// deadline through r.Context(), so context-aware store and crypto calls
+// abort; if the handler hasn't finished by then the client gets 503 and
+// anything the handler writes afterwards is discarded. A d of zero or less
+// means no timeout. Wrap individual handlers to give endpoints different
+// budgets, or use Timeouts for a whole mux.
+func Timeout(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		if d <= 0 {
+			return next
+		}
+
+		return http.TimeoutHandler(next, d, timeoutMessage)
+	}
+}
+
+// Timeouts applies a timeout chosen by path: the override for the request's
+// exact path if there is one, otherwise Default. A client may ask for less
+// with RequestTimeoutHeader, never for more; where the server sets no
+// timeout, what it asks for is capped at ClientMax instead.
+//
+// The budget for an endpoint that hashes passwords, such as /token or
+// /login, must cover a full argon2id hash with the configured parameters,
+// plus time spent waiting for a CPU when many hashes run at once. Hashing
+// itself can't be interrupted, so a timeout there only frees the client.
+type Timeouts struct {
+	Default   time.Duration
+	Overrides map[string]time.Duration
+	// ClientMax caps client-requested timeouts on paths without a server
+	// timeout. Zero ignores what clients ask for on those paths.
+	ClientMax time.Duration
+}
+
+// ConfigureTimeouts reads REQUEST_TIMEOUT, which defaults to no timeout,
+// REQUEST_TIMEOUT_OVERRIDES, a comma-separated list of path=duration pairs
+// such as "/token=10s,/userinfo=2s", and REQUEST_TIMEOUT_CLIENT_MAX.
+func ConfigureTimeouts() (t Timeouts, err error) {
+	for _, c := range []struct {
+		env string
+		v   *time.Duration
+	}{
+		{"REQUEST_TIMEOUT", &t.Default},
+		{"REQUEST_TIMEOUT_CLIENT_MAX", &t.ClientMax},
+	} {
+		raw := os.Getenv(c.env)
+		if raw == "" {
+			continue
+		}
+		*c.v, err = time.ParseDuration(raw)
+		if err != nil || *c.v < 0 {
+			return Timeouts{}, fmt.Errorf("%s misconfigured: %q", c.env, raw)
+		}
+	}
+
+	if raw := os.Getenv("REQUEST_TIMEOUT_OVERRIDES"); raw != "" {
+		t.Overrides = make(map[string]time.Duration)
+		for _, pair := range strings.Split(raw, ",") {
+			path, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			d, err := time.ParseDuration(value)
+			if !ok || !strings.HasPrefix(path, "/") || err != nil || d < 0 {
+				return Timeouts{}, fmt.Errorf("REQUEST_TIMEOUT_OVERRIDES misconfigured: %q is not path=duration", pair)
+			}
+			t.Overrides[path] = d
+		}
+	}
+
+	return t, nil
+}
+
+func (t Timeouts) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d, err := t.timeout(r)
+			if err != nil {
+				http.Error(w, "Malformed Request-Timeout, it must be a positive number of seconds.", http.StatusBadRequest)
+				return
+			}
+
+			Timeout(d)(next).ServeHTTP(w, r)
+		})
+	}
+}
+
+// timeout is the deadline for r: the server's for its path, shortened to
+// what the client asked for if that is less.
+func (t Timeouts) timeout(r *http.Request) (time.Duration, error) {
+	d, ok := t.Overrides[r.URL.Path]
+	if !ok {
+		d = t.Default
+	}
+
+	raw := r.Header.Get(RequestTimeoutHeader)
+	if raw == "" {
+		raw = r.URL.Query().Get(RequestTimeoutParam)
+	}
+	if raw == "" {
+		return d, nil
+	}
+	seconds, err := strconv.ParseFloat(raw, 64)
+	if err != nil || !(seconds > 0) || math.IsInf(seconds, 1) {
+		return 0, errMalformedTimeout
+	}
+
+	var limit time.Duration = d
+	if limit <= 0 {
+		limit = t.ClientMax
+	}
+	if limit <= 0 {
+		return d, nil
+	}
+	if seconds >= limit.Seconds() {
+		return limit, nil
+	}
+
+	// A value too small to be a whole nanosecond would come out as no
+	// timeout at all.
+	requested := time.Duration(seconds * float64(time.Second))
+	if requested <= 0 {
+		return 0, errMalformedTimeout
+	}
+
+	return requested, nil
+}
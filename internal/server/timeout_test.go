@@ -0,0 +1,153 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/server"
+)
+
+// waitForCancel blocks until its request's context ends and reports why.
+func waitForCancel(cause chan<- error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		cause <- r.Context().Err()
+		w.Write([]byte("too late"))
+	})
+}
+
+func TestTimeoutCutsOffSlowHandler(t *testing.T) {
+	cause := make(chan error, 1)
+	h := server.Timeout(10 * time.Millisecond)(waitForCancel(cause))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if err := <-cause; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("handler context got: %v, want: %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestTimeoutPassesFastHandler(t *testing.T) {
+	h := server.Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("done"))
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusCreated || rec.Body.String() != "done" {
+		t.Errorf("got: %d %q, want: %d %q", rec.Code, rec.Body, http.StatusCreated, "done")
+	}
+}
+
+func TestTimeoutsByPath(t *testing.T) {
+	cause := make(chan error, 2)
+	h := server.Timeouts{
+		Default:   10 * time.Millisecond,
+		Overrides: map[string]time.Duration{"/token": time.Hour},
+	}.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if deadline, _ := r.Context().Deadline(); time.Until(deadline) > time.Minute {
+			w.Write([]byte("long budget"))
+			return
+		}
+		waitForCancel(cause).ServeHTTP(w, r)
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/token", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("/token got: %d, want: %d", rec.Code, http.StatusOK)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/userinfo", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("/userinfo got: %d, want: %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestConfigureTimeouts(t *testing.T) {
+	t.Setenv("REQUEST_TIMEOUT", "5s")
+	t.Setenv("REQUEST_TIMEOUT_OVERRIDES", "/token=30s, /userinfo=2s")
+	t.Setenv("REQUEST_TIMEOUT_CLIENT_MAX", "1m")
+
+	got, err := server.ConfigureTimeouts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Default != 5*time.Second || got.Overrides["/token"] != 30*time.Second || got.Overrides["/userinfo"] != 2*time.Second || got.ClientMax != time.Minute {
+		t.Errorf("got: %+v, want: 5s with /token=30s and /userinfo=2s, clients up to 1m", got)
+	}
+
+	t.Setenv("REQUEST_TIMEOUT_OVERRIDES", "token=30s")
+	if _, err = server.ConfigureTimeouts(); err == nil {
+		t.Error("got: nil, want: an error")
+	}
+}
+
+func TestTimeoutsClientRequested(t *testing.T) {
+	cause := make(chan error, 1)
+	h := server.Timeouts{Default: time.Hour}.Middleware()(waitForCancel(cause))
+
+	r := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+	r.Header.Set(server.RequestTimeoutHeader, "0.01")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("got: %d, want: %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if err := <-cause; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("handler context got: %v, want: %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestTimeoutsClientRequestedCapped(t *testing.T) {
+	var budgets = []struct {
+		name     string
+		timeouts server.Timeouts
+		target   string
+		want     time.Duration
+	}{
+		{"server default", server.Timeouts{Default: time.Minute}, "/?request_timeout=3600", time.Minute},
+		{"client max", server.Timeouts{ClientMax: 2 * time.Minute}, "/?request_timeout=3600", 2 * time.Minute},
+		{"shorter", server.Timeouts{ClientMax: 2 * time.Minute}, "/?request_timeout=30", 30 * time.Second},
+		{"sub-millisecond", server.Timeouts{Default: time.Minute}, "/?request_timeout=0.0005", 500 * time.Microsecond},
+	}
+
+	for _, c := range budgets {
+		var got time.Duration
+		h := c.timeouts.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			deadline, _ := r.Context().Deadline()
+			got = time.Until(deadline)
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, c.target, nil))
+
+		if got > c.want || got < c.want-time.Second {
+			t.Errorf("%s got: %v, want: %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestTimeoutsClientRequestedMalformed(t *testing.T) {
+	h := server.Timeouts{Default: time.Minute}.Middleware()(ok)
+
+	for _, v := range []string{"soon", "-1", "0", "-0", "1e-10", "NaN", "+Inf"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(server.RequestTimeoutHeader, v)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%q got: %d, want: %d", v, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
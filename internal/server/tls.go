@@ -0,0 +1,129 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// defaultCipherSuites are the TLS 1.2 suites offered unless configured
+// otherwise: forward secret AEAD suites only. TLS 1.3 suites aren't
+// configurable and are all safe.
+var defaultCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// TLS is how the server terminates TLS itself. The zero value serves plain
+// HTTP, which is meant for development or running behind a proxy that
+// terminates TLS.
+type TLS struct {
+	CertFile string
+	KeyFile  string
+	// MinVersion is tls.VersionTLS12 or tls.VersionTLS13. Zero means 1.2.
+	MinVersion uint16
+	// CipherSuites are the TLS 1.2 suites offered. Nil means
+	// defaultCipherSuites.
+	CipherSuites []uint16
+}
+
+// ConfigureTLS reads TLS_CERT_FILE and TLS_KEY_FILE, which must be set
+// together, TLS_MIN_VERSION ("1.2" or "1.3") and TLS_CIPHER_SUITES, a
+// comma-separated list of Go cipher suite names such as
+// "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256". Suites Go considers insecure are
+// refused.
+func ConfigureTLS() (t TLS, err error) {
+	t.CertFile = os.Getenv("TLS_CERT_FILE")
+	t.KeyFile = os.Getenv("TLS_KEY_FILE")
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return TLS{}, errors.New("TLS misconfigured: TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	switch raw := os.Getenv("TLS_MIN_VERSION"); raw {
+	case "":
+	case "1.2":
+		t.MinVersion = tls.VersionTLS12
+	case "1.3":
+		t.MinVersion = tls.VersionTLS13
+	default:
+		return TLS{}, fmt.Errorf("TLS_MIN_VERSION misconfigured: %q is not 1.2 or 1.3", raw)
+	}
+
+	if raw := os.Getenv("TLS_CIPHER_SUITES"); raw != "" {
+		for _, name := range strings.Split(raw, ",") {
+			id, ok := cipherSuiteID(strings.TrimSpace(name))
+			if !ok {
+				return TLS{}, fmt.Errorf("TLS_CIPHER_SUITES misconfigured: %s is not a supported secure suite", name)
+			}
+			t.CipherSuites = append(t.CipherSuites, id)
+		}
+	}
+
+	return t, nil
+}
+
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name && slices.Contains(suite.SupportedVersions, tls.VersionTLS12) {
+			return suite.ID, true
+		}
+	}
+
+	return 0, false
+}
+
+func (t TLS) Enabled() bool {
+	return t.CertFile != ""
+}
+
+// Config loads the certificate and key and returns the tls.Config to serve
+// with. Calling it at startup surfaces a bad certificate before the first
+// connection does.
+func (t TLS) Config() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load TLS certificate: %w", err)
+	}
+
+	var minVersion uint16 = t.MinVersion
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12
+	}
+	if minVersion < tls.VersionTLS12 {
+		return nil, fmt.Errorf("TLS minimum version %#x is below TLS 1.2", minVersion)
+	}
+	var suites []uint16 = t.CipherSuites
+	if suites == nil {
+		suites = defaultCipherSuites
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   minVersion,
+		CipherSuites: suites,
+	}, nil
+}
+
+// ListenAndServe serves srv over HTTPS when TLS is enabled and plain HTTP
+// otherwise.
+func (t TLS) ListenAndServe(srv *http.Server) error {
+	if !t.Enabled() {
+		return srv.ListenAndServe()
+	}
+
+	cfg, err := t.Config()
+	if err != nil {
+		return err
+	}
+	srv.TLSConfig = cfg
+
+	return srv.ListenAndServeTLS("", "")
+}
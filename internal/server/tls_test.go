@@ -0,0 +1,126 @@
+package server_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/server"
+)
+
+// writeCert writes a self-signed certificate and its key to dir.
+func writeCert(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestTLSConfig(t *testing.T) {
+	certFile, keyFile := writeCert(t, t.TempDir())
+	t.Setenv("TLS_CERT_FILE", certFile)
+	t.Setenv("TLS_KEY_FILE", keyFile)
+
+	var versions = []struct {
+		env  string
+		want uint16
+	}{
+		{"", tls.VersionTLS12},
+		{"1.2", tls.VersionTLS12},
+		{"1.3", tls.VersionTLS13},
+	}
+	for _, v := range versions {
+		t.Setenv("TLS_MIN_VERSION", v.env)
+
+		conf, err := server.ConfigureTLS()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := conf.Config()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.MinVersion != v.want {
+			t.Errorf("%q got: %#x, want: %#x", v.env, cfg.MinVersion, v.want)
+		}
+		if len(cfg.CipherSuites) == 0 || len(cfg.Certificates) != 1 {
+			t.Errorf("%q got: %d suites and %d certificates, want: defaults and 1", v.env, len(cfg.CipherSuites), len(cfg.Certificates))
+		}
+	}
+}
+
+func TestTLSConfigBadCert(t *testing.T) {
+	dir := t.TempDir()
+	_, keyFile := writeCert(t, dir)
+
+	conf := server.TLS{CertFile: filepath.Join(dir, "missing.pem"), KeyFile: keyFile}
+	if _, err := conf.Config(); err == nil {
+		t.Error("got: nil, want: an error")
+	}
+	if err := conf.ListenAndServe(nil); err == nil {
+		t.Error("got: nil, want: an error before serving")
+	}
+}
+
+func TestConfigureTLS(t *testing.T) {
+	t.Setenv("TLS_CIPHER_SUITES", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384")
+	conf, err := server.ConfigureTLS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Enabled() || len(conf.CipherSuites) != 2 {
+		t.Errorf("got: %+v, want: disabled with 2 suites", conf)
+	}
+
+	var bad = []struct{ env, value string }{
+		{"TLS_MIN_VERSION", "1.0"},
+		{"TLS_CIPHER_SUITES", "TLS_RSA_WITH_RC4_128_SHA"},
+		{"TLS_CIPHER_SUITES", "TLS_AES_128_GCM_SHA256"},
+		{"TLS_CERT_FILE", "cert.pem"},
+	}
+	for _, c := range bad {
+		t.Setenv(c.env, c.value)
+		if _, err := server.ConfigureTLS(); err == nil {
+			t.Errorf("%s=%s got: nil, want: an error", c.env, c.value)
+		}
+		t.Setenv(c.env, "")
+	}
+}
@@ -0,0 +1,25 @@
+package server
+
+import "context"
+
+// Token is the validated access token an authentication middleware attaches
+// to the request context for downstream handlers and middlewares.
+type Token struct {
+	Subject  string
+	ClientID string
+	Scopes   []string
+	// Claims are claims requested individually for the token, on top of
+	// those its scopes release, such as through the OIDC claims parameter.
+	Claims []string
+}
+
+type tokenKey struct{}
+
+func WithToken(ctx context.Context, token Token) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+func TokenFromContext(ctx context.Context) (token Token, ok bool) {
+	token, ok = ctx.Value(tokenKey{}).(Token)
+	return token, ok
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// AccessToken is an opaque access token issued at /token, for clients that
+// don't get JWTs. Only a hash of the token is stored.
+type AccessToken struct {
+	TokenHash string
+	ClientID  string
+	UserID    int64
+	Scope     string
+	// Claims are the claims requested individually for userinfo,
+	// space-separated.
+	Claims    string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+type AccessTokenStore interface {
+	CreateAccessToken(ctx context.Context, token AccessToken) error
+	GetAccessToken(ctx context.Context, tokenHash string) (AccessToken, error)
+	DeleteUserAccessTokens(ctx context.Context, userID int64) error
+}
+
+type MemoryAccessTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]AccessToken
+}
+
+func NewMemoryAccessTokenStore() *MemoryAccessTokenStore {
+	return &MemoryAccessTokenStore{tokens: make(map[string]AccessToken)}
+}
+
+// CreateAccessToken stores token, dropping any that have expired by the time
+// it was issued so the map doesn't grow without bound.
+func (s *MemoryAccessTokenStore) CreateAccessToken(ctx context.Context, token AccessToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tokens[token.TokenHash]; ok {
+		return ErrConflict
+	}
+	for k, v := range s.tokens {
+		if !token.IssuedAt.Before(v.ExpiresAt) {
+			delete(s.tokens, k)
+		}
+	}
+	s.tokens[token.TokenHash] = token
+
+	return nil
+}
+
+func (s *MemoryAccessTokenStore) GetAccessToken(ctx context.Context, tokenHash string) (AccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[tokenHash]
+	if !ok {
+		return AccessToken{}, ErrNotFound
+	}
+
+	return token, nil
+}
+
+func (s *MemoryAccessTokenStore) DeleteUserAccessTokens(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, v := range s.tokens {
+		if v.UserID == userID {
+			delete(s.tokens, k)
+		}
+	}
+
+	return nil
+}
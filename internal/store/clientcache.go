@@ -0,0 +1,216 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultClientCacheSize        = 1000
+	defaultClientCacheTTL         = time.Minute
+	defaultClientCacheNegativeTTL = 5 * time.Second
+)
+
+// ClientCache is a ClientStore that keeps recently used clients in memory in
+// front of Store, since client records are read on every authorization and
+// token request but rarely change. PutClient and Invalidate drop the cached
+// copy at once. Changes made through another instance are picked up once
+// TTL runs out. Unknown ids are cached too, for the shorter NegativeTTL, so
+// a newly registered client isn't refused for long.
+type ClientCache struct {
+	Store ClientStore
+
+	// Size is the most clients kept. The least recently used one is evicted
+	// to make room. Zero means 1000.
+	Size int
+	// TTL is how long a cached client is served. Zero means a minute.
+	TTL time.Duration
+	// NegativeTTL is how long an id is remembered as unknown. Zero means
+	// 5 seconds.
+	NegativeTTL time.Duration
+
+	// Now defaults to time.Now and exists so tests can control time.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   list.List // of *cachedClient, most recently used first
+	// generation counts invalidations, so that a lookup racing with one
+	// doesn't cache what it read before it.
+	generation uint64
+}
+
+type cachedClient struct {
+	id      string
+	client  Client
+	found   bool
+	expires time.Time
+}
+
+// ConfigureClientCache puts a cache in front of clients, sized by
+// CLIENT_CACHE_SIZE with lifetimes from CLIENT_CACHE_TTL and
+// CLIENT_CACHE_NEGATIVE_TTL, such as "30s".
+func ConfigureClientCache(clients ClientStore) (*ClientCache, error) {
+	c := &ClientCache{Store: clients}
+
+	if raw := os.Getenv("CLIENT_CACHE_SIZE"); raw != "" {
+		size, err := strconv.Atoi(raw)
+		if err != nil || size < 1 {
+			return nil, fmt.Errorf("CLIENT_CACHE_SIZE misconfigured: want a positive integer, got %q", raw)
+		}
+		c.Size = size
+	}
+
+	var durations = []struct {
+		env string
+		dst *time.Duration
+	}{
+		{"CLIENT_CACHE_TTL", &c.TTL},
+		{"CLIENT_CACHE_NEGATIVE_TTL", &c.NegativeTTL},
+	}
+	for _, d := range durations {
+		raw := os.Getenv(d.env)
+		if raw == "" {
+			continue
+		}
+		ttl, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s misconfigured: %w", d.env, err)
+		}
+		if ttl <= 0 {
+			return nil, fmt.Errorf("%s misconfigured: must be positive, got %s", d.env, ttl)
+		}
+		*d.dst = ttl
+	}
+
+	return c, nil
+}
+
+func (c *ClientCache) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+
+	return time.Now()
+}
+
+func (c *ClientCache) size() int {
+	if c.Size > 0 {
+		return c.Size
+	}
+
+	return defaultClientCacheSize
+}
+
+func (c *ClientCache) ttl(found bool) time.Duration {
+	switch {
+	case found && c.TTL > 0:
+		return c.TTL
+	case found:
+		return defaultClientCacheTTL
+	case c.NegativeTTL > 0:
+		return c.NegativeTTL
+	default:
+		return defaultClientCacheNegativeTTL
+	}
+}
+
+// GetClient serves id from the cache, falling through to Store on a miss.
+// Errors other than ErrNotFound aren't cached.
+func (c *ClientCache) GetClient(ctx context.Context, id string) (Client, error) {
+	if client, found, ok := c.lookup(id); ok {
+		if !found {
+			return Client{}, ErrNotFound
+		}
+		return client, nil
+	}
+
+	c.mu.Lock()
+	var generation uint64 = c.generation
+	c.mu.Unlock()
+
+	client, err := c.Store.GetClient(ctx, id)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return Client{}, err
+	}
+	c.add(id, client, err == nil, generation)
+
+	return client, err
+}
+
+func (c *ClientCache) lookup(id string) (client Client, found, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[id]
+	if !ok {
+		return Client{}, false, false
+	}
+	entry := e.Value.(*cachedClient)
+	if !c.now().Before(entry.expires) {
+		c.remove(e)
+		return Client{}, false, false
+	}
+	c.order.MoveToFront(e)
+
+	return entry.client, entry.found, true
+}
+
+func (c *ClientCache) add(id string, client Client, found bool, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+	}
+	if e, ok := c.entries[id]; ok {
+		c.remove(e)
+	}
+
+	entry := &cachedClient{id: id, client: client, found: found, expires: c.now().Add(c.ttl(found))}
+	c.entries[id] = c.order.PushFront(entry)
+	for c.order.Len() > c.size() {
+		c.remove(c.order.Back())
+	}
+}
+
+// remove must be called with mu held.
+func (c *ClientCache) remove(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.entries, e.Value.(*cachedClient).id)
+}
+
+// Invalidate drops any cached copy of id, for changes made to the client
+// other than through PutClient.
+func (c *ClientCache) Invalidate(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if e, ok := c.entries[id]; ok {
+		c.remove(e)
+	}
+}
+
+// ListClients always reads Store; listing is for administration, not the
+// hot path.
+func (c *ClientCache) ListClients(ctx context.Context, filter ClientFilter, limit int, cursor string) (clients []Client, next string, err error) {
+	return c.Store.ListClients(ctx, filter, limit, cursor)
+}
+
+// PutClient writes client to Store and drops its cached copy, whether or
+// not the write succeeded.
+func (c *ClientCache) PutClient(ctx context.Context, client Client) error {
+	defer c.Invalidate(client.ID)
+
+	return c.Store.PutClient(ctx, client)
+}
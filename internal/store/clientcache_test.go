@@ -0,0 +1,124 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+// countingClients counts the lookups that reach the store behind a cache.
+type countingClients struct {
+	*store.MemoryClientStore
+	gets int
+}
+
+func (c *countingClients) GetClient(ctx context.Context, id string) (store.Client, error) {
+	c.gets++
+	return c.MemoryClientStore.GetClient(ctx, id)
+}
+
+func newClientCache() (*store.ClientCache, *countingClients, *time.Time) {
+	now := time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC)
+	backing := &countingClients{MemoryClientStore: store.NewMemoryClientStore(store.Client{ID: "client1", Name: "One"})}
+	cache := &store.ClientCache{Store: backing, Size: 2, Now: func() time.Time { return now }}
+
+	return cache, backing, &now
+}
+
+func TestClientCacheHit(t *testing.T) {
+	cache, backing, now := newClientCache()
+	ctx := context.Background()
+
+	for range 2 {
+		client, err := cache.GetClient(ctx, "client1")
+		if err != nil || client.Name != "One" {
+			t.Fatalf("got: %+v, %v, want: client1", client, err)
+		}
+	}
+	if backing.gets != 1 {
+		t.Errorf("got: %d store lookups, want: 1", backing.gets)
+	}
+
+	*now = now.Add(time.Minute)
+	cache.GetClient(ctx, "client1")
+	if backing.gets != 2 {
+		t.Errorf("got: %d store lookups, want: 2 once expired", backing.gets)
+	}
+}
+
+func TestClientCachePutInvalidates(t *testing.T) {
+	cache, backing, _ := newClientCache()
+	ctx := context.Background()
+
+	cache.GetClient(ctx, "client1")
+	err := cache.PutClient(ctx, store.Client{ID: "client1", Name: "Renamed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := cache.GetClient(ctx, "client1")
+	if err != nil || client.Name != "Renamed" {
+		t.Errorf("got: %+v, %v, want: the updated client", client, err)
+	}
+	if backing.gets != 2 {
+		t.Errorf("got: %d store lookups, want: 2", backing.gets)
+	}
+}
+
+func TestClientCacheNegative(t *testing.T) {
+	cache, backing, now := newClientCache()
+	ctx := context.Background()
+
+	for range 2 {
+		if _, err := cache.GetClient(ctx, "client2"); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("got: %v, want: %v", err, store.ErrNotFound)
+		}
+	}
+	if backing.gets != 1 {
+		t.Errorf("got: %d store lookups, want: 1", backing.gets)
+	}
+
+	// Registered elsewhere: found once the negative entry expires.
+	backing.MemoryClientStore.PutClient(ctx, store.Client{ID: "client2"})
+	*now = now.Add(5 * time.Second)
+	if _, err := cache.GetClient(ctx, "client2"); err != nil {
+		t.Errorf("got: %v, want: nil", err)
+	}
+}
+
+func TestClientCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache, backing, _ := newClientCache()
+	ctx := context.Background()
+	backing.MemoryClientStore.PutClient(ctx, store.Client{ID: "client2"})
+	backing.MemoryClientStore.PutClient(ctx, store.Client{ID: "client3"})
+
+	for _, id := range []string{"client1", "client2", "client1", "client3"} {
+		cache.GetClient(ctx, id)
+	}
+	backing.gets = 0
+
+	cache.GetClient(ctx, "client1")
+	cache.GetClient(ctx, "client2")
+	if backing.gets != 1 {
+		t.Errorf("got: %d store lookups, want: only client2's", backing.gets)
+	}
+}
+
+func TestConfigureClientCache(t *testing.T) {
+	t.Setenv("CLIENT_CACHE_SIZE", "50")
+	t.Setenv("CLIENT_CACHE_TTL", "30s")
+	t.Setenv("CLIENT_CACHE_NEGATIVE_TTL", "")
+
+	cache, err := store.ConfigureClientCache(store.NewMemoryClientStore())
+	if err != nil || cache.Size != 50 || cache.TTL != 30*time.Second || cache.NegativeTTL != 0 {
+		t.Errorf("got: %+v, %v, want: size 50 and a 30s TTL", cache, err)
+	}
+
+	t.Setenv("CLIENT_CACHE_TTL", "-1s")
+	if _, err = store.ConfigureClientCache(store.NewMemoryClientStore()); err == nil {
+		t.Error("got: nil, want: an error")
+	}
+}
@@ -0,0 +1,183 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client types, per RFC 6749 section 2.1.
+const (
+	ClientConfidential = "confidential"
+	ClientPublic       = "public"
+)
+
+// DefaultGrantTypes are the grants a client with no GrantTypes may use.
+var DefaultGrantTypes = []string{"authorization_code", "refresh_token"}
+
+type Client struct {
+	ID         string
+	Name       string
+	SecretHash string
+	// PreviousSecretHash is the hash of the secret SecretHash replaced,
+	// which keeps authenticating the client until PreviousSecretExpiresAt
+	// so a rotated secret can be rolled out without downtime.
+	PreviousSecretHash      string
+	PreviousSecretExpiresAt time.Time
+	// Secret is the client secret itself, needed only by clients using
+	// client_secret_jwt, whose assertions are HMACs keyed with it.
+	Secret string
+	// JWKS and JWKSURI hold the public keys of clients using
+	// private_key_jwt: a JWKS document inline, or where to fetch one. JWKS
+	// takes precedence.
+	JWKS    string
+	JWKSURI string
+	// TokenEndpointAuthMethod is the only way the client may authenticate
+	// at the token and introspection endpoints: client_secret_basic,
+	// client_secret_post, client_secret_jwt, private_key_jwt or none.
+	// Empty means any its credentials allow, except none.
+	TokenEndpointAuthMethod string
+	RedirectURIs            []string
+	// PostLogoutRedirectURIs are where the client may send users back to
+	// after RP-initiated logout.
+	PostLogoutRedirectURIs []string
+	// GrantTypes are the grant types the client may use at the token
+	// endpoint. Empty means DefaultGrantTypes.
+	GrantTypes []string
+	// FirstParty marks a client run by the deployment itself. Only such a
+	// client may use the password grant, and only if GrantTypes also
+	// names it.
+	FirstParty bool
+	// Audiences are further audiences, such as resource servers, that the
+	// client's ID and JWT access tokens are issued for besides the client.
+	Audiences []string
+	// IDTokenSignedResponseAlg is the alg ID tokens for this client are
+	// signed with. Empty means the provider's default.
+	IDTokenSignedResponseAlg string
+	// AccessTokenFormat is "jwt" or "opaque". Empty means jwt.
+	AccessTokenFormat string
+	// RefreshTokenBinding is "ip" or "device" to make refresh tokens usable
+	// only from the context they were issued in. Empty means unbound, which
+	// suits mobile clients whose IP keeps changing.
+	RefreshTokenBinding string
+	// AllowNonceReuse exempts the client from the provider's nonce replay
+	// check, for clients that legitimately send the same nonce twice.
+	AllowNonceReuse bool
+	// SubjectType is "public" or "pairwise". Empty means the provider's
+	// default.
+	SubjectType string
+	// SectorIdentifier groups clients that see the same pairwise subjects.
+	// Empty means the host the client's redirect URIs share, or the
+	// client's own id if they don't share one.
+	SectorIdentifier string
+}
+
+// Type is ClientConfidential if the client holds any credentials and
+// ClientPublic otherwise.
+func (c Client) Type() string {
+	if c.SecretHash != "" || c.Secret != "" || c.JWKS != "" || c.JWKSURI != "" {
+		return ClientConfidential
+	}
+	return ClientPublic
+}
+
+// AllowsGrant reports whether the client may use grantType.
+func (c Client) AllowsGrant(grantType string) bool {
+	grantTypes := c.GrantTypes
+	if len(grantTypes) == 0 {
+		grantTypes = DefaultGrantTypes
+	}
+	return slices.Contains(grantTypes, grantType)
+}
+
+// ClientFilter narrows a client listing. Name matches any client whose name
+// contains it, ignoring case, and Type is ClientConfidential or
+// ClientPublic. Zero fields match every client.
+type ClientFilter struct {
+	Name string
+	Type string
+}
+
+func (f ClientFilter) matches(c Client) bool {
+	if f.Name != "" && !strings.Contains(strings.ToLower(c.Name), strings.ToLower(f.Name)) {
+		return false
+	}
+	return f.Type == "" || c.Type() == f.Type
+}
+
+// DefaultClientListLimit is the page size ListClients uses for a limit
+// below 1.
+const DefaultClientListLimit = 50
+
+type ClientStore interface {
+	GetClient(ctx context.Context, id string) (Client, error)
+	// ListClients returns up to limit clients matching filter, ordered by
+	// id, starting after cursor. next is the cursor for the following page,
+	// or empty on the last one. An empty cursor starts from the beginning.
+	// A limit below 1 means DefaultClientListLimit.
+	ListClients(ctx context.Context, filter ClientFilter, limit int, cursor string) (clients []Client, next string, err error)
+	// PutClient registers client, replacing any client with its id.
+	PutClient(ctx context.Context, client Client) error
+}
+
+type MemoryClientStore struct {
+	mu      sync.RWMutex
+	clients map[string]Client
+}
+
+func NewMemoryClientStore(clients ...Client) *MemoryClientStore {
+	s := &MemoryClientStore{clients: make(map[string]Client)}
+	for _, c := range clients {
+		s.clients[c.ID] = c
+	}
+
+	return s
+}
+
+func (s *MemoryClientStore) PutClient(ctx context.Context, client Client) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clients[client.ID] = client
+
+	return nil
+}
+
+func (s *MemoryClientStore) GetClient(ctx context.Context, id string) (Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	client, ok := s.clients[id]
+	if !ok {
+		return Client{}, ErrNotFound
+	}
+
+	return client, nil
+}
+
+func (s *MemoryClientStore) ListClients(ctx context.Context, filter ClientFilter, limit int, cursor string) (clients []Client, next string, err error) {
+	if limit < 1 {
+		limit = DefaultClientListLimit
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, client := range s.clients {
+		if client.ID > cursor && filter.matches(client) {
+			clients = append(clients, client)
+		}
+	}
+	slices.SortFunc(clients, func(a, b Client) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	if len(clients) > limit {
+		clients = clients[:limit]
+		next = clients[limit-1].ID
+	}
+
+	return clients, next, nil
+}
@@ -0,0 +1,14 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/store"
+	"github.com/ehubscher/goidp/internal/store/storetest"
+)
+
+func TestMemoryClientStoreConformance(t *testing.T) {
+	storetest.RunClientStoreTests(t, func() store.ClientStore {
+		return store.NewMemoryClientStore()
+	})
+}
@@ -0,0 +1,281 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/db"
+)
+
+type AuthCode struct {
+	Code        string
+	ClientID    string
+	RedirectURI string
+	Scope       string
+	Nonce       string
+	// Claims is the JSON claims request the code was issued for, if any.
+	Claims string
+	// CodeChallenge and CodeChallengeMethod are the PKCE challenge the
+	// authorization request carried, if any.
+	CodeChallenge       string
+	CodeChallengeMethod string
+	UserID              int64
+	AuthTime            time.Time
+	CreatedAt           time.Time
+	ExpiresAfter        time.Time
+	// Used reports whether the code has been consumed. Only GetAuthCode
+	// returns used codes.
+	Used bool
+}
+
+// AuthCodeStore keeps authorization codes. Stores only keep a hash of each
+// code, so a leaked store can't be replayed at the token endpoint; callers
+// pass and get back the code itself.
+type AuthCodeStore interface {
+	CreateAuthCode(ctx context.Context, code AuthCode) error
+	// GetAuthCode returns the code whether or not it has been consumed.
+	GetAuthCode(ctx context.Context, code string) (AuthCode, error)
+	// ConsumeAuthCode marks the code used and returns it. Of any number of
+	// concurrent calls for one code exactly one succeeds; the others, and
+	// every later call, get ErrNotFound.
+	ConsumeAuthCode(ctx context.Context, code string) (AuthCode, error)
+	// DeleteExpiredAuthCodes removes the codes, used or not, that expired
+	// before now, and returns how many there were.
+	DeleteExpiredAuthCodes(ctx context.Context, now time.Time) (int64, error)
+}
+
+func hashAuthCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// codeSweepInterval is how often MemoryAuthCodeStore drops expired codes.
+const codeSweepInterval = time.Minute
+
+// MemoryAuthCodeStore keeps consumed codes, marked used, so replays can be
+// detected, and drops expired ones as new codes are created so it doesn't
+// grow without bound.
+type MemoryAuthCodeStore struct {
+	mu        sync.Mutex
+	codes     map[string]AuthCode
+	lastSweep time.Time
+}
+
+func NewMemoryAuthCodeStore() *MemoryAuthCodeStore {
+	return &MemoryAuthCodeStore{codes: make(map[string]AuthCode)}
+}
+
+func (s *MemoryAuthCodeStore) CreateAuthCode(ctx context.Context, code AuthCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash := hashAuthCode(code.Code)
+	if _, ok := s.codes[hash]; ok {
+		return ErrConflict
+	}
+	code.Code = ""
+	code.Used = false
+	if code.CreatedAt.IsZero() {
+		code.CreatedAt = time.Now()
+	}
+	s.sweep(code.CreatedAt)
+	s.codes[hash] = code
+
+	return nil
+}
+
+// sweep drops the codes that expired before now, at most once per
+// codeSweepInterval. s.mu must be held.
+func (s *MemoryAuthCodeStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < codeSweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for hash, c := range s.codes {
+		if c.ExpiresAfter.Before(now) {
+			delete(s.codes, hash)
+		}
+	}
+}
+
+func (s *MemoryAuthCodeStore) GetAuthCode(ctx context.Context, code string) (AuthCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.codes[hashAuthCode(code)]
+	if !ok {
+		return AuthCode{}, ErrNotFound
+	}
+	c.Code = code
+
+	return c, nil
+}
+
+func (s *MemoryAuthCodeStore) ConsumeAuthCode(ctx context.Context, code string) (AuthCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash := hashAuthCode(code)
+	c, ok := s.codes[hash]
+	if !ok || c.Used {
+		return AuthCode{}, ErrNotFound
+	}
+	c.Used = true
+	s.codes[hash] = c
+	c.Code = code
+
+	return c, nil
+}
+
+func (s *MemoryAuthCodeStore) DeleteExpiredAuthCodes(ctx context.Context, now time.Time) (n int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, c := range s.codes {
+		if c.ExpiresAfter.Before(now) {
+			delete(s.codes, hash)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// SweepAuthCodes calls DeleteExpiredAuthCodes on codes every interval until
+// ctx is done. Run it in its own goroutine for stores, such as
+// SQLAuthCodeStore, that don't clean up after themselves.
+func SweepAuthCodes(ctx context.Context, codes AuthCodeStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n, err := codes.DeleteExpiredAuthCodes(ctx, now)
+			if err != nil {
+				slog.Error("Cannot delete expired authorization codes.", "err", err)
+				continue
+			}
+			if n > 0 {
+				slog.Debug("Deleted expired authorization codes.", "count", n)
+			}
+		}
+	}
+}
+
+// SQLAuthCodeStore keeps authorization codes in the auth_codes table of a
+// SQL database of any supported dialect. Consumed codes stay behind, marked
+// used, until DeleteExpiredAuthCodes removes them.
+type SQLAuthCodeStore struct {
+	db      *sql.DB
+	dialect db.Dialect
+}
+
+func NewSQLAuthCodeStore(conn *sql.DB, dialect db.Dialect) *SQLAuthCodeStore {
+	return &SQLAuthCodeStore{db: conn, dialect: dialect}
+}
+
+func NewSQLiteAuthCodeStore(conn *sql.DB) *SQLAuthCodeStore {
+	return NewSQLAuthCodeStore(conn, db.SQLite)
+}
+
+const authCodeColumns = `client_id, redirect_uri, scope, nonce, claims, code_challenge, code_challenge_method, user_id, auth_time, used, created_at, expires_after`
+
+func scanAuthCode(row interface{ Scan(dest ...any) error }, code string) (c AuthCode, err error) {
+	err = row.Scan(
+		&c.ClientID,
+		&c.RedirectURI,
+		&c.Scope,
+		&c.Nonce,
+		&c.Claims,
+		&c.CodeChallenge,
+		&c.CodeChallengeMethod,
+		&c.UserID,
+		&c.AuthTime,
+		&c.Used,
+		&c.CreatedAt,
+		&c.ExpiresAfter,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return AuthCode{}, ErrNotFound
+	}
+	if err != nil {
+		return AuthCode{}, checkErr(err)
+	}
+	c.Code = code
+
+	return c, nil
+}
+
+func (s *SQLAuthCodeStore) CreateAuthCode(ctx context.Context, code AuthCode) error {
+	if code.CreatedAt.IsZero() {
+		code.CreatedAt = time.Now()
+	}
+
+	hash := hashAuthCode(code.Code)
+	var id int64
+	err := s.dialect.QuerierFor(ctx, s.db).QueryRowContext(
+		ctx,
+		`INSERT INTO auth_codes(code, client_id, redirect_uri, scope, nonce, claims, code_challenge, code_challenge_method, user_id, auth_time, created_at, expires_after)
+		SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM auth_codes WHERE code = ?)
+		RETURNING id`,
+		hash,
+		code.ClientID,
+		code.RedirectURI,
+		code.Scope,
+		code.Nonce,
+		code.Claims,
+		code.CodeChallenge,
+		code.CodeChallengeMethod,
+		code.UserID,
+		code.AuthTime.UTC(),
+		code.CreatedAt.UTC(),
+		code.ExpiresAfter.UTC(),
+		hash,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrConflict
+	}
+
+	return checkErr(err)
+}
+
+func (s *SQLAuthCodeStore) GetAuthCode(ctx context.Context, code string) (AuthCode, error) {
+	return scanAuthCode(s.dialect.QuerierFor(ctx, s.db).QueryRowContext(
+		ctx,
+		`SELECT `+authCodeColumns+` FROM auth_codes WHERE code = ?`,
+		hashAuthCode(code),
+	), code)
+}
+
+func (s *SQLAuthCodeStore) ConsumeAuthCode(ctx context.Context, code string) (AuthCode, error) {
+	// Marking the code used and reading it back is one statement, so two
+	// redemptions racing can't both see it unused.
+	return scanAuthCode(s.dialect.QuerierFor(ctx, s.db).QueryRowContext(
+		ctx,
+		`UPDATE auth_codes SET used = TRUE WHERE code = ? AND NOT used RETURNING `+authCodeColumns,
+		hashAuthCode(code),
+	), code)
+}
+
+func (s *SQLAuthCodeStore) DeleteExpiredAuthCodes(ctx context.Context, now time.Time) (int64, error) {
+	res, err := s.dialect.QuerierFor(ctx, s.db).ExecContext(
+		ctx,
+		`DELETE FROM auth_codes WHERE expires_after < ?`,
+		now.UTC(),
+	)
+	if err != nil {
+		return 0, checkErr(err)
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,98 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/store"
+	"github.com/ehubscher/goidp/internal/store/storetest"
+)
+
+func TestMemoryAuthCodeStoreConformance(t *testing.T) {
+	storetest.RunAuthCodeStoreTests(t, func() (store.AuthCodeStore, store.UserStore) {
+		return store.NewMemoryAuthCodeStore(), store.NewMemoryUserStore()
+	})
+}
+
+func TestSQLiteAuthCodeStoreConformance(t *testing.T) {
+	storetest.RunAuthCodeStoreTests(t, func() (store.AuthCodeStore, store.UserStore) {
+		conn := openTestDB(t)
+		return store.NewSQLiteAuthCodeStore(conn), store.NewSQLiteUserStore(conn)
+	})
+}
+
+func TestSQLiteAuthCodeStoreHashesCodes(t *testing.T) {
+	conn := openTestDB(t)
+	ctx := context.Background()
+	user, err := store.NewSQLiteUserStore(conn).CreateUser(ctx, "example1@email.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.NewSQLiteAuthCodeStore(conn).CreateAuthCode(ctx, store.AuthCode{
+		Code:         "plaintext-code",
+		ClientID:     "client",
+		RedirectURI:  "https://client.example/callback",
+		UserID:       user.ID,
+		AuthTime:     time.Now(),
+		ExpiresAfter: time.Now().Add(time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stored string
+	err = conn.QueryRow(`SELECT code FROM auth_codes`).Scan(&stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == "plaintext-code" || len(stored) != 64 {
+		t.Errorf("got: %q, want: a SHA-256 hex digest", stored)
+	}
+}
+
+func TestMemoryAuthCodeStoreSweeps(t *testing.T) {
+	codes := store.NewMemoryAuthCodeStore()
+	ctx := context.Background()
+	issued := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+
+	for i, code := range []string{"code-1", "code-2"} {
+		err := codes.CreateAuthCode(ctx, store.AuthCode{
+			Code:         code,
+			CreatedAt:    issued.Add(time.Duration(i) * time.Hour),
+			ExpiresAfter: issued.Add(time.Duration(i)*time.Hour + time.Minute),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := codes.GetAuthCode(ctx, "code-1"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("got: %v, want: the expired code swept", err)
+	}
+	if _, err := codes.GetAuthCode(ctx, "code-2"); err != nil {
+		t.Errorf("got: %v, want: the new code kept", err)
+	}
+}
+
+func TestSweepAuthCodes(t *testing.T) {
+	codes := store.NewMemoryAuthCodeStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	err := codes.CreateAuthCode(ctx, store.AuthCode{Code: "code-1", ExpiresAfter: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		store.SweepAuthCodes(ctx, codes, time.Millisecond)
+		close(done)
+	}()
+	for _, err := codes.GetAuthCode(ctx, "code-1"); err == nil; _, err = codes.GetAuthCode(ctx, "code-1") {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Consent records the scopes a user has agreed to grant a client.
+type Consent struct {
+	UserID    int64
+	ClientID  string
+	Scopes    []string
+	GrantedAt time.Time
+}
+
+type ConsentStore interface {
+	GetConsent(ctx context.Context, userID int64, clientID string) (Consent, error)
+	SaveConsent(ctx context.Context, consent Consent) error
+	// ListUserConsents returns every consent the user has given, ordered
+	// by client id.
+	ListUserConsents(ctx context.Context, userID int64) ([]Consent, error)
+	DeleteUserConsents(ctx context.Context, userID int64) error
+}
+
+type consentKey struct {
+	userID   int64
+	clientID string
+}
+
+type MemoryConsentStore struct {
+	mu       sync.RWMutex
+	consents map[consentKey]Consent
+}
+
+func NewMemoryConsentStore() *MemoryConsentStore {
+	return &MemoryConsentStore{consents: make(map[consentKey]Consent)}
+}
+
+func (s *MemoryConsentStore) GetConsent(ctx context.Context, userID int64, clientID string) (Consent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	consent, ok := s.consents[consentKey{userID, clientID}]
+	if !ok {
+		return Consent{}, ErrNotFound
+	}
+	consent.Scopes = slices.Clone(consent.Scopes)
+
+	return consent, nil
+}
+
+func (s *MemoryConsentStore) SaveConsent(ctx context.Context, consent Consent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	consent.Scopes = slices.Clone(consent.Scopes)
+	s.consents[consentKey{consent.UserID, consent.ClientID}] = consent
+
+	return nil
+}
+
+func (s *MemoryConsentStore) ListUserConsents(ctx context.Context, userID int64) (consents []Consent, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for k, consent := range s.consents {
+		if k.userID == userID {
+			consent.Scopes = slices.Clone(consent.Scopes)
+			consents = append(consents, consent)
+		}
+	}
+	slices.SortFunc(consents, func(a, b Consent) int {
+		return strings.Compare(a.ClientID, b.ClientID)
+	})
+
+	return consents, nil
+}
+
+func (s *MemoryConsentStore) DeleteUserConsents(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k := range s.consents {
+		if k.userID == userID {
+			delete(s.consents, k)
+		}
+	}
+
+	return nil
+}
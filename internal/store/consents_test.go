@@ -0,0 +1,14 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/store"
+	"github.com/ehubscher/goidp/internal/store/storetest"
+)
+
+func TestMemoryConsentStoreConformance(t *testing.T) {
+	storetest.RunConsentStoreTests(t, func() store.ConsentStore {
+		return store.NewMemoryConsentStore()
+	})
+}
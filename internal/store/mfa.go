@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// MFAEnrollment holds a user's second factor settings.
+type MFAEnrollment struct {
+	UserID int64
+	// Required makes the user present a second factor at login whether or
+	// not the provider's MFA policy asks it of them.
+	Required bool
+	// TOTPSecret is the key shared with the user's authenticator app.
+	// Empty means no app is enrolled.
+	TOTPSecret []byte
+	// TOTPLastStep is the time step of the last code accepted.
+	TOTPLastStep int64
+}
+
+type MFAStore interface {
+	GetMFAEnrollment(ctx context.Context, userID int64) (MFAEnrollment, error)
+	PutMFAEnrollment(ctx context.Context, enrollment MFAEnrollment) error
+	// UseTOTPStep records step as the last one accepted for the user. It
+	// fails with ErrConflict unless step is later than the last, so the
+	// same code can't complete two logins.
+	UseTOTPStep(ctx context.Context, userID, step int64) error
+	DeleteMFAEnrollment(ctx context.Context, userID int64) error
+}
+
+type MemoryMFAStore struct {
+	mu          sync.Mutex
+	enrollments map[int64]MFAEnrollment
+}
+
+func NewMemoryMFAStore() *MemoryMFAStore {
+	return &MemoryMFAStore{enrollments: make(map[int64]MFAEnrollment)}
+}
+
+func (s *MemoryMFAStore) GetMFAEnrollment(ctx context.Context, userID int64) (MFAEnrollment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enrollment, ok := s.enrollments[userID]
+	if !ok {
+		return MFAEnrollment{}, ErrNotFound
+	}
+	enrollment.TOTPSecret = slices.Clone(enrollment.TOTPSecret)
+
+	return enrollment, nil
+}
+
+func (s *MemoryMFAStore) PutMFAEnrollment(ctx context.Context, enrollment MFAEnrollment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enrollment.TOTPSecret = slices.Clone(enrollment.TOTPSecret)
+	s.enrollments[enrollment.UserID] = enrollment
+
+	return nil
+}
+
+func (s *MemoryMFAStore) UseTOTPStep(ctx context.Context, userID, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enrollment, ok := s.enrollments[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	if step <= enrollment.TOTPLastStep {
+		return ErrConflict
+	}
+	enrollment.TOTPLastStep = step
+	s.enrollments[userID] = enrollment
+
+	return nil
+}
+
+func (s *MemoryMFAStore) DeleteMFAEnrollment(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.enrollments, userID)
+
+	return nil
+}
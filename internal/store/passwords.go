@@ -0,0 +1,132 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/ehubscher/goidp/internal/db"
+)
+
+// PasswordHistoryStore keeps the hashes of the passwords a user has set, so
+// recent ones can be refused when the password is changed.
+type PasswordHistoryStore interface {
+	// RecentPasswordHashes returns up to n of the user's hashes, newest first.
+	RecentPasswordHashes(ctx context.Context, userID int64, n int) ([]string, error)
+	// AddPasswordHash records hash as the newest and prunes all but the keep
+	// most recent entries.
+	AddPasswordHash(ctx context.Context, userID int64, hash string, keep int) error
+	DeletePasswordHistory(ctx context.Context, userID int64) error
+}
+
+type MemoryPasswordHistoryStore struct {
+	mu     sync.RWMutex
+	hashes map[int64][]string
+}
+
+func NewMemoryPasswordHistoryStore() *MemoryPasswordHistoryStore {
+	return &MemoryPasswordHistoryStore{hashes: make(map[int64][]string)}
+}
+
+func (s *MemoryPasswordHistoryStore) RecentPasswordHashes(ctx context.Context, userID int64, n int) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hashes := s.hashes[userID]
+	if len(hashes) > n {
+		hashes = hashes[:n]
+	}
+
+	return append([]string(nil), hashes...), nil
+}
+
+func (s *MemoryPasswordHistoryStore) AddPasswordHash(ctx context.Context, userID int64, hash string, keep int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hashes := append([]string{hash}, s.hashes[userID]...)
+	if len(hashes) > keep {
+		hashes = hashes[:keep]
+	}
+	s.hashes[userID] = hashes
+
+	return nil
+}
+
+func (s *MemoryPasswordHistoryStore) DeletePasswordHistory(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.hashes, userID)
+
+	return nil
+}
+
+// SQLPasswordHistoryStore keeps password history in a SQL database of any supported dialect.
+type SQLPasswordHistoryStore struct {
+	db      *sql.DB
+	dialect db.Dialect
+}
+
+func NewSQLPasswordHistoryStore(conn *sql.DB, dialect db.Dialect) *SQLPasswordHistoryStore {
+	return &SQLPasswordHistoryStore{db: conn, dialect: dialect}
+}
+
+func NewSQLitePasswordHistoryStore(conn *sql.DB) *SQLPasswordHistoryStore {
+	return NewSQLPasswordHistoryStore(conn, db.SQLite)
+}
+
+func (s *SQLPasswordHistoryStore) RecentPasswordHashes(ctx context.Context, userID int64, n int) (hashes []string, err error) {
+	rows, err := s.dialect.QuerierFor(ctx, s.db).QueryContext(
+		ctx,
+		`SELECT password_hash FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?`,
+		userID,
+		n,
+	)
+	if err != nil {
+		return nil, checkErr(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash string
+		err = rows.Scan(&hash)
+		if err != nil {
+			return nil, checkErr(err)
+		}
+		hashes = append(hashes, hash)
+	}
+
+	return hashes, checkErr(rows.Err())
+}
+
+func (s *SQLPasswordHistoryStore) AddPasswordHash(ctx context.Context, userID int64, hash string, keep int) error {
+	q := s.dialect.QuerierFor(ctx, s.db)
+
+	_, err := q.ExecContext(
+		ctx,
+		`INSERT INTO password_history(user_id, password_hash) VALUES(?,?)`,
+		userID,
+		hash,
+	)
+	if err != nil {
+		return checkErr(err)
+	}
+
+	_, err = q.ExecContext(
+		ctx,
+		`DELETE FROM password_history WHERE user_id = ? AND id NOT IN (
+			SELECT id FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?
+		)`,
+		userID,
+		userID,
+		keep,
+	)
+
+	return checkErr(err)
+}
+
+func (s *SQLPasswordHistoryStore) DeletePasswordHistory(ctx context.Context, userID int64) error {
+	_, err := s.dialect.QuerierFor(ctx, s.db).ExecContext(ctx, `DELETE FROM password_history WHERE user_id = ?`, userID)
+	return checkErr(err)
+}
@@ -0,0 +1,58 @@
+package store_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/store"
+	"github.com/ehubscher/goidp/internal/store/storetest"
+)
+
+func TestSQLitePasswordHistoryStore(t *testing.T) {
+	conn := openTestDB(t)
+	_, err := conn.Exec(`INSERT INTO users(email, password_hash) VALUES(?,?)`, "example1@email.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history := store.NewSQLitePasswordHistoryStore(conn)
+	ctx := context.Background()
+
+	for _, hash := range []string{"h1", "h2", "h3", "h4"} {
+		err = history.AddPasswordHash(ctx, 1, hash, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := history.RecentPasswordHashes(ctx, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"h4", "h3", "h2"}; !slices.Equal(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+
+	var rows int
+	err = conn.QueryRow(`SELECT COUNT(*) FROM password_history`).Scan(&rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows != 3 {
+		t.Errorf("got: %d rows, want: 3 after pruning", rows)
+	}
+}
+
+func TestMemoryPasswordHistoryStoreConformance(t *testing.T) {
+	storetest.RunPasswordHistoryStoreTests(t, func() (store.PasswordHistoryStore, store.UserStore) {
+		return store.NewMemoryPasswordHistoryStore(), store.NewMemoryUserStore()
+	})
+}
+
+func TestSQLitePasswordHistoryStoreConformance(t *testing.T) {
+	storetest.RunPasswordHistoryStoreTests(t, func() (store.PasswordHistoryStore, store.UserStore) {
+		conn := openTestDB(t)
+		return store.NewSQLitePasswordHistoryStore(conn), store.NewSQLiteUserStore(conn)
+	})
+}
@@ -0,0 +1,61 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/db"
+	"github.com/ehubscher/goidp/internal/store"
+	"github.com/ehubscher/goidp/internal/store/storetest"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// openPostgres connects to the database at TEST_POSTGRES_URL and empties it.
+// Without the variable the test skips.
+func openPostgres(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_URL is not set")
+	}
+	conn, err := db.Config{Dialect: db.Postgres, DSN: dsn}.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ctx := context.Background()
+	err = db.Postgres.Migrate(ctx, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.ExecContext(ctx, `TRUNCATE users RESTART IDENTITY CASCADE`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn
+}
+
+func TestPostgresStoreConformance(t *testing.T) {
+	openPostgres(t)
+
+	storetest.RunUserStoreTests(t, func() store.UserStore {
+		return store.NewSQLUserStore(openPostgres(t), db.Postgres)
+	})
+	storetest.RunProfileStoreTests(t, func() (store.ProfileStore, store.UserStore) {
+		conn := openPostgres(t)
+		return store.NewSQLProfileStore(conn, db.Postgres), store.NewSQLUserStore(conn, db.Postgres)
+	})
+	storetest.RunPasswordHistoryStoreTests(t, func() (store.PasswordHistoryStore, store.UserStore) {
+		conn := openPostgres(t)
+		return store.NewSQLPasswordHistoryStore(conn, db.Postgres), store.NewSQLUserStore(conn, db.Postgres)
+	})
+	storetest.RunAuthCodeStoreTests(t, func() (store.AuthCodeStore, store.UserStore) {
+		conn := openPostgres(t)
+		return store.NewSQLAuthCodeStore(conn, db.Postgres), store.NewSQLUserStore(conn, db.Postgres)
+	})
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/db"
+)
+
+// Profile holds the OpenID Connect standard claims we keep for a user beyond
+// the email address on the user record itself.
+type Profile struct {
+	UserID     int64
+	Name       string
+	GivenName  string
+	FamilyName string
+	Picture    string
+	Locale     string
+	UpdatedAt  time.Time
+}
+
+type ProfileStore interface {
+	GetProfile(ctx context.Context, userID int64) (Profile, error)
+	UpdateProfile(ctx context.Context, profile Profile) error
+	DeleteProfile(ctx context.Context, userID int64) error
+}
+
+type MemoryProfileStore struct {
+	mu       sync.RWMutex
+	profiles map[int64]Profile
+}
+
+func NewMemoryProfileStore() *MemoryProfileStore {
+	return &MemoryProfileStore{profiles: make(map[int64]Profile)}
+}
+
+func (s *MemoryProfileStore) GetProfile(ctx context.Context, userID int64) (Profile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	profile, ok := s.profiles[userID]
+	if !ok {
+		return Profile{}, ErrNotFound
+	}
+
+	return profile, nil
+}
+
+func (s *MemoryProfileStore) UpdateProfile(ctx context.Context, profile Profile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if profile.UpdatedAt.IsZero() {
+		profile.UpdatedAt = time.Now()
+	}
+	s.profiles[profile.UserID] = profile
+
+	return nil
+}
+
+func (s *MemoryProfileStore) DeleteProfile(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.profiles, userID)
+
+	return nil
+}
+
+// SQLProfileStore keeps profiles in a SQL database of any supported dialect.
+type SQLProfileStore struct {
+	db      *sql.DB
+	dialect db.Dialect
+}
+
+func NewSQLProfileStore(conn *sql.DB, dialect db.Dialect) *SQLProfileStore {
+	return &SQLProfileStore{db: conn, dialect: dialect}
+}
+
+func NewSQLiteProfileStore(conn *sql.DB) *SQLProfileStore {
+	return NewSQLProfileStore(conn, db.SQLite)
+}
+
+func (s *SQLProfileStore) GetProfile(ctx context.Context, userID int64) (Profile, error) {
+	var profile Profile
+	err := s.dialect.QuerierFor(ctx, s.db).QueryRowContext(
+		ctx,
+		`SELECT user_id, name, given_name, family_name, picture, locale, updated_at FROM profiles WHERE user_id = ?`,
+		userID,
+	).Scan(
+		&profile.UserID,
+		&profile.Name,
+		&profile.GivenName,
+		&profile.FamilyName,
+		&profile.Picture,
+		&profile.Locale,
+		&profile.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Profile{}, ErrNotFound
+	}
+	if err != nil {
+		return Profile{}, checkErr(err)
+	}
+
+	return profile, nil
+}
+
+func (s *SQLProfileStore) UpdateProfile(ctx context.Context, profile Profile) error {
+	if profile.UpdatedAt.IsZero() {
+		profile.UpdatedAt = time.Now()
+	}
+
+	_, err := s.dialect.QuerierFor(ctx, s.db).ExecContext(
+		ctx,
+		`INSERT INTO profiles(user_id, name, given_name, family_name, picture, locale, updated_at)
+		VALUES(?,?,?,?,?,?,?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			name = excluded.name,
+			given_name = excluded.given_name,
+			family_name = excluded.family_name,
+			picture = excluded.picture,
+			locale = excluded.locale,
+			updated_at = excluded.updated_at`,
+		profile.UserID,
+		profile.Name,
+		profile.GivenName,
+		profile.FamilyName,
+		profile.Picture,
+		profile.Locale,
+		profile.UpdatedAt.UTC(),
+	)
+
+	return checkErr(err)
+}
+
+func (s *SQLProfileStore) DeleteProfile(ctx context.Context, userID int64) error {
+	_, err := s.dialect.QuerierFor(ctx, s.db).ExecContext(ctx, `DELETE FROM profiles WHERE user_id = ?`, userID)
+	return checkErr(err)
+}
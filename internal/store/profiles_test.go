@@ -0,0 +1,94 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/db"
+	"github.com/ehubscher/goidp/internal/store"
+	"github.com/ehubscher/goidp/internal/store/storetest"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	conn, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetMaxOpenConns(1)
+
+	err = db.Migrate(context.Background(), conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn
+}
+
+func TestSQLiteProfileStore(t *testing.T) {
+	conn := openTestDB(t)
+	_, err := conn.Exec(`INSERT INTO users(email, password_hash) VALUES(?,?)`, "example1@email.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profiles := store.NewSQLiteProfileStore(conn)
+	ctx := context.Background()
+
+	_, err = profiles.GetProfile(ctx, 1)
+	if err != store.ErrNotFound {
+		t.Errorf("got: %v, want: %v", err, store.ErrNotFound)
+	}
+
+	want := store.Profile{
+		UserID:    1,
+		Name:      "Jane Doe",
+		GivenName: "Jane",
+		Locale:    "en-CA",
+		UpdatedAt: time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC),
+	}
+	for _, name := range []string{"Jane Roe", want.Name} {
+		want.Name = name
+		err = profiles.UpdateProfile(ctx, want)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := profiles.GetProfile(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != want.Name || got.GivenName != want.GivenName || got.Locale != want.Locale || !got.UpdatedAt.Equal(want.UpdatedAt) {
+		t.Errorf("got: %+v, want: %+v", got, want)
+	}
+}
+
+func TestSQLiteProfileStoreUnavailable(t *testing.T) {
+	conn := openTestDB(t)
+	profiles := store.NewSQLiteProfileStore(conn)
+	conn.Close()
+
+	_, err := profiles.GetProfile(context.Background(), 1)
+	if !errors.Is(err, store.ErrUnavailable) {
+		t.Errorf("got: %v, want: %v", err, store.ErrUnavailable)
+	}
+}
+
+func TestMemoryProfileStoreConformance(t *testing.T) {
+	storetest.RunProfileStoreTests(t, func() (store.ProfileStore, store.UserStore) {
+		return store.NewMemoryProfileStore(), store.NewMemoryUserStore()
+	})
+}
+
+func TestSQLiteProfileStoreConformance(t *testing.T) {
+	storetest.RunProfileStoreTests(t, func() (store.ProfileStore, store.UserStore) {
+		conn := openTestDB(t)
+		return store.NewSQLiteProfileStore(conn), store.NewSQLiteUserStore(conn)
+	})
+}
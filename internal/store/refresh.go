@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RefreshToken is a refresh token issued at /token. Only a hash of the token
+// is stored. Scope is the scope originally granted, which every token issued
+// from it is limited to. Binding is the hashed fingerprint of the context
+// the token is bound to, or empty.
+type RefreshToken struct {
+	TokenHash string
+	ClientID  string
+	UserID    int64
+	Scope     string
+	// Claims are the claims requested individually for userinfo,
+	// space-separated, passed on to the access tokens it is refreshed for.
+	Claims    string
+	Binding   string
+	AuthTime  time.Time
+	ExpiresAt time.Time
+}
+
+type RefreshTokenStore interface {
+	CreateRefreshToken(ctx context.Context, token RefreshToken) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error)
+	// ConsumeRefreshToken removes the token so it cannot be used a second
+	// time. It returns ErrNotFound if it was already consumed.
+	ConsumeRefreshToken(ctx context.Context, tokenHash string) error
+	DeleteUserRefreshTokens(ctx context.Context, userID int64) error
+}
+
+type MemoryRefreshTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]RefreshToken
+}
+
+func NewMemoryRefreshTokenStore() *MemoryRefreshTokenStore {
+	return &MemoryRefreshTokenStore{tokens: make(map[string]RefreshToken)}
+}
+
+func (s *MemoryRefreshTokenStore) CreateRefreshToken(ctx context.Context, token RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tokens[token.TokenHash]; ok {
+		return ErrConflict
+	}
+	s.tokens[token.TokenHash] = token
+
+	return nil
+}
+
+func (s *MemoryRefreshTokenStore) GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[tokenHash]
+	if !ok {
+		return RefreshToken{}, ErrNotFound
+	}
+
+	return token, nil
+}
+
+func (s *MemoryRefreshTokenStore) ConsumeRefreshToken(ctx context.Context, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tokens[tokenHash]; !ok {
+		return ErrNotFound
+	}
+	delete(s.tokens, tokenHash)
+
+	return nil
+}
+
+func (s *MemoryRefreshTokenStore) DeleteUserRefreshTokens(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, v := range s.tokens {
+		if v.UserID == userID {
+			delete(s.tokens, k)
+		}
+	}
+
+	return nil
+}
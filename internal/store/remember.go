@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RememberToken is a persistent login ("remember me") token. Series stays
+// fixed for the life of the login while TokenHash changes on every use.
+type RememberToken struct {
+	Series    string
+	TokenHash string
+	UserID    int64
+	AuthTime  time.Time
+	// AMR is the amr of the session that was remembered, which sessions
+	// restored from the token carry on.
+	AMR       []string
+	ExpiresAt time.Time
+}
+
+type RememberTokenStore interface {
+	CreateRememberToken(ctx context.Context, token RememberToken) error
+	GetRememberToken(ctx context.Context, series string) (RememberToken, error)
+	// RotateRememberToken replaces the token hash for series, but only if it
+	// is still oldHash, so two concurrent uses can't both rotate it.
+	RotateRememberToken(ctx context.Context, series, oldHash, newHash string, expiresAt time.Time) error
+	DeleteRememberSeries(ctx context.Context, series string) error
+	DeleteUserRememberTokens(ctx context.Context, userID int64) error
+}
+
+type MemoryRememberTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]RememberToken
+}
+
+func NewMemoryRememberTokenStore() *MemoryRememberTokenStore {
+	return &MemoryRememberTokenStore{tokens: make(map[string]RememberToken)}
+}
+
+func (s *MemoryRememberTokenStore) CreateRememberToken(ctx context.Context, token RememberToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tokens[token.Series]; ok {
+		return ErrConflict
+	}
+	s.tokens[token.Series] = token
+
+	return nil
+}
+
+func (s *MemoryRememberTokenStore) GetRememberToken(ctx context.Context, series string) (RememberToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[series]
+	if !ok {
+		return RememberToken{}, ErrNotFound
+	}
+
+	return token, nil
+}
+
+func (s *MemoryRememberTokenStore) RotateRememberToken(ctx context.Context, series, oldHash, newHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[series]
+	if !ok || token.TokenHash != oldHash {
+		return ErrNotFound
+	}
+	token.TokenHash = newHash
+	token.ExpiresAt = expiresAt
+	s.tokens[series] = token
+
+	return nil
+}
+
+func (s *MemoryRememberTokenStore) DeleteRememberSeries(ctx context.Context, series string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.tokens, series)
+
+	return nil
+}
+
+func (s *MemoryRememberTokenStore) DeleteUserRememberTokens(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for series, token := range s.tokens {
+		if token.UserID == userID {
+			delete(s.tokens, series)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"container/heap"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultReplayCacheSize = 100_000
+
+// ErrReplayCacheFull means a replay cache holds as many live keys as it
+// may. It is ErrUnavailable, as the check can succeed once entries expire.
+var ErrReplayCacheFull = fmt.Errorf("%w: replay cache full", ErrUnavailable)
+
+// ReplayCache answers "seen before?" for single-use values that only need
+// remembering while they could be accepted, such as nonces and the jti of
+// client assertions. Implementations must be safe for concurrent use. A
+// cache shared by every instance makes replay checks hold across a whole
+// deployment, which MemoryReplayCache can only do for one.
+type ReplayCache interface {
+	// Seen records key for ttl and reports whether it was already recorded
+	// and hadn't expired yet. It must fail rather than forget a live key,
+	// so that a replay is never let through.
+	Seen(ctx context.Context, key string, ttl time.Duration) (seen bool, err error)
+}
+
+// MemoryReplayCache is a ReplayCache held in memory. Keys are hashed, so an
+// entry's size doesn't depend on the value a client chose, and expired
+// entries are swept on every call. The zero value is ready to use.
+type MemoryReplayCache struct {
+	// Size bounds how many live keys are held. Once full, Seen fails with
+	// ErrReplayCacheFull until entries expire. Zero means 100000.
+	Size int
+
+	// Now defaults to time.Now and exists so tests can control time.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	seen     map[[sha256.Size]byte]time.Time
+	expiries replayQueue
+}
+
+type replayEntry struct {
+	key     [sha256.Size]byte
+	expires time.Time
+}
+
+// replayQueue is a min-heap of entries by expiry, as TTLs differ per key.
+type replayQueue []replayEntry
+
+func (q replayQueue) Len() int           { return len(q) }
+func (q replayQueue) Less(i, j int) bool { return q[i].expires.Before(q[j].expires) }
+func (q replayQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *replayQueue) Push(x any)        { *q = append(*q, x.(replayEntry)) }
+func (q *replayQueue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+func (c *MemoryReplayCache) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+
+	return time.Now()
+}
+
+func (c *MemoryReplayCache) size() int {
+	if c.Size > 0 {
+		return c.Size
+	}
+
+	return defaultReplayCacheSize
+}
+
+func (c *MemoryReplayCache) Seen(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.seen == nil {
+		c.seen = make(map[[sha256.Size]byte]time.Time)
+	}
+	var now time.Time = c.now()
+	c.sweep(now)
+
+	hash := sha256.Sum256([]byte(key))
+	if _, ok := c.seen[hash]; ok {
+		return true, nil
+	}
+	if len(c.seen) >= c.size() {
+		return false, ErrReplayCacheFull
+	}
+
+	var expires time.Time = now.Add(ttl)
+	c.seen[hash] = expires
+	heap.Push(&c.expiries, replayEntry{hash, expires})
+
+	return false, nil
+}
+
+// sweep drops every entry that has expired by now. A key is only recorded
+// again once its entry is gone, so each live key has one queue entry.
+func (c *MemoryReplayCache) sweep(now time.Time) {
+	for len(c.expiries) > 0 && !now.Before(c.expiries[0].expires) {
+		e := heap.Pop(&c.expiries).(replayEntry)
+		delete(c.seen, e.key)
+	}
+}
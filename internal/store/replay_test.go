@@ -0,0 +1,90 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+func TestMemoryReplayCache(t *testing.T) {
+	now := time.Date(2024, 3, 17, 12, 0, 0, 0, time.UTC)
+	cache := &store.MemoryReplayCache{Now: func() time.Time { return now }}
+	ctx := context.Background()
+
+	var checks = []struct {
+		advance time.Duration
+		key     string
+		ttl     time.Duration
+		seen    bool
+	}{
+		{0, "jti-1", time.Minute, false},
+		{30 * time.Second, "jti-1", time.Minute, true},
+		{0, "jti-2", 10 * time.Minute, false},
+		{30 * time.Second, "jti-1", time.Minute, false},
+		{0, "jti-2", 10 * time.Minute, true},
+		{10 * time.Minute, "jti-2", 10 * time.Minute, false},
+	}
+
+	for i, c := range checks {
+		now = now.Add(c.advance)
+		seen, err := cache.Seen(ctx, c.key, c.ttl)
+		if err != nil || seen != c.seen {
+			t.Errorf("%d: %s got: %v, %v, want: %v", i, c.key, seen, err, c.seen)
+		}
+	}
+}
+
+func TestMemoryReplayCacheFull(t *testing.T) {
+	now := time.Date(2024, 3, 17, 12, 0, 0, 0, time.UTC)
+	cache := &store.MemoryReplayCache{Size: 2, Now: func() time.Time { return now }}
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "b"} {
+		_, err := cache.Seen(ctx, key, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := cache.Seen(ctx, "c", time.Minute)
+	if !errors.Is(err, store.ErrReplayCacheFull) || !errors.Is(err, store.ErrUnavailable) {
+		t.Errorf("got: %v, want: %v", err, store.ErrReplayCacheFull)
+	}
+	// A live key is still recognized while full.
+	seen, err := cache.Seen(ctx, "a", time.Minute)
+	if err != nil || !seen {
+		t.Errorf("got: %v, %v, want: seen", seen, err)
+	}
+
+	now = now.Add(time.Minute)
+	seen, err = cache.Seen(ctx, "c", time.Minute)
+	if err != nil || seen {
+		t.Errorf("after expiry got: %v, %v, want: not seen", seen, err)
+	}
+}
+
+func TestMemoryReplayCacheConcurrent(t *testing.T) {
+	cache := &store.MemoryReplayCache{}
+
+	var first atomic.Int32
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			seen, err := cache.Seen(context.Background(), "jti", time.Minute)
+			if err == nil && !seen {
+				first.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if first.Load() != 1 {
+		t.Errorf("got: %d first uses, want: 1", first.Load())
+	}
+}
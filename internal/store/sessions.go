@@ -0,0 +1,151 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+type Session struct {
+	ID       string
+	UserID   int64
+	AuthTime time.Time
+	// AMR lists the methods the user authenticated with, as in the amr
+	// claim of RFC 8176.
+	AMR       []string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type SessionStore interface {
+	CreateSession(ctx context.Context, session Session) error
+	GetSession(ctx context.Context, id string) (Session, error)
+	DeleteSession(ctx context.Context, id string) error
+	// DeleteUserSessions deletes all of the user's sessions except the one
+	// with id except, which may be empty.
+	DeleteUserSessions(ctx context.Context, userID int64, except string) error
+	// CountUserSessions returns how many of the user's sessions are still
+	// unexpired at now.
+	CountUserSessions(ctx context.Context, userID int64, now time.Time) (int, error)
+	// ListUserSessions returns the user's sessions that are still unexpired
+	// at now, oldest first by CreatedAt.
+	ListUserSessions(ctx context.Context, userID int64, now time.Time) ([]Session, error)
+	// EvictUserSessions deletes the user's oldest sessions, by CreatedAt,
+	// until at most keep unexpired ones remain. Expired sessions are deleted
+	// as well. It returns the ids of the evicted unexpired sessions.
+	EvictUserSessions(ctx context.Context, userID int64, keep int, now time.Time) ([]string, error)
+}
+
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]Session
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]Session)}
+}
+
+func (s *MemorySessionStore) CreateSession(ctx context.Context, session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[session.ID]; ok {
+		return ErrConflict
+	}
+	s.sessions[session.ID] = session
+
+	return nil
+}
+
+func (s *MemorySessionStore) GetSession(ctx context.Context, id string) (Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return Session{}, ErrNotFound
+	}
+
+	return session, nil
+}
+
+func (s *MemorySessionStore) DeleteSession(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+
+	return nil
+}
+
+func (s *MemorySessionStore) DeleteUserSessions(ctx context.Context, userID int64, except string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, session := range s.sessions {
+		if session.UserID == userID && id != except {
+			delete(s.sessions, id)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemorySessionStore) CountUserSessions(ctx context.Context, userID int64, now time.Time) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var n int
+	for _, session := range s.sessions {
+		if session.UserID == userID && now.Before(session.ExpiresAt) {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (s *MemorySessionStore) ListUserSessions(ctx context.Context, userID int64, now time.Time) (sessions []Session, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, session := range s.sessions {
+		if session.UserID == userID && now.Before(session.ExpiresAt) {
+			sessions = append(sessions, session)
+		}
+	}
+	slices.SortFunc(sessions, func(a, b Session) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return sessions, nil
+}
+
+func (s *MemorySessionStore) EvictUserSessions(ctx context.Context, userID int64, keep int, now time.Time) (evicted []string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var live []Session
+	for id, session := range s.sessions {
+		if session.UserID != userID {
+			continue
+		}
+		if !now.Before(session.ExpiresAt) {
+			delete(s.sessions, id)
+			continue
+		}
+		live = append(live, session)
+	}
+
+	slices.SortFunc(live, func(a, b Session) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	for len(live) > keep {
+		delete(s.sessions, live[0].ID)
+		evicted = append(evicted, live[0].ID)
+		live = live[1:]
+	}
+
+	return evicted, nil
+}
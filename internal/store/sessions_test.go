@@ -0,0 +1,14 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/store"
+	"github.com/ehubscher/goidp/internal/store/storetest"
+)
+
+func TestMemorySessionStoreConformance(t *testing.T) {
+	storetest.RunSessionStoreTests(t, func() store.SessionStore {
+		return store.NewMemorySessionStore()
+	})
+}
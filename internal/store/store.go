@@ -0,0 +1,58 @@
+package store
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("already exists")
+	// ErrUnavailable means the backing database can't currently serve the
+	// request, so the caller may retry later.
+	ErrUnavailable = errors.New("store unavailable")
+)
+
+// checkErr marks errors that mean the database itself is unreachable or busy
+// with ErrUnavailable, leaving all other errors as they are.
+func checkErr(err error) error {
+	if err == nil || !isUnavailable(err) {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", ErrUnavailable, err)
+}
+
+func isUnavailable(err error) bool {
+	if errors.Is(err, sql.ErrConnDone) || errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	// database/sql doesn't export the error it returns once closed.
+	if err.Error() == "sql: database is closed" {
+		return true
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() & 0xff {
+		case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED, sqlite3.SQLITE_CANTOPEN, sqlite3.SQLITE_IOERR:
+			return true
+		}
+	}
+
+	// Postgres drivers expose the SQLSTATE code. Class 08 is a connection
+	// exception, 53 insufficient resources and 57P0x a server shutting down.
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		state := pgErr.SQLState()
+		return strings.HasPrefix(state, "08") || strings.HasPrefix(state, "53") || strings.HasPrefix(state, "57P0")
+	}
+
+	return false
+}
@@ -0,0 +1,782 @@
+// Package storetest holds the conformance tests every implementation of the
+// store interfaces must pass, so backends can't drift apart in behaviour.
+// Each implementation's own test file calls the Run functions with its
+// constructor. Factories must return a new, empty store on every call.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/store"
+)
+
+func RunUserStoreTests(t *testing.T, factory func() store.UserStore) {
+	ctx := context.Background()
+
+	t.Run("Create", func(t *testing.T) {
+		users := factory()
+		user, err := users.CreateUser(ctx, "example1@email.com", "h1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := users.GetUserByID(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != user.ID || got.Email != "example1@email.com" || got.PasswordHash != "h1" || got.EmailVerified {
+			t.Errorf("by id got: %+v, want: %+v", got, user)
+		}
+		got, err = users.GetUserByEmail(ctx, "EXAMPLE1@email.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != user.ID {
+			t.Errorf("by email got: %+v, want: %+v", got, user)
+		}
+
+		err = users.UpdatePasswordHash(ctx, user.ID, "h2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err = users.GetUserByID(ctx, user.ID)
+		if err != nil || got.PasswordHash != "h2" {
+			t.Errorf("updated got: %+v, %v, want: hash h2", got, err)
+		}
+
+		err = users.SetEmailVerified(ctx, user.ID, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err = users.GetUserByID(ctx, user.ID)
+		if err != nil || !got.EmailVerified {
+			t.Errorf("verified got: %+v, %v, want: email verified", got, err)
+		}
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		users := factory()
+		_, err := users.CreateUser(ctx, "example1@email.com", "h1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = users.CreateUser(ctx, "Example1@email.com", "h2")
+		if !errors.Is(err, store.ErrConflict) {
+			t.Errorf("got: %v, want: %v", err, store.ErrConflict)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		users := factory()
+		if _, err := users.GetUserByID(ctx, 42); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("by id got: %v, want: %v", err, store.ErrNotFound)
+		}
+		if _, err := users.GetUserByEmail(ctx, "nobody@email.com"); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("by email got: %v, want: %v", err, store.ErrNotFound)
+		}
+		if err := users.UpdatePasswordHash(ctx, 42, "h1"); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("update got: %v, want: %v", err, store.ErrNotFound)
+		}
+		if err := users.SetEmailVerified(ctx, 42, true); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("verify got: %v, want: %v", err, store.ErrNotFound)
+		}
+		if err := users.SoftDelete(ctx, 42); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("soft delete got: %v, want: %v", err, store.ErrNotFound)
+		}
+		if err := users.HardDelete(ctx, 42); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("hard delete got: %v, want: %v", err, store.ErrNotFound)
+		}
+	})
+
+	t.Run("EachPasswordHash", func(t *testing.T) {
+		users := factory()
+		for i, hash := range []string{"h1", "h2"} {
+			_, err := users.CreateUser(ctx, fmt.Sprintf("example%d@email.com", i), hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var hashes []string
+		err := users.EachPasswordHash(ctx, func(_ int64, hash string) error {
+			hashes = append(hashes, hash)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(hashes)
+		if want := []string{"h1", "h2"}; !slices.Equal(hashes, want) {
+			t.Errorf("got: %v, want: %v", hashes, want)
+		}
+
+		stop := errors.New("stop")
+		err = users.EachPasswordHash(ctx, func(int64, string) error { return stop })
+		if !errors.Is(err, stop) {
+			t.Errorf("got: %v, want: the callback's error", err)
+		}
+	})
+
+	t.Run("EachUser", func(t *testing.T) {
+		users := factory()
+		var want []int64
+		for i := range 3 {
+			user, err := users.CreateUser(ctx, fmt.Sprintf("example%d@email.com", i), "h1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want = append(want, user.ID)
+		}
+		err := users.SoftDelete(ctx, want[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = slices.Delete(want, 1, 2)
+
+		var got []int64
+		err = users.EachUser(ctx, func(user store.User) error {
+			if user.Email == "" || user.PasswordHash != "h1" {
+				t.Errorf("got: %+v, want: a whole user", user)
+			}
+			got = append(got, user.ID)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("got: %v, want: %v in order", got, want)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		users := factory()
+		user, err := users.CreateUser(ctx, "example1@email.com", "h1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = users.SoftDelete(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := users.GetUserByID(ctx, user.ID); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("soft deleted got: %v, want: %v", err, store.ErrNotFound)
+		}
+		if err := users.SoftDelete(ctx, user.ID); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("second soft delete got: %v, want: %v", err, store.ErrNotFound)
+		}
+		if _, err := users.CreateUser(ctx, "example1@email.com", "h2"); !errors.Is(err, store.ErrConflict) {
+			t.Errorf("reuse of email got: %v, want: %v", err, store.ErrConflict)
+		}
+
+		err = users.HardDelete(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := users.HardDelete(ctx, user.ID); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("second hard delete got: %v, want: %v", err, store.ErrNotFound)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		users := factory()
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := users.CreateUser(ctx, "example1@email.com", "h1")
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		var created int
+		for err := range errs {
+			switch {
+			case err == nil:
+				created++
+			case !errors.Is(err, store.ErrConflict):
+				t.Errorf("got: %v, want: nil or %v", err, store.ErrConflict)
+			}
+		}
+		if created != 1 {
+			t.Errorf("got: %d users created, want: 1", created)
+		}
+	})
+}
+
+// RunProfileStoreTests takes a factory for a profile store and a user store
+// over the same data, since profiles belong to existing users.
+func RunProfileStoreTests(t *testing.T, factory func() (store.ProfileStore, store.UserStore)) {
+	ctx := context.Background()
+
+	t.Run("Update", func(t *testing.T) {
+		profiles, users := factory()
+		user := createUser(t, users)
+
+		want := store.Profile{
+			UserID:    user.ID,
+			Name:      "Jane Doe",
+			GivenName: "Jane",
+			Locale:    "en-CA",
+			UpdatedAt: time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC),
+		}
+		for _, name := range []string{"Jane Roe", want.Name} {
+			want.Name = name
+			err := profiles.UpdateProfile(ctx, want)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, err := profiles.GetProfile(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Name != want.Name || got.GivenName != want.GivenName || got.Locale != want.Locale || !got.UpdatedAt.Equal(want.UpdatedAt) {
+			t.Errorf("got: %+v, want: %+v", got, want)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		profiles, users := factory()
+		user := createUser(t, users)
+
+		if _, err := profiles.GetProfile(ctx, user.ID); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("got: %v, want: %v", err, store.ErrNotFound)
+		}
+
+		err := profiles.UpdateProfile(ctx, store.Profile{UserID: user.ID, Name: "Jane Doe"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = profiles.DeleteProfile(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := profiles.GetProfile(ctx, user.ID); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("deleted got: %v, want: %v", err, store.ErrNotFound)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		profiles, users := factory()
+		user := createUser(t, users)
+
+		var wg sync.WaitGroup
+		for i := range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := profiles.UpdateProfile(ctx, store.Profile{UserID: user.ID, Name: fmt.Sprintf("Jane %d", i)})
+				if err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if _, err := profiles.GetProfile(ctx, user.ID); err != nil {
+			t.Errorf("got: %v, want: the last write", err)
+		}
+	})
+}
+
+// RunPasswordHistoryStoreTests is like RunProfileStoreTests for password
+// history.
+func RunPasswordHistoryStoreTests(t *testing.T, factory func() (store.PasswordHistoryStore, store.UserStore)) {
+	ctx := context.Background()
+
+	t.Run("Prune", func(t *testing.T) {
+		history, users := factory()
+		user := createUser(t, users)
+
+		for _, hash := range []string{"h1", "h2", "h3", "h4"} {
+			err := history.AddPasswordHash(ctx, user.ID, hash, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, err := history.RecentPasswordHashes(ctx, user.ID, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"h4", "h3"}; !slices.Equal(got, want) {
+			t.Errorf("got: %v, want: %v", got, want)
+		}
+		got, err = history.RecentPasswordHashes(ctx, user.ID, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"h4", "h3", "h2"}; !slices.Equal(got, want) {
+			t.Errorf("got: %v, want: %v after pruning", got, want)
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		history, users := factory()
+		user := createUser(t, users)
+
+		err := history.AddPasswordHash(ctx, user.ID, "h1", 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = history.DeletePasswordHistory(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := history.RecentPasswordHashes(ctx, user.ID, 10)
+		if err != nil || len(got) != 0 {
+			t.Errorf("got: %v, %v, want: none", got, err)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		history, users := factory()
+		user := createUser(t, users)
+
+		var wg sync.WaitGroup
+		for i := range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := history.AddPasswordHash(ctx, user.ID, fmt.Sprintf("h%d", i), 5)
+				if err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		got, err := history.RecentPasswordHashes(ctx, user.ID, 10)
+		if err != nil || len(got) != 5 {
+			t.Errorf("got: %v, %v, want: 5 hashes", got, err)
+		}
+	})
+}
+
+// RunAuthCodeStoreTests is like RunProfileStoreTests for authorization
+// codes.
+func RunAuthCodeStoreTests(t *testing.T, factory func() (store.AuthCodeStore, store.UserStore)) {
+	ctx := context.Background()
+	issued := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	newCode := func(userID int64, code string) store.AuthCode {
+		return store.AuthCode{
+			Code:                code,
+			ClientID:            "client",
+			RedirectURI:         "https://client.example/callback",
+			Scope:               "openid email",
+			Nonce:               "n-0S6_WzA2Mj",
+			CodeChallenge:       "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+			CodeChallengeMethod: "S256",
+			UserID:              userID,
+			AuthTime:            issued.Add(-time.Minute),
+			CreatedAt:           issued,
+			ExpiresAfter:        issued.Add(time.Minute),
+		}
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		codes, users := factory()
+		want := newCode(createUser(t, users).ID, "code-1")
+		err := codes.CreateAuthCode(ctx, want)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := codes.GetAuthCode(ctx, "code-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Code != want.Code || got.ClientID != want.ClientID || got.RedirectURI != want.RedirectURI ||
+			got.Scope != want.Scope || got.Nonce != want.Nonce || got.CodeChallenge != want.CodeChallenge ||
+			got.CodeChallengeMethod != want.CodeChallengeMethod || got.UserID != want.UserID ||
+			!got.AuthTime.Equal(want.AuthTime) || !got.ExpiresAfter.Equal(want.ExpiresAfter) || got.Used {
+			t.Errorf("got: %+v, want: %+v", got, want)
+		}
+
+		if err := codes.CreateAuthCode(ctx, want); !errors.Is(err, store.ErrConflict) {
+			t.Errorf("duplicate got: %v, want: %v", err, store.ErrConflict)
+		}
+		if _, err := codes.GetAuthCode(ctx, "code-2"); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("unknown got: %v, want: %v", err, store.ErrNotFound)
+		}
+	})
+
+	t.Run("ConsumeOnce", func(t *testing.T) {
+		codes, users := factory()
+		err := codes.CreateAuthCode(ctx, newCode(createUser(t, users).ID, "code-1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := codes.ConsumeAuthCode(ctx, "code-1")
+		if err != nil || got.Code != "code-1" || got.Scope != "openid email" {
+			t.Fatalf("got: %+v, %v, want: the code", got, err)
+		}
+		if _, err := codes.ConsumeAuthCode(ctx, "code-1"); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("second consume got: %v, want: %v", err, store.ErrNotFound)
+		}
+		got, err = codes.GetAuthCode(ctx, "code-1")
+		if err != nil || !got.Used {
+			t.Errorf("got: %+v, %v, want: the code marked used", got, err)
+		}
+	})
+
+	t.Run("ConcurrentConsume", func(t *testing.T) {
+		codes, users := factory()
+		err := codes.CreateAuthCode(ctx, newCode(createUser(t, users).ID, "code-1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var consumed int
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := codes.ConsumeAuthCode(ctx, "code-1")
+				if err != nil && !errors.Is(err, store.ErrNotFound) {
+					t.Error(err)
+				}
+				if err == nil {
+					mu.Lock()
+					consumed++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		if consumed != 1 {
+			t.Errorf("got: %d successful consumes, want: 1", consumed)
+		}
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		codes, users := factory()
+		user := createUser(t, users)
+		for i, expiresAfter := range []time.Duration{time.Minute, 2 * time.Minute, time.Hour} {
+			code := newCode(user.ID, fmt.Sprintf("code-%d", i))
+			code.ExpiresAfter = issued.Add(expiresAfter)
+			err := codes.CreateAuthCode(ctx, code)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err := codes.ConsumeAuthCode(ctx, "code-0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n, err := codes.DeleteExpiredAuthCodes(ctx, issued.Add(5*time.Minute))
+		if err != nil || n != 2 {
+			t.Errorf("got: %d, %v, want: 2 expired codes deleted", n, err)
+		}
+		for _, code := range []string{"code-0", "code-1"} {
+			if _, err := codes.GetAuthCode(ctx, code); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("%s got: %v, want: %v", code, err, store.ErrNotFound)
+			}
+		}
+		if _, err := codes.ConsumeAuthCode(ctx, "code-2"); err != nil {
+			t.Errorf("unexpired got: %v, want: nil", err)
+		}
+	})
+}
+
+func RunConsentStoreTests(t *testing.T, factory func() store.ConsentStore) {
+	ctx := context.Background()
+
+	t.Run("Save", func(t *testing.T) {
+		consents := factory()
+		for _, scopes := range [][]string{{"openid"}, {"openid", "email"}} {
+			err := consents.SaveConsent(ctx, store.Consent{UserID: 1, ClientID: "b", Scopes: scopes})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := consents.SaveConsent(ctx, store.Consent{UserID: 1, ClientID: "a", Scopes: []string{"openid"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := consents.GetConsent(ctx, 1, "b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got.Scopes, []string{"openid", "email"}) {
+			t.Errorf("got: %v, want: the last save", got.Scopes)
+		}
+
+		list, err := consents.ListUserConsents(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 2 || list[0].ClientID != "a" || list[1].ClientID != "b" {
+			t.Errorf("list got: %+v, want: a then b", list)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		consents := factory()
+		err := consents.SaveConsent(ctx, store.Consent{UserID: 1, ClientID: "a", Scopes: []string{"openid"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := consents.GetConsent(ctx, 2, "a"); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("other user got: %v, want: %v", err, store.ErrNotFound)
+		}
+		err = consents.DeleteUserConsents(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := consents.GetConsent(ctx, 1, "a"); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("deleted got: %v, want: %v", err, store.ErrNotFound)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		consents := factory()
+
+		var wg sync.WaitGroup
+		for i := range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := consents.SaveConsent(ctx, store.Consent{UserID: 1, ClientID: fmt.Sprintf("c%d", i), Scopes: []string{"openid"}})
+				if err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		list, err := consents.ListUserConsents(ctx, 1)
+		if err != nil || len(list) != 10 {
+			t.Errorf("got: %d consents, %v, want: 10", len(list), err)
+		}
+	})
+}
+
+func RunClientStoreTests(t *testing.T, factory func() store.ClientStore) {
+	ctx := context.Background()
+	fill := func(t *testing.T, clients store.ClientStore, n int) {
+		t.Helper()
+		for i := range n {
+			err := clients.PutClient(ctx, store.Client{ID: fmt.Sprintf("client%02d", i)})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	t.Run("Put", func(t *testing.T) {
+		clients := factory()
+		err := clients.PutClient(ctx, store.Client{ID: "client1", Name: "One"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = clients.PutClient(ctx, store.Client{ID: "client1", Name: "Uno"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := clients.GetClient(ctx, "client1")
+		if err != nil || got.Name != "Uno" {
+			t.Errorf("got: %+v, %v, want: the replaced client", got, err)
+		}
+		if _, err := clients.GetClient(ctx, "missing"); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("got: %v, want: %v", err, store.ErrNotFound)
+		}
+	})
+
+	t.Run("Paginate", func(t *testing.T) {
+		clients := factory()
+		fill(t, clients, 5)
+
+		var ids []string
+		var cursor string
+		for {
+			page, next, err := clients.ListClients(ctx, store.ClientFilter{}, 2, cursor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range page {
+				ids = append(ids, c.ID)
+			}
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+		if want := []string{"client00", "client01", "client02", "client03", "client04"}; !slices.Equal(ids, want) {
+			t.Errorf("got: %v, want: %v", ids, want)
+		}
+	})
+
+	t.Run("ZeroLimit", func(t *testing.T) {
+		clients := factory()
+		fill(t, clients, store.DefaultClientListLimit+1)
+
+		for _, limit := range []int{0, -1} {
+			page, next, err := clients.ListClients(ctx, store.ClientFilter{}, limit, "")
+			if err != nil || len(page) != store.DefaultClientListLimit || next == "" {
+				t.Errorf("limit %d got: %d clients, next %q, %v, want: %d and a next cursor", limit, len(page), next, err, store.DefaultClientListLimit)
+			}
+		}
+	})
+}
+
+func RunSessionStoreTests(t *testing.T, factory func() store.SessionStore) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 17, 12, 0, 0, 0, time.UTC)
+	session := func(id string, userID int64, age time.Duration) store.Session {
+		return store.Session{ID: id, UserID: userID, CreatedAt: now.Add(-age), AuthTime: now.Add(-age), ExpiresAt: now.Add(time.Hour - age)}
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		sessions := factory()
+		want := session("s1", 1, 0)
+		err := sessions.CreateSession(ctx, want)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := sessions.GetSession(ctx, "s1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.UserID != want.UserID || !got.ExpiresAt.Equal(want.ExpiresAt) {
+			t.Errorf("got: %+v, want: %+v", got, want)
+		}
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		sessions := factory()
+		err := sessions.CreateSession(ctx, session("s1", 1, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sessions.CreateSession(ctx, session("s1", 2, 0))
+		if !errors.Is(err, store.ErrConflict) {
+			t.Errorf("got: %v, want: %v", err, store.ErrConflict)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		sessions := factory()
+		if _, err := sessions.GetSession(ctx, "missing"); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("got: %v, want: %v", err, store.ErrNotFound)
+		}
+
+		err := sessions.CreateSession(ctx, session("s1", 1, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sessions.DeleteSession(ctx, "s1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := sessions.GetSession(ctx, "s1"); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("deleted got: %v, want: %v", err, store.ErrNotFound)
+		}
+	})
+
+	t.Run("PerUser", func(t *testing.T) {
+		sessions := factory()
+		for _, s := range []store.Session{
+			session("old", 1, 50*time.Minute),
+			session("new", 1, 10*time.Minute),
+			session("expired", 1, 2*time.Hour),
+			session("other", 2, 0),
+		} {
+			err := sessions.CreateSession(ctx, s)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		n, err := sessions.CountUserSessions(ctx, 1, now)
+		if err != nil || n != 2 {
+			t.Errorf("count got: %d, %v, want: 2", n, err)
+		}
+		list, err := sessions.ListUserSessions(ctx, 1, now)
+		if err != nil || len(list) != 2 || list[0].ID != "old" || list[1].ID != "new" {
+			t.Errorf("list got: %+v, %v, want: old then new", list, err)
+		}
+
+		evicted, err := sessions.EvictUserSessions(ctx, 1, 1, now)
+		if err != nil || !slices.Equal(evicted, []string{"old"}) {
+			t.Errorf("evict got: %v, %v, want: [old]", evicted, err)
+		}
+
+		err = sessions.DeleteUserSessions(ctx, 1, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := sessions.CountUserSessions(ctx, 1, now); n != 0 {
+			t.Errorf("after delete got: %d, want: 0", n)
+		}
+		if _, err := sessions.GetSession(ctx, "other"); err != nil {
+			t.Errorf("other user's session got: %v, want: kept", err)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		sessions := factory()
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- sessions.CreateSession(ctx, session("s1", 1, 0))
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		var created int
+		for err := range errs {
+			switch {
+			case err == nil:
+				created++
+			case !errors.Is(err, store.ErrConflict):
+				t.Errorf("got: %v, want: nil or %v", err, store.ErrConflict)
+			}
+		}
+		if created != 1 {
+			t.Errorf("got: %d sessions created, want: 1", created)
+		}
+	})
+}
+
+func createUser(t *testing.T, users store.UserStore) store.User {
+	t.Helper()
+
+	user, err := users.CreateUser(context.Background(), "example1@email.com", "h1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
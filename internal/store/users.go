@@ -0,0 +1,371 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/db"
+)
+
+type User struct {
+	ID            int64
+	Email         string
+	PasswordHash  string
+	EmailVerified bool
+	CreatedAt     time.Time
+}
+
+type UserStore interface {
+	CreateUser(ctx context.Context, email, passwordHash string) (User, error)
+	GetUserByID(ctx context.Context, id int64) (User, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	UpdatePasswordHash(ctx context.Context, id int64, passwordHash string) error
+	SetEmailVerified(ctx context.Context, id int64, verified bool) error
+	// EachPasswordHash calls fn for every user's password hash, streaming
+	// rather than loading all users at once. An error from fn stops the
+	// iteration and is returned.
+	EachPasswordHash(ctx context.Context, fn func(userID int64, passwordHash string) error) error
+	// EachUser is EachPasswordHash for whole users, in order of id.
+	EachUser(ctx context.Context, fn func(user User) error) error
+	// SoftDelete deactivates the user. The row is kept, so audit records
+	// still resolve and the email stays taken, but every other method acts
+	// as if the user didn't exist.
+	SoftDelete(ctx context.Context, id int64) error
+	// HardDelete removes the user for good, soft-deleted or not.
+	HardDelete(ctx context.Context, id int64) error
+}
+
+type MemoryUserStore struct {
+	mu      sync.RWMutex
+	nextID  int64
+	users   map[int64]User
+	deleted map[int64]time.Time
+}
+
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{users: make(map[int64]User), deleted: make(map[int64]time.Time)}
+}
+
+func (s *MemoryUserStore) CreateUser(ctx context.Context, email, passwordHash string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if strings.EqualFold(u.Email, email) {
+			return User{}, ErrConflict
+		}
+	}
+
+	s.nextID++
+	user := User{
+		ID:           s.nextID,
+		Email:        email,
+		PasswordHash: passwordHash,
+		CreatedAt:    time.Now(),
+	}
+	s.users[user.ID] = user
+
+	return user, nil
+}
+
+func (s *MemoryUserStore) GetUserByID(ctx context.Context, id int64) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if _, deleted := s.deleted[id]; !ok || deleted {
+		return User{}, ErrNotFound
+	}
+
+	return user, nil
+}
+
+func (s *MemoryUserStore) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		if _, deleted := s.deleted[u.ID]; !deleted && strings.EqualFold(u.Email, email) {
+			return u, nil
+		}
+	}
+
+	return User{}, ErrNotFound
+}
+
+func (s *MemoryUserStore) UpdatePasswordHash(ctx context.Context, id int64, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if _, deleted := s.deleted[id]; !ok || deleted {
+		return ErrNotFound
+	}
+	user.PasswordHash = passwordHash
+	s.users[id] = user
+
+	return nil
+}
+
+func (s *MemoryUserStore) SetEmailVerified(ctx context.Context, id int64, verified bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if _, deleted := s.deleted[id]; !ok || deleted {
+		return ErrNotFound
+	}
+	user.EmailVerified = verified
+	s.users[id] = user
+
+	return nil
+}
+
+func (s *MemoryUserStore) EachPasswordHash(ctx context.Context, fn func(userID int64, passwordHash string) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		if _, deleted := s.deleted[u.ID]; deleted {
+			continue
+		}
+		err := fn(u.ID, u.PasswordHash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryUserStore) EachUser(ctx context.Context, fn func(user User) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := make([]int64, 0, len(s.users))
+	for id := range s.users {
+		if _, deleted := s.deleted[id]; !deleted {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	for _, id := range ids {
+		err := fn(s.users[id])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryUserStore) SoftDelete(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.users[id]
+	if _, deleted := s.deleted[id]; !ok || deleted {
+		return ErrNotFound
+	}
+	s.deleted[id] = time.Now()
+
+	return nil
+}
+
+func (s *MemoryUserStore) HardDelete(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.users, id)
+	delete(s.deleted, id)
+
+	return nil
+}
+
+// SQLUserStore keeps users in a SQL database of any supported dialect.
+type SQLUserStore struct {
+	db      *sql.DB
+	dialect db.Dialect
+}
+
+func NewSQLUserStore(conn *sql.DB, dialect db.Dialect) *SQLUserStore {
+	return &SQLUserStore{db: conn, dialect: dialect}
+}
+
+func NewSQLiteUserStore(conn *sql.DB) *SQLUserStore {
+	return NewSQLUserStore(conn, db.SQLite)
+}
+
+const userColumns = `id, email, password_hash, email_verified, created_at`
+
+func scanUser(row interface{ Scan(dest ...any) error }) (user User, err error) {
+	err = row.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.EmailVerified, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotFound
+	}
+	if err != nil {
+		return User{}, checkErr(err)
+	}
+
+	return user, nil
+}
+
+func (s *SQLUserStore) CreateUser(ctx context.Context, email, passwordHash string) (User, error) {
+	// The table predates any unique index on email, so uniqueness is
+	// checked in the insert itself.
+	var id int64
+	err := s.dialect.QuerierFor(ctx, s.db).QueryRowContext(
+		ctx,
+		`INSERT INTO users(email, password_hash, created_at)
+		SELECT ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM users WHERE `+s.dialect.FoldEqual("email")+`)
+		RETURNING id`,
+		email,
+		passwordHash,
+		time.Now().UTC(),
+		email,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrConflict
+	}
+	if err != nil {
+		return User{}, checkErr(err)
+	}
+
+	return s.GetUserByID(ctx, id)
+}
+
+func (s *SQLUserStore) GetUserByID(ctx context.Context, id int64) (User, error) {
+	return scanUser(s.dialect.QuerierFor(ctx, s.db).QueryRowContext(
+		ctx,
+		`SELECT `+userColumns+` FROM users WHERE id = ? AND deleted_at IS NULL`,
+		id,
+	))
+}
+
+func (s *SQLUserStore) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	return scanUser(s.dialect.QuerierFor(ctx, s.db).QueryRowContext(
+		ctx,
+		`SELECT `+userColumns+` FROM users WHERE `+s.dialect.FoldEqual("email")+` AND deleted_at IS NULL ORDER BY id LIMIT 1`,
+		email,
+	))
+}
+
+func (s *SQLUserStore) UpdatePasswordHash(ctx context.Context, id int64, passwordHash string) error {
+	res, err := s.dialect.QuerierFor(ctx, s.db).ExecContext(
+		ctx,
+		`UPDATE users SET password_hash = ? WHERE id = ? AND deleted_at IS NULL`,
+		passwordHash,
+		id,
+	)
+	if err != nil {
+		return checkErr(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return checkErr(err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLUserStore) SetEmailVerified(ctx context.Context, id int64, verified bool) error {
+	return s.exec(
+		ctx,
+		`UPDATE users SET email_verified = ? WHERE id = ? AND deleted_at IS NULL`,
+		verified,
+		id,
+	)
+}
+
+func (s *SQLUserStore) EachPasswordHash(ctx context.Context, fn func(userID int64, passwordHash string) error) error {
+	rows, err := s.dialect.QuerierFor(ctx, s.db).QueryContext(ctx, `SELECT id, password_hash FROM users WHERE deleted_at IS NULL ORDER BY id`)
+	if err != nil {
+		return checkErr(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var hash string
+		err = rows.Scan(&id, &hash)
+		if err != nil {
+			return checkErr(err)
+		}
+
+		err = fn(id, hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return checkErr(rows.Err())
+}
+
+func (s *SQLUserStore) EachUser(ctx context.Context, fn func(user User) error) error {
+	rows, err := s.dialect.QuerierFor(ctx, s.db).QueryContext(ctx, `SELECT `+userColumns+` FROM users WHERE deleted_at IS NULL ORDER BY id`)
+	if err != nil {
+		return checkErr(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return err
+		}
+
+		err = fn(user)
+		if err != nil {
+			return err
+		}
+	}
+
+	return checkErr(rows.Err())
+}
+
+func (s *SQLUserStore) SoftDelete(ctx context.Context, id int64) error {
+	return s.exec(
+		ctx,
+		`UPDATE users SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`,
+		time.Now().UTC(),
+		id,
+	)
+}
+
+// HardDelete deletes the user's row. Profiles and password history go with
+// it through ON DELETE CASCADE.
+func (s *SQLUserStore) HardDelete(ctx context.Context, id int64) error {
+	return s.exec(ctx, `DELETE FROM users WHERE id = ?`, id)
+}
+
+// exec runs a statement that should affect one user, returning ErrNotFound
+// if it affected none.
+func (s *SQLUserStore) exec(ctx context.Context, query string, args ...any) error {
+	res, err := s.dialect.QuerierFor(ctx, s.db).ExecContext(ctx, query, args...)
+	if err != nil {
+		return checkErr(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return checkErr(err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
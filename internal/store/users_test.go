@@ -0,0 +1,125 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ehubscher/goidp/internal/store"
+	"github.com/ehubscher/goidp/internal/store/storetest"
+)
+
+func TestSQLiteUserStore(t *testing.T) {
+	users := store.NewSQLiteUserStore(openTestDB(t))
+	ctx := context.Background()
+
+	user, err := users.CreateUser(ctx, "example1@email.com", "h1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = users.CreateUser(ctx, "Example1@email.com", "h2")
+	if !errors.Is(err, store.ErrConflict) {
+		t.Errorf("got: %v, want: %v", err, store.ErrConflict)
+	}
+
+	got, err := users.GetUserByEmail(ctx, "EXAMPLE1@email.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != user.ID || got.PasswordHash != "h1" {
+		t.Errorf("got: %+v, want: %+v", got, user)
+	}
+
+	err = users.UpdatePasswordHash(ctx, user.ID, "h3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = users.UpdatePasswordHash(ctx, user.ID+1, "h3")
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("got: %v, want: %v", err, store.ErrNotFound)
+	}
+
+	_, err = users.CreateUser(ctx, "example2@email.com", "h4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hashes []string
+	err = users.EachPasswordHash(ctx, func(_ int64, hash string) error {
+		hashes = append(hashes, hash)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 2 || hashes[0] != "h3" || hashes[1] != "h4" {
+		t.Errorf("got: %v, want: [h3 h4]", hashes)
+	}
+}
+
+func TestSQLiteUserSoftDelete(t *testing.T) {
+	conn := openTestDB(t)
+	users := store.NewSQLiteUserStore(conn)
+	ctx := context.Background()
+
+	user, err := users.CreateUser(ctx, "example1@email.com", "h1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = users.SoftDelete(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := users.GetUserByEmail(ctx, "example1@email.com"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("by email got: %v, want: %v", err, store.ErrNotFound)
+	}
+	if _, err := users.GetUserByID(ctx, user.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("by id got: %v, want: %v", err, store.ErrNotFound)
+	}
+	if err := users.UpdatePasswordHash(ctx, user.ID, "h2"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("update got: %v, want: %v", err, store.ErrNotFound)
+	}
+	if err := users.SoftDelete(ctx, user.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("second soft delete got: %v, want: %v", err, store.ErrNotFound)
+	}
+	if _, err := users.CreateUser(ctx, "example1@email.com", "h3"); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("reuse of email got: %v, want: %v", err, store.ErrConflict)
+	}
+	err = users.EachPasswordHash(ctx, func(id int64, _ string) error {
+		t.Errorf("got: user %d, want: none", id)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var deleted bool
+	err = conn.QueryRow(`SELECT deleted_at IS NOT NULL FROM users WHERE id = ?`, user.ID).Scan(&deleted)
+	if err != nil || !deleted {
+		t.Errorf("got: %v, %v, want: the row kept with deleted_at set", deleted, err)
+	}
+
+	err = users.HardDelete(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	err = conn.QueryRow(`SELECT COUNT(*) FROM users WHERE id = ?`, user.ID).Scan(&n)
+	if err != nil || n != 0 {
+		t.Errorf("got: %d rows, %v, want: none", n, err)
+	}
+}
+
+func TestMemoryUserStoreConformance(t *testing.T) {
+	storetest.RunUserStoreTests(t, func() store.UserStore {
+		return store.NewMemoryUserStore()
+	})
+}
+
+func TestSQLiteUserStoreConformance(t *testing.T) {
+	storetest.RunUserStoreTests(t, func() store.UserStore {
+		return store.NewSQLiteUserStore(openTestDB(t))
+	})
+}
@@ -0,0 +1,413 @@
+package token
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/jose"
+)
+
+const (
+	DefaultMaxSize        = 8192 // bytes, a common header size limit
+	defaultAccessTokenTTL = 15 * time.Minute
+	defaultLeeway         = 30 * time.Second
+)
+
+// Token types for the typ header. Access tokens use the RFC 9068 type so
+// an ID token, typed plain JWT, is never mistaken for one.
+const (
+	TypeJWT         = "JWT"
+	TypeAccessToken = "at+jwt"
+)
+
+var (
+	ErrTooLarge = errors.New("token exceeds maximum size")
+	ErrInvalid  = errors.New("token is invalid")
+	ErrExpired  = errors.New("token has expired")
+	// ErrMissingKeyID and ErrUnknownKeyID are wrapped in ErrInvalid.
+	ErrMissingKeyID = errors.New("token header has no kid")
+	ErrUnknownKeyID = errors.New("token kid matches no known key")
+	// ErrNotYetValid is wrapped in ErrInvalid.
+	ErrNotYetValid = errors.New("token is not yet valid")
+	// ErrWrongType is wrapped in ErrInvalid.
+	ErrWrongType = errors.New("token has the wrong typ")
+)
+
+// Claims are the registered claims we check when validating a token, plus the
+// access token claims from RFC 9068.
+type Claims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat"`
+	ID        string   `json:"jti,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	// AuthorizedParty is the client the token was issued to, when its
+	// audience alone doesn't say.
+	AuthorizedParty string `json:"azp,omitempty"`
+	// UserInfoClaims are the claims requested individually for userinfo,
+	// space-separated, as with the OIDC claims parameter.
+	UserInfoClaims string `json:"userinfo_claims,omitempty"`
+}
+
+// CheckAuthorizedParty applies the azp rules of OpenID Connect Core section
+// 3.1.3.7 for a relying party with id clientID: the client must be among the
+// audiences, a token for several audiences must name an azp, and an azp
+// present must be the client.
+func (c Claims) CheckAuthorizedParty(clientID string) error {
+	if !slices.Contains(c.Audience, clientID) {
+		return fmt.Errorf("%w: not issued for %s", ErrInvalid, clientID)
+	}
+	if len(c.Audience) > 1 && c.AuthorizedParty == "" {
+		return fmt.Errorf("%w: azp required with multiple audiences", ErrInvalid)
+	}
+	if c.AuthorizedParty != "" && c.AuthorizedParty != clientID {
+		return fmt.Errorf("%w: azp is %s, not %s", ErrInvalid, c.AuthorizedParty, clientID)
+	}
+
+	return nil
+}
+
+// Audience accepts aud as either a single string or an array.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var one string
+	if json.Unmarshal(b, &one) == nil {
+		*a = Audience{one}
+		return nil
+	}
+
+	var many []string
+	err := json.Unmarshal(b, &many)
+	if err != nil {
+		return err
+	}
+	*a = many
+
+	return nil
+}
+
+// Issuer signs and validates the JWTs this provider issues.
+type Issuer struct {
+	Keys   *jose.KeyManager
+	Issuer string
+	// LegacyIssuers are earlier issuer identifiers whose tokens still
+	// validate, so the issuer can move without invalidating live tokens.
+	// Tokens are only ever issued as Issuer.
+	LegacyIssuers []string
+
+	AccessTokenTTL time.Duration
+	// MaxSize caps both the tokens we issue and those we'll attempt to parse.
+	// Zero means DefaultMaxSize.
+	MaxSize int
+	Leeway  time.Duration
+	// AlwaysAuthorizedParty puts azp in every token SetAudience is used
+	// for. Otherwise it is only added when there is more than one audience,
+	// as OpenID Connect requires.
+	AlwaysAuthorizedParty bool
+
+	Now func() time.Time
+}
+
+func (i *Issuer) now() time.Time {
+	if i.Now != nil {
+		return i.Now()
+	}
+
+	return time.Now()
+}
+
+func (i *Issuer) maxSize() int {
+	if i.MaxSize > 0 {
+		return i.MaxSize
+	}
+
+	return DefaultMaxSize
+}
+
+func (i *Issuer) accessTokenTTL() time.Duration {
+	if i.AccessTokenTTL > 0 {
+		return i.AccessTokenTTL
+	}
+
+	return defaultAccessTokenTTL
+}
+
+// Lifetime is how long issued access tokens are valid for, AccessTokenTTL or
+// its default.
+func (i *Issuer) Lifetime() time.Duration {
+	return i.accessTokenTTL()
+}
+
+func (i *Issuer) leeway() time.Duration {
+	if i.Leeway > 0 {
+		return i.Leeway
+	}
+
+	return defaultLeeway
+}
+
+// Sign signs claims with the current signing key. Tokens over MaxSize are
+// refused so a misconfiguration that bloats tokens is caught at issuance
+// rather than by clients hitting header limits.
+func (i *Issuer) Sign(claims map[string]any) (string, error) {
+	return i.SignAs("", claims)
+}
+
+// SignAs is Sign with a key for alg, as chosen by jose.KeyManager's
+// SigningKeyFor. An empty alg means the current signing key.
+func (i *Issuer) SignAs(alg string, claims map[string]any) (string, error) {
+	return i.sign(alg, TypeJWT, claims)
+}
+
+func (i *Issuer) sign(alg, typ string, claims map[string]any) (string, error) {
+	key, ok := i.Keys.SigningKeyFor(alg)
+	if !ok {
+		return "", fmt.Errorf("%w: no signing key for %s", jose.ErrUnsupported, alg)
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := jose.Sign(jose.Header{Alg: key.Alg, Typ: typ, Kid: key.ID}, key.Private, payload)
+	if err != nil {
+		return "", err
+	}
+
+	var size, max int = len(token), i.maxSize()
+	if size > max {
+		slog.Error("Issued token exceeds the maximum size.", "size", size, "max", max)
+		return "", fmt.Errorf("%w: %d bytes, max %d", ErrTooLarge, size, max)
+	}
+	if size > max*8/10 {
+		slog.Warn("Issued token is approaching the maximum size.", "size", size, "max", max)
+	}
+
+	return token, nil
+}
+
+// AudienceFor returns clientID followed by the extra audiences not already
+// in the list.
+func AudienceFor(clientID string, extra []string) []string {
+	var audience []string = []string{clientID}
+	for _, aud := range extra {
+		if !slices.Contains(audience, aud) {
+			audience = append(audience, aud)
+		}
+	}
+
+	return audience
+}
+
+// SetAudience sets the aud of claims to AudienceFor(clientID, extra), and
+// azp to clientID as AlwaysAuthorizedParty decides. A single audience is
+// set as a string, the form most relying parties expect.
+func (i *Issuer) SetAudience(claims map[string]any, clientID string, extra []string) {
+	var audience []string = AudienceFor(clientID, extra)
+	if len(audience) == 1 {
+		claims["aud"] = clientID
+	} else {
+		claims["aud"] = audience
+	}
+	if len(audience) > 1 || i.AlwaysAuthorizedParty {
+		claims["azp"] = clientID
+	}
+}
+
+// IssueAccessToken issues an RFC 9068 access token for subject, typed
+// at+jwt. A positive notBefore delays its activation: the token carries an
+// nbf that far ahead, and its lifetime of AccessTokenTTL starts from then.
+// expiresIn is always measured from now, so it includes the delay.
+// The audience is clientID plus extraAudiences, as for SetAudience.
+func (i *Issuer) IssueAccessToken(subject, clientID string, extraAudiences, scopes []string, notBefore time.Duration) (token string, expiresIn time.Duration, err error) {
+	return i.IssueAccessTokenWith(subject, clientID, extraAudiences, scopes, notBefore, nil)
+}
+
+// IssueAccessTokenWith is IssueAccessToken adding the claims in extra,
+// such as userinfo_claims. It can't override the claims it sets itself.
+func (i *Issuer) IssueAccessTokenWith(subject, clientID string, extraAudiences, scopes []string, notBefore time.Duration, extra map[string]any) (token string, expiresIn time.Duration, err error) {
+	jti, err := randomID()
+	if err != nil {
+		return "", 0, err
+	}
+
+	var now time.Time = i.now()
+	var activation time.Time = now
+	if notBefore > 0 {
+		activation = now.Add(notBefore)
+	}
+	var exp time.Time = activation.Add(i.accessTokenTTL())
+	claims := make(map[string]any, len(extra)+8)
+	for name, v := range extra {
+		claims[name] = v
+	}
+	claims["iss"] = i.Issuer
+	claims["sub"] = subject
+	claims["client_id"] = clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = exp.Unix()
+	claims["jti"] = jti
+	for _, name := range []string{"aud", "azp", "scope", "nbf"} {
+		delete(claims, name)
+	}
+	i.SetAudience(claims, clientID, extraAudiences)
+	if len(scopes) > 0 {
+		claims["scope"] = strings.Join(scopes, " ")
+	}
+	if activation.After(now) {
+		claims["nbf"] = activation.Unix()
+	}
+
+	token, err = i.sign("", TypeAccessToken, claims)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return token, exp.Sub(now), nil
+}
+
+// Validate verifies a token we issued, of any type, and returns its claims.
+// Inputs larger than MaxSize are rejected before any decoding work is done.
+func (i *Issuer) Validate(token string) (Claims, error) {
+	return i.validate(token, "", true)
+}
+
+// ValidateAccessToken is Validate for a token presented as an access token,
+// which must be typed at+jwt as RFC 9068 section 4 requires.
+func (i *Issuer) ValidateAccessToken(token string) (Claims, error) {
+	return i.validate(token, TypeAccessToken, true)
+}
+
+// ValidateHint is Validate for an ID token presented as a hint, such as an
+// id_token_hint, whose expiry doesn't matter: it only identifies who the
+// client believes is signed in. Access tokens are refused by their typ.
+func (i *Issuer) ValidateHint(token string) (Claims, error) {
+	return i.validate(token, TypeJWT, false)
+}
+
+// validate checks the typ header against typ unless typ is empty.
+func (i *Issuer) validate(token, typ string, checkExpiry bool) (Claims, error) {
+	if len(token) > i.maxSize() {
+		return Claims{}, fmt.Errorf("%w: %d bytes", ErrTooLarge, len(token))
+	}
+
+	jws, err := jose.Parse(token)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+
+	// The key is picked by kid alone and the algorithm is the key's own, so
+	// a token naming another algorithm in its header fails to verify. There
+	// is deliberately no fallback to trying every key.
+	if jws.Header.Kid == "" {
+		return Claims{}, fmt.Errorf("%w: %w", ErrInvalid, ErrMissingKeyID)
+	}
+	key, ok := i.Keys.Key(jws.Header.Kid)
+	if !ok {
+		return Claims{}, fmt.Errorf("%w: %w", ErrInvalid, ErrUnknownKeyID)
+	}
+	err = jws.Verify(key.Alg, key.Public())
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	if typ != "" && !hasType(jws.Header.Typ, typ) {
+		return Claims{}, fmt.Errorf("%w: %w: %q", ErrInvalid, ErrWrongType, jws.Header.Typ)
+	}
+
+	var claims Claims
+	err = json.Unmarshal(jws.Payload, &claims)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+
+	if !i.acceptsIssuer(claims.Issuer) {
+		return Claims{}, fmt.Errorf("%w: unexpected issuer", ErrInvalid)
+	}
+
+	var now time.Time = i.now()
+	if checkExpiry && !now.Before(time.Unix(claims.ExpiresAt, 0).Add(i.leeway())) {
+		return Claims{}, ErrExpired
+	}
+	if claims.NotBefore != 0 && now.Add(i.leeway()).Before(time.Unix(claims.NotBefore, 0)) {
+		return Claims{}, fmt.Errorf("%w: %w", ErrInvalid, ErrNotYetValid)
+	}
+
+	return claims, nil
+}
+
+func (i *Issuer) acceptsIssuer(iss string) bool {
+	return iss == i.Issuer || iss != "" && slices.Contains(i.LegacyIssuers, iss)
+}
+
+// hasType compares a typ header to want the way RFC 7515 section 4.1.9
+// asks: case-insensitively and with the "application/" prefix optional.
+func hasType(got, want string) bool {
+	if len(got) > len("application/") && strings.EqualFold(got[:len("application/")], "application/") {
+		got = got[len("application/"):]
+	}
+
+	return strings.EqualFold(got, want)
+}
+
+// ConfigureMaxSize reads TOKEN_MAX_SIZE, defaulting to DefaultMaxSize.
+func ConfigureMaxSize() (int, error) {
+	var v string = os.Getenv("TOKEN_MAX_SIZE")
+	if v == "" {
+		return DefaultMaxSize, nil
+	}
+
+	size, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("token max size misconfigured: %w", err)
+	}
+	if size < 1024 {
+		return 0, fmt.Errorf("token max size must be at least 1024 bytes, got %d", size)
+	}
+
+	return size, nil
+}
+
+// ConfigureLegacyIssuers reads TOKEN_LEGACY_ISSUERS, a comma-separated list
+// of issuer identifiers to keep accepting during an issuer migration.
+func ConfigureLegacyIssuers() ([]string, error) {
+	var issuers []string
+	for _, iss := range strings.Split(os.Getenv("TOKEN_LEGACY_ISSUERS"), ",") {
+		iss = strings.TrimSpace(iss)
+		if iss == "" {
+			continue
+		}
+		u, err := url.Parse(iss)
+		if err != nil || u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+			return nil, fmt.Errorf("token legacy issuers misconfigured: %q is not an absolute URL", iss)
+		}
+		issuers = append(issuers, iss)
+	}
+
+	return issuers, nil
+}
+
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
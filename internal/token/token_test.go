@@ -0,0 +1,428 @@
+package token_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehubscher/goidp/internal/jose"
+	"github.com/ehubscher/goidp/internal/token"
+)
+
+const testIssuer = "https://idp.example"
+
+func newTestIssuer(t *testing.T) *token.Issuer {
+	t.Helper()
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jose.NewKey(jose.ES256, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := jose.NewKeyManager(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC)
+	return &token.Issuer{
+		Keys:    keys,
+		Issuer:  testIssuer,
+		MaxSize: 2048,
+		Now:     func() time.Time { return now },
+	}
+}
+
+func TestIssueAccessToken(t *testing.T) {
+	issuer := newTestIssuer(t)
+
+	tok, expiresIn, err := issuer.IssueAccessToken("7", "client1", nil, []string{"openid", "email"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expiresIn != 15*time.Minute {
+		t.Errorf("got: %s, want: %s", expiresIn, 15*time.Minute)
+	}
+
+	claims, err := issuer.Validate(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "7" || claims.ClientID != "client1" || claims.Scope != "openid email" || claims.Issuer != testIssuer {
+		t.Errorf("got: %+v, want: the issued claims", claims)
+	}
+}
+
+func TestIssueAccessTokenWith(t *testing.T) {
+	issuer := newTestIssuer(t)
+
+	extra := map[string]any{"userinfo_claims": "email", "sub": "8", "scope": "admin"}
+	tok, _, err := issuer.IssueAccessTokenWith("7", "client1", nil, []string{"openid"}, 0, extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := issuer.Validate(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserInfoClaims != "email" {
+		t.Errorf("got: %q, want: %q", claims.UserInfoClaims, "email")
+	}
+	if claims.Subject != "7" || claims.Scope != "openid" {
+		t.Errorf("got: %+v, want: extra not overriding sub or scope", claims)
+	}
+}
+
+func TestIssueAccessTokenNotBefore(t *testing.T) {
+	issuer := newTestIssuer(t)
+	var issued time.Time = issuer.Now()
+	var elapsed time.Duration
+	issuer.Now = func() time.Time { return issued.Add(elapsed) }
+
+	tok, expiresIn, err := issuer.IssueAccessToken("7", "client1", nil, nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expiresIn != time.Hour+15*time.Minute {
+		t.Errorf("got: %s, want: %s", expiresIn, time.Hour+15*time.Minute)
+	}
+
+	// Within the leeway of activation the token is already accepted.
+	var checks = []struct {
+		elapsed time.Duration
+		valid   bool
+	}{
+		{0, false},
+		{time.Hour - time.Minute, false},
+		{time.Hour - 10*time.Second, true},
+		{time.Hour + 10*time.Minute, true},
+	}
+	for _, c := range checks {
+		elapsed = c.elapsed
+
+		_, err := issuer.Validate(tok)
+		if c.valid && err != nil {
+			t.Errorf("after %s got: %v, want: nil", c.elapsed, err)
+		}
+		if !c.valid && !errors.Is(err, token.ErrNotYetValid) {
+			t.Errorf("after %s got: %v, want: %v", c.elapsed, err, token.ErrNotYetValid)
+		}
+	}
+}
+
+func TestSignRefusesOversizedToken(t *testing.T) {
+	issuer := newTestIssuer(t)
+
+	_, err := issuer.Sign(map[string]any{"iss": testIssuer, "groups": strings.Repeat("g", 4096)})
+	if !errors.Is(err, token.ErrTooLarge) {
+		t.Errorf("got: %v, want: %v", err, token.ErrTooLarge)
+	}
+
+	_, err = issuer.Sign(map[string]any{"iss": testIssuer, "groups": strings.Repeat("g", 256)})
+	if err != nil {
+		t.Errorf("got: %v, want: nil", err)
+	}
+}
+
+func TestValidateRejectsOversizedInput(t *testing.T) {
+	issuer := newTestIssuer(t)
+
+	// Far too large to be ours; this must fail on length alone, before the
+	// input is ever split or decoded.
+	start := time.Now()
+	_, err := issuer.Validate(strings.Repeat("A", 10<<20))
+	if !errors.Is(err, token.ErrTooLarge) {
+		t.Errorf("got: %v, want: %v", err, token.ErrTooLarge)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("got: %s, want: a fast rejection", elapsed)
+	}
+}
+
+func TestConfigureMaxSize(t *testing.T) {
+	var configs = []struct {
+		v    string
+		want int
+		ok   bool
+	}{
+		{"", token.DefaultMaxSize, true},
+		{"4096", 4096, true},
+		{"100", 0, false},
+		{"big", 0, false},
+	}
+
+	for _, c := range configs {
+		t.Setenv("TOKEN_MAX_SIZE", c.v)
+
+		got, err := token.ConfigureMaxSize()
+		if got != c.want || (err == nil) != c.ok {
+			t.Errorf("%q got: %d, %v, want: %d, ok %v", c.v, got, err, c.want, c.ok)
+		}
+	}
+}
+
+func newMultiAlgIssuer(t *testing.T) *token.Issuer {
+	t.Helper()
+
+	issuer := newTestIssuer(t)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs256, err := jose.NewKey(jose.RS256, rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.Keys, err = jose.NewKeyManager(issuer.Keys.SigningKey(), rs256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return issuer
+}
+
+func TestSignAs(t *testing.T) {
+	issuer := newMultiAlgIssuer(t)
+
+	for _, alg := range []string{jose.ES256, jose.RS256} {
+		tok, err := issuer.SignAs(alg, map[string]any{"iss": testIssuer, "sub": "7", "exp": time.Now().Add(time.Hour).Unix()})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		jws, err := jose.Parse(tok)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, _ := issuer.Keys.Key(jws.Header.Kid)
+		if jws.Header.Alg != alg || key.Alg != alg {
+			t.Errorf("got: alg %s with a %s key, want: %s", jws.Header.Alg, key.Alg, alg)
+		}
+
+		_, err = issuer.Validate(tok)
+		if err != nil {
+			t.Errorf("%s got: %v, want: nil", alg, err)
+		}
+	}
+
+	_, err := issuer.SignAs(jose.HS256, map[string]any{})
+	if !errors.Is(err, jose.ErrUnsupported) {
+		t.Errorf("got: %v, want: %v", err, jose.ErrUnsupported)
+	}
+}
+
+func TestValidatePinsAlgToKey(t *testing.T) {
+	issuer := newMultiAlgIssuer(t)
+
+	// An RS256 signature presented under the ES256 key's kid must not
+	// verify, even though the header claims RS256.
+	rs256, _ := issuer.Keys.SigningKeyFor(jose.RS256)
+	es256 := issuer.Keys.SigningKey()
+	tok, err := jose.Sign(
+		jose.Header{Alg: jose.RS256, Typ: "JWT", Kid: es256.ID},
+		rs256.Private,
+		[]byte(`{"iss":"`+testIssuer+`","sub":"7","exp":9999999999}`),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = issuer.Validate(tok)
+	if !errors.Is(err, token.ErrInvalid) || !errors.Is(err, jose.ErrAlgorithm) {
+		t.Errorf("got: %v, want: %v", err, jose.ErrAlgorithm)
+	}
+}
+
+func TestValidateKeyID(t *testing.T) {
+	issuer := newMultiAlgIssuer(t)
+	key := issuer.Keys.SigningKey()
+	payload := []byte(`{"iss":"` + testIssuer + `","sub":"7","exp":9999999999}`)
+
+	// Another key of the same algorithm that the issuer doesn't know.
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stranger, err := jose.NewKey(jose.ES256, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tokens = []struct {
+		name   string
+		header jose.Header
+		signer any
+		err    error
+	}{
+		{"valid kid", jose.Header{Alg: key.Alg, Kid: key.ID}, key.Private, nil},
+		{"missing kid", jose.Header{Alg: key.Alg}, key.Private, token.ErrMissingKeyID},
+		{"unknown kid", jose.Header{Alg: key.Alg, Kid: "unknown"}, key.Private, token.ErrUnknownKeyID},
+		{"unknown key", jose.Header{Alg: stranger.Alg, Kid: stranger.ID}, stranger.Private, token.ErrUnknownKeyID},
+	}
+
+	for _, c := range tokens {
+		tok, err := jose.Sign(c.header, c.signer, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = issuer.Validate(tok)
+		if c.err == nil && err != nil {
+			t.Errorf("%s got: %v, want: nil", c.name, err)
+		}
+		if c.err != nil && (!errors.Is(err, c.err) || !errors.Is(err, token.ErrInvalid)) {
+			t.Errorf("%s got: %v, want: %v", c.name, err, c.err)
+		}
+	}
+}
+
+func TestCheckAuthorizedParty(t *testing.T) {
+	var cases = []struct {
+		claims token.Claims
+		valid  bool
+	}{
+		{token.Claims{Audience: token.Audience{"client1"}}, true},
+		{token.Claims{Audience: token.Audience{"client1"}, AuthorizedParty: "client1"}, true},
+		{token.Claims{Audience: token.Audience{"client1", "api"}, AuthorizedParty: "client1"}, true},
+		{token.Claims{Audience: token.Audience{"client1", "api"}}, false},
+		{token.Claims{Audience: token.Audience{"client1", "api"}, AuthorizedParty: "api"}, false},
+		{token.Claims{Audience: token.Audience{"api"}}, false},
+	}
+
+	for _, c := range cases {
+		err := c.claims.CheckAuthorizedParty("client1")
+		if c.valid && err != nil {
+			t.Errorf("%+v got: %v, want: nil", c.claims, err)
+		}
+		if !c.valid && !errors.Is(err, token.ErrInvalid) {
+			t.Errorf("%+v got: %v, want: %v", c.claims, err, token.ErrInvalid)
+		}
+	}
+}
+
+func TestValidateHintIgnoresExpiry(t *testing.T) {
+	issuer := newTestIssuer(t)
+	tok, err := issuer.Sign(map[string]any{"iss": testIssuer, "sub": "7", "iat": 0, "exp": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = issuer.Validate(tok)
+	if !errors.Is(err, token.ErrExpired) {
+		t.Errorf("got: %v, want: %v", err, token.ErrExpired)
+	}
+	claims, err := issuer.ValidateHint(tok)
+	if err != nil || claims.Subject != "7" {
+		t.Errorf("got: %+v, %v, want: the claims", claims, err)
+	}
+}
+
+func TestAccessTokenType(t *testing.T) {
+	issuer := newTestIssuer(t)
+	access, _, err := issuer.IssueAccessToken("7", "client1", nil, []string{"openid"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idToken, err := issuer.Sign(map[string]any{"iss": testIssuer, "sub": "7", "aud": "client1", "iat": issuer.Now().Unix(), "exp": issuer.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jws, err := jose.Parse(access)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jws.Header.Typ != token.TypeAccessToken || jws.Header.Kid == "" {
+		t.Errorf("got: %+v, want: typ %s and a kid", jws.Header, token.TypeAccessToken)
+	}
+
+	claims, err := issuer.ValidateAccessToken(access)
+	if err != nil || claims.ClientID != "client1" || claims.Scope != "openid" {
+		t.Errorf("got: %+v, %v, want: the access token's claims", claims, err)
+	}
+	_, err = issuer.ValidateAccessToken(idToken)
+	if !errors.Is(err, token.ErrInvalid) || !errors.Is(err, token.ErrWrongType) {
+		t.Errorf("id_token as access token got: %v, want: %v", err, token.ErrWrongType)
+	}
+	_, err = issuer.ValidateHint(access)
+	if !errors.Is(err, token.ErrWrongType) {
+		t.Errorf("access token as hint got: %v, want: %v", err, token.ErrWrongType)
+	}
+}
+
+func TestAccessTokenMediaType(t *testing.T) {
+	issuer := newTestIssuer(t)
+	key, _ := issuer.Keys.SigningKeyFor("")
+	payload := `{"iss":"` + testIssuer + `","sub":"7","exp":` + strconv.FormatInt(issuer.Now().Add(time.Hour).Unix(), 10) + `}`
+
+	for _, typ := range []string{"application/at+jwt", "AT+JWT"} {
+		tok, err := jose.Sign(jose.Header{Alg: key.Alg, Typ: typ, Kid: key.ID}, key.Private, []byte(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = issuer.ValidateAccessToken(tok); err != nil {
+			t.Errorf("%s got: %v, want: nil", typ, err)
+		}
+	}
+}
+
+func TestLegacyIssuers(t *testing.T) {
+	old := newTestIssuer(t)
+	old.Issuer = "https://old.idp.example"
+	legacy, _, err := old.IssueAccessToken("7", "client1", nil, []string{"openid"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.Issuer = "https://unknown.example"
+	unknown, _, err := old.IssueAccessToken("7", "client1", nil, []string{"openid"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := newTestIssuer(t)
+	issuer.Keys = old.Keys
+	issuer.LegacyIssuers = []string{"https://old.idp.example"}
+
+	claims, err := issuer.ValidateAccessToken(legacy)
+	if err != nil || claims.Issuer != "https://old.idp.example" {
+		t.Errorf("legacy issuer got: %+v, %v, want: the claims", claims, err)
+	}
+	_, err = issuer.ValidateAccessToken(unknown)
+	if !errors.Is(err, token.ErrInvalid) {
+		t.Errorf("unknown issuer got: %v, want: %v", err, token.ErrInvalid)
+	}
+
+	current, _, err := issuer.IssueAccessToken("7", "client1", nil, []string{"openid"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err = issuer.ValidateAccessToken(current)
+	if err != nil || claims.Issuer != testIssuer {
+		t.Errorf("new token got: %+v, %v, want: issued as %s", claims, err, testIssuer)
+	}
+}
+
+func TestConfigureLegacyIssuers(t *testing.T) {
+	t.Setenv("TOKEN_LEGACY_ISSUERS", " https://old.idp.example , https://older.idp.example,")
+	issuers, err := token.ConfigureLegacyIssuers()
+	if err != nil || !slices.Equal(issuers, []string{"https://old.idp.example", "https://older.idp.example"}) {
+		t.Errorf("got: %q, %v, want: both issuers", issuers, err)
+	}
+
+	t.Setenv("TOKEN_LEGACY_ISSUERS", "old.idp.example")
+	_, err = token.ConfigureLegacyIssuers()
+	if err == nil {
+		t.Error("got: nil, want: an error for a relative issuer")
+	}
+}
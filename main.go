@@ -1,15 +1,47 @@
 package main
 
 import (
-	"database/sql"
-	"fmt"
+	"context"
+	"errors"
 	"log"
 	"log/slog"
+	"net/http"
 	"os"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/ehubscher/goidp/internal/authn"
+	"github.com/ehubscher/goidp/internal/clientip"
+	"github.com/ehubscher/goidp/internal/db"
+	"github.com/ehubscher/goidp/internal/feature"
+	"github.com/ehubscher/goidp/internal/jose"
+	"github.com/ehubscher/goidp/internal/logging"
+	"github.com/ehubscher/goidp/internal/mail"
+	"github.com/ehubscher/goidp/internal/oauth"
+	"github.com/ehubscher/goidp/internal/ratelimit"
+	"github.com/ehubscher/goidp/internal/reload"
+	"github.com/ehubscher/goidp/internal/render"
+	"github.com/ehubscher/goidp/internal/retryafter"
+	"github.com/ehubscher/goidp/internal/secrets"
+	"github.com/ehubscher/goidp/internal/seed"
+	"github.com/ehubscher/goidp/internal/server"
+	"github.com/ehubscher/goidp/internal/store"
+	"github.com/ehubscher/goidp/internal/token"
+	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/joho/godotenv"
-	_ "modernc.org/sqlite"
+)
+
+// probePaths are the health checks, which answer in maintenance mode and
+// aren't rate limited.
+var probePaths = []string{"/healthz", "/readyz"}
+
+const (
+	defaultListenAddr = ":8080"
+	readHeaderTimeout = 10 * time.Second
+	codeSweepInterval = time.Minute
+	mailFlushTimeout  = 10 * time.Second
 )
 
 func main() {
@@ -18,54 +50,221 @@ func main() {
 		log.Fatal(err)
 	}
 
-	argon2idB64Hash, err := authn.GenerateHash("argon2id", "password123")
+	err = logging.Setup()
 	if err != nil {
-		log.Fatalf("Failed to generate password hash: %v", err)
+		log.Fatal(err)
 	}
-	fmt.Printf("argon2id base64-encoded hash: %s\n", argon2idB64Hash)
+	secrets.SetDefault(secrets.Configure())
 
-	bcryptB64Hash, err := authn.GenerateHash("bcrypt", "password123")
+	retryAfterFormat, err := retryafter.Configure()
+	if err != nil {
+		log.Fatal(err)
+	}
+	retryafter.SetFormat(retryAfterFormat)
+
+	responseFormat, err := render.ConfigureFormat()
+	if err != nil {
+		log.Fatal(err)
+	}
+	render.SetDefaultFormat(responseFormat)
+
+	_, err = authn.SelfCheck(os.Getenv("AUTHN_STRICT") == "true")
+	if err != nil {
+		log.Fatalf("Password hashing self-check failed: %v", err)
+	}
+
+	signingKey, err := jose.ConfigureSigningKey()
+	if err != nil {
+		log.Fatalf("Signing key misconfigured: %v", err)
+	}
+	keys, err := jose.NewKeyManager(signingKey)
 	if err != nil {
-		log.Fatalf("Failed to generate password hash: %v", err)
+		log.Fatalf("Signing key unusable: %v", err)
 	}
-	fmt.Printf("bcrypt base64-encoded hash: %s\n", bcryptB64Hash)
+	slog.Info("Loaded signing key.", "kid", keys.SigningKey().ID, "alg", keys.SigningKey().Alg)
 
-	var dbFileName string = fmt.Sprintf("%s.sqlite", os.Getenv("DB_NAME"))
-	db, err := sql.Open("sqlite", dbFileName)
+	verifyPolicy, err := authn.ConfigureVerifyPolicy()
 	if err != nil {
-		slog.Error("Error connecting SQLite database: %s", err)
+		log.Fatal(err)
 	}
-	defer db.Close()
+	authn.SetVerifyPolicy(verifyPolicy)
 
-	stmt, err := db.Prepare(`INSERT INTO users(email, password_hash) VALUES(?,?)`)
+	memoryBudget, err := authn.ConfigureMemoryBudget()
 	if err != nil {
-		slog.Error("Cannot prepare SQL query for insert into users table.", "err", err)
 		log.Fatal(err)
 	}
+	authn.SetMemoryBudget(memoryBudget)
 
-	res, err := stmt.Exec("example1@email.com", argon2idB64Hash)
+	warmup, err := authn.ConfigureWarmup()
 	if err != nil {
-		slog.Error("Cannot insert into users table.", "err", err)
 		log.Fatal(err)
 	}
+	warmup.Run()
 
-	rows, err := res.RowsAffected()
+	firstBoot, err := seed.Configure()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	slog.Info("Succesfully inserted user.", "rows", rows)
+	dbConfig, err := db.Configure()
+	if err != nil {
+		log.Fatal(err)
+	}
+	conn, err := dbConfig.Open()
+	if err != nil {
+		slog.Error("Error connecting database.", "dialect", dbConfig.Dialect, "err", err)
+		log.Fatal(err)
+	}
+	defer conn.Close()
 
-	res, err = db.Exec(`INSERT INTO users(email, password_hash) VALUES(?,?)`, "example2@email.com", bcryptB64Hash)
+	err = dbConfig.Dialect.Migrate(context.Background(), conn)
 	if err != nil {
-		slog.Error("Cannot insert into users table.", "err", err)
+		slog.Error("Cannot migrate database.", "dialect", dbConfig.Dialect, "err", err)
 		log.Fatal(err)
 	}
 
-	rows, err = res.RowsAffected()
+	// There is no SQL client store yet, and a client seeded into memory
+	// would come back with a new secret on every boot.
+	if firstBoot.Client.ID != "" {
+		slog.Warn("Not seeding the first client: there is no persistent client store.", "client_id", firstBoot.Client.ID)
+	}
+	users := store.NewSQLUserStore(conn, dbConfig.Dialect)
+	seeded, err := firstBoot.Run(context.Background(), users, nil)
 	if err != nil {
+		slog.Error("Cannot seed database.", "err", err)
 		log.Fatal(err)
 	}
+	if seeded.Admin != nil {
+		slog.Info("Seeded admin user.", "user_id", seeded.Admin.ID, "email", seeded.Admin.Email)
+	}
 
-	slog.Info("Succesfully inserted user.", "rows", rows)
+	// Mail goes through the queue once SMTP is configured. Whatever is still
+	// queued at shutdown is sent before the process exits.
+	var mailQueue *mail.Queue
+	if os.Getenv("SMTP_ADDR") != "" {
+		relay, err := mail.ConfigureSMTP()
+		if err != nil {
+			log.Fatal(err)
+		}
+		mailQueue = &mail.Queue{Mailer: relay}
+	}
+
+	issuer := os.Getenv("ISSUER")
+	if issuer == "" {
+		log.Fatal("ISSUER must be set to the issuer identifier, e.g. https://id.example.com")
+	}
+	// The SQL store keeps used and expired codes until they are swept.
+	codes := store.NewSQLAuthCodeStore(conn, dbConfig.Dialect)
+	sweepCtx, stopSweep := context.WithCancel(context.Background())
+	defer stopSweep()
+	go store.SweepAuthCodes(sweepCtx, codes, codeSweepInterval)
+
+	features, err := feature.Configure()
+	if err != nil {
+		log.Fatal(err)
+	}
+	proxies, err := clientip.Configure()
+	if err != nil {
+		log.Fatal(err)
+	}
+	clientLimit, err := ratelimit.Configure("CLIENT_RATE_LIMIT")
+	if err != nil {
+		log.Fatal(err)
+	}
+	ipLimit, err := ratelimit.Configure("IP_RATE_LIMIT")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	provider := &oauth.Provider{
+		Users:           users,
+		Clients:         store.NewMemoryClientStore(),
+		Sessions:        store.NewMemorySessionStore(),
+		Codes:           codes,
+		Profiles:        store.NewSQLProfileStore(conn, dbConfig.Dialect),
+		Consents:        store.NewMemoryConsentStore(),
+		PasswordHistory: store.NewSQLPasswordHistoryStore(conn, dbConfig.Dialect),
+		Keys:            keys,
+		Tokens:          &token.Issuer{Keys: keys, Issuer: issuer},
+		Issuer:          issuer,
+		Features:        features,
+		ClientRateLimit: clientLimit,
+		TrustedProxies:  proxies,
+	}
+
+	var readiness server.Readiness
+	mux := http.NewServeMux()
+	provider.RegisterHandlers(mux)
+	mux.HandleFunc("GET /healthz", server.Healthz)
+	mux.Handle("GET /readyz", &readiness)
+
+	var maintenance server.Maintenance
+	if raw := os.Getenv("MAINTENANCE"); raw != "" {
+		on, err := strconv.ParseBool(raw)
+		if err != nil {
+			log.Fatalf("MAINTENANCE misconfigured: %v", err)
+		}
+		maintenance.Set(on)
+	}
+	handler := server.Chain(mux,
+		maintenance.Middleware(probePaths...),
+		ipLimit.Middleware(func(r *http.Request) string {
+			if slices.Contains(probePaths, r.URL.Path) {
+				return ""
+			}
+			return proxies.ClientIP(r)
+		}),
+	)
+
+	reloader := &reload.Reloader{
+		Features:    provider.SetFeatures,
+		RateLimits:  map[string]*ratelimit.Limiter{"CLIENT_RATE_LIMIT": clientLimit, "IP_RATE_LIMIT": ipLimit},
+		Maintenance: &maintenance,
+	}
+	stopReload := reloader.OnSignal(syscall.SIGHUP)
+	defer stopReload()
+
+	addr := os.Getenv("LISTEN_ADDR")
+	if addr == "" {
+		addr = defaultListenAddr
+	}
+	srv := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: readHeaderTimeout}
+
+	tlsSettings, err := server.ConfigureTLS()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if tlsSettings.Enabled() {
+		// Loading it now fails startup on a bad certificate rather than
+		// the first handshake.
+		_, err = tlsSettings.Config()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	drain, err := server.ConfigureDrain(&readiness)
+	if err != nil {
+		log.Fatal(err)
+	}
+	drained := drain.ShutdownOnSignal(srv, syscall.SIGTERM, os.Interrupt)
+
+	slog.Info("Serving.", "addr", addr, "issuer", issuer, "tls", tlsSettings.Enabled())
+	err = tlsSettings.ListenAndServe(srv)
+	if !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	err = <-drained
+	if err != nil {
+		slog.Error("Shutdown cut requests off.", "err", err)
+	}
+
+	if mailQueue != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), mailFlushTimeout)
+		defer cancel()
+		err = mailQueue.Shutdown(ctx)
+		if err != nil {
+			slog.Error("Mail still queued at exit was dropped.", "err", err)
+		}
+	}
 }